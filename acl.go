@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+)
+
+const (
+	ACL_PREFIX_LEN = len("/acl/")  // ДЛИНА ПРЕФИКСА ДЛЯ МАРШРУТА ПРАВ ДОСТУПА
+	ACL_HEADER     = "X-ACL"       // ЗАГОЛОВОК ЗАГРУЗКИ С ПРАВАМИ ДОСТУПА К ОБЪЕКТУ
+	ACL_PUBLIC     = "public-read" // ЗНАЧЕНИЕ ЗАГОЛОВКА ДЛЯ ОБЪЕКТА, ОТКРЫТОГО ДЛЯ ЧТЕНИЯ ВСЕМ
+)
+
+// ACL — права доступа к объекту
+type ACL struct {
+	Owner  string // Владелец объекта (пусто — объект загружен без авторизации)
+	Public bool   // Объект может читать любой клиент, в том числе аноним
+}
+
+// canRead — может ли клиент читать объект
+func (m Meta) canRead(identity string) bool {
+	return m.Public || m.canWrite(identity)
+}
+
+// canWrite — может ли клиент изменять объект и его права доступа
+func (m Meta) canWrite(identity string) bool {
+	return m.Owner == "" || identity == m.Owner || identity == ADMIN_IDENTITY
+}
+
+// authorizeObject — проверяет права клиента на объект и, если прав нет,
+// отвечает 401 анониму и 403 авторизованному клиенту
+func authorizeObject(w http.ResponseWriter, r *http.Request, storage *Storage, key string, write bool) bool {
+	m, err := storage.LoadMeta(key)
+	if err != nil {
+		log.Printf("Ошибка чтения метаданных %s: %v", logKey(key), logErr(err))
+		http.Error(w, "Ошибка чтения метаданных", http.StatusInternalServerError)
+		return false
+	}
+	if write && m.canWrite(Identity(r)) || !write && m.canRead(Identity(r)) {
+		return true
+	}
+	denyAccess(w, r)
+	return false
+}
+
+// denyAccess — отказ в доступе: 401 анониму и 403 авторизованному клиенту
+func denyAccess(w http.ResponseWriter, r *http.Request) {
+	if Identity(r) == "" {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Требуется авторизация", http.StatusUnauthorized)
+	} else {
+		http.Error(w, "Доступ запрещён", http.StatusForbidden)
+	}
+}
+
+// uploadMeta — начальные метаданные загружаемого объекта: владелец — загружающий клиент
+func uploadMeta(r *http.Request) Meta {
+	expires, _ := parseExpires(r)
+	return Meta{Owner: Identity(r), Public: r.Header.Get(ACL_HEADER) == ACL_PUBLIC, Expires: expires}
+}
+
+// SetACL — изменяет права доступа к объекту
+func (s *Storage) SetACL(key string, acl ACL) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.exists(key) {
+		return os.ErrNotExist
+	}
+	return s.UpdateMeta(key, func(m *Meta) {
+		m.Owner, m.Public = acl.Owner, acl.Public
+	})
+}
+
+// HandleACL — обработчик для чтения (GET) и изменения (PUT, JSON-тело ACL) прав доступа.
+// Изменять права может только владелец объекта; передать объект другому владельцу — только администратор.
+func HandleACL(w http.ResponseWriter, r *http.Request, storage *Storage) {
+	key := storage.RequestKey(r, r.URL.Path[ACL_PREFIX_LEN:])
+	if !checkKey(w, key) {
+		return
+	}
+	if !storage.Exists(key) {
+		http.Error(w, "Объект не найден", http.StatusNotFound)
+		return
+	}
+	if !authorizeObject(w, r, storage, key, r.Method == http.MethodPut) {
+		return
+	}
+
+	m, err := storage.LoadMeta(key)
+	if err != nil {
+		http.Error(w, "Ошибка чтения метаданных", http.StatusInternalServerError)
+		return
+	}
+	acl := ACL{Owner: m.Owner, Public: m.Public}
+
+	if r.Method == http.MethodPut {
+		var update ACL
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			http.Error(w, "Ожидается JSON с полями Owner и Public", http.StatusBadRequest)
+			return
+		}
+		if update.Owner == "" {
+			update.Owner = acl.Owner
+		}
+		if update.Owner != acl.Owner && Identity(r) != ADMIN_IDENTITY {
+			http.Error(w, "Сменить владельца может только администратор", http.StatusForbidden)
+			return
+		}
+		if err := storage.SetACL(key, update); err != nil {
+			log.Printf("Ошибка изменения прав доступа %s: %v", logKey(key), logErr(err))
+			http.Error(w, "Ошибка изменения прав доступа", http.StatusInternalServerError)
+			return
+		}
+		acl = update
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(acl)
+}
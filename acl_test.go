@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestObjectACL(t *testing.T) {
+	ts, _ := newTestServer(t, "-api-key", "secret", "-users", "alice:a-key,bob:b-key")
+	admin := []string{"Authorization", "Bearer secret"}
+	alice := []string{"Authorization", "Bearer a-key"}
+	bob := []string{"Authorization", "Bearer b-key"}
+	upload(t, ts, "private", "p", alice...)
+	upload(t, ts, "public", "p", append(alice, ACL_HEADER, ACL_PUBLIC)...)
+
+	reads := []struct {
+		name   string
+		path   string
+		header []string
+		status int
+	}{
+		{"owner reads private", "/download/private", alice, http.StatusOK},
+		{"admin reads private", "/download/private", admin, http.StatusOK},
+		{"other user reads private", "/download/private", bob, http.StatusForbidden},
+		{"anonymous reads private", "/download/private", nil, http.StatusUnauthorized},
+		{"anonymous reads public", "/download/public", nil, http.StatusOK},
+		{"other user reads public", "/download/public", bob, http.StatusOK},
+		{"other user reads ACL", "/acl/private", bob, http.StatusForbidden},
+		{"owner reads ACL", "/acl/private", alice, http.StatusOK},
+	}
+	for _, tt := range reads {
+		if resp, _ := do(t, ts, http.MethodGet, tt.path, "", tt.header...); resp.StatusCode != tt.status {
+			t.Errorf("%s: %d, want %d", tt.name, resp.StatusCode, tt.status)
+		}
+	}
+	// Читать публичный объект может любой, изменять — только владелец
+	if resp, _ := do(t, ts, http.MethodDelete, "/delete/public", "", bob...); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("other user deletes public: %d, want 403", resp.StatusCode)
+	}
+
+	updates := []struct {
+		name   string
+		body   string
+		header []string
+		status int
+		want   ACL
+	}{
+		{"other user opens", `{"Public":true}`, bob, http.StatusForbidden, ACL{}},
+		{"not json", `public`, alice, http.StatusBadRequest, ACL{}},
+		{"owner gives away", `{"Owner":"bob"}`, alice, http.StatusForbidden, ACL{}},
+		{"owner opens", `{"Public":true}`, alice, http.StatusOK, ACL{Owner: "alice", Public: true}},
+		{"admin gives away", `{"Owner":"bob"}`, admin, http.StatusOK, ACL{Owner: "bob"}},
+	}
+	for _, tt := range updates {
+		resp, body := do(t, ts, http.MethodPut, "/acl/private", tt.body, tt.header...)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: %d %s, want %d", tt.name, resp.StatusCode, body, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		var got ACL
+		if err := json.Unmarshal([]byte(body), &got); err != nil || got != tt.want {
+			t.Errorf("%s: ACL %+v (%v), want %+v", tt.name, got, err, tt.want)
+		}
+	}
+	// Новый владелец распоряжается объектом, прежний больше нет
+	if resp, _ := do(t, ts, http.MethodDelete, "/delete/private", "", alice...); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("former owner deletes: %d, want 403", resp.StatusCode)
+	}
+	if resp, _ := do(t, ts, http.MethodDelete, "/delete/private", "", bob...); resp.StatusCode != http.StatusOK {
+		t.Errorf("new owner deletes: %d, want 200", resp.StatusCode)
+	}
+}
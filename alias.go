@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+)
+
+const (
+	ALIAS_PREFIX_LEN = len("/alias/")  // ДЛИНА ПРЕФИКСА ДЛЯ МАРШРУТА ПСЕВДОНИМОВ
+	ALIASES_FILE     = ".aliases.json" // ФАЙЛ С ПСЕВДОНИМАМИ В ХРАНИЛИЩЕ (ТОЧКА — НЕ ПОПАДАЕТ В СПИСОК ОБЪЕКТОВ)
+	MAX_ALIAS_HOPS   = 8               // СКОЛЬКО ПСЕВДОНИМОВ ПОДРЯД МОЖНО ПРОЙТИ ДО ОБЪЕКТА
+)
+
+var (
+	ErrAliasLoop   = errors.New("alias chain loops back on itself")       // Псевдоним указывает сам на себя через цепочку
+	ErrAliasHops   = errors.New("alias chain exceeds the maximum length") // Цепочка длиннее MAX_ALIAS_HOPS
+	ErrAliasDenied = errors.New("alias belongs to another client")        // Изменить псевдоним может только владелец или администратор
+)
+
+// Aliases — псевдонимы ключей: скачивание псевдонима отдаёт объект, на который он
+// указывает (как символическая ссылка). Псевдоним может указывать на другой псевдоним,
+// например "latest" на "v2", пока цепочка не длиннее MAX_ALIAS_HOPS.
+// Псевдонимы хранятся в одном файле и переживают перезапуск. Как и объектом, псевдонимом
+// владеет создавший его клиент: перенаправить или удалить псевдоним может только он или администратор.
+type Aliases struct {
+	mu      sync.RWMutex
+	path    string
+	aliases map[string]aliasEntry // Псевдоним → куда он указывает и кто им владеет
+}
+
+// aliasEntry — ключ, на который указывает псевдоним, и его владелец (пусто — любой клиент)
+type aliasEntry struct {
+	Target string
+	Owner  string `json:",omitempty"`
+}
+
+// canWrite — может ли клиент перенаправить или удалить псевдоним, как Meta.canWrite
+func (a aliasEntry) canWrite(identity string) bool {
+	return a.Owner == "" || identity == a.Owner || identity == ADMIN_IDENTITY
+}
+
+// LoadAliases — читает псевдонимы из файла path; если файла нет, псевдонимов нет.
+// Файл прежнего вида {"псевдоним": "цель"} читается как псевдонимы без владельца.
+func LoadAliases(path string) (*Aliases, error) {
+	a := &Aliases{path: path, aliases: make(map[string]aliasEntry)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return a, nil
+	}
+	if err != nil {
+		return a, err
+	}
+	if err := json.Unmarshal(data, &a.aliases); err == nil {
+		return a, nil
+	}
+	targets := make(map[string]string)
+	if err := json.Unmarshal(data, &targets); err != nil {
+		return a, err
+	}
+	a.aliases = make(map[string]aliasEntry, len(targets))
+	for name, target := range targets {
+		a.aliases[name] = aliasEntry{Target: target}
+	}
+	return a, nil
+}
+
+// Target — на что непосредственно указывает псевдоним
+func (a *Aliases) Target(name string) (string, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	al, ok := a.aliases[name]
+	return al.Target, ok
+}
+
+// Resolve — проходит цепочку псевдонимов от key до ключа, не являющегося псевдонимом.
+// Ключ, не являющийся псевдонимом, возвращается как есть.
+func (a *Aliases) Resolve(key string) (string, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.resolve(key)
+}
+
+func (a *Aliases) resolve(key string) (string, error) {
+	seen := map[string]bool{key: true}
+	for hops := 0; ; hops++ {
+		al, ok := a.aliases[key]
+		if !ok {
+			return key, nil
+		}
+		target := al.Target
+		if seen[target] {
+			return "", ErrAliasLoop
+		}
+		if hops == MAX_ALIAS_HOPS {
+			return "", ErrAliasHops
+		}
+		seen[target] = true
+		key = target
+	}
+}
+
+// Set — направляет псевдоним name на ключ target от имени клиента identity, который
+// становится владельцем нового псевдонима; чужой псевдоним не меняется (ErrAliasDenied).
+// Возвращает ключ объекта в конце цепочки; псевдоним, замыкающий цепочку или удлиняющий
+// её сверх MAX_ALIAS_HOPS, не сохраняется.
+func (a *Aliases) Set(name, target, identity string) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	prev, existed := a.aliases[name]
+	if existed && !prev.canWrite(identity) {
+		return "", ErrAliasDenied
+	}
+	owner := identity
+	if existed && prev.Owner != "" {
+		// Администратор, перенаправивший псевдоним, не отнимает его у владельца
+		owner = prev.Owner
+	}
+	a.aliases[name] = aliasEntry{Target: target, Owner: owner}
+	resolved, err := a.resolve(name)
+	if err == nil {
+		err = a.save()
+	}
+	if err != nil {
+		if existed {
+			a.aliases[name] = prev
+		} else {
+			delete(a.aliases, name)
+		}
+		return "", err
+	}
+	return resolved, nil
+}
+
+// Remove — удаляет псевдоним от имени клиента identity; false — такого псевдонима не было,
+// чужой псевдоним не удаляется (ErrAliasDenied)
+func (a *Aliases) Remove(name, identity string) (bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	prev, ok := a.aliases[name]
+	if !ok {
+		return false, nil
+	}
+	if !prev.canWrite(identity) {
+		return false, ErrAliasDenied
+	}
+	delete(a.aliases, name)
+	if err := a.save(); err != nil {
+		a.aliases[name] = prev
+		return false, err
+	}
+	return true, nil
+}
+
+// save — записывает псевдонимы во временный файл и переименовывает его,
+// чтобы при сбое не остался наполовину записанный файл
+func (a *Aliases) save() error {
+	data, err := json.Marshal(a.aliases)
+	if err != nil {
+		return err
+	}
+	tmp := a.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, a.path)
+}
+
+// resolveAlias — ключ объекта для key с учётом псевдонимов; при ошибке в цепочке отвечает 508
+func resolveAlias(w http.ResponseWriter, storage *Storage, key string) (string, bool) {
+	resolved, err := storage.aliases.Resolve(key)
+	if err != nil {
+		log.Printf("Ошибка разрешения псевдонима %s: %v", logKey(key), logErr(err))
+		http.Error(w, "Цепочка псевдонимов зациклена или слишком длинная", http.StatusLoopDetected)
+		return "", false
+	}
+	return resolved, true
+}
+
+// checkNotAlias — не даёт загрузить объект под ключом псевдонима (он заслонял бы объект), иначе отвечает 409
+func checkNotAlias(w http.ResponseWriter, storage *Storage, key string) bool {
+	if _, ok := storage.aliases.Target(key); !ok {
+		return true
+	}
+	http.Error(w, "Под этим ключом псевдоним, сначала удалите его", http.StatusConflict)
+	return false
+}
+
+// HandleAlias — обработчик псевдонимов: PUT /alias/<key>?target=<key> направляет псевдоним
+// на объект (или другой псевдоним), GET показывает, куда он указывает, DELETE удаляет.
+// Скачивание псевдонима через /download/ отдаёт объект в конце цепочки.
+func HandleAlias(w http.ResponseWriter, r *http.Request, storage *Storage) {
+	alias := storage.RequestKey(r, r.URL.Path[ALIAS_PREFIX_LEN:])
+	if !checkKey(w, alias) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		target, ok := storage.aliases.Target(alias)
+		if !ok {
+			http.Error(w, "Псевдоним не найден", http.StatusNotFound)
+			return
+		}
+		resolved, ok := resolveAlias(w, storage, alias)
+		if !ok {
+			return
+		}
+		writeAlias(w, r, alias, target, resolved)
+	case http.MethodPut:
+		target := storage.RequestKey(r, r.URL.Query().Get("target"))
+		if !checkKey(w, target) {
+			return
+		}
+		if storage.Exists(alias) {
+			http.Error(w, "Под этим ключом уже есть объект", http.StatusConflict)
+			return
+		}
+		// Объект в конце цепочки должен существовать и быть доступен клиенту
+		end, ok := resolveAlias(w, storage, target)
+		if !ok {
+			return
+		}
+		if !storage.Exists(end) {
+			http.Error(w, "Объект не найден", http.StatusNotFound)
+			return
+		}
+		if !authorizeObject(w, r, storage, end, false) {
+			return
+		}
+		resolved, err := storage.aliases.Set(alias, target, Identity(r))
+		if errors.Is(err, ErrAliasDenied) {
+			denyAccess(w, r)
+			return
+		}
+		if errors.Is(err, ErrAliasLoop) || errors.Is(err, ErrAliasHops) {
+			http.Error(w, "Цепочка псевдонимов зациклена или слишком длинная", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Printf("Ошибка сохранения псевдонима %s: %v", logKey(alias), logErr(err))
+			http.Error(w, "Ошибка сохранения псевдонима", http.StatusInternalServerError)
+			return
+		}
+		writeAlias(w, r, alias, target, resolved)
+	case http.MethodDelete:
+		removed, err := storage.aliases.Remove(alias, Identity(r))
+		if errors.Is(err, ErrAliasDenied) {
+			denyAccess(w, r)
+			return
+		}
+		if err != nil {
+			log.Printf("Ошибка удаления псевдонима %s: %v", logKey(alias), logErr(err))
+			http.Error(w, "Ошибка удаления псевдонима", http.StatusInternalServerError)
+			return
+		}
+		if !removed {
+			http.Error(w, "Псевдоним не найден", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+// writeAlias — отвечает JSON с псевдонимом, его целью и объектом в конце цепочки
+func writeAlias(w http.ResponseWriter, r *http.Request, alias, target, resolved string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Alias    string
+		Target   string
+		Resolved string
+	}{clientKey(r, alias), clientKey(r, target), clientKey(r, resolved)})
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAliases(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ALIASES_FILE)
+	a, err := LoadAliases(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		alias, target string
+		resolved      string
+		err           error
+	}{
+		{"v1", "obj", "obj", nil},
+		{"latest", "v1", "obj", nil},
+		{"v1", "latest", "", ErrAliasLoop},
+		{"self", "self", "", ErrAliasLoop},
+	}
+	for _, tt := range tests {
+		resolved, err := a.Set(tt.alias, tt.target, "")
+		if resolved != tt.resolved || !errors.Is(err, tt.err) {
+			t.Errorf("Set(%s, %s) = %q, %v; want %q, %v", tt.alias, tt.target, resolved, err, tt.resolved, tt.err)
+		}
+	}
+	// Отклонённый псевдоним не меняет прежний
+	if target, _ := a.Target("v1"); target != "obj" {
+		t.Errorf("v1 points to %q after a rejected change, want obj", target)
+	}
+
+	// Цепочка длиннее MAX_ALIAS_HOPS не сохраняется
+	prev := "obj"
+	for i := 1; i <= MAX_ALIAS_HOPS; i++ {
+		alias := fmt.Sprintf("hop%d", i)
+		if _, err := a.Set(alias, prev, ""); err != nil {
+			t.Fatalf("Set(%s, %s): %v", alias, prev, err)
+		}
+		prev = alias
+	}
+	if _, err := a.Set("too-far", prev, ""); !errors.Is(err, ErrAliasHops) {
+		t.Errorf("chain of %d aliases: %v, want ErrAliasHops", MAX_ALIAS_HOPS+1, err)
+	}
+
+	// Псевдонимы переживают перезапуск
+	if removed, err := a.Remove("latest", ""); !removed || err != nil {
+		t.Errorf("Remove(latest) = %v, %v", removed, err)
+	}
+	reloaded, err := LoadAliases(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved, err := reloaded.Resolve("v1"); resolved != "obj" || err != nil {
+		t.Errorf("v1 after reload resolves to %q, %v", resolved, err)
+	}
+	if _, ok := reloaded.Target("latest"); ok {
+		t.Error("removed alias is back after reload")
+	}
+}
+
+func TestHandleAlias(t *testing.T) {
+	ts, _ := newTestServer(t)
+	upload(t, ts, "v1", "first")
+	upload(t, ts, "v2", "second")
+
+	steps := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{http.MethodPut, "/alias/latest?target=v1", http.StatusOK},
+		{http.MethodPut, "/alias/stable?target=latest", http.StatusOK},
+		{http.MethodPut, "/alias/latest?target=stable", http.StatusConflict},
+		{http.MethodPut, "/alias/broken?target=missing", http.StatusNotFound},
+		{http.MethodPut, "/alias/v2?target=v1", http.StatusConflict},
+		{http.MethodPut, "/alias/latest?target=v2", http.StatusOK},
+		// Под ключом псевдонима объект не загружается
+		{http.MethodPost, "/upload/latest", http.StatusConflict},
+		{http.MethodGet, "/alias/missing", http.StatusNotFound},
+		{http.MethodPatch, "/alias/latest", http.StatusMethodNotAllowed},
+	}
+	for _, s := range steps {
+		if resp, body := do(t, ts, s.method, s.path, "data"); resp.StatusCode != s.status {
+			t.Errorf("%s %s: %d %s, want %d", s.method, s.path, resp.StatusCode, body, s.status)
+		}
+	}
+
+	// Скачивание псевдонима отдаёт объект в конце цепочки
+	for key, want := range map[string]string{"latest": "second", "stable": "second", "v1": "first"} {
+		if resp, body := do(t, ts, http.MethodGet, "/download/"+key, ""); resp.StatusCode != http.StatusOK || body != want {
+			t.Errorf("GET /download/%s: %d %q, want %q", key, resp.StatusCode, body, want)
+		}
+	}
+	if _, body := do(t, ts, http.MethodGet, "/alias/stable", ""); body != "{\"Alias\":\"stable\",\"Target\":\"latest\",\"Resolved\":\"v2\"}\n" {
+		t.Errorf("GET /alias/stable = %s", body)
+	}
+	if resp, _ := do(t, ts, http.MethodDelete, "/alias/stable", ""); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("DELETE /alias/stable: %d, want 204", resp.StatusCode)
+	}
+	if resp, _ := do(t, ts, http.MethodGet, "/download/stable", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("download of deleted alias: %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestAliasOwner(t *testing.T) {
+	ts, _ := newTestServer(t, "-api-key", "secret", "-users", "alice:a-key,bob:b-key")
+	alice, bob, admin := "Bearer a-key", "Bearer b-key", "Bearer secret"
+	upload(t, ts, "v1", "first", "Authorization", alice, ACL_HEADER, ACL_PUBLIC)
+	upload(t, ts, "v2", "second", "Authorization", alice, ACL_HEADER, ACL_PUBLIC)
+
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		auth   string
+		status int
+	}{
+		{"owner creates", http.MethodPut, "/alias/latest?target=v1", alice, http.StatusOK},
+		// Псевдоним чужого клиента нельзя ни перенаправить, ни удалить
+		{"other user redirects", http.MethodPut, "/alias/latest?target=v2", bob, http.StatusForbidden},
+		{"other user deletes", http.MethodDelete, "/alias/latest", bob, http.StatusForbidden},
+		{"anonymous deletes", http.MethodDelete, "/alias/latest", "", http.StatusUnauthorized},
+		{"admin redirects", http.MethodPut, "/alias/latest?target=v2", admin, http.StatusOK},
+		// Перенаправление администратором оставляет псевдоним владельцу
+		{"owner redirects", http.MethodPut, "/alias/latest?target=v1", alice, http.StatusOK},
+		{"owner deletes", http.MethodDelete, "/alias/latest", alice, http.StatusNoContent},
+		{"other user creates", http.MethodPut, "/alias/latest?target=v1", bob, http.StatusOK},
+		{"admin deletes", http.MethodDelete, "/alias/latest", admin, http.StatusNoContent},
+	}
+	for _, s := range steps {
+		var header []string
+		if s.auth != "" {
+			header = []string{"Authorization", s.auth}
+		}
+		if resp, body := do(t, ts, s.method, s.path, "", header...); resp.StatusCode != s.status {
+			t.Errorf("%s: %s %s: %d %s, want %d", s.name, s.method, s.path, resp.StatusCode, body, s.status)
+		}
+	}
+}
+
+func TestLoadAliasesWithoutOwners(t *testing.T) {
+	// Файл псевдонимов прежнего вида, без владельцев
+	path := filepath.Join(t.TempDir(), ALIASES_FILE)
+	if err := os.WriteFile(path, []byte(`{"latest":"v1"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	a, err := LoadAliases(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target, ok := a.Target("latest"); !ok || target != "v1" {
+		t.Errorf("latest points to %q, %v; want v1", target, ok)
+	}
+	// Псевдоним без владельца может изменить любой клиент, и тот становится владельцем
+	if _, err := a.Set("latest", "v2", "bob"); err != nil {
+		t.Fatalf("Set(latest) by bob: %v", err)
+	}
+	if _, err := a.Remove("latest", "alice"); !errors.Is(err, ErrAliasDenied) {
+		t.Errorf("Remove(latest) by alice: %v, want ErrAliasDenied", err)
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ADMIN_IDENTITY          = "admin"          // ИМЯ, ПОД КОТОРЫМ ДЕЙСТВУЕТ ВЛАДЕЛЕЦ ГЛОБАЛЬНОГО API-КЛЮЧА
+	PRESIGN_PREFIX_LEN      = len("/presign/") // ДЛИНА ПРЕФИКСА ДЛЯ МАРШРУТА ПОДПИСАННЫХ ССЫЛОК
+	PRESIGN_DEFAULT_EXPIRES = 15 * 60          // СРОК ДЕЙСТВИЯ ПОДПИСАННОЙ ССЫЛКИ ПО УМОЛЧАНИЮ В СЕКУНДАХ
+	PRESIGN_MAX_EXPIRES     = 7 * 24 * 60 * 60 // МАКСИМАЛЬНЫЙ СРОК ДЕЙСТВИЯ ПОДПИСАННОЙ ССЫЛКИ В СЕКУНДАХ
+)
+
+// Auth — учётные данные клиентов. Глобальный API-ключ даёт права администратора,
+// ключи пользователей — права на собственные объекты.
+type Auth struct {
+	apiKey string            // Глобальный API-ключ, им же подписываются ссылки
+	tokens map[string]string // Имя пользователя по его ключу
+}
+
+// NewAuth — конструктор учётных данных из конфигурации
+func NewAuth(cfg *Config) *Auth {
+	a := &Auth{apiKey: cfg.APIKey, tokens: make(map[string]string)}
+	for name, token := range cfg.Users {
+		a.tokens[token] = name
+	}
+	return a
+}
+
+// Enabled — включена ли авторизация
+func (a *Auth) Enabled() bool {
+	return a.apiKey != ""
+}
+
+// identify — имя клиента по ключу из заголовка Authorization: Bearer <ключ>
+func (a *Auth) identify(r *http.Request) string {
+	token := r.Header.Get("Authorization")
+	if !a.Enabled() || !strings.HasPrefix(token, "Bearer ") {
+		return ""
+	}
+	token = strings.TrimPrefix(token, "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(a.apiKey)) == 1 {
+		return ADMIN_IDENTITY
+	}
+	return a.tokens[token]
+}
+
+// Identity — имя авторизованного клиента (пусто — аноним)
+func Identity(r *http.Request) string {
+	name, _ := r.Context().Value(identityKey).(string)
+	return name
+}
+
+// withIdentity — запрос с заданным именем клиента в контексте
+func withIdentity(r *http.Request, name string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), identityKey, name))
+}
+
+// WithIdentity — определяет клиента по ключу в запросе. Запросы без ключа
+// не отклоняются: анонимам доступны публичные объекты.
+func WithIdentity(auth *Auth, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if name := auth.identify(r); name != "" {
+			r = withIdentity(r, name)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// presignSignature — HMAC-подпись метода, пути, срока действия и владельца ссылки
+func presignSignature(secret, method, path string, expires int64, owner string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%d\n%s", method, path, expires, owner)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// presignedOwner — проверяет подпись и срок действия подписанной ссылки и возвращает
+// клиента, получившего ссылку. Подпись привязана к методу и пути, поэтому ссылку
+// нельзя использовать для другого объекта.
+func (a *Auth) presignedOwner(r *http.Request) (string, bool) {
+	q := r.URL.Query()
+	expires, err := strconv.ParseInt(q.Get("X-Expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return "", false
+	}
+	owner := q.Get("X-Owner")
+	want := presignSignature(a.apiKey, r.Method, tenantPath(r, r.URL.Path), expires, owner)
+	return owner, hmac.Equal([]byte(q.Get("X-Signature")), []byte(want))
+}
+
+// RequireAuth — пропускает запрос только от авторизованного клиента, а если presigned —
+// ещё и по действующей подписанной ссылке. Без настроенной авторизации пропускает всех.
+func RequireAuth(auth *Auth, presigned bool, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !auth.Enabled() || Identity(r) != "" {
+			next(w, r)
+			return
+		}
+		if presigned {
+			if owner, ok := auth.presignedOwner(r); ok {
+				next(w, withIdentity(r, owner))
+				return
+			}
+		}
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Требуется авторизация", http.StatusUnauthorized)
+	}
+}
+
+// HandlePresign — обработчик для выдачи подписанной ссылки на загрузку объекта.
+// Параметры: method (PUT или POST, по умолчанию PUT), expires — срок действия в секундах.
+// По ссылке объект можно загрузить без ключа, например прямо из браузера;
+// владельцем объекта станет клиент, запросивший ссылку.
+// С method=GET администратор получает ссылку на скачивание со своей скоростью
+// rate байт в секунду вместо -download-rate (0 — без ограничения).
+func HandlePresign(w http.ResponseWriter, r *http.Request, auth *Auth) {
+	if !auth.Enabled() {
+		http.Error(w, "Подписанные ссылки требуют настроенного -api-key", http.StatusBadRequest)
+		return
+	}
+
+	key := r.URL.Path[PRESIGN_PREFIX_LEN:]
+	if !checkKey(w, key) {
+		return
+	}
+	q := r.URL.Query()
+	method := q.Get("method")
+	if method == "" {
+		method = http.MethodPut
+	}
+	if method != http.MethodPut && method != http.MethodPost && method != http.MethodGet {
+		http.Error(w, "Подписать можно только PUT, POST или GET", http.StatusBadRequest)
+		return
+	}
+	// Скачивание открыто и без ссылки, её смысл — обойти общее ограничение скорости
+	if method == http.MethodGet && Identity(r) != ADMIN_IDENTITY {
+		http.Error(w, "Ссылку на скачивание со своей скоростью выдаёт только администратор", http.StatusForbidden)
+		return
+	}
+	var rate int64
+	if v := q.Get(RATE_PARAM); v != "" && method == http.MethodGet {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			http.Error(w, "Некорректная скорость скачивания", http.StatusBadRequest)
+			return
+		}
+		rate = n
+	}
+	seconds := int64(PRESIGN_DEFAULT_EXPIRES)
+	if v := q.Get("expires"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 || n > PRESIGN_MAX_EXPIRES {
+			http.Error(w, "Некорректный срок действия ссылки", http.StatusBadRequest)
+			return
+		}
+		seconds = n
+	}
+
+	expires := time.Now().Unix() + seconds
+	owner := Identity(r)
+	path := "/upload/" + key
+	query := url.Values{
+		"X-Expires":   {strconv.FormatInt(expires, 10)},
+		"X-Owner":     {owner},
+		"X-Signature": {presignSignature(auth.apiKey, method, tenantPath(r, path), expires, owner)},
+	}
+	if method == http.MethodGet {
+		path = "/download/" + key
+		query = url.Values{
+			"X-Expires":   {strconv.FormatInt(expires, 10)},
+			SIGNED_RATE:   {strconv.FormatInt(rate, 10)},
+			"X-Signature": {rateSignature(auth.apiKey, tenantPath(r, path), expires, rate)},
+		}
+	}
+	u := url.URL{Path: path, RawQuery: query.Encode()}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Method  string
+		URL     string
+		Expires time.Time
+	}{method, u.String(), time.Unix(expires, 0).UTC()})
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAPIKey(t *testing.T) {
+	ts, _ := newTestServer(t, "-api-key", "secret")
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header []string
+		status int
+	}{
+		{"upload without key", http.MethodPost, "/upload/obj", nil, http.StatusUnauthorized},
+		{"upload with wrong key", http.MethodPost, "/upload/obj", []string{"Authorization", "Bearer wrong"}, http.StatusUnauthorized},
+		{"upload with key", http.MethodPost, "/upload/obj", []string{"Authorization", "Bearer secret"}, http.StatusCreated},
+		{"download with key", http.MethodGet, "/download/obj", []string{"Authorization", "Bearer secret"}, http.StatusOK},
+		{"delete without key", http.MethodDelete, "/delete/obj", nil, http.StatusUnauthorized},
+		{"presign without key", http.MethodGet, "/presign/new", nil, http.StatusUnauthorized},
+		{"presign DELETE", http.MethodGet, "/presign/new?method=DELETE", []string{"Authorization", "Bearer secret"}, http.StatusBadRequest},
+		{"presign zero expires", http.MethodGet, "/presign/new?expires=0", []string{"Authorization", "Bearer secret"}, http.StatusBadRequest},
+		{"delete with key", http.MethodDelete, "/delete/obj", []string{"Authorization", "Bearer secret"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, ts, tt.method, tt.path, "data", tt.header...)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: %d %s, want %d", tt.name, resp.StatusCode, body, tt.status)
+		}
+		if tt.status == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") != "Bearer" {
+			t.Errorf("%s: no WWW-Authenticate challenge", tt.name)
+		}
+	}
+}
+
+func TestPresignedUpload(t *testing.T) {
+	ts, _ := newTestServer(t, "-api-key", "secret", "-cors-origins", "https://app.example")
+	presign := func(query string) string {
+		resp, body := do(t, ts, http.MethodGet, "/presign/photo"+query, "", "Authorization", "Bearer secret")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("presign%s: %d %s", query, resp.StatusCode, body)
+		}
+		var link struct{ Method, URL string }
+		if err := json.Unmarshal([]byte(body), &link); err != nil {
+			t.Fatal(err)
+		}
+		return link.URL
+	}
+	put, post := presign(""), presign("?method=POST")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		status int
+	}{
+		{"tampered signature", http.MethodPut, strings.Replace(put, "X-Signature=", "X-Signature=0", 1), http.StatusUnauthorized},
+		{"other key", http.MethodPut, strings.Replace(put, "/upload/photo", "/upload/other", 1), http.StatusUnauthorized},
+		{"other method", http.MethodPost, put, http.StatusUnauthorized},
+		{"signed PUT", http.MethodPut, put, http.StatusCreated},
+		{"signed POST over existing", http.MethodPost, post, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		// Браузер загружает по ссылке без API-ключа, с заголовком Origin
+		resp, body := do(t, ts, tt.method, tt.path, "image", "Origin", "https://app.example")
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: %d %s, want %d", tt.name, resp.StatusCode, body, tt.status)
+		}
+		if resp.Header.Get("Access-Control-Allow-Origin") != "https://app.example" {
+			t.Errorf("%s: response is not readable by the browser", tt.name)
+		}
+	}
+	if resp, body := do(t, ts, http.MethodGet, "/download/photo", "", "Authorization", "Bearer secret"); resp.StatusCode != http.StatusOK || body != "image" {
+		t.Errorf("download of presigned upload: %d %q", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	BACKEND_FS     = "fs"     // ОБЪЕКТЫ В ФАЙЛАХ ПОД -storage-dir И -type-dirs
+	BACKEND_MEMORY = "memory" // ОБЪЕКТЫ ТОЛЬКО В ПАМЯТИ ПРОЦЕССА, ДО ПЕРЕЗАПУСКА
+	BACKEND_S3     = "s3"     // ОБЪЕКТЫ ВО ВНЕШНЕМ S3-ХРАНИЛИЩЕ (-s3-endpoint, -s3-bucket)
+)
+
+// ObjectContent — содержимое объекта, открытое для потокового чтения. Stat относится
+// к открытому содержимому, даже если объект тем временем перезаписали или удалили.
+type ObjectContent interface {
+	io.ReadSeekCloser
+	io.ReaderAt
+	Stat() (os.FileInfo, error)
+}
+
+// Backend — где хранится содержимое объектов (флаг -backend). Кэш, очередь отложенной
+// записи, квота и права остаются в Storage над бэкендом, а метаданные, незавершённые
+// загрузки и служебные файлы всегда лежат в -storage-dir. Методы вызываются с
+// захваченным мьютексом хранилища, Open и Stat — хотя бы на чтение (Checksum — и без него).
+type Backend interface {
+	// Stat — размер и время изменения объекта, отсутствующий — os.ErrNotExist.
+	// IsDir — на месте ключа только вложенные объекты (a, когда есть a/b)
+	Stat(key string) (os.FileInfo, error)
+	// Open — открывает содержимое для чтения; удаление объекта не мешает дочитать его
+	Open(key string) (ObjectContent, error)
+	// Write — заменяет содержимое целиком, после ошибки остаётся прежнее. С durable
+	// запись переживает сбой питания
+	Write(key string, data []byte, durable bool) error
+	// WriteFile — заменяет содержимое готовым временным файлом, который при этом забирается
+	WriteFile(key, tmpPath string) error
+	// WriteAt — записывает data поверх содержимого существующего объекта с offset,
+	// дописывая его при необходимости
+	WriteAt(key string, data []byte, offset int64) error
+	// Remove — удаляет объект
+	Remove(key string) error
+	// Touch — меняет время изменения объекта
+	Touch(key string, t time.Time) error
+	// CheckKey — можно ли записать объект с ключом рядом с уже сохранёнными
+	// (ErrKeyIsPrefix, ErrPrefixIsObject)
+	CheckKey(key string) error
+	// Walk — вызывает fn для ключей объектов, начинающихся с prefix. Может вызвать
+	// fn и для других ключей, как KeyMapper.Walk
+	Walk(prefix string, fn func(key string) error) error
+}
+
+// newBackend — бэкенд по флагу -backend; конфигурация уже проверена в ParseConfig
+func newBackend(cfg *Config, s *Storage) Backend {
+	switch cfg.Backend {
+	case BACKEND_MEMORY:
+		return NewMemoryBackend()
+	case BACKEND_S3:
+		return NewS3Backend(cfg.S3Endpoint, cfg.S3Bucket)
+	}
+	return &FSBackend{s: s}
+}
+
+// checkBackend — проверяет флаги бэкенда при запуске, чтобы неверная настройка
+// не обнаружилась только на первом запросе
+func checkBackend(cfg *Config) error {
+	s3Flags := cfg.S3Endpoint != "" || cfg.S3Bucket != "" || cfg.S3AccessKey != "" || cfg.S3SecretKey != ""
+	switch cfg.Backend {
+	case BACKEND_FS, BACKEND_MEMORY:
+		if s3Flags {
+			return fmt.Errorf("-s3-* flags require -backend %s", BACKEND_S3)
+		}
+	case BACKEND_S3:
+		if err := checkS3Config(cfg); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown backend %q, expected %q, %q or %q", cfg.Backend, BACKEND_FS, BACKEND_MEMORY, BACKEND_S3)
+	}
+	// Маршруты по типу содержимого — это директории на диске
+	if cfg.Backend != BACKEND_FS && len(cfg.TypeRoutes) > 0 {
+		return fmt.Errorf("-type-dirs requires -backend %s", BACKEND_FS)
+	}
+	return nil
+}
+
+// FSBackend — объекты в файлах под корнями по типу содержимого (-type-dirs) с раскладкой
+// KeyMapper. Файлы, которые сейчас отдаются потоком, учитываются в Storage.readers.
+type FSBackend struct {
+	s *Storage
+}
+
+// Stat — состояние файла объекта
+func (b *FSBackend) Stat(key string) (os.FileInfo, error) {
+	return os.Stat(b.s.objectPath(key))
+}
+
+// Open — открывает файл объекта; пока он не закрыт, удаление не мешает дочитать его
+func (b *FSBackend) Open(key string) (ObjectContent, error) {
+	file, err := os.Open(b.s.objectPath(key))
+	if err != nil {
+		return nil, err
+	}
+	return &objectFile{File: file, readers: b.s.readers, key: key, open: b.s.readers.acquire(key)}, nil
+}
+
+// Write — записывает файл объекта через временный файл (writeFileAtomic). С durable
+// синхронизируется и директория, чтобы новая запись о файле тоже пережила сбой
+func (b *FSBackend) Write(key string, data []byte, durable bool) error {
+	path := b.s.objectPath(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(b.s.stagingDir(path), path, data, durable); err != nil {
+		return err
+	}
+	if !durable {
+		return nil
+	}
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+// WriteFile — перемещает временный файл на место файла объекта (moveFile)
+func (b *FSBackend) WriteFile(key, tmpPath string) error {
+	path := b.s.objectPath(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return moveFile(tmpPath, path, b.s.stagingDir(path))
+}
+
+// WriteAt — записывает данные в файл объекта на месте
+func (b *FSBackend) WriteAt(key string, data []byte, offset int64) error {
+	file, err := os.OpenFile(b.s.objectPath(key), os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteAt(data, offset); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Remove — удаляет файл объекта (читаемый сейчас — после отдачи) и опустевшие
+// родительские директории
+func (b *FSBackend) Remove(key string) error {
+	path := b.s.objectPath(key)
+	if err := b.s.readers.remove(key, path, b.s.stagingDir(path)); err != nil {
+		return err
+	}
+	removeEmptyParents(path, b.s.objectRoot(key))
+	return nil
+}
+
+// Touch — меняет время изменения файла объекта
+func (b *FSBackend) Touch(key string, t time.Time) error {
+	return os.Chtimes(b.s.objectPath(key), t, t)
+}
+
+// CheckKey — путь файла объекта не занят директорией вложенных объектов (a, когда
+// есть a/b), и ни одна из родительских директорий не является файлом другого
+// объекта (a/b, когда есть a)
+func (b *FSBackend) CheckKey(key string) error {
+	s := b.s
+	root := s.objectRoot(key)
+	path := s.objectPath(key)
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return fmt.Errorf("%w: %s", ErrKeyIsPrefix, key)
+	}
+	for dir := filepath.Dir(path); dir != root && strings.HasPrefix(dir, root+"/"); dir = filepath.Dir(dir) {
+		if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+			// Путь к файлу кончается ключом, и ключ мешающего объекта — начало нашего
+			conflict := strings.TrimPrefix(dir, root+"/")
+			if strings.HasSuffix(path, "/"+key) {
+				conflict = key[:len(key)-(len(path)-len(dir))]
+			}
+			return fmt.Errorf("%w: %s", ErrPrefixIsObject, conflict)
+		}
+	}
+
+	// Объекты из очереди отложенной записи ещё не на диске, их конфликт с ключом
+	// виден по путям, которые они займут (под тем же корнем)
+	if s.wb != nil {
+		rel := s.mapper.Path(key)
+		s.wb.mu.Lock()
+		defer s.wb.mu.Unlock()
+		for pending := range s.wb.pending {
+			if s.objectRoot(pending) != root {
+				continue
+			}
+			pendingRel := s.mapper.Path(pending)
+			if strings.HasPrefix(pendingRel, rel+"/") {
+				return fmt.Errorf("%w: %s", ErrKeyIsPrefix, key)
+			}
+			if strings.HasPrefix(rel, pendingRel+"/") {
+				return fmt.Errorf("%w: %s", ErrPrefixIsObject, pending)
+			}
+		}
+	}
+	return nil
+}
+
+// Walk — обходит ключи под каждым корнем объектов (walkRoots)
+func (b *FSBackend) Walk(prefix string, fn func(key string) error) error {
+	return b.s.walkRoots(prefix, fn)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBackends(t *testing.T) {
+	for _, backend := range []string{BACKEND_FS, BACKEND_MEMORY} {
+		// Объекты больше байта не кэшируются, чтения идут в бэкенд
+		storage, _ := newTestStorage(t, "-backend", backend, "-cache-threshold", "1")
+		if err := storage.Save("dir/a", []byte("hello"), Meta{}); err != nil {
+			t.Fatalf("%s: save: %v", backend, err)
+		}
+		if _, err := storage.Patch("dir/a", 5, []byte(" world"), ""); err != nil {
+			t.Fatalf("%s: patch: %v", backend, err)
+		}
+		if data, ok := storage.Load("dir/a"); !ok || string(data.body) != "hello world" {
+			t.Errorf("%s: load dir/a = %q, %v", backend, data.body, ok)
+		}
+		want := md5.Sum([]byte("hello world"))
+		if sum, err := storage.Checksum("dir/a", "md5"); err != nil || sum != hex.EncodeToString(want[:]) {
+			t.Errorf("%s: checksum = %q, %v, want %x", backend, sum, err, want)
+		}
+
+		tmp, err := os.CreateTemp(tmpDir, "upload-*")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmp.WriteString("from file")
+		tmp.Close()
+		if err := storage.SaveFile("b", tmp.Name(), "", Meta{}); err != nil {
+			t.Fatalf("%s: save file: %v", backend, err)
+		}
+		if _, err := os.Stat(tmp.Name()); !os.IsNotExist(err) {
+			t.Errorf("%s: temp file is left after SaveFile: %v", backend, err)
+		}
+
+		past := time.Now().Add(-time.Hour).Truncate(time.Second)
+		if err := storage.backend.Touch("b", past); err != nil {
+			t.Fatalf("%s: touch: %v", backend, err)
+		}
+		if info, err := storage.backend.Stat("b"); err != nil || info.Size() != int64(len("from file")) || !info.ModTime().Equal(past) {
+			t.Errorf("%s: stat b = %v, %v", backend, info, err)
+		}
+		if keys, err := storage.diskKeys(); err != nil || !reflect.DeepEqual(keys, []string{"b", "dir/a"}) {
+			t.Errorf("%s: keys = %v, %v", backend, keys, err)
+		}
+
+		// Открытое содержимое дочитывается и после удаления объекта
+		obj, content, ok := storage.Open("b")
+		if !ok || content == nil {
+			t.Fatalf("%s: open b: %v %v", backend, obj, ok)
+		}
+		if err := storage.Delete("b", ""); err != nil {
+			t.Fatalf("%s: delete: %v", backend, err)
+		}
+		if data, err := io.ReadAll(content); err != nil || string(data) != "from file" {
+			t.Errorf("%s: read after delete = %q, %v", backend, data, err)
+		}
+		content.Close()
+		if _, ok := storage.Load("b"); ok {
+			t.Errorf("%s: deleted object is still loaded", backend)
+		}
+		if err := storage.Delete("b", ""); !os.IsNotExist(err) {
+			t.Errorf("%s: second delete: %v, want not exist", backend, err)
+		}
+
+		// Файлы объектов появляются на диске только у fs
+		_, err = os.Stat(storage.objectPath("dir/a"))
+		if onDisk := err == nil; onDisk != (backend == BACKEND_FS) {
+			t.Errorf("%s: object file on disk: %v", backend, err)
+		}
+	}
+}
+
+func TestMemoryBackendNestedKeys(t *testing.T) {
+	storage, _ := newTestStorage(t, "-backend", BACKEND_MEMORY)
+	// В памяти нет директорий, a и a/b друг другу не мешают
+	for _, key := range []string{"a/b", "a"} {
+		if err := storage.Save(key, []byte(key), Meta{}); err != nil {
+			t.Errorf("save %s: %v", key, err)
+		}
+	}
+	if keys, err := storage.diskKeys(); err != nil || !reflect.DeepEqual(keys, []string{"a", "a/b"}) {
+		t.Errorf("keys = %v, %v", keys, err)
+	}
+}
+
+func TestS3BackendStub(t *testing.T) {
+	storage, _ := newTestStorage(t, "-backend", BACKEND_S3, "-s3-endpoint", "https://s3.example.com", "-s3-bucket", "objects")
+	if err := storage.Save("k", []byte("v"), Meta{}); !errors.Is(err, ErrBackendNotImplemented) {
+		t.Errorf("save: %v, want %v", err, ErrBackendNotImplemented)
+	}
+	if _, ok := storage.Load("k"); ok {
+		t.Error("load of an unsaved object succeeded")
+	}
+	if _, err := storage.diskKeys(); !errors.Is(err, ErrBackendNotImplemented) {
+		t.Errorf("keys: %v, want %v", err, ErrBackendNotImplemented)
+	}
+}
+
+func TestParseBackend(t *testing.T) {
+	s3 := []string{"-backend", "s3", "-s3-endpoint", "https://s3.example.com", "-s3-bucket", "objects"}
+	tests := []struct {
+		name string
+		args []string
+		ok   bool
+	}{
+		{"default", nil, true},
+		{"memory", []string{"-backend", "memory"}, true},
+		{"s3", s3, true},
+		{"s3 with keys", append(s3, "-s3-access-key", "id", "-s3-secret-key", "secret"), true},
+		{"unknown", []string{"-backend", "tape"}, false},
+		{"s3 without endpoint", []string{"-backend", "s3", "-s3-bucket", "objects"}, false},
+		{"s3 without bucket", []string{"-backend", "s3", "-s3-endpoint", "https://s3.example.com"}, false},
+		{"s3 endpoint without scheme", []string{"-backend", "s3", "-s3-endpoint", "s3.example.com", "-s3-bucket", "objects"}, false},
+		{"s3 invalid bucket", []string{"-backend", "s3", "-s3-endpoint", "https://s3.example.com", "-s3-bucket", "Objects"}, false},
+		{"s3 secret without access key", append(s3, "-s3-secret-key", "secret"), false},
+		{"s3 flags with fs", []string{"-s3-bucket", "objects"}, false},
+		{"type dirs with memory", []string{"-backend", "memory", "-type-dirs", "image/*=/mnt/media"}, false},
+	}
+	for _, tt := range tests {
+		_, err := ParseConfig(append([]string{"-storage-dir", "/storage"}, tt.args...))
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+
+	// Секретный ключ S3 не попадает в вывод конфигурации
+	cfg, err := ParseConfig(append([]string{"-storage-dir", "/storage"}, append(s3, "-s3-access-key", "id", "-s3-secret-key", "secret")...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := cfg.redacted(); c.S3SecretKey != REDACTED {
+		t.Errorf("s3 secret key is not redacted: %q", c.S3SecretKey)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"hash/fnv"
+	"log"
+	"math"
+)
+
+const BLOOM_FALSE_POSITIVE_RATE = 0.01 // ДОЛЯ ЛОЖНЫХ СРАБАТЫВАНИЙ ФИЛЬТРА ПРИ РАСЧЁТНОМ ЧИСЛЕ КЛЮЧЕЙ
+
+// Bloom — фильтр Блума по ключам объектов. Если фильтр говорит, что ключа нет,
+// его точно нет, и диск можно не трогать. Положительный ответ может быть ложным,
+// поэтому наличие объекта всё равно проверяется по-настоящему.
+// Bloom не потокобезопасен, доступ к нему защищается мьютексом Storage.
+type Bloom struct {
+	bits []uint64 // Битовый массив фильтра
+	m    uint64   // Число бит
+	k    uint64   // Число хэш-функций
+}
+
+// NewBloom — конструктор фильтра, рассчитанного на n ключей
+func NewBloom(n int) *Bloom {
+	if n < 1 {
+		n = 1
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(BLOOM_FALSE_POSITIVE_RATE) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Max(1, math.Round(float64(m)/float64(n)*math.Ln2)))
+	return &Bloom{bits: make([]uint64, (m+63)/64), m: m, k: k}
+}
+
+// Add — добавляет ключ в фильтр
+func (b *Bloom) Add(key string) {
+	h1, h2 := bloomHashes(key)
+	for i := uint64(0); i < b.k; i++ {
+		bit := (h1 + i*h2) % b.m
+		b.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// MayContain — false означает, что ключ точно не добавлялся
+func (b *Bloom) MayContain(key string) bool {
+	h1, h2 := bloomHashes(key)
+	for i := uint64(0); i < b.k; i++ {
+		bit := (h1 + i*h2) % b.m
+		if b.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// bloomHashes — две независимые хэш-функции, из которых строятся остальные
+func bloomHashes(key string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	h1 := h.Sum64()
+	h.Write([]byte{0})
+	h2 := h.Sum64() | 1 // Нечётный шаг, чтобы позиции не повторялись
+	return h1, h2
+}
+
+// initBloom — заполняет фильтр ключами объектов, уже лежащих на диске
+func (s *Storage) initBloom(expected int) {
+	keys, err := s.diskKeys()
+	if err != nil {
+		// Без полного списка ключей фильтр давал бы ложные отказы, поэтому выключаем его
+		log.Printf("Фильтр Блума отключён, не удалось прочитать ключи: %v", logErr(err))
+		return
+	}
+	if len(keys)*2 > expected {
+		expected = len(keys) * 2
+	}
+	s.bloom = NewBloom(expected)
+	for _, key := range keys {
+		s.bloom.Add(key)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestBloom(t *testing.T) {
+	for _, n := range []int{0, 1, 100, 10000} {
+		b := NewBloom(n)
+		for i := 0; i < n; i++ {
+			b.Add("key-" + strconv.Itoa(i))
+		}
+		// Добавленный ключ фильтр не отклоняет никогда
+		for i := 0; i < n; i++ {
+			if !b.MayContain("key-" + strconv.Itoa(i)) {
+				t.Fatalf("n %d: added key-%d rejected", n, i)
+			}
+		}
+		// Ложных срабатываний при расчётном числе ключей — около BLOOM_FALSE_POSITIVE_RATE
+		falsePositives := 0
+		for i := 0; i < 10000; i++ {
+			if b.MayContain("absent-" + strconv.Itoa(i)) {
+				falsePositives++
+			}
+		}
+		if n > 1 && float64(falsePositives)/10000 > 3*BLOOM_FALSE_POSITIVE_RATE {
+			t.Errorf("n %d: %d false positives of 10000", n, falsePositives)
+		}
+	}
+}
+
+func TestBloomRejections(t *testing.T) {
+	dir := t.TempDir()
+	// Объект, записанный до запуска, попадает в фильтр при старте
+	if err := os.WriteFile(dir+"/old", []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ts, _ := newTestServer(t, "-storage-dir", dir, "-bloom-keys", "100")
+	upload(t, ts, "new", "new")
+
+	tests := []struct {
+		key        string
+		status     int
+		rejections string
+	}{
+		{"missing", http.StatusNotFound, "1"},
+		{"old", http.StatusOK, "1"},
+		{"new", http.StatusOK, "1"},
+		{"missing", http.StatusNotFound, "2"},
+	}
+	for _, tt := range tests {
+		if resp, _ := do(t, ts, http.MethodGet, "/download/"+tt.key, ""); resp.StatusCode != tt.status {
+			t.Errorf("download %s: %d, want %d", tt.key, resp.StatusCode, tt.status)
+		}
+		if got := metrics(t, ts)["storage_bloom_rejections_total"]; got != tt.rejections {
+			t.Errorf("after %s: bloom rejections %s, want %s", tt.key, got, tt.rejections)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+var (
+	ErrTooLarge     = errors.New("object exceeds the maximum object size")         // Объект больше -max-object-size
+	ErrBadEncoding  = errors.New("request body is not valid gzip")                 // Тело с Content-Encoding: gzip не распаковывается
+	ErrUnsupEncoded = errors.New("only gzip and identity encodings are supported") // Неизвестный Content-Encoding
+)
+
+// readUploadBody — читает тело загрузки. Тело с Content-Encoding: gzip распаковывается
+// на лету, и объект хранится распакованным. Предел maxSize (0 — без ограничений)
+// проверяется по распакованному размеру, поэтому «zip-бомба» обрывается, как только
+// распакованные данные его превысят, а не после распаковки целиком.
+func readUploadBody(r *http.Request, maxSize int64) ([]byte, error) {
+	var body io.Reader = r.Body
+	gzipped := false
+	switch encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); encoding {
+	case "", "identity":
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, ErrBadEncoding
+		}
+		defer gz.Close()
+		body = gz
+		gzipped = true
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupEncoded, encoding)
+	}
+
+	if maxSize > 0 {
+		body = io.LimitReader(body, maxSize+1)
+	}
+	// В бюджете учитывается распакованный размер: именно столько займёт тело в памяти
+	if res := memoryReservation(r); res != nil {
+		body = res.reader(body)
+	}
+	data, err := io.ReadAll(body)
+	if errors.Is(err, ErrMemoryBudget) {
+		return nil, err
+	}
+	// Обрыв посреди потока gzip — это неполное сжатое тело; у несжатого тела
+	// ошибка чтения (например, разорванное соединение) остаётся как есть
+	if err != nil {
+		if gzipped && (errors.Is(err, gzip.ErrChecksum) || errors.Is(err, gzip.ErrHeader) || errors.Is(err, io.ErrUnexpectedEOF)) {
+			return nil, ErrBadEncoding
+		}
+		return nil, err
+	}
+	if maxSize > 0 && int64(len(data)) > maxSize {
+		return nil, ErrTooLarge
+	}
+	return data, nil
+}
+
+// checkDeclaredBody — проверяет тело загрузки по заголовкам, не читая его: неизвестный
+// Content-Encoding и несжатое тело, объявленное больше maxSize, отклоняются сразу. С Expect:
+// 100-continue клиент тогда получает отказ до того, как начнёт передавать тело.
+func checkDeclaredBody(r *http.Request, maxSize int64) error {
+	switch encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); encoding {
+	case "", "identity":
+		if maxSize > 0 && r.ContentLength > maxSize {
+			return ErrTooLarge
+		}
+	case "gzip", "x-gzip":
+		// Распакованный размер по заголовкам неизвестен, он проверяется при чтении
+	default:
+		return fmt.Errorf("%w: %q", ErrUnsupEncoded, encoding)
+	}
+	return nil
+}
+
+// uploadErrorStatus — код ответа для ошибки чтения тела загрузки
+func uploadErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrBadEncoding):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrUnsupEncoded):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, ErrMemoryBudget):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// setRetryAfter — если тело не поместилось в бюджет памяти уже при чтении, просит клиента
+// повторить запрос позже, как и отказ LimitMemory до чтения тела
+func setRetryAfter(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrMemoryBudget) {
+		w.Header().Set("Retry-After", RETRY_AFTER)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// gzipped — data, сжатые gzip
+func gzipped(t *testing.T, data string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestGzipUpload(t *testing.T) {
+	ts, _ := newTestServer(t, "-max-object-size", "100")
+	// Тысяча байт сжимается в несколько десятков: предел проверяется по распакованному размеру
+	bomb := gzipped(t, strings.Repeat("a", 1000))
+	if len(bomb) > 100 {
+		t.Fatalf("compressed body is %d bytes, the test needs it under the limit", len(bomb))
+	}
+
+	tests := []struct {
+		name     string
+		key      string
+		body     string
+		encoding string
+		status   int
+		stored   string
+	}{
+		{"gzip", "gz", gzipped(t, "hello world"), "gzip", http.StatusCreated, "hello world"},
+		{"x-gzip", "xgz", gzipped(t, "hello"), "x-gzip", http.StatusCreated, "hello"},
+		{"identity", "plain", "hello", "identity", http.StatusCreated, "hello"},
+		{"decompressed too large", "bomb", bomb, "gzip", http.StatusRequestEntityTooLarge, ""},
+		{"identity too large", "large", strings.Repeat("a", 101), "", http.StatusRequestEntityTooLarge, ""},
+		{"not gzip", "broken", "hello", "gzip", http.StatusBadRequest, ""},
+		{"truncated gzip", "truncated", gzipped(t, "hello world")[:20], "gzip", http.StatusBadRequest, ""},
+		{"unsupported encoding", "br", "hello", "br", http.StatusUnsupportedMediaType, ""},
+	}
+	for _, tt := range tests {
+		var header []string
+		if tt.encoding != "" {
+			header = []string{"Content-Encoding", tt.encoding}
+		}
+		if resp, body := do(t, ts, http.MethodPost, "/upload/"+tt.key, tt.body, header...); resp.StatusCode != tt.status {
+			t.Errorf("%s: %d %s, want %d", tt.name, resp.StatusCode, body, tt.status)
+		}
+		// Объект хранится распакованным, отклонённый не сохраняется
+		resp, body := do(t, ts, http.MethodGet, "/download/"+tt.key, "")
+		if tt.stored == "" && resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%s: rejected object is stored: %d", tt.name, resp.StatusCode)
+		}
+		if tt.stored != "" && body != tt.stored {
+			t.Errorf("%s: stored %q, want %q", tt.name, body, tt.stored)
+		}
+	}
+}
+
+// watchedBody — тело запроса, которое запоминает, читал ли его клиент для отправки
+type watchedBody struct {
+	*strings.Reader
+	read *atomic.Bool
+}
+
+func (b watchedBody) Read(p []byte) (int, error) {
+	b.read.Store(true)
+	return b.Reader.Read(p)
+}
+
+func TestRejectBeforeBody(t *testing.T) {
+	ts, _ := newTestServer(t, "-api-key", "secret", "-max-object-size", "8", "-disk-quota", "10")
+	admin := []string{"Authorization", "Bearer secret"}
+	upload(t, ts, "obj", "1234", admin...)
+	// S3 хранит объект под ключом <bucket>/<key>
+	for _, key := range []string{"leased", "bucket/leased"} {
+		if resp, body := do(t, ts, http.MethodPost, "/lease/"+key+"?seconds=60", "", admin...); resp.StatusCode != http.StatusOK {
+			t.Fatalf("lease %s: %d %s", key, resp.StatusCode, body)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		header []string
+		status int
+		sent   bool // Должен ли клиент передать тело
+	}{
+		{"bad key", http.MethodPost, "/upload/a%00b", "data", admin, http.StatusBadRequest, false},
+		{"no auth", http.MethodPost, "/upload/new", "data", nil, http.StatusUnauthorized, false},
+		{"exists", http.MethodPost, "/upload/obj", "data", admin, http.StatusConflict, false},
+		{"leased", http.MethodPut, "/upload/leased", "data", append([]string{"If-Match", "*"}, admin...), http.StatusConflict, false},
+		{"etag mismatch", http.MethodPut, "/upload/obj", "data", append([]string{"If-Match", `"nope"`}, admin...), http.StatusPreconditionFailed, false},
+		{"if-match missing", http.MethodPut, "/upload/missing", "data", append([]string{"If-Match", "*"}, admin...), http.StatusPreconditionFailed, false},
+		{"too large", http.MethodPost, "/upload/big", "123456789", admin, http.StatusRequestEntityTooLarge, false},
+		{"unknown encoding", http.MethodPost, "/upload/br", "data", append([]string{"Content-Encoding", "br"}, admin...), http.StatusUnsupportedMediaType, false},
+		{"over quota", http.MethodPost, "/upload/full", "1234567", admin, http.StatusInsufficientStorage, false},
+		{"s3 too large", http.MethodPut, "/bucket/big", "123456789", admin, http.StatusRequestEntityTooLarge, false},
+		{"s3 over quota", http.MethodPut, "/bucket/full", "1234567", admin, http.StatusInsufficientStorage, false},
+		{"s3 leased", http.MethodPut, "/bucket/leased", "data", admin, http.StatusConflict, false},
+		{"accepted", http.MethodPost, "/upload/new", "data", admin, http.StatusCreated, true},
+	}
+	client := &http.Client{Transport: &http.Transport{ExpectContinueTimeout: time.Minute}}
+	defer client.CloseIdleConnections()
+	for _, tt := range tests {
+		var read atomic.Bool
+		req, err := http.NewRequest(tt.method, ts.URL+tt.path, watchedBody{strings.NewReader(tt.body), &read})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.ContentLength = int64(len(tt.body))
+		req.Header.Set("Expect", "100-continue")
+		for i := 0; i+1 < len(tt.header); i += 2 {
+			req.Header.Set(tt.header[i], tt.header[i+1])
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status || read.Load() != tt.sent {
+			t.Errorf("%s: %d, body sent %v; want %d, %v", tt.name, resp.StatusCode, read.Load(), tt.status, tt.sent)
+		}
+	}
+}
+
+// failingBody — тело запроса, чтение которого обрывается ошибкой err
+type failingBody struct {
+	err error
+}
+
+func (b failingBody) Read(p []byte) (int, error) {
+	return 0, b.err
+}
+
+func TestReadUploadBodyErrors(t *testing.T) {
+	errReset := errors.New("connection reset")
+	tests := []struct {
+		name     string
+		body     io.Reader
+		encoding string
+		want     error
+	}{
+		{"truncated gzip", strings.NewReader(gzipped(t, "hello world")[:20]), "gzip", ErrBadEncoding},
+		// Обрыв несжатого тела — ошибка соединения, а не неверное сжатие
+		{"truncated identity", failingBody{io.ErrUnexpectedEOF}, "", io.ErrUnexpectedEOF},
+		{"read error", failingBody{errReset}, "", errReset},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/upload/k", tt.body)
+		if tt.encoding != "" {
+			r.Header.Set("Content-Encoding", tt.encoding)
+		}
+		if _, err := readUploadBody(r, 0); !errors.Is(err, tt.want) || (tt.want != ErrBadEncoding && errors.Is(err, ErrBadEncoding)) {
+			t.Errorf("%s: %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import "time"
+
+// Cache — кэш объектов в памяти с ограничением по суммарному размеру.
+// Какой объект вытесняется при переполнении, решает политика вытеснения.
+// Закреплённые объекты политике не передаются и поэтому не вытесняются никогда.
+// Cache не потокобезопасен, доступ к нему защищается мьютексом Storage.
+type Cache struct {
+	capacity  int64           // Максимальный суммарный размер объектов в байтах (0 — без ограничений)
+	maxObject int64           // Объекты больше этого размера не кэшируются (0 — без ограничений)
+	size      int64           // Текущий суммарный размер объектов в байтах
+	items     map[string]obj  // Объекты по ключу
+	pinned    map[string]bool // Закреплённые ключи, в том числе ещё не попавшие в кэш
+	policy    EvictionPolicy  // Порядок вытеснения объектов
+	onEvict   func(o obj)     // Вызывается для каждого вытесненного объекта
+}
+
+// NewCache — конструктор кэша заданной ёмкости с политикой вытеснения policy
+func NewCache(capacity, maxObject int64, policy EvictionPolicy, onEvict func(o obj)) *Cache {
+	return &Cache{
+		capacity:  capacity,
+		maxObject: maxObject,
+		items:     make(map[string]obj),
+		pinned:    make(map[string]bool),
+		policy:    policy,
+		onEvict:   onEvict,
+	}
+}
+
+// Get — возвращает объект и сообщает политике вытеснения об обращении к нему
+func (c *Cache) Get(key string) (obj, bool) {
+	o, ok := c.items[key]
+	if ok {
+		c.policy.Accessed(key)
+	}
+	return o, ok
+}
+
+// Peek — возвращает объект, не меняя порядок вытеснения
+func (c *Cache) Peek(key string) (obj, bool) {
+	o, ok := c.items[key]
+	return o, ok
+}
+
+// Contains — проверяет наличие объекта, не меняя порядок вытеснения
+func (c *Cache) Contains(key string) bool {
+	_, ok := c.items[key]
+	return ok
+}
+
+// Put — добавляет объект в кэш, вытесняя старые при нехватке места.
+// Объект больше ёмкости кэша или порога maxObject не кэшируется, чтобы одна
+// большая загрузка не вытесняла весь кэш.
+func (c *Cache) Put(o obj) {
+	c.Remove(o.name)
+	size := int64(len(o.body))
+	if !c.Fits(size) {
+		return
+	}
+
+	// Место освобождается до добавления, иначе LFU вытеснил бы сам новый объект,
+	// у которого ещё нет обращений. Если вытеснять больше некого (остались только
+	// закреплённые), объект не кэшируется.
+	for c.capacity > 0 && c.size+size > c.capacity {
+		key, ok := c.policy.Victim()
+		if !ok {
+			return
+		}
+		c.evict(key)
+	}
+	c.items[o.name] = o
+	if !c.pinned[o.name] {
+		c.policy.Added(o.name)
+	}
+	c.size += size
+}
+
+// Fits — может ли кэш вообще хранить объект размера size: не больше его ёмкости и порога
+// maxObject. Они не меняются после создания кэша, поэтому Fits безопасен и без мьютекса.
+func (c *Cache) Fits(size int64) bool {
+	return (c.capacity == 0 || size <= c.capacity) && (c.maxObject == 0 || size <= c.maxObject)
+}
+
+// Pin — закрепляет ключ: его объект, уже закэшированный или добавленный позже,
+// не вытесняется, пока ключ не откреплён. Место в ёмкости кэша он занимает как обычно.
+func (c *Cache) Pin(key string) {
+	if c.pinned[key] {
+		return
+	}
+	c.pinned[key] = true
+	c.policy.Removed(key)
+}
+
+// Unpin — снимает закрепление; объект снова вытесняется как недавно добавленный
+func (c *Cache) Unpin(key string) {
+	if !c.pinned[key] {
+		return
+	}
+	delete(c.pinned, key)
+	if _, ok := c.items[key]; ok {
+		c.policy.Added(key)
+	}
+}
+
+// Pinned — закреплён ли ключ
+func (c *Cache) Pinned(key string) bool {
+	return c.pinned[key]
+}
+
+// Touch — обновляет время изменения объекта и сообщает политике вытеснения
+// об обращении к нему, не меняя содержимое
+func (c *Cache) Touch(key string, modTime time.Time) {
+	if o, ok := c.items[key]; ok {
+		o.modTime = modTime
+		c.items[key] = o
+		c.policy.Accessed(key)
+	}
+}
+
+// Remove — удаляет объект из кэша
+func (c *Cache) Remove(key string) {
+	if _, ok := c.items[key]; ok {
+		c.drop(key)
+	}
+}
+
+// Keys — ключи всех объектов в кэше
+func (c *Cache) Keys() []string {
+	keys := make([]string, 0, len(c.items))
+	for key := range c.items {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Len — количество объектов в кэше
+func (c *Cache) Len() int {
+	return len(c.items)
+}
+
+// Size — суммарный размер объектов в кэше в байтах
+func (c *Cache) Size() int64 {
+	return c.size
+}
+
+// evict — вытесняет объект из кэша
+func (c *Cache) evict(key string) {
+	o := c.drop(key)
+	if c.onEvict != nil {
+		c.onEvict(o)
+	}
+}
+
+// drop — убирает объект из кэша и из политики вытеснения
+func (c *Cache) drop(key string) obj {
+	o := c.items[key]
+	delete(c.items, key)
+	c.policy.Removed(key)
+	c.size -= int64(len(o.body))
+	return o
+}
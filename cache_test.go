@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCacheFits(t *testing.T) {
+	tests := []struct {
+		capacity, maxObject, size int64
+		want                      bool
+	}{
+		{0, 0, 1 << 30, true},
+		{10, 0, 10, true},
+		{10, 0, 11, false},
+		{0, 5, 5, true},
+		{0, 5, 6, false},
+		{10, 5, 6, false},
+	}
+	for _, tt := range tests {
+		c := NewCache(tt.capacity, tt.maxObject, newEvictionPolicy(EVICT_LRU), nil)
+		if got := c.Fits(tt.size); got != tt.want {
+			t.Errorf("capacity %d, threshold %d: Fits(%d) = %v, want %v", tt.capacity, tt.maxObject, tt.size, got, tt.want)
+		}
+		c.Put(obj{name: "k", body: make([]byte, tt.size)})
+		if got := c.Contains("k"); got != tt.want {
+			t.Errorf("capacity %d, threshold %d: object of %d cached = %v, want %v", tt.capacity, tt.maxObject, tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestCacheThreshold(t *testing.T) {
+	ts, _ := newTestServer(t, "-cache-threshold", "5")
+	upload(t, ts, "small", "abc")
+	upload(t, ts, "large", "0123456789")
+
+	// Маленький объект отдаётся из кэша, большой каждый раз читается с диска
+	tests := []struct {
+		key          string
+		hits, misses string
+		body         string
+	}{
+		{"small", "1", "0", "abc"},
+		{"large", "1", "1", "0123456789"},
+		{"large", "1", "2", "0123456789"},
+		{"small", "2", "2", "abc"},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, ts, http.MethodGet, "/download/"+tt.key, "")
+		if resp.StatusCode != http.StatusOK || body != tt.body {
+			t.Fatalf("download %s: %d %q", tt.key, resp.StatusCode, body)
+		}
+		m := metrics(t, ts)
+		if m["storage_cache_hits_total"] != tt.hits || m["storage_cache_misses_total"] != tt.misses {
+			t.Errorf("after %s: hits %s misses %s, want %s %s", tt.key, m["storage_cache_hits_total"], m["storage_cache_misses_total"], tt.hits, tt.misses)
+		}
+	}
+	if got := metrics(t, ts)["storage_cache_bytes"]; got != "3" {
+		t.Errorf("cache holds %s bytes, want only the small object", got)
+	}
+}
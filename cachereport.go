@@ -0,0 +1,62 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// CACHE_WATERMARK — ПРОЦЕНТ ЁМКОСТИ КЭША ПО УМОЛЧАНИЮ, ПРИ КОТОРОМ ПИШЕТСЯ ПРЕДУПРЕЖДЕНИЕ
+const CACHE_WATERMARK = 90
+
+// Capacity — ёмкость кэша в байтах (0 — без ограничений)
+func (c *Cache) Capacity() int64 {
+	return c.capacity
+}
+
+// cacheWatermark — отслеживает заполнение кэша относительно порога в процентах ёмкости
+type cacheWatermark struct {
+	percent int  // Порог в процентах ёмкости
+	above   bool // Заполнение было выше порога при прошлой проверке
+}
+
+// check — сравнивает заполнение кэша с порогом. Возвращает true, если заполнение только
+// что поднялось до порога: предупреждение пишется один раз при пересечении, а не на
+// каждом отчёте, пока кэш остаётся заполненным
+func (cw *cacheWatermark) check(size, capacity int64) bool {
+	if capacity <= 0 {
+		return false
+	}
+	above := size*100 >= capacity*int64(cw.percent)
+	crossed := above && !cw.above
+	cw.above = above
+	return crossed
+}
+
+// cacheReportLoop — раз в interval пишет в журнал заполнение кэша и предупреждает, когда
+// оно достигает watermark процентов ёмкости: вскоре начнётся вытеснение, и кэш стоит
+// увеличить, пока объекты не начали вытеснять друг друга по кругу
+func (s *Storage) cacheReportLoop(interval time.Duration, watermark int) {
+	cw := &cacheWatermark{percent: watermark}
+	for range time.Tick(interval) {
+		s.reportCache(cw)
+	}
+}
+
+// reportCache — один отчёт о заполнении кэша с проверкой порога cw
+func (s *Storage) reportCache(cw *cacheWatermark) {
+	s.mu.RLock()
+	objects, size, capacity := s.cache.Len(), s.cache.Size(), s.cache.Capacity()
+	s.mu.RUnlock()
+
+	if capacity <= 0 {
+		log.Printf("Кэш: объектов %d, %d байт", objects, size)
+		return
+	}
+	log.Printf("Кэш: объектов %d, %d из %d байт (%d%%), вытеснено объектов %d",
+		objects, size, capacity, size*100/capacity, s.metrics.Evictions.Load())
+	if cw.check(size, capacity) {
+		s.metrics.CacheWatermarkAlerts.Add(1)
+		log.Printf("Предупреждение: кэш заполнен на %d%% при пороге %d%%, увеличьте -cache-size, пока вытеснение не стало частым",
+			size*100/capacity, cw.percent)
+	}
+}
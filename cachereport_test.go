@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCacheWatermark(t *testing.T) {
+	cw := &cacheWatermark{percent: 90}
+	// Предупреждение — только при пересечении порога снизу вверх
+	steps := []struct {
+		size, capacity int64
+		crossed        bool
+	}{
+		{50, 100, false},
+		{90, 100, true},
+		{95, 100, false},
+		{100, 100, false},
+		{80, 100, false},
+		{99, 100, true},
+		{1000, 0, false},
+	}
+	for i, s := range steps {
+		if got := cw.check(s.size, s.capacity); got != s.crossed {
+			t.Errorf("step %d: check(%d, %d) = %v, want %v", i, s.size, s.capacity, got, s.crossed)
+		}
+	}
+}
+
+func TestReportCache(t *testing.T) {
+	logs := captureLog(t)
+	ts, storage := newTestServer(t, "-cache-size", "10")
+	upload(t, ts, "a", "123456")
+
+	// Отчёты идут подряд, как по тикам -cache-report; предупреждение — только в первом
+	cw := &cacheWatermark{percent: 50}
+	storage.reportCache(cw)
+	storage.reportCache(cw)
+	if got := strings.Count(logs.String(), "Кэш: объектов 1, 6 из 10 байт (60%)"); got != 2 {
+		t.Errorf("%d reports, want 2:\n%s", got, logs.String())
+	}
+	if got := strings.Count(logs.String(), "кэш заполнен на 60% при пороге 50%"); got != 1 {
+		t.Errorf("%d watermark warnings, want 1:\n%s", got, logs.String())
+	}
+	m := metrics(t, ts)
+	if m["storage_cache_watermark_alerts_total"] != "1" || m["storage_cache_capacity_bytes"] != "10" {
+		t.Errorf("watermark alerts %s, capacity %s; want 1 and 10", m["storage_cache_watermark_alerts_total"], m["storage_cache_capacity_bytes"])
+	}
+
+	// Без -cache-size порога нет, в отчёте только заполнение
+	logs.Reset()
+	_, unbounded := newTestServer(t)
+	unbounded.reportCache(&cacheWatermark{percent: 50})
+	if !strings.Contains(logs.String(), "Кэш: объектов 0, 0 байт") || strings.Contains(logs.String(), "Предупреждение") {
+		t.Errorf("report without -cache-size:\n%s", logs.String())
+	}
+
+	for _, args := range [][]string{{"-cache-report", "-1s"}, {"-cache-watermark", "0"}, {"-cache-watermark", "101"}} {
+		if _, err := ParseConfig(args); err == nil {
+			t.Errorf("ParseConfig(%q) accepted invalid settings", args)
+		}
+	}
+}
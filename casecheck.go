@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// CaseReport — ключи, которые на файловой системе без учёта регистра (NTFS, APFS,
+// FAT) оказались бы одним файлом: перед переносом хранилища их нужно переименовать
+type CaseReport struct {
+	Objects    int        // Сколько объектов просмотрено
+	Collisions [][]string // Группы ключей, различающихся только регистром, по порядку ключей
+}
+
+// CaseCollisions — ищет на диске ключи под prefix, различающиеся только регистром
+func (s *Storage) CaseCollisions(prefix string) (CaseReport, error) {
+	report := CaseReport{Collisions: make([][]string, 0)}
+	groups := make(map[string][]string)
+	err := s.walkPrefixKeys(prefix, func(key string) error {
+		report.Objects++
+		folded := strings.ToLower(key)
+		groups[folded] = append(groups[folded], key)
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+	for _, keys := range groups {
+		if len(keys) > 1 {
+			sort.Strings(keys)
+			report.Collisions = append(report.Collisions, keys)
+		}
+	}
+	sort.Slice(report.Collisions, func(i, j int) bool {
+		return report.Collisions[i][0] < report.Collisions[j][0]
+	})
+	return report, nil
+}
+
+// HandleCaseCollisions — обработчик для отчёта о ключах, различающихся только регистром:
+// GET /admin/case-collisions?prefix= (без префикса — всё хранилище). Отчёт содержит
+// ключи всех владельцев, поэтому при -api-key доступен только администратору.
+func HandleCaseCollisions(w http.ResponseWriter, r *http.Request, storage *Storage, cfg *Config) {
+	if cfg.APIKey != "" && Identity(r) != ADMIN_IDENTITY {
+		http.Error(w, "Доступ запрещён", http.StatusForbidden)
+		return
+	}
+
+	prefix := r.URL.Query().Get("prefix")
+	if !checkPrefix(w, prefix) {
+		return
+	}
+	report, err := storage.CaseCollisions(prefix)
+	if err != nil {
+		log.Printf("Ошибка поиска ключей, различающихся регистром: %v", logErr(err))
+		http.Error(w, "Ошибка чтения хранилища", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
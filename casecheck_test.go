@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestHandleCaseCollisions(t *testing.T) {
+	ts, _ := newTestServer(t, "-api-key", "secret", "-users", "alice:a-key")
+	admin := []string{"Authorization", "Bearer secret"}
+	for _, key := range []string{"Photo.jpg", "photo.jpg", "PHOTO.JPG", "a/B", "a/b", "a/c", "unique"} {
+		upload(t, ts, key, "1", admin...)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		query      string
+		header     []string
+		status     int
+		objects    int
+		collisions [][]string
+	}{
+		{"all", http.MethodGet, "", admin, http.StatusOK, 7, [][]string{{"PHOTO.JPG", "Photo.jpg", "photo.jpg"}, {"a/B", "a/b"}}},
+		{"prefix", http.MethodGet, "?prefix=a/", admin, http.StatusOK, 3, [][]string{{"a/B", "a/b"}}},
+		{"no collisions", http.MethodGet, "?prefix=u", admin, http.StatusOK, 1, [][]string{}},
+		{"bad prefix", http.MethodGet, "?prefix=../x", admin, http.StatusBadRequest, 0, nil},
+		{"user", http.MethodGet, "", []string{"Authorization", "Bearer a-key"}, http.StatusForbidden, 0, nil},
+		{"anonymous", http.MethodGet, "", nil, http.StatusUnauthorized, 0, nil},
+		{"wrong method", http.MethodPost, "", admin, http.StatusMethodNotAllowed, 0, nil},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, ts, tt.method, "/admin/case-collisions"+tt.query, "", tt.header...)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: %d %s, want %d", tt.name, resp.StatusCode, body, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		var report CaseReport
+		if err := json.Unmarshal([]byte(body), &report); err != nil {
+			t.Fatalf("%s: %v: %s", tt.name, err, body)
+		}
+		if report.Objects != tt.objects || !reflect.DeepEqual(report.Collisions, tt.collisions) {
+			t.Errorf("%s: %+v, want %d objects and %v", tt.name, report, tt.objects, tt.collisions)
+		}
+	}
+}
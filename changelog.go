@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	CHANGELOG_SIZE = 1000              // СКОЛЬКО ПОСЛЕДНИХ ИЗМЕНЕНИЙ ПОМНИТ ЖУРНАЛ ПО УМОЛЧАНИЮ
+	CHANGELOG_FILE = ".changelog.json" // ФАЙЛ ЖУРНАЛА ИЗМЕНЕНИЙ В ХРАНИЛИЩЕ (ТОЧКА — НЕ ПОПАДАЕТ В СПИСОК ОБЪЕКТОВ)
+)
+
+const (
+	CHANGE_CREATE = "create" // ОБЪЕКТ СОЗДАН
+	CHANGE_UPDATE = "update" // ОБЪЕКТ ПЕРЕЗАПИСАН ИЛИ ИЗМЕНЁН ЧАСТИЧНО
+	CHANGE_DELETE = "delete" // ОБЪЕКТ УДАЛЁН
+)
+
+// Change — одно изменение объекта в журнале. Seq растёт на единицу с каждым
+// изменением: по разрыву в Seq клиент видит, что часть изменений уже вытеснена.
+type Change struct {
+	Seq  uint64
+	Op   string
+	Key  string
+	Time time.Time
+}
+
+// ChangeLog — последние изменения объектов в кольцевом буфере фиксированного размера:
+// клиент догоняет недавние изменения, не сравнивая полные списки объектов.
+// Если задан path, журнал переживает перезапуск.
+type ChangeLog struct {
+	mu      sync.Mutex
+	path    string   // Файл журнала (пусто — только в памяти)
+	entries []Change // Кольцевой буфер изменений
+	next    int      // Куда запишется следующее изменение
+	full    bool     // Буфер заполнен, старейшее изменение — entries[next]
+	seq     uint64   // Seq последнего изменения
+}
+
+// NewChangeLog — журнал на size изменений; изменения, сохранённые в path, читаются
+// (лишние старейшие — отбрасываются)
+func NewChangeLog(size int, path string) (*ChangeLog, error) {
+	c := &ChangeLog{path: path, entries: make([]Change, size)}
+	if path == "" {
+		return c, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	var saved []Change
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return c, err
+	}
+	for _, change := range saved {
+		c.add(change)
+	}
+	return c, nil
+}
+
+// Record — добавляет изменение объекта key; старейшее изменение при этом может вытесниться
+func (c *ChangeLog) Record(op, key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.add(Change{Seq: c.seq + 1, Op: op, Key: key, Time: time.Now()})
+	if c.path == "" {
+		return
+	}
+	if err := c.save(); err != nil {
+		log.Printf("Ошибка сохранения журнала изменений %s: %v", c.path, err)
+	}
+}
+
+func (c *ChangeLog) add(change Change) {
+	c.entries[c.next] = change
+	c.next = (c.next + 1) % len(c.entries)
+	if c.next == 0 {
+		c.full = true
+	}
+	c.seq = change.Seq
+}
+
+// Recent — изменения с Seq больше since по порядку, от старых к новым
+func (c *ChangeLog) Recent(since uint64) []Change {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.recent(since)
+}
+
+func (c *ChangeLog) recent(since uint64) []Change {
+	list := make([]Change, 0)
+	if c.full {
+		list = append(list, c.entries[c.next:]...)
+	}
+	list = append(list, c.entries[:c.next]...)
+	for len(list) > 0 && list[0].Seq <= since {
+		list = list[1:]
+	}
+	return list
+}
+
+// save — записывает журнал во временный файл и переименовывает его,
+// чтобы при сбое не остался наполовину записанный файл
+func (c *ChangeLog) save() error {
+	data, err := json.Marshal(c.recent(0))
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(storagePath(TMP_DIR), c.path, data, false)
+}
+
+// recordChange — отмечает изменение объекта в журнале, если журнал включён
+func (s *Storage) recordChange(op, key string) {
+	if s.changes != nil {
+		s.changes.Record(op, key)
+	}
+}
+
+// HandleChangeLog — обработчик для журнала изменений: GET /changelog?limit=N&since=S
+// отдаёт последние изменения объектов по порядку, от старых к новым. since — Seq
+// последнего уже известного клиенту изменения: отдаются только более новые.
+// Журнал только в памяти сервера (или в файле при -changelog-persist) и не больше
+// -changelog-size изменений: удалённое в обход сервера в нём не отражается.
+// Клиент виртуального хоста видит только изменения в своей поддиректории.
+func HandleChangeLog(w http.ResponseWriter, r *http.Request, storage *Storage) {
+	if storage.changes == nil {
+		http.Error(w, "Журнал изменений выключен (-changelog-size 0)", http.StatusNotFound)
+		return
+	}
+	q := r.URL.Query()
+	limit := 0
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "limit должен быть положительным числом", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	var since uint64
+	if v := q.Get("since"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			http.Error(w, "since должен быть номером изменения", http.StatusBadRequest)
+			return
+		}
+		since = n
+	}
+
+	changes := storage.changes.Recent(since)
+	if tenant := Tenant(r); tenant != "" {
+		own := make([]Change, 0, len(changes))
+		for _, change := range changes {
+			if strings.HasPrefix(change.Key, tenant+"/") {
+				change.Key = clientKey(r, change.Key)
+				own = append(own, change)
+			}
+		}
+		changes = own
+	}
+	// Без since — последние limit изменений, с since — ближайшие после него,
+	// чтобы клиент догонял журнал страницами, передавая Seq последнего полученного
+	if limit > 0 && len(changes) > limit {
+		if since > 0 {
+			changes = changes[:limit]
+		} else {
+			changes = changes[len(changes)-limit:]
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(changes)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// changeList — журнал изменений со стороны клиента: номер, операция и ключ
+func changeList(t *testing.T, body string) []string {
+	t.Helper()
+	var changes []Change
+	if err := json.Unmarshal([]byte(body), &changes); err != nil {
+		t.Fatalf("changelog %s: %v", body, err)
+	}
+	list := make([]string, 0, len(changes))
+	for _, change := range changes {
+		list = append(list, strconv.FormatUint(change.Seq, 10)+" "+change.Op+" "+change.Key)
+	}
+	return list
+}
+
+func TestHandleChangeLog(t *testing.T) {
+	ts, _ := newTestServer(t, "-changelog-size", "4", "-virtual-hosts", "a.test=tenant-a,127.0.0.1=")
+	upload(t, ts, "a", "1")
+	steps := []struct {
+		method, path, body string
+		header             []string
+	}{
+		{http.MethodPut, "/upload/a", "2", []string{"If-Match", "*"}},
+		{http.MethodPatch, "/patch/a", "3", []string{"X-Offset", "1"}},
+		{http.MethodDelete, "/delete/a", "", nil},
+		{http.MethodPost, "/upload/b", "1", []string{"Host", "a.test"}},
+	}
+	for _, s := range steps {
+		if resp, body := do(t, ts, s.method, s.path, s.body, s.header...); resp.StatusCode >= 300 {
+			t.Fatalf("%s %s: %d %s", s.method, s.path, resp.StatusCode, body)
+		}
+	}
+
+	tests := []struct {
+		query  string
+		host   string
+		status int
+		want   []string
+	}{
+		// Первое изменение уже вытеснено: в журнале только четыре последних
+		{"", "", http.StatusOK, []string{"2 update a", "3 update a", "4 delete a", "5 create tenant-a/b"}},
+		{"?limit=2", "", http.StatusOK, []string{"4 delete a", "5 create tenant-a/b"}},
+		{"?since=2&limit=2", "", http.StatusOK, []string{"3 update a", "4 delete a"}},
+		{"?since=5", "", http.StatusOK, []string{}},
+		{"", "a.test", http.StatusOK, []string{"5 create b"}},
+		{"?limit=0", "", http.StatusBadRequest, nil},
+		{"?since=-1", "", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		header := []string{}
+		if tt.host != "" {
+			header = append(header, "Host", tt.host)
+		}
+		resp, body := do(t, ts, http.MethodGet, "/changelog"+tt.query, "", header...)
+		if resp.StatusCode != tt.status {
+			t.Errorf("GET /changelog%s: %d, want %d", tt.query, resp.StatusCode, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		if got := changeList(t, body); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("GET /changelog%s (host %q) = %v, want %v", tt.query, tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestChangeLogDisabled(t *testing.T) {
+	ts, _ := newTestServer(t, "-changelog-size", "0")
+	upload(t, ts, "a", "1")
+	if resp, _ := do(t, ts, http.MethodGet, "/changelog", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET /changelog with -changelog-size 0: %d, want 404", resp.StatusCode)
+	}
+	if _, err := ParseConfig([]string{"-changelog-size", "-1"}); err == nil {
+		t.Error("ParseConfig accepted a negative -changelog-size")
+	}
+}
+
+func TestChangeLogPersist(t *testing.T) {
+	dir := t.TempDir()
+	ts, _ := newTestServer(t, "-storage-dir", dir, "-changelog-persist")
+	upload(t, ts, "a", "1")
+	upload(t, ts, "b", "1")
+	ts.Close()
+
+	// После перезапуска журнал продолжается с прежних номеров
+	ts, _ = newTestServer(t, "-storage-dir", dir, "-changelog-persist")
+	upload(t, ts, "c", "1")
+	_, body := do(t, ts, http.MethodGet, "/changelog", "")
+	if got, want := changeList(t, body), []string{"1 create a", "2 create b", "3 create c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("changelog after restart = %v, want %v", got, want)
+	}
+
+	// Журнал меньшего размера при чтении отбрасывает старейшие изменения
+	changes, err := NewChangeLog(2, dir+"/"+CHANGELOG_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := changes.Recent(0); len(got) != 2 || got[0].Key != "b" || got[1].Key != "c" {
+		t.Errorf("changelog of size 2 = %+v, want b and c", got)
+	}
+	// Файл журнала — служебный и в список объектов не попадает
+	if got := listNames(t, ts, ""); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Errorf("GET /list = %v", got)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"mime"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/transform"
+)
+
+var (
+	ErrUnknownCharset = errors.New("unknown or unsupported charset")                   // Кодировка не найдена в реестре IANA
+	ErrUnencodable    = errors.New("object text cannot be represented in the charset") // В кодировке нет нужных символов
+)
+
+// lookupCharset — кодировка по имени из реестра IANA (utf-8, iso-8859-1, windows-1251, koi8-r...)
+func lookupCharset(name string) (encoding.Encoding, error) {
+	enc, err := ianaindex.IANA.Encoding(name)
+	// Для известных, но не реализованных кодировок ianaindex возвращает nil без ошибки
+	if err != nil || enc == nil {
+		return nil, ErrUnknownCharset
+	}
+	return enc, nil
+}
+
+// Transcode — перекодирует текстовый объект из его кодировки (параметр charset типа,
+// по умолчанию UTF-8) в кодировку charset. Возвращает новое содержимое и тип с новой
+// кодировкой. Для нетекстовых объектов возвращает ok == false.
+func Transcode(o obj, contentType, charset string) (text obj, newType string, ok bool, err error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || !strings.HasPrefix(mediaType, "text/") {
+		return o, "", false, nil
+	}
+	to, err := lookupCharset(charset)
+	if err != nil {
+		return o, "", false, err
+	}
+	from := encoding.Encoding(encoding.Nop)
+	if src := params["charset"]; src != "" && !strings.EqualFold(src, "utf-8") {
+		if from, err = lookupCharset(src); err != nil {
+			return o, "", false, err
+		}
+	}
+
+	// Сначала в UTF-8 из исходной кодировки, затем в запрошенную. Кодировщик
+	// не подменяет отсутствующие символы, а возвращает ошибку
+	body, _, err := transform.Bytes(transform.Chain(from.NewDecoder(), to.NewEncoder()), o.body)
+	if err != nil {
+		return o, "", false, ErrUnencodable
+	}
+	params["charset"] = strings.ToLower(charset)
+	return obj{name: o.name, body: body, modTime: o.modTime}, mime.FormatMediaType(mediaType, params), true, nil
+}
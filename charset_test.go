@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDownloadCharset(t *testing.T) {
+	ts, _ := newTestServer(t)
+	upload(t, ts, "utf8.txt", "привет", "Content-Type", "text/plain; charset=utf-8")
+	upload(t, ts, "data.bin", "привет", "Content-Type", "application/octet-stream")
+	resp, _ := do(t, ts, http.MethodGet, "/download/utf8.txt", "")
+	etag := resp.Header.Get("ETag")
+
+	tests := []struct {
+		path        string
+		status      int
+		body        string
+		contentType string
+	}{
+		{"/download/utf8.txt?charset=windows-1251", http.StatusOK, "\xef\xf0\xe8\xe2\xe5\xf2", "text/plain; charset=windows-1251"},
+		{"/download/utf8.txt?charset=KOI8-R", http.StatusOK, "\xd0\xd2\xc9\xd7\xc5\xd4", "text/plain; charset=koi8-r"},
+		{"/download/utf8.txt?charset=iso-8859-1", http.StatusNotAcceptable, "", ""},
+		{"/download/utf8.txt?charset=no-such", http.StatusBadRequest, "", ""},
+		// Нетекстовые объекты отдаются как есть
+		{"/download/data.bin?charset=windows-1251", http.StatusOK, "привет", "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, ts, http.MethodGet, tt.path, "")
+		if resp.StatusCode != tt.status {
+			t.Errorf("GET %s: %d %s, want %d", tt.path, resp.StatusCode, body, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		if body != tt.body || resp.Header.Get("Content-Type") != tt.contentType {
+			t.Errorf("GET %s: %q %s, want %q %s", tt.path, body, resp.Header.Get("Content-Type"), tt.body, tt.contentType)
+		}
+		// У перекодированного содержимого свой ETag
+		if got := resp.Header.Get("ETag"); strings.HasPrefix(tt.path, "/download/utf8.txt") && got == etag {
+			t.Errorf("GET %s: ETag %s is the same as of the original", tt.path, got)
+		}
+	}
+}
+
+func TestTranscode(t *testing.T) {
+	tests := []struct {
+		contentType, charset string
+		body, want           string
+		wantType             string
+		ok                   bool
+		err                  error
+	}{
+		{"text/plain; charset=utf-8", "windows-1251", "привет", "\xef\xf0\xe8\xe2\xe5\xf2", "text/plain; charset=windows-1251", true, nil},
+		// Исходная кодировка берётся из типа объекта, без неё — UTF-8
+		{"text/plain; charset=windows-1251", "utf-8", "\xef\xf0\xe8\xe2\xe5\xf2", "привет", "text/plain; charset=utf-8", true, nil},
+		{"text/html", "KOI8-R", "привет", "\xd0\xd2\xc9\xd7\xc5\xd4", "text/html; charset=koi8-r", true, nil},
+		{"application/json", "windows-1251", "привет", "привет", "", false, nil},
+		{"text/plain", "iso-8859-1", "привет", "привет", "", false, ErrUnencodable},
+		{"text/plain", "no-such", "привет", "привет", "", false, ErrUnknownCharset},
+		{"text/plain; charset=no-such", "utf-8", "привет", "привет", "", false, ErrUnknownCharset},
+	}
+	for _, tt := range tests {
+		text, newType, ok, err := Transcode(obj{name: "k", body: []byte(tt.body)}, tt.contentType, tt.charset)
+		if ok != tt.ok || !errors.Is(err, tt.err) || string(text.body) != tt.want || newType != tt.wantType {
+			t.Errorf("Transcode(%s to %s) = %q, %q, %v, %v; want %q, %q, %v, %v",
+				tt.contentType, tt.charset, text.body, newType, ok, err, tt.want, tt.wantType, tt.ok, tt.err)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const CHECKSUM_PREFIX_LEN = len("/checksum/") // ДЛИНА ПРЕФИКСА ДЛЯ МАРШРУТА КОНТРОЛЬНОЙ СУММЫ
+
+// checksumAlgos — поддерживаемые алгоритмы контрольных сумм
+var checksumAlgos = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"md5":    md5.New,
+	"crc32":  func() hash.Hash { return crc32.NewIEEE() },
+}
+
+// Checksum — метод для вычисления контрольной суммы объекта.
+// Данные читаются с диска потоком, результат кэшируется в метаданных.
+func (s *Storage) Checksum(key, algo string) (string, error) {
+	if _, ok := checksumAlgos[algo]; !ok {
+		return "", fmt.Errorf("unsupported checksum algorithm %v", algo)
+	}
+
+	m, err := s.LoadMeta(key)
+	if err != nil {
+		return "", err
+	}
+	if sum, ok := m.Checksums[algo]; ok {
+		return sum, nil
+	}
+
+	sum, err := s.contentChecksum(key, algo)
+	if err != nil {
+		return "", err
+	}
+
+	// Кэшируем результат, чтобы не пересчитывать его при следующих запросах. Файл
+	// читается без мьютекса хранилища (Checksum вызывается и под ним, из Replace и Delete),
+	// и объект могли перезаписать во время подсчёта: тогда сумма относится к прежнему
+	// содержимому, и в метаданные нового она не записывается
+	err = s.UpdateMeta(key, func(cur *Meta) {
+		if !cur.Written.Equal(m.Written) || cur.Checksums["md5"] != m.Checksums["md5"] {
+			return
+		}
+		if cur.Checksums == nil {
+			cur.Checksums = make(map[string]string)
+		}
+		cur.Checksums[algo] = sum
+	})
+	if err != nil {
+		log.Printf("Ошибка при сохранении метаданных %s: %v", logKey(key), logErr(err))
+	}
+	return sum, nil
+}
+
+// fileChecksum — вычисляет контрольную сумму файла, читая его потоком
+func fileChecksum(path, algo string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return readerChecksum(file, algo)
+}
+
+// contentChecksum — вычисляет контрольную сумму содержимого объекта в бэкенде, читая его потоком
+func (s *Storage) contentChecksum(key, algo string) (string, error) {
+	content, err := s.backend.Open(key)
+	if err != nil {
+		return "", err
+	}
+	defer content.Close()
+	return readerChecksum(content, algo)
+}
+
+// readerChecksum — контрольная сумма всех данных из r
+func readerChecksum(r io.Reader, algo string) (string, error) {
+	h := checksumAlgos[algo]()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ETag — возвращает ETag объекта, построенный из его MD5
+func (s *Storage) ETag(key string) (string, error) {
+	sum, err := s.Checksum(key, "md5")
+	if err != nil {
+		return "", err
+	}
+	return `"` + sum + `"`, nil
+}
+
+// etagMatches — проверяет, подходит ли ETag под значение заголовка If-Match
+// (список ETag через запятую или "*")
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// HandleChecksum — обработчик для получения контрольной суммы объекта
+func HandleChecksum(w http.ResponseWriter, r *http.Request, storage *Storage) {
+	// Получаем ключ (имя объекта) из URL и алгоритм из параметров запроса
+	key := storage.RequestKey(r, r.URL.Path[CHECKSUM_PREFIX_LEN:])
+	if !checkKey(w, key) {
+		return
+	}
+	algo := r.URL.Query().Get("algo")
+	if algo == "" {
+		algo = "sha256"
+	}
+	if _, ok := checksumAlgos[algo]; !ok {
+		http.Error(w, "Неподдерживаемый алгоритм: "+algo, http.StatusBadRequest)
+		return
+	}
+
+	if !authorizeObject(w, r, storage, key, false) {
+		return
+	}
+	sum, err := storage.Checksum(key, algo)
+	if os.IsNotExist(err) {
+		http.Error(w, "Объект не найден", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Ошибка вычисления контрольной суммы", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Key      string
+		Algo     string
+		Checksum string
+	}{clientKey(r, key), algo, sum})
+}
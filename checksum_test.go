@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestHandleChecksum(t *testing.T) {
+	ts, storage := newTestServer(t)
+	upload(t, ts, "hello", "hello world")
+
+	tests := []struct {
+		path   string
+		status int
+		algo   string
+		sum    string
+	}{
+		{"/checksum/hello", http.StatusOK, "sha256", "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"},
+		{"/checksum/hello?algo=sha256", http.StatusOK, "sha256", "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"},
+		{"/checksum/hello?algo=md5", http.StatusOK, "md5", "5eb63bbbe01eeed093cb22bb8f5acdc3"},
+		{"/checksum/hello?algo=crc32", http.StatusOK, "crc32", "0d4a1185"},
+		{"/checksum/hello?algo=sha1", http.StatusBadRequest, "", ""},
+		{"/checksum/missing", http.StatusNotFound, "", ""},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, ts, http.MethodGet, tt.path, "")
+		if resp.StatusCode != tt.status {
+			t.Errorf("GET %s: %d, want %d", tt.path, resp.StatusCode, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		var got struct{ Key, Algo, Checksum string }
+		if err := json.Unmarshal([]byte(body), &got); err != nil {
+			t.Fatalf("GET %s: %v", tt.path, err)
+		}
+		if got.Key != "hello" || got.Algo != tt.algo || got.Checksum != tt.sum {
+			t.Errorf("GET %s = %+v, want %s %s", tt.path, got, tt.algo, tt.sum)
+		}
+	}
+
+	// Посчитанные суммы сохранены в метаданных и повторно не считаются
+	m, err := storage.LoadMeta("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, algo := range []string{"sha256", "md5", "crc32"} {
+		if m.Checksums[algo] == "" {
+			t.Errorf("checksum %s is not cached in metadata: %v", algo, m.Checksums)
+		}
+	}
+}
+
+func TestChecksumAfterReplace(t *testing.T) {
+	storage, _ := newTestStorage(t)
+	if err := storage.Save("k", []byte("hello world"), Meta{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.Checksum("k", "sha256"); err != nil {
+		t.Fatal(err)
+	}
+	// Перезапись сбрасывает суммы прежнего содержимого
+	if err := storage.Replace("k", []byte("abc"), "*", Meta{}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := storage.Checksum("k", "sha256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"; got != want {
+		t.Errorf("sha256 after replace = %s, want %s", got, want)
+	}
+}
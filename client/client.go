@@ -0,0 +1,110 @@
+// Package client — клиент для кластера серверов хранилища.
+// Ключ объекта консистентно хэшируется на один из серверов, и все операции
+// с этим ключом выполняются на нём.
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var (
+	ErrNotFound = errors.New("object not found")         // Объекта нет на сервере
+	ErrExists   = errors.New("object already exists")    // Объект с таким ключом уже загружен
+	ErrNoNodes  = errors.New("no servers in the client") // В клиенте не задано ни одного сервера
+)
+
+// Client — клиент кластера серверов хранилища
+type Client struct {
+	Ring *Ring        // Кольцо серверов; серверы можно добавлять и убирать на ходу
+	HTTP *http.Client // HTTP-клиент для запросов к серверам
+}
+
+// New — конструктор клиента для серверов с адресами вида "http://host:8080"
+func New(servers ...string) *Client {
+	return &Client{
+		Ring: NewRing(DEFAULT_REPLICAS, servers...),
+		HTTP: http.DefaultClient,
+	}
+}
+
+// Upload — загружает объект на сервер, отвечающий за ключ
+func (c *Client) Upload(ctx context.Context, key string, data io.Reader) error {
+	resp, err := c.do(ctx, http.MethodPost, "/upload/", key, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return nil
+	case http.StatusConflict:
+		return ErrExists
+	default:
+		return statusError(resp)
+	}
+}
+
+// Download — скачивает объект; вызывающий обязан закрыть возвращённый поток
+func (c *Client) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/download/", key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrNotFound
+	default:
+		defer resp.Body.Close()
+		return nil, statusError(resp)
+	}
+}
+
+// Delete — удаляет объект с сервера, отвечающего за ключ
+func (c *Client) Delete(ctx context.Context, key string) error {
+	resp, err := c.do(ctx, http.MethodDelete, "/delete/", key, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		return nil
+	case http.StatusNotFound:
+		return ErrNotFound
+	default:
+		return statusError(resp)
+	}
+}
+
+// do — выполняет запрос к серверу, отвечающему за ключ
+func (c *Client) do(ctx context.Context, method, route, key string, body io.Reader) (*http.Response, error) {
+	server := c.Ring.Node(key)
+	if server == "" {
+		return nil, ErrNoNodes
+	}
+
+	u := strings.TrimSuffix(server, "/") + route + url.PathEscape(key)
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	return c.HTTP.Do(req)
+}
+
+// statusError — ошибка для неожиданного ответа сервера
+func statusError(resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("%s %s: %s: %s", resp.Request.Method, resp.Request.URL, resp.Status, strings.TrimSpace(string(msg)))
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeServer — сервер хранилища в памяти с маршрутами /upload/, /download/ и /delete/
+func fakeServer(t *testing.T) (*httptest.Server, map[string]string) {
+	var mu sync.Mutex
+	objects := make(map[string]string)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		route, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		_, exists := objects[key]
+		switch {
+		case route == "upload" && exists:
+			w.WriteHeader(http.StatusConflict)
+		case route == "upload":
+			data, _ := io.ReadAll(r.Body)
+			objects[key] = string(data)
+			w.WriteHeader(http.StatusCreated)
+		case !exists:
+			w.WriteHeader(http.StatusNotFound)
+		case route == "download":
+			io.WriteString(w, objects[key])
+		case route == "delete":
+			delete(objects, key)
+		default:
+			http.Error(w, "Неизвестный маршрут", http.StatusTeapot)
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return ts, objects
+}
+
+func TestClient(t *testing.T) {
+	a, onA := fakeServer(t)
+	b, onB := fakeServer(t)
+	c := New(a.URL, b.URL)
+	ctx := context.Background()
+
+	keys := []string{"one", "two", "three", "four", "dir/five"}
+	for _, key := range keys {
+		if err := c.Upload(ctx, key, strings.NewReader("data "+key)); err != nil {
+			t.Fatalf("Upload(%s): %v", key, err)
+		}
+	}
+	// Каждый объект лежит ровно на том сервере, который ему назначает кольцо
+	for _, key := range keys {
+		want, other := onA, onB
+		if c.Ring.Node(key) == b.URL {
+			want, other = onB, onA
+		}
+		if _, ok := want[key]; !ok {
+			t.Errorf("%s is not on its node %s", key, c.Ring.Node(key))
+		}
+		if _, ok := other[key]; ok {
+			t.Errorf("%s is also on the other node", key)
+		}
+	}
+
+	tests := []struct {
+		name string
+		op   func() error
+		want error
+	}{
+		{"upload existing", func() error { return c.Upload(ctx, "one", strings.NewReader("x")) }, ErrExists},
+		{"download", func() error {
+			body, err := c.Download(ctx, "dir/five")
+			if err != nil {
+				return err
+			}
+			defer body.Close()
+			if data, _ := io.ReadAll(body); string(data) != "data dir/five" {
+				return errors.New("unexpected body " + string(data))
+			}
+			return nil
+		}, nil},
+		{"download missing", func() error { _, err := c.Download(ctx, "missing"); return err }, ErrNotFound},
+		{"delete", func() error { return c.Delete(ctx, "one") }, nil},
+		{"delete again", func() error { return c.Delete(ctx, "one") }, ErrNotFound},
+		{"no nodes", func() error { return New().Delete(ctx, "one") }, ErrNoNodes},
+	}
+	for _, tt := range tests {
+		if err := tt.op(); !errors.Is(err, tt.want) {
+			t.Errorf("%s: %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package client
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+const DEFAULT_REPLICAS = 100 // ЧИСЛО ВИРТУАЛЬНЫХ УЗЛОВ НА СЕРВЕР ДЛЯ РАВНОМЕРНОГО РАСПРЕДЕЛЕНИЯ
+
+// Ring — кольцо консистентного хэширования. Каждый сервер представлен
+// несколькими виртуальными узлами, поэтому ключи распределяются равномерно,
+// а при добавлении или удалении сервера переезжает лишь малая часть ключей.
+type Ring struct {
+	mu       sync.RWMutex      // Мьютекс для обеспечения потокобезопасности
+	replicas int               // Число виртуальных узлов на сервер
+	hashes   []uint32          // Отсортированные хэши виртуальных узлов
+	nodes    map[uint32]string // Сервер, которому принадлежит виртуальный узел
+}
+
+// NewRing — конструктор кольца; replicas <= 0 означает DEFAULT_REPLICAS
+func NewRing(replicas int, nodes ...string) *Ring {
+	if replicas <= 0 {
+		replicas = DEFAULT_REPLICAS
+	}
+	r := &Ring{replicas: replicas, nodes: make(map[uint32]string)}
+	r.Add(nodes...)
+	return r
+}
+
+// Add — добавляет серверы в кольцо
+func (r *Ring) Add(nodes ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, node := range nodes {
+		for i := 0; i < r.replicas; i++ {
+			h := hashKey(node + "#" + strconv.Itoa(i))
+			if _, taken := r.nodes[h]; !taken {
+				r.hashes = append(r.hashes, h)
+			}
+			r.nodes[h] = node
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+}
+
+// Remove — убирает сервер из кольца
+func (r *Ring) Remove(node string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	hashes := r.hashes[:0]
+	for _, h := range r.hashes {
+		if r.nodes[h] == node {
+			delete(r.nodes, h)
+			continue
+		}
+		hashes = append(hashes, h)
+	}
+	r.hashes = hashes
+}
+
+// Node — сервер, отвечающий за ключ; пустая строка, если кольцо пустое
+func (r *Ring) Node(key string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.hashes) == 0 {
+		return ""
+	}
+	// Ближайший по часовой стрелке виртуальный узел
+	h := hashKey(key)
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.nodes[r.hashes[i]]
+}
+
+// hashKey — хэш строки для размещения на кольце. MD5 перемешивает похожие
+// строки заметно равномернее, чем CRC32.
+func hashKey(s string) uint32 {
+	sum := md5.Sum([]byte(s))
+	return binary.BigEndian.Uint32(sum[:4])
+}
@@ -0,0 +1,95 @@
+package client
+
+import (
+	"strconv"
+	"testing"
+)
+
+// testKeys — n различных ключей для проверки распределения
+func testKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = "object-" + strconv.Itoa(i)
+	}
+	return keys
+}
+
+func TestRingEmpty(t *testing.T) {
+	r := NewRing(0)
+	if node := r.Node("key"); node != "" {
+		t.Errorf("empty ring: Node = %q, want empty", node)
+	}
+	r.Add("a")
+	r.Remove("a")
+	if node := r.Node("key"); node != "" {
+		t.Errorf("ring after removing its only node: Node = %q, want empty", node)
+	}
+}
+
+func TestRingDistribution(t *testing.T) {
+	tests := []struct {
+		replicas int
+		nodes    []string
+	}{
+		{0, []string{"a", "b"}},
+		{DEFAULT_REPLICAS, []string{"a", "b", "c"}},
+		{200, []string{"a", "b", "c", "d", "e"}},
+	}
+	keys := testKeys(10000)
+	for _, tt := range tests {
+		r := NewRing(tt.replicas, tt.nodes...)
+		counts := make(map[string]int)
+		for _, key := range keys {
+			node := r.Node(key)
+			if node != r.Node(key) {
+				t.Fatalf("%d nodes: key %s maps to different nodes", len(tt.nodes), key)
+			}
+			counts[node]++
+		}
+		// Каждому серверу достаётся не меньше половины равной доли
+		for _, node := range tt.nodes {
+			if min := len(keys) / len(tt.nodes) / 2; counts[node] < min {
+				t.Errorf("%d nodes, %d replicas: %s got %d keys, want at least %d", len(tt.nodes), tt.replicas, node, counts[node], min)
+			}
+		}
+	}
+}
+
+func TestRingRebalance(t *testing.T) {
+	keys := testKeys(10000)
+	r := NewRing(DEFAULT_REPLICAS, "a", "b", "c")
+	before := make(map[string]string, len(keys))
+	for _, key := range keys {
+		before[key] = r.Node(key)
+	}
+
+	// Новый сервер забирает ключи только себе, остальные остаются на месте
+	r.Add("d")
+	moved := 0
+	for _, key := range keys {
+		if node := r.Node(key); node != before[key] {
+			moved++
+			if node != "d" {
+				t.Fatalf("after adding d: key %s moved from %s to %s", key, before[key], node)
+			}
+		}
+	}
+	if moved == 0 || moved > len(keys)/2 {
+		t.Errorf("after adding d: %d of %d keys moved", moved, len(keys))
+	}
+
+	// После удаления сервера ключи возвращаются на прежние места
+	r.Remove("d")
+	for _, key := range keys {
+		if node := r.Node(key); node != before[key] {
+			t.Fatalf("after removing d: key %s on %s, want %s", key, node, before[key])
+		}
+	}
+	// Переезжают только ключи удалённого сервера
+	r.Remove("b")
+	for _, key := range keys {
+		if node := r.Node(key); before[key] != "b" && node != before[key] {
+			t.Fatalf("after removing b: key %s moved from %s to %s", key, before[key], node)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+const (
+	ENCODING_BR       = "br"   // СЖАТИЕ BROTLI: ЛУЧШЕ ЖМЁТ ТЕКСТ, ПРЕДПОЧИТАЕТСЯ
+	ENCODING_GZIP     = "gzip" // СЖАТИЕ GZIP: ПОНИМАЮТ ВСЕ КЛИЕНТЫ
+	COMPRESS_MIN_SIZE = 1024   // ОБЪЕКТЫ МЕНЬШЕ ЭТОГО РАЗМЕРА В БАЙТАХ НЕ СЖИМАЮТСЯ
+)
+
+// compressibleTypes — нетекстовые типы, которые стоит сжимать; text/* сжимается всегда.
+// Изображения, архивы и видео уже сжаты, повторное сжатие только тратит процессор
+var compressibleTypes = map[string]bool{
+	"application/json":       true,
+	"application/javascript": true,
+	"application/xml":        true,
+	"application/wasm":       true,
+	"image/svg+xml":          true,
+}
+
+// compressible — стоит ли сжимать содержимое этого типа
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") || compressibleTypes[mediaType] ||
+		strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml")
+}
+
+// negotiateEncoding — выбирает сжатие по Accept-Encoding: br или gzip с наибольшим
+// весом q, при равных весах — br. Пусто — клиент не принимает ни того, ни другого.
+func negotiateEncoding(r *http.Request) string {
+	weights := map[string]float64{}
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "*" {
+			for _, enc := range []string{ENCODING_BR, ENCODING_GZIP} {
+				if _, listed := weights[enc]; !listed {
+					weights[enc] = q
+				}
+			}
+			continue
+		}
+		weights[name] = q
+	}
+	best, bestQ := "", 0.0
+	for _, enc := range []string{ENCODING_BR, ENCODING_GZIP} {
+		if q := weights[enc]; q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	return best
+}
+
+// encoder — сжимающий поток, который умеет отправлять накопленное без закрытия
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// compressWriter — ответ, тело которого сжимается выбранным алгоритмом. Сжимаются
+// только ответы 200: у 304 нет тела, а диапазоны (206) отдаются без сжатия.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	enc         encoder // nil — тело идёт без сжатия
+	wroteHeader bool
+}
+
+// newCompressWriter — оборачивает ответ сжатием encoding (ENCODING_BR или ENCODING_GZIP)
+func newCompressWriter(w http.ResponseWriter, encoding string) *compressWriter {
+	return &compressWriter{ResponseWriter: w, encoding: encoding}
+}
+
+func (c *compressWriter) WriteHeader(status int) {
+	if c.wroteHeader {
+		return
+	}
+	c.wroteHeader = true
+	if status == http.StatusOK {
+		// Длина сжатого тела заранее неизвестна
+		c.Header().Del("Content-Length")
+		c.Header().Set("Content-Encoding", c.encoding)
+		if c.encoding == ENCODING_BR {
+			c.enc = brotli.NewWriter(c.ResponseWriter)
+		} else {
+			c.enc = gzip.NewWriter(c.ResponseWriter)
+		}
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *compressWriter) Write(p []byte) (int, error) {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.enc != nil {
+		return c.enc.Write(p)
+	}
+	return c.ResponseWriter.Write(p)
+}
+
+// Flush — отправляет клиенту всё, что уже сжато
+func (c *compressWriter) Flush() {
+	if c.enc != nil {
+		c.enc.Flush()
+	}
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close — дописывает конец сжатого потока
+func (c *compressWriter) Close() error {
+	if c.enc != nil {
+		return c.enc.Close()
+	}
+	return nil
+}
+
+// Unwrap — даёт http.ResponseController добраться до исходного ответа
+func (c *compressWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		accept, want string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", ENCODING_GZIP},
+		{"gzip, br", ENCODING_BR},
+		{"br;q=0.5, gzip", ENCODING_GZIP},
+		{"GZIP;q=0.8, deflate", ENCODING_GZIP},
+		{"br;q=0, gzip;q=0", ""},
+		{"*", ENCODING_BR},
+		{"br;q=0, *", ENCODING_GZIP},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Encoding", tt.accept)
+		if got := negotiateEncoding(r); got != tt.want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+// decompress — распаковывает тело ответа по его Content-Encoding
+func decompress(t *testing.T, encoding, body string) string {
+	t.Helper()
+	var r io.Reader = strings.NewReader(body)
+	switch encoding {
+	case ENCODING_BR:
+		r = brotli.NewReader(r)
+	case ENCODING_GZIP:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = gz
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("decompressing %s: %v", encoding, err)
+	}
+	return string(data)
+}
+
+func TestCompressDownload(t *testing.T) {
+	ts, _ := newTestServer(t, "-compress")
+	text := strings.Repeat("сжимаемый текст ", 100)
+	upload(t, ts, "large.txt", text)
+	upload(t, ts, "small.txt", "короткий текст")
+	upload(t, ts, "large.bin", text, "Content-Type", "application/octet-stream")
+	resp, _ := do(t, ts, http.MethodGet, "/download/large.txt", "", "Accept-Encoding", "identity")
+	etag := resp.Header.Get("ETag")
+
+	tests := []struct {
+		name     string
+		key      string
+		header   []string
+		encoding string
+	}{
+		{"brotli", "large.txt", []string{"Accept-Encoding", "gzip, br"}, ENCODING_BR},
+		{"gzip", "large.txt", []string{"Accept-Encoding", "gzip"}, ENCODING_GZIP},
+		{"not accepted", "large.txt", []string{"Accept-Encoding", "identity"}, ""},
+		// Range относится к несжатому содержимому
+		{"range", "large.txt", []string{"Accept-Encoding", "gzip", "Range", "bytes=0-9"}, ""},
+		{"too small", "small.txt", []string{"Accept-Encoding", "gzip"}, ""},
+		{"binary", "large.bin", []string{"Accept-Encoding", "gzip"}, ""},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, ts, http.MethodGet, "/download/"+tt.key, "", tt.header...)
+		if got := resp.Header.Get("Content-Encoding"); got != tt.encoding {
+			t.Errorf("%s: Content-Encoding %q, want %q", tt.name, got, tt.encoding)
+			continue
+		}
+		if tt.encoding == "" {
+			continue
+		}
+		if got := decompress(t, tt.encoding, body); got != text {
+			t.Errorf("%s: decompressed body differs from the object", tt.name)
+		}
+		// У сжатого ответа свой ETag, а кэши различают ответы по Accept-Encoding
+		if resp.Header.Get("ETag") == etag || resp.Header.Get("Vary") != "Accept-Encoding" {
+			t.Errorf("%s: ETag %s, Vary %q", tt.name, resp.Header.Get("ETag"), resp.Header.Get("Vary"))
+		}
+	}
+
+	// Без -compress объекты отдаются как есть
+	ts, _ = newTestServer(t)
+	upload(t, ts, "large.txt", text)
+	if resp, _ := do(t, ts, http.MethodGet, "/download/large.txt", "", "Accept-Encoding", "br"); resp.Header.Get("Content-Encoding") != "" {
+		t.Errorf("compressed without -compress: %s", resp.Header.Get("Content-Encoding"))
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// etagMatchesWeak — слабое сравнение ETag для If-None-Match: W/"x" и "x" совпадают
+func etagMatchesWeak(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// modifiedAfter — изменён ли объект позже даты из заголовка. Даты в HTTP с точностью
+// до секунды, поэтому и время изменения сравнивается без долей секунды.
+func modifiedAfter(modTime time.Time, header string) (bool, bool) {
+	t, err := http.ParseTime(header)
+	if err != nil || modTime.IsZero() {
+		return false, false
+	}
+	return modTime.Truncate(time.Second).After(t), true
+}
+
+// checkConditions — проверяет условные заголовки запроса в порядке RFC 7232 (раздел 6):
+// If-Unmodified-Since учитывается, только если нет If-Match, а If-Modified-Since —
+// только если нет If-None-Match, то есть при обоих заголовках решает ETag.
+// Возвращает 0, если объект нужно отдать, иначе статус ответа: 304 или 412.
+func checkConditions(r *http.Request, etag string, modTime time.Time) int {
+	read := r.Method == http.MethodGet || r.Method == http.MethodHead
+	if im := r.Header.Get("If-Match"); im != "" {
+		// Сильное сравнение: наши ETag не бывают слабыми, а W/ в заголовке с ними не совпадёт
+		if etag == "" || !etagMatches(im, etag) {
+			return http.StatusPreconditionFailed
+		}
+	} else if ius := r.Header.Get("If-Unmodified-Since"); ius != "" {
+		if after, ok := modifiedAfter(modTime, ius); ok && after {
+			return http.StatusPreconditionFailed
+		}
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if etag != "" && etagMatchesWeak(inm, etag) {
+			if read {
+				return http.StatusNotModified
+			}
+			return http.StatusPreconditionFailed
+		}
+	} else if ims := r.Header.Get("If-Modified-Since"); ims != "" && read {
+		if after, ok := modifiedAfter(modTime, ims); ok && !after {
+			return http.StatusNotModified
+		}
+	}
+	return 0
+}
+
+// writeConditional — отвечает на невыполненное условие: 304 без тела и его заголовков
+// или 412 с описанием
+func writeConditional(w http.ResponseWriter, status int, modTime time.Time) {
+	if status != http.StatusNotModified {
+		http.Error(w, "Условие запроса не выполнено", status)
+		return
+	}
+	h := w.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	h.Del("Content-Encoding")
+	h.Del("Content-Disposition")
+	// Last-Modified нужен, только если клиент сверяет объект по дате, а не по ETag
+	if h.Get("ETag") == "" && !modTime.IsZero() {
+		h.Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+	w.WriteHeader(http.StatusNotModified)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestConditionalDownload(t *testing.T) {
+	ts, _ := newTestServer(t)
+	upload(t, ts, "obj", "data")
+	resp, _ := do(t, ts, http.MethodHead, "/download/obj", "")
+	etag, modified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if etag == "" || modified == "" {
+		t.Fatalf("download lacks validators: ETag %q, Last-Modified %q", etag, modified)
+	}
+	const (
+		older = "Mon, 02 Jan 2006 15:04:05 GMT"
+		later = "Mon, 02 Jan 2040 15:04:05 GMT"
+	)
+
+	tests := []struct {
+		name   string
+		method string
+		header []string
+		status int
+	}{
+		{"If-None-Match matching", http.MethodGet, []string{"If-None-Match", etag}, http.StatusNotModified},
+		{"If-None-Match weak", http.MethodGet, []string{"If-None-Match", "W/" + etag}, http.StatusNotModified},
+		{"If-None-Match one of", http.MethodGet, []string{"If-None-Match", `"0123", ` + etag}, http.StatusNotModified},
+		{"If-None-Match *", http.MethodGet, []string{"If-None-Match", "*"}, http.StatusNotModified},
+		{"If-None-Match stale", http.MethodGet, []string{"If-None-Match", `"0123"`}, http.StatusOK},
+		{"If-None-Match HEAD", http.MethodHead, []string{"If-None-Match", etag}, http.StatusNotModified},
+		{"If-Modified-Since same", http.MethodGet, []string{"If-Modified-Since", modified}, http.StatusNotModified},
+		{"If-Modified-Since later", http.MethodGet, []string{"If-Modified-Since", later}, http.StatusNotModified},
+		{"If-Modified-Since older", http.MethodGet, []string{"If-Modified-Since", older}, http.StatusOK},
+		{"If-Modified-Since invalid", http.MethodGet, []string{"If-Modified-Since", "yesterday"}, http.StatusOK},
+		// При If-None-Match дата не учитывается
+		{"stale ETag, later date", http.MethodGet, []string{"If-None-Match", `"0123"`, "If-Modified-Since", later}, http.StatusOK},
+		{"matching ETag, older date", http.MethodGet, []string{"If-None-Match", etag, "If-Modified-Since", older}, http.StatusNotModified},
+		{"If-Match matching", http.MethodGet, []string{"If-Match", etag}, http.StatusOK},
+		{"If-Match *", http.MethodGet, []string{"If-Match", "*"}, http.StatusOK},
+		{"If-Match stale", http.MethodGet, []string{"If-Match", `"0123"`}, http.StatusPreconditionFailed},
+		// If-Match сравнивает ETag строго
+		{"If-Match weak", http.MethodGet, []string{"If-Match", "W/" + etag}, http.StatusPreconditionFailed},
+		{"If-Unmodified-Since older", http.MethodGet, []string{"If-Unmodified-Since", older}, http.StatusPreconditionFailed},
+		{"If-Unmodified-Since later", http.MethodGet, []string{"If-Unmodified-Since", later}, http.StatusOK},
+		// При If-Match дата не учитывается
+		{"matching ETag, unmodified since older", http.MethodGet, []string{"If-Match", etag, "If-Unmodified-Since", older}, http.StatusOK},
+		// If-Match проверяется раньше If-None-Match
+		{"If-Match stale, If-None-Match matching", http.MethodGet, []string{"If-Match", `"0123"`, "If-None-Match", etag}, http.StatusPreconditionFailed},
+		{"If-Match matching, If-None-Match matching", http.MethodGet, []string{"If-Match", etag, "If-None-Match", etag}, http.StatusNotModified},
+	}
+	downloads := int64(0)
+	for _, tt := range tests {
+		resp, body := do(t, ts, tt.method, "/download/obj", "", tt.header...)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: %d, want %d", tt.name, resp.StatusCode, tt.status)
+			continue
+		}
+		switch {
+		case tt.status == http.StatusNotModified:
+			if body != "" || resp.Header.Get("ETag") != etag {
+				t.Errorf("%s: 304 with body %q, ETag %q", tt.name, body, resp.Header.Get("ETag"))
+			}
+		case tt.status == http.StatusOK && tt.method == http.MethodGet:
+			if body != "data" {
+				t.Errorf("%s: body %q", tt.name, body)
+			}
+			downloads++
+		}
+	}
+	// Ответы 304 и 412 объект не отдают и скачиваниями не считаются
+	if got := statDownloads(t, ts, "obj"); got != downloads {
+		t.Errorf("downloads = %d, want %d", got, downloads)
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// REDACTED — ЧЕМ ЗАМЕНЯЮТСЯ СЕКРЕТЫ В ВЫВОДЕ КОНФИГУРАЦИИ
+const REDACTED = "***"
+
+// Config — настройки сервера, задаваемые флагами командной строки
+type Config struct {
+	MaxUploads      int               // Максимум одновременных загрузок (0 — без ограничений)
+	MaxDownloads    int               // Максимум одновременных скачиваний (0 — без ограничений)
+	MaxPerClient    int               // Максимум одновременных загрузок или скачиваний одного клиента (0 — без ограничений)
+	MaxConnections  int               // Максимум одновременно открытых соединений (0 — без ограничений)
+	MaxObjectSize   int64             // Максимальный размер объекта в байтах после распаковки (0 — без ограничений)
+	MaxUploadMemory int64             // Общий предел памяти под тела выполняемых загрузок в байтах (0 — без ограничений)
+	DiskQuota       int64             // Предел суммарного размера объектов на диске в байтах (0 — без квоты)
+	MaxListResults  int               // Сколько объектов отдаёт один запрос /list (0 — без ограничений)
+	MaxTags         int               // Максимум тегов у объекта
+	MaxTagKeyLen    int               // Максимальная длина имени тега в байтах
+	MaxTagValueLen  int               // Максимальная длина значения тега в байтах
+	MaxMetaSize     int               // Максимум байт задаваемых метаданных объекта вместе
+	CacheSize       int64             // Ёмкость кэша объектов в памяти в байтах (0 — без ограничений)
+	CacheThreshold  int64             // Объекты больше этого размера не кэшируются в памяти (0 — без ограничений)
+	CachePolicy     string            // Политика вытеснения из кэша: lru, lfu или fifo
+	CacheReport     time.Duration     // Как часто писать в журнал заполнение кэша (0 — не писать)
+	CacheWatermark  int               // При каком проценте ёмкости кэша предупреждать в журнале
+	CachePin        []string          // Ключи объектов, которые никогда не вытесняются из кэша
+	MaxKeyDepth     int               // Максимум частей вложенного ключа через "/"
+	KeyTemplate     string            // Шаблон ключей для загрузок без ключа (POST /upload)
+	ShardWidth      int               // Число hex-символов хэша ключа в имени поддиректории (0 — плоская раскладка)
+	BloomKeys       int               // Расчётное число ключей для фильтра Блума (0 — фильтр выключен)
+	NegativeTTL     time.Duration     // Сколько помнить, что ключа нет на диске (0 — не помнить)
+	ChangeLogSize   int               // Сколько последних изменений объектов помнит /changelog (0 — выключено)
+	PersistChanges  bool              // Сохранять журнал изменений в файл, чтобы он пережил перезапуск
+	APIKey          string            // API-ключ для изменяющих запросов и подписи ссылок (пусто — без авторизации)
+	Users           map[string]string // Ключи пользователей по их именам, для прав доступа к объектам
+	CORSOrigins     []string          // Источники, которым разрешены запросы из браузера
+	NormalizeKeys   []string          // Нормализация ключей: lower и/или nfc (пусто — ключи как есть)
+	InlineTypes     []string          // Типы содержимого, которые браузер показывает, а не скачивает
+	DefaultType     string            // Тип объекта, если ни расширение, ни содержимое его не выдают
+	AllowedTypes    []string          // Типы содержимого ("image/png") и группы ("image/*"), которые можно загружать
+	CoalesceLoads   bool              // Объединять одновременные чтения одного ключа с диска
+	Consistency     string            // Что верно при расхождении кэша с диском: disk или cache
+	IndexKey        string            // Объект, отдаваемый как стартовая страница (пусто — список маршрутов)
+	VirtualHosts    map[string]string // Поддиректории хранилища по хостам запросов (пусто — без виртуальных хостов)
+	Backend         string            // Где хранится содержимое объектов: fs, memory или s3
+	S3Endpoint      string            // Адрес S3-хранилища для -backend s3
+	S3Bucket        string            // Бакет S3-хранилища для объектов
+	S3AccessKey     string            // Ключ доступа к S3-хранилищу (пусто — без подписи запросов)
+	S3SecretKey     string            // Секретный ключ к S3-хранилищу
+	StorageDir      string            // Директория для хранения объектов
+	TypeRoutes      []TypeRoute       // Директории для объектов по типу содержимого (пусто — всё в StorageDir)
+	TempDir         string            // Директория для временных файлов и незавершённых загрузок
+	TempMaxAge      time.Duration     // Временные файлы старше этого возраста удаляются (0 — не удаляются)
+	Scanner         string            // Проверка содержимого загрузок: none или eicar
+	StreamBuffer    int               // Буфер отдачи объектов в байтах (0 — без своего буфера)
+	DownloadRate    int64             // Скорость одного скачивания в байтах в секунду (0 — без ограничения)
+	StreamFlush     time.Duration     // Как часто отправлять буфер отдачи клиенту (0 — при заполнении)
+	Compress        bool              // Сжимать текстовые объекты при скачивании (br или gzip по Accept-Encoding)
+	SlowRequest     time.Duration     // Запросы дольше этого времени попадают в журнал с предупреждением (0 — выключено)
+	AccessLogSample int               // Писать в журнал каждый N-й успешный запрос и все ошибки (0 — журнал запросов выключен)
+	LogKeys         string            // Как писать ключи объектов в журнал: full или hash
+	ShutdownTimeout time.Duration     // Сколько ждать завершения запросов при остановке, затем они прерываются
+	SelfTest        bool              // Выполнить самопроверку хранилища и завершиться
+	WriteBack       bool              // Режим отложенной записи: объекты пишутся на диск в фоне
+	FlushInterval   time.Duration     // Период сброса отложенной записи на диск (0 — сразу после каждой записи)
+	SealAfter       time.Duration     // Через сколько после последней записи объект становится только для чтения (0 — никогда)
+	ExpirySweep     time.Duration     // Как часто удалять объекты с истёкшим Expires (0 — только при обращении)
+	CountFlush      time.Duration     // Как часто сохранять счётчики скачиваний в метаданные (0 — только при остановке)
+	MinTTL          time.Duration     // Кратчайший срок жизни, который можно задать заголовком Expires (0 — любой)
+	MaxTTL          time.Duration     // Длиннейший срок жизни, который можно задать заголовком Expires (0 — любой)
+	TTLBounds       string            // Что делать со сроком вне пределов: TTL_REJECT или TTL_CLAMP
+}
+
+// ParseConfig — разбирает аргументы командной строки в конфигурацию сервера
+func ParseConfig(args []string) (*Config, error) {
+	cfg := &Config{}
+	fs := flag.NewFlagSet("storage_server", flag.ContinueOnError)
+	fs.IntVar(&cfg.MaxUploads, "max-uploads", 0, "максимум одновременных загрузок (0 — без ограничений)")
+	fs.IntVar(&cfg.MaxDownloads, "max-downloads", 0, "максимум одновременных скачиваний (0 — без ограничений)")
+	fs.IntVar(&cfg.MaxPerClient, "max-per-client", 0, "максимум одновременных загрузок и отдельно скачиваний одного клиента — по имени или IP-адресу (0 — без ограничений)")
+	fs.IntVar(&cfg.MaxConnections, "max-connections", 0, "максимум одновременно открытых соединений; новые соединения ждут, пока не закроется одно из открытых (0 — без ограничений)")
+	fs.Int64Var(&cfg.MaxObjectSize, "max-object-size", 0, "максимальный размер объекта в байтах; для загрузок с Content-Encoding: gzip — после распаковки (0 — без ограничений)")
+	fs.Int64Var(&cfg.MaxUploadMemory, "max-upload-memory", 0, "общий предел памяти в байтах под тела всех выполняемых загрузок, читаемых в память; не поместившиеся получают 503 (0 — без ограничений)")
+	fs.Int64Var(&cfg.DiskQuota, "disk-quota", 0, "предел суммарного размера объектов на диске в байтах; загрузки сверх него получают 507, ?checkQuota=<размер> проверяет загрузку заранее (0 — без квоты)")
+	fs.IntVar(&cfg.MaxListResults, "max-list-results", LIST_MAX_RESULTS, "сколько объектов отдаёт один запрос /list, остальные — следующими страницами с ?marker= (0 — без ограничений)")
+	fs.IntVar(&cfg.MaxTags, "max-tags", MAX_TAGS, "максимум тегов у объекта в PATCH /meta/")
+	fs.IntVar(&cfg.MaxTagKeyLen, "max-tag-key-len", MAX_TAG_KEY_LEN, "максимальная длина имени тега в байтах")
+	fs.IntVar(&cfg.MaxTagValueLen, "max-tag-value-len", MAX_TAG_VALUE_LEN, "максимальная длина значения тега в байтах")
+	fs.IntVar(&cfg.MaxMetaSize, "max-meta-size", MAX_META_SIZE, "максимум байт типа содержимого, Cache-Control, перенаправления и тегов объекта вместе; больше — 400")
+	fs.Int64Var(&cfg.CacheSize, "cache-size", 0, "ёмкость кэша объектов в памяти в байтах, при переполнении вытесняются давно не использованные (0 — без ограничений)")
+	fs.Int64Var(&cfg.CacheThreshold, "cache-threshold", 0, "объекты больше этого размера в байтах пишутся сразу на диск и не кэшируются (0 — без ограничений)")
+	fs.StringVar(&cfg.CachePolicy, "cache-policy", EVICT_LRU, "политика вытеснения из кэша: lru — давно не использованные, lfu — редко используемые, fifo — в порядке добавления")
+	fs.DurationVar(&cfg.CacheReport, "cache-report", 0, "как часто писать в журнал заполнение кэша; при -cache-size также предупреждать о достижении -cache-watermark (0 — не писать)")
+	fs.IntVar(&cfg.CacheWatermark, "cache-watermark", CACHE_WATERMARK, "при каком заполнении кэша в процентах от -cache-size писать предупреждение")
+	fs.StringVar(&cfg.KeyTemplate, "key-template", KEY_TEMPLATE_RANDOM, "шаблон ключей, которые сервер назначает загрузке без ключа (POST /upload): random — 32 hex-символа, uuid, timestamp — время загрузки и случайный суффикс, hash — SHA-256 содержимого, date — 2024/01/15/<uuid>")
+	fs.IntVar(&cfg.MaxKeyDepth, "max-key-depth", MAX_KEY_DEPTH, "максимум частей вложенного ключа через /, более глубокие ключи отклоняются с 400")
+	fs.IntVar(&cfg.ShardWidth, "shard-width", 0, "раскладывать объекты по поддиректориям из первых N hex-символов хэша ключа (0 — плоская раскладка)")
+	fs.IntVar(&cfg.BloomKeys, "bloom-keys", 1000000, "расчётное число ключей для фильтра Блума, отсекающего запросы отсутствующих объектов (0 — выключен)")
+	fs.IntVar(&cfg.ChangeLogSize, "changelog-size", CHANGELOG_SIZE, "сколько последних созданий, перезаписей и удалений объектов отдаёт /changelog, более старые вытесняются (0 — журнал выключен)")
+	fs.BoolVar(&cfg.PersistChanges, "changelog-persist", false, "сохранять журнал изменений в "+CHANGELOG_FILE+" в -storage-dir, чтобы он пережил перезапуск (каждое изменение перезаписывает файл)")
+	fs.DurationVar(&cfg.NegativeTTL, "negative-ttl", 0, "помнить не найденные на диске ключи этот срок, например 2s, и не искать их повторно; созданный сервером объект виден сразу, добавленный в обход — через этот срок (0 — выключено)")
+	fs.BoolVar(&cfg.WriteBack, "write-back", false, "отложенная запись: объекты сохраняются на диск в фоне, POST /admin/flush дожидается записи")
+	fs.DurationVar(&cfg.FlushInterval, "flush-interval", 0, "в режиме -write-back сбрасывать накопленные записи на диск раз в этот интервал, например 1s, или раньше при "+fmt.Sprint(WRITE_BACK_MAX_PENDING)+" объектах в очереди (0 — сразу после каждой записи)")
+	fs.BoolVar(&cfg.CoalesceLoads, "coalesce-loads", true, "одновременные запросы одного отсутствующего в кэше объекта читают диск один раз")
+	fs.StringVar(&cfg.Consistency, "consistency", CONSISTENCY_DISK, "что верно, если файл на диске изменили в обход сервера и он расходится с кэшем: disk — перечитать, cache — отдавать из кэша")
+	fs.StringVar(&cfg.IndexKey, "index-key", "", "объект, отдаваемый по запросу / как стартовая страница (пусто — список маршрутов)")
+	fs.DurationVar(&cfg.SealAfter, "seal-after", 0, "объект становится только для чтения через этот срок после последней записи, например 24h; изменить его может администратор с "+SEAL_OVERRIDE_HEADER+": true (0 — никогда)")
+	fs.DurationVar(&cfg.MinTTL, "min-ttl", 0, "кратчайший срок жизни объекта, который можно задать заголовком Expires при загрузке, например 1m (0 — без предела)")
+	fs.DurationVar(&cfg.MaxTTL, "max-ttl", 0, "длиннейший срок жизни объекта, который можно задать заголовком Expires при загрузке, например 720h (0 — без предела); объекты без Expires остаются бессрочными")
+	fs.StringVar(&cfg.TTLBounds, "ttl-bounds", TTL_REJECT, "что делать с Expires вне -min-ttl и -max-ttl: reject — отвечать 400, clamp — сдвигать срок к ближайшему пределу")
+	fs.DurationVar(&cfg.ExpirySweep, "expiry-sweep", EXPIRY_SWEEP, "как часто удалять объекты, срок которых, заданный заголовком Expires при загрузке, истёк; такие объекты не отдаются и до удаления (0 — удалять только при обращении)")
+	fs.DurationVar(&cfg.CountFlush, "download-count-flush", DOWNLOAD_COUNT_FLUSH, "как часто сохранять накопленные счётчики скачиваний в метаданные объектов (0 — только при остановке сервера)")
+	fs.StringVar(&cfg.Backend, "backend", BACKEND_FS, "где хранить содержимое объектов: fs — файлы в -storage-dir, memory — только в памяти до перезапуска, s3 — во внешнем S3-хранилище (-s3-endpoint, -s3-bucket); метаданные и служебные файлы всегда в -storage-dir")
+	fs.StringVar(&cfg.S3Endpoint, "s3-endpoint", "", "адрес S3-хранилища для -backend s3, например https://s3.example.com")
+	fs.StringVar(&cfg.S3Bucket, "s3-bucket", "", "бакет S3-хранилища, в котором хранятся объекты при -backend s3")
+	fs.StringVar(&cfg.S3AccessKey, "s3-access-key", "", "ключ доступа к S3-хранилищу, задаётся вместе с -s3-secret-key (пусто — запросы без подписи)")
+	fs.StringVar(&cfg.S3SecretKey, "s3-secret-key", "", "секретный ключ к S3-хранилищу")
+	fs.StringVar(&cfg.StorageDir, "storage-dir", STORAGE_DIR, "директория для хранения объектов, их метаданных и служебных файлов")
+	fs.StringVar(&cfg.TempDir, "temp-dir", "", "директория для временных файлов и незавершённых загрузок (пусто — "+TMP_DIR+" в -storage-dir); на другой ФС, чем хранилище, завершённые загрузки копируются вместо переименования")
+	fs.DurationVar(&cfg.TempMaxAge, "temp-max-age", 24*time.Hour, "удалять брошенные загрузки и временные файлы, не изменявшиеся дольше этого времени (0 — не удалять)")
+	fs.StringVar(&cfg.Scanner, "scanner", SCANNER_NONE, "проверка содержимого загрузок до сохранения: none — без проверки, eicar — пример с сигнатурой тестового файла EICAR")
+	fs.Int64Var(&cfg.DownloadRate, "download-rate", 0, "скорость отдачи одного скачивания в байтах в секунду, чтобы большое скачивание не занимало весь канал; клиент может снизить её параметром ?rate=, а подписанная ссылка администратора — задать свою (0 — без ограничения)")
+	fs.IntVar(&cfg.StreamBuffer, "stream-buffer", 0, "буфер отдачи объектов в байтах: данные уходят клиенту порциями этого размера (0 — без своего буфера)")
+	fs.DurationVar(&cfg.StreamFlush, "stream-flush", 0, "отправлять буфер отдачи клиенту не реже этого интервала, например 100ms (0 — при заполнении)")
+	fs.BoolVar(&cfg.Compress, "compress", false, "сжимать при скачивании текстовые объекты от 1 КБ: br, если клиент его принимает, иначе gzip (Accept-Encoding)")
+	fs.DurationVar(&cfg.SlowRequest, "slow-request", 0, "предупреждать в журнале о запросах дольше этого времени, например 5s (0 — выключено)")
+	fs.IntVar(&cfg.AccessLogSample, "access-log-sample", 0, "журнал запросов: писать каждый N-й успешный запрос и все запросы с кодом 400 и выше (1 — все запросы, 0 — журнал запросов выключен)")
+	fs.StringVar(&cfg.LogKeys, "log-keys", LOG_KEYS_FULL, "как писать ключи объектов в журнал: full — как есть, hash — началом SHA-256, если ключи содержат личные данные")
+	fs.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", SHUTDOWN_TIMEOUT, "сколько при остановке ждать завершения выполняемых запросов; оставшиеся прерываются, их соединения закрываются")
+	fs.BoolVar(&cfg.SelfTest, "selftest", false, "проверить запись, чтение, контрольную сумму, список и удаление объекта в хранилище и завершиться")
+	fs.StringVar(&cfg.APIKey, "api-key", "", "API-ключ (Authorization: Bearer) для загрузки, удаления и подписанных ссылок (пусто — без авторизации)")
+	cachePin := fs.String("cache-pin", "", "ключи через запятую, объекты которых никогда не вытесняются из кэша, например часто читаемые индексы; в кэш они попадают при первом чтении")
+	users := fs.String("users", "", "пользователи через запятую в виде имя:ключ; объекты доступны владельцу, если не открыты для всех")
+	corsOrigins := fs.String("cors-origins", "", "источники через запятую, которым разрешены запросы из браузера (* — любые)")
+	normalizeKeys := fs.String("normalize-keys", "", "нормализация ключей через запятую: lower — нижний регистр, nfc — юникодная форма NFC (пусто — ключи как есть)")
+	virtualHosts := fs.String("virtual-hosts", "", "виртуальные хосты через запятую в виде хост=поддиректория: объекты хоста хранятся в своей поддиректории, пустая — всё хранилище; остальные хосты получают 421")
+	typeDirs := fs.String("type-dirs", "", "директории для объектов по типу содержимого через запятую в виде тип=директория, например image/*=/mnt/media; тип определяется по расширению ключа, остальные объекты — в -storage-dir")
+	fs.StringVar(&cfg.DefaultType, "default-type", DEFAULT_CONTENT_TYPE, "тип содержимого при скачивании объекта, тип которого не задан в метаданных и не определяется ни по расширению ключа, ни по первым байтам, например text/plain")
+	allowedTypes := fs.String("allowed-types", "", "типы содержимого через запятую, которые можно загружать, например image/*,application/pdf; проверяются заголовок Content-Type, расширение ключа и первые байты, остальное — 415 (пусто — любые)")
+	inlineTypes := fs.String("inline-types", DEFAULT_INLINE_TYPES, "типы содержимого через запятую, которые браузер показывает (Content-Disposition: inline), остальные скачиваются")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if !filepath.IsAbs(cfg.StorageDir) {
+		return nil, fmt.Errorf("storage dir must be an absolute path")
+	}
+	cfg.StorageDir = filepath.Clean(cfg.StorageDir)
+	cfg.CORSOrigins = splitList(*corsOrigins)
+	cfg.InlineTypes = splitList(*inlineTypes)
+	cfg.AllowedTypes = splitList(strings.ToLower(*allowedTypes))
+	cfg.CachePin = splitList(*cachePin)
+	cfg.NormalizeKeys = splitList(*normalizeKeys)
+	for _, n := range cfg.NormalizeKeys {
+		if n != NORMALIZE_LOWER && n != NORMALIZE_NFC {
+			return nil, fmt.Errorf("unknown key normalization %q, expected %q or %q", n, NORMALIZE_LOWER, NORMALIZE_NFC)
+		}
+	}
+	hosts, err := parseVirtualHosts(splitList(*virtualHosts))
+	if err != nil {
+		return nil, err
+	}
+	cfg.VirtualHosts = hosts
+	routes, err := parseTypeRoutes(cfg.StorageDir, splitList(*typeDirs))
+	if err != nil {
+		return nil, err
+	}
+	cfg.TypeRoutes = routes
+	if err := checkBackend(cfg); err != nil {
+		return nil, err
+	}
+	cfg.Users = make(map[string]string)
+	for _, user := range splitList(*users) {
+		name, token, ok := strings.Cut(user, ":")
+		if !ok || name == "" || token == "" {
+			return nil, fmt.Errorf("user %q must be in name:key form", user)
+		}
+		if name == ADMIN_IDENTITY {
+			return nil, fmt.Errorf("user name %q is reserved", name)
+		}
+		cfg.Users[name] = token
+	}
+	if len(cfg.Users) > 0 && cfg.APIKey == "" {
+		return nil, fmt.Errorf("-users requires -api-key")
+	}
+	if cfg.MaxUploads < 0 || cfg.MaxDownloads < 0 || cfg.MaxPerClient < 0 || cfg.MaxConnections < 0 {
+		return nil, fmt.Errorf("concurrency limits must not be negative")
+	}
+	if cfg.MaxObjectSize < 0 || cfg.MaxUploadMemory < 0 || cfg.DiskQuota < 0 {
+		return nil, fmt.Errorf("max object size, upload memory and disk quota must not be negative")
+	}
+	if cfg.MaxListResults < 0 {
+		return nil, fmt.Errorf("max list results must not be negative")
+	}
+	if cfg.MaxTags < 0 || cfg.MaxTagKeyLen < 1 || cfg.MaxTagValueLen < 0 || cfg.MaxMetaSize < 0 {
+		return nil, fmt.Errorf("tag and metadata limits must not be negative, and tag names need at least 1 byte")
+	}
+	if cfg.CacheSize < 0 || cfg.CacheThreshold < 0 {
+		return nil, fmt.Errorf("cache size and threshold must not be negative")
+	}
+	if _, _, err := mime.ParseMediaType(cfg.DefaultType); err != nil || !strings.Contains(cfg.DefaultType, "/") {
+		return nil, fmt.Errorf("default type %q is not a valid media type", cfg.DefaultType)
+	}
+	for _, t := range cfg.AllowedTypes {
+		if major, minor, ok := strings.Cut(t, "/"); !ok || major == "" || minor == "" {
+			return nil, fmt.Errorf("allowed type %q must be a type or a group, e.g. image/png or image/*", t)
+		}
+	}
+	if cfg.AccessLogSample < 0 {
+		return nil, fmt.Errorf("access log sample must not be negative")
+	}
+	if cfg.MinTTL < 0 || cfg.MaxTTL < 0 {
+		return nil, fmt.Errorf("ttl bounds must not be negative")
+	}
+	if cfg.MaxTTL > 0 && cfg.MinTTL > cfg.MaxTTL {
+		return nil, fmt.Errorf("min ttl %v is longer than max ttl %v", cfg.MinTTL, cfg.MaxTTL)
+	}
+	if cfg.TTLBounds != TTL_REJECT && cfg.TTLBounds != TTL_CLAMP {
+		return nil, fmt.Errorf("unknown ttl bounds mode %q, expected %q or %q", cfg.TTLBounds, TTL_REJECT, TTL_CLAMP)
+	}
+	if cfg.ExpirySweep < 0 {
+		return nil, fmt.Errorf("expiry sweep interval must not be negative")
+	}
+	if cfg.CountFlush < 0 {
+		return nil, fmt.Errorf("download count flush interval must not be negative")
+	}
+	if cfg.CacheReport < 0 {
+		return nil, fmt.Errorf("cache report interval must not be negative")
+	}
+	if cfg.CacheWatermark < 1 || cfg.CacheWatermark > 100 {
+		return nil, fmt.Errorf("cache watermark must be between 1 and 100 percent")
+	}
+	if cfg.Consistency != CONSISTENCY_DISK && cfg.Consistency != CONSISTENCY_CACHE {
+		return nil, fmt.Errorf("consistency must be %q or %q", CONSISTENCY_DISK, CONSISTENCY_CACHE)
+	}
+	if cfg.LogKeys != LOG_KEYS_FULL && cfg.LogKeys != LOG_KEYS_HASH {
+		return nil, fmt.Errorf("log keys must be %q or %q", LOG_KEYS_FULL, LOG_KEYS_HASH)
+	}
+	if cfg.IndexKey != "" {
+		if err := validateKey(cfg.IndexKey); err != nil {
+			return nil, fmt.Errorf("invalid -index-key: %v", err)
+		}
+	}
+	if cfg.Scanner != SCANNER_NONE && cfg.Scanner != SCANNER_EICAR {
+		return nil, fmt.Errorf("unknown scanner %q, expected %q or %q", cfg.Scanner, SCANNER_NONE, SCANNER_EICAR)
+	}
+	if cfg.DownloadRate < 0 {
+		return nil, fmt.Errorf("download rate must not be negative")
+	}
+	if cfg.StreamBuffer < 0 || cfg.StreamFlush < 0 {
+		return nil, fmt.Errorf("stream buffer and flush interval must not be negative")
+	}
+	if cfg.TempMaxAge < 0 {
+		return nil, fmt.Errorf("temp file max age must not be negative")
+	}
+	if cfg.SealAfter < 0 {
+		return nil, fmt.Errorf("seal-after must not be negative")
+	}
+	if cfg.FlushInterval < 0 {
+		return nil, fmt.Errorf("flush interval must not be negative")
+	}
+	if cfg.FlushInterval > 0 && !cfg.WriteBack {
+		return nil, fmt.Errorf("-flush-interval requires -write-back")
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		return nil, fmt.Errorf("shutdown timeout must be positive")
+	}
+	if cfg.SlowRequest < 0 {
+		return nil, fmt.Errorf("slow request threshold must not be negative")
+	}
+	if cfg.CachePolicy != EVICT_LRU && cfg.CachePolicy != EVICT_LFU && cfg.CachePolicy != EVICT_FIFO {
+		return nil, fmt.Errorf("unknown cache policy %q, expected %q, %q or %q", cfg.CachePolicy, EVICT_LRU, EVICT_LFU, EVICT_FIFO)
+	}
+	if cfg.ChangeLogSize < 0 {
+		return nil, fmt.Errorf("changelog size must not be negative")
+	}
+	if cfg.NegativeTTL < 0 {
+		return nil, fmt.Errorf("negative cache ttl must not be negative")
+	}
+	if cfg.BloomKeys < 0 {
+		return nil, fmt.Errorf("bloom filter size must not be negative")
+	}
+	if err := checkKeyTemplate(cfg.KeyTemplate); err != nil {
+		return nil, err
+	}
+	if cfg.KeyTemplate == KEY_TEMPLATE_DATE && cfg.MaxKeyDepth < DATE_KEY_DEPTH {
+		return nil, fmt.Errorf("key template %q needs -max-key-depth of at least %d", KEY_TEMPLATE_DATE, DATE_KEY_DEPTH)
+	}
+	if cfg.MaxKeyDepth < 1 {
+		return nil, fmt.Errorf("max key depth must be at least 1")
+	}
+	if cfg.TempDir == "" {
+		cfg.TempDir = cfg.StorageDir + "/" + TMP_DIR
+	}
+	cfg.TempDir = filepath.Clean(cfg.TempDir)
+	if err := checkServiceDir(cfg.StorageDir, cfg.TempDir); err != nil {
+		return nil, fmt.Errorf("invalid temp dir: %v", err)
+	}
+	if cfg.ShardWidth < 0 || cfg.ShardWidth > MAX_SHARD_WIDTH {
+		return nil, fmt.Errorf("shard width must be between 0 and %d", MAX_SHARD_WIDTH)
+	}
+	return cfg, nil
+}
+
+// redacted — копия конфигурации, в которой ключи и секреты заменены на REDACTED
+func (cfg *Config) redacted() Config {
+	c := *cfg
+	if c.APIKey != "" {
+		c.APIKey = REDACTED
+	}
+	if c.S3SecretKey != "" {
+		c.S3SecretKey = REDACTED
+	}
+	c.Users = make(map[string]string, len(cfg.Users))
+	for name := range cfg.Users {
+		c.Users[name] = REDACTED
+	}
+	return c
+}
+
+// HandleConfig — обработчик для вывода действующей конфигурации сервера без секретов.
+// Доступен только администратору, если авторизация включена.
+func HandleConfig(w http.ResponseWriter, r *http.Request, cfg *Config) {
+	if cfg.APIKey != "" && Identity(r) != ADMIN_IDENTITY {
+		http.Error(w, "Доступ запрещён", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		TmpDir string
+		Config
+	}{tmpDir, cfg.redacted()})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHandleConfig(t *testing.T) {
+	ts, _ := newTestServer(t, "-api-key", "secret", "-users", "alice:a-key", "-max-uploads", "3")
+	tests := []struct {
+		name   string
+		header []string
+		status int
+	}{
+		{"anonymous", nil, http.StatusUnauthorized},
+		{"user", []string{"Authorization", "Bearer a-key"}, http.StatusForbidden},
+		{"admin", []string{"Authorization", "Bearer secret"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, ts, http.MethodGet, "/admin/config", "", tt.header...)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: %d, want %d", tt.name, resp.StatusCode, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		// Секреты не покидают сервер, остальные настройки — действующие значения
+		if strings.Contains(body, "secret") || strings.Contains(body, "a-key") {
+			t.Errorf("config leaks a secret: %s", body)
+		}
+		var got struct {
+			TmpDir     string
+			StorageDir string
+			MaxUploads int
+			APIKey     string
+			Users      map[string]string
+		}
+		if err := json.Unmarshal([]byte(body), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.MaxUploads != 3 || got.StorageDir != storageDir || got.TmpDir != storageDir+"/"+TMP_DIR {
+			t.Errorf("config = %+v, want effective settings", got)
+		}
+		if got.APIKey != REDACTED || got.Users["alice"] != REDACTED {
+			t.Errorf("secrets are not redacted: %q %v", got.APIKey, got.Users)
+		}
+	}
+}
+
+func TestHandleConfigWithoutAuth(t *testing.T) {
+	ts, _ := newTestServer(t)
+	resp, body := do(t, ts, http.MethodGet, "/admin/config", "")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, `"APIKey":""`) {
+		t.Errorf("config without -api-key: %d %s", resp.StatusCode, body)
+	}
+}
+
+func TestStorageDirConfig(t *testing.T) {
+	tests := []struct {
+		args    []string
+		storage string
+		temp    string
+		valid   bool
+	}{
+		{nil, STORAGE_DIR, STORAGE_DIR + "/" + TMP_DIR, true},
+		{[]string{"-storage-dir", "/srv/objects/"}, "/srv/objects", "/srv/objects/" + TMP_DIR, true},
+		{[]string{"-storage-dir", "/srv/objects", "-temp-dir", "/var/tmp/uploads"}, "/srv/objects", "/var/tmp/uploads", true},
+		{[]string{"-storage-dir", "/srv/objects", "-temp-dir", "/srv/objects/.uploads"}, "/srv/objects", "/srv/objects/.uploads", true},
+		{[]string{"-storage-dir", "objects"}, "", "", false},
+		// Временные файлы под корнем попали бы в список объектов
+		{[]string{"-storage-dir", "/srv/objects", "-temp-dir", "/srv/objects/uploads"}, "", "", false},
+		{[]string{"-storage-dir", "/srv/objects", "-temp-dir", "/srv/objects"}, "", "", false},
+		{[]string{"-temp-dir", "tmp"}, "", "", false},
+	}
+	for _, tt := range tests {
+		cfg, err := ParseConfig(tt.args)
+		if (err == nil) != tt.valid {
+			t.Errorf("ParseConfig(%q): %v, want valid %v", tt.args, err, tt.valid)
+			continue
+		}
+		if err == nil && (cfg.StorageDir != tt.storage || cfg.TempDir != tt.temp) {
+			t.Errorf("ParseConfig(%q): storage %s temp %s, want %s %s", tt.args, cfg.StorageDir, cfg.TempDir, tt.storage, tt.temp)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+const (
+	CONSISTENCY_DISK  = "disk"  // ПРИ РАСХОЖДЕНИИ КЭША И ДИСКА ВЕРНЫМ СЧИТАЕТСЯ ДИСК
+	CONSISTENCY_CACHE = "cache" // ПРИ РАСХОЖДЕНИИ КЭША И ДИСКА ВЕРНЫМ СЧИТАЕТСЯ КЭШ
+)
+
+// cacheConsistent — сверяет объект из кэша с файлом на диске; вызывается с захваченным
+// мьютексом. Файл могли изменить или удалить в обход сервера, тогда размер
+// на диске расходится с кэшем. При политике CONSISTENCY_DISK объект убирается
+// из кэша и возвращается false, чтобы он был перечитан с диска; при CONSISTENCY_CACHE
+// расхождение только попадает в журнал.
+func (s *Storage) cacheConsistent(data obj) bool {
+	// Объект, ещё не записанный на диск, сверять не с чем
+	if s.pending(data.name) {
+		return true
+	}
+	info, err := s.backend.Stat(data.name)
+	if err == nil && info.Size() == int64(len(data.body)) {
+		return true
+	}
+
+	s.metrics.CacheMismatches.Add(1)
+	disk := "файл отсутствует"
+	if err == nil {
+		disk = fmt.Sprintf("%d байт", info.Size())
+	}
+	if s.consistency == CONSISTENCY_CACHE {
+		log.Printf("Объект %s в кэше (%d байт) расходится с диском (%v), отдаётся из кэша", logKey(data.name), len(data.body), disk)
+		return true
+	}
+	log.Printf("Объект %s в кэше (%d байт) расходится с диском (%v), перечитывается с диска", logKey(data.name), len(data.body), disk)
+	s.cache.Remove(data.name)
+	return false
+}
+
+// PersistCacheOnly — записывает на диск объекты, которые есть только в кэше. При
+// CONSISTENCY_CACHE объект, файл которого удалили в обход сервера, по-прежнему
+// отдаётся из памяти и пропал бы с перезапуском; вызывается при остановке, после
+// сброса очереди отложенной записи. Возвращает количество записанных объектов.
+func (s *Storage) PersistCacheOnly() (int, error) {
+	if s.consistency != CONSISTENCY_CACHE {
+		return 0, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	written := 0
+	for _, key := range s.cache.Keys() {
+		o, ok := s.cache.Peek(key)
+		if !ok || s.pending(key) {
+			continue
+		}
+		if _, err := s.backend.Stat(key); !os.IsNotExist(err) {
+			continue
+		}
+		if err := s.backend.Write(key, o.body, true); err != nil {
+			return written, err
+		}
+		log.Printf("Объект %s, которого не было на диске, записан из кэша", logKey(key))
+		written++
+	}
+	return written, nil
+}
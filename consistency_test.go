@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestCacheConsistency(t *testing.T) {
+	tests := []struct {
+		policy   string
+		modified string // Что отдаётся после изменения файла в обход сервера
+		removed  int    // Код ответа после удаления файла в обход сервера
+	}{
+		{CONSISTENCY_DISK, "changed on disk", http.StatusNotFound},
+		{CONSISTENCY_CACHE, "cached", http.StatusOK},
+	}
+	for _, tt := range tests {
+		ts, storage := newTestServer(t, "-consistency", tt.policy)
+		upload(t, ts, "obj", "cached")
+		if err := os.WriteFile(storage.objectPath("obj"), []byte("changed on disk"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if resp, body := do(t, ts, http.MethodGet, "/download/obj", ""); resp.StatusCode != http.StatusOK || body != tt.modified {
+			t.Errorf("%s: after out-of-band write: %d %q, want %q", tt.policy, resp.StatusCode, body, tt.modified)
+		}
+		if got := metrics(t, ts)["storage_cache_mismatches_total"]; got != "1" {
+			t.Errorf("%s: mismatches %s, want 1", tt.policy, got)
+		}
+
+		upload(t, ts, "gone", "cached")
+		if err := os.Remove(storage.objectPath("gone")); err != nil {
+			t.Fatal(err)
+		}
+		if resp, _ := do(t, ts, http.MethodGet, "/download/gone", ""); resp.StatusCode != tt.removed {
+			t.Errorf("%s: after out-of-band delete: %d, want %d", tt.policy, resp.StatusCode, tt.removed)
+		}
+	}
+}
+
+func TestPersistCacheOnly(t *testing.T) {
+	tests := []struct {
+		mode     string
+		written  int
+		restored bool
+	}{
+		{CONSISTENCY_CACHE, 1, true},
+		// Диск считается верным: пропавший файл не возвращается
+		{CONSISTENCY_DISK, 0, false},
+	}
+	for _, tt := range tests {
+		storage, _ := newTestStorage(t, "-consistency", tt.mode)
+		if err := storage.Save("gone", []byte("cached"), Meta{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := storage.Save("kept", []byte("cached"), Meta{}); err != nil {
+			t.Fatal(err)
+		}
+		os.Remove(storage.objectPath("gone"))
+
+		// При остановке на диск возвращается только пропавший файл
+		if n, err := storage.PersistCacheOnly(); err != nil || n != tt.written {
+			t.Fatalf("%s: PersistCacheOnly = %d, %v; want %d", tt.mode, n, err, tt.written)
+		}
+		data, err := os.ReadFile(storage.objectPath("gone"))
+		if restored := err == nil; restored != tt.restored || restored && string(data) != "cached" {
+			t.Errorf("%s: restored file %q, %v; want restored %v", tt.mode, data, err, tt.restored)
+		}
+		if data, err := os.ReadFile(storage.objectPath("kept")); err != nil || string(data) != "cached" {
+			t.Errorf("%s: kept file %q, %v", tt.mode, data, err)
+		}
+	}
+}
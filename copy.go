@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+)
+
+const COPY_PREFIX_LEN = len("/copy/") // ДЛИНА ПРЕФИКСА ДЛЯ МАРШРУТА КОПИРОВАНИЯ ОБЪЕКТОВ
+
+// copyMeta — метаданные копии: права доступа задаёт копирующий запрос (как при загрузке),
+// а тип содержимого, Cache-Control, теги и перенаправление берутся у исходного объекта
+func copyMeta(src, m Meta) Meta {
+	m.ContentType = src.ContentType
+	m.CacheControl = src.CacheControl
+	m.Tags = src.Tags
+	m.Redirect = src.Redirect
+	m.RedirectCode = src.RedirectCode
+	return m
+}
+
+// Copy — копирует объект src в новый ключ dst. Содержимое не загружается в память:
+// файл потоком копируется во временный (попутно считается MD5 для ETag) и
+// переносится на место целиком, поэтому копия появляется только готовой и
+// многогигабайтный объект копируется с постоянным расходом памяти.
+// Начатое копирование не мешает удалить исходный объект: он дочитывается.
+func (s *Storage) Copy(src, dst string, m Meta) error {
+	srcMeta, err := s.LoadMeta(src)
+	if err != nil {
+		return err
+	}
+	m = copyMeta(srcMeta, m)
+
+	// Объект, ещё не записанный на диск, уже целиком в памяти
+	s.mu.RLock()
+	o, pending := s.wbPending(src)
+	s.mu.RUnlock()
+	if pending {
+		return s.Save(dst, o.body, m)
+	}
+
+	in, info, err := s.openObject(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if err := s.quota.Check(info.Size()); err != nil {
+		return err
+	}
+
+	out, err := os.CreateTemp(tmpDir, "copy-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+	h := md5.New()
+	_, err = io.Copy(io.MultiWriter(out, h), in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(out.Name(), 0644)
+	}
+	if err != nil {
+		return err
+	}
+	return s.SaveFile(dst, out.Name(), hex.EncodeToString(h.Sum(nil)), m)
+}
+
+// HandleCopy — обработчик для копирования объекта: POST /copy/<key>?source=<key>
+// создаёт объект key с содержимым и метаданными source. Как и загрузка, копирование
+// только создаёт новые объекты: существующий key — 409.
+func HandleCopy(w http.ResponseWriter, r *http.Request, storage *Storage) {
+	key := storage.RequestKey(r, r.URL.Path[COPY_PREFIX_LEN:])
+	if !checkKey(w, key) || !checkExpires(w, r) {
+		return
+	}
+	source := r.URL.Query().Get("source")
+	if source == "" {
+		http.Error(w, "Исходный объект задаётся параметром source", http.StatusBadRequest)
+		return
+	}
+	source = storage.RequestKey(r, source)
+	if !checkKey(w, source) {
+		return
+	}
+	if !storage.Exists(source) {
+		http.Error(w, "Исходный объект не найден", http.StatusNotFound)
+		return
+	}
+	if !authorizeObject(w, r, storage, source, false) {
+		return
+	}
+	if !checkLease(w, r, storage, key) || !checkNotAlias(w, storage, key) {
+		return
+	}
+	// Существующий объект отклоняем сразу, а не после копирования всего содержимого
+	if storage.Live(key) {
+		writeExists(w, r, storage, key, fmt.Sprintf("%v: %v", ErrExists, clientKey(r, key)))
+		return
+	}
+
+	err := storage.Copy(source, key, uploadMeta(r))
+	if os.IsNotExist(err) {
+		http.Error(w, "Исходный объект не найден", http.StatusNotFound)
+	} else if errors.Is(err, ErrExists) {
+		writeExists(w, r, storage, key, clientError(r, err))
+	} else if errors.Is(err, ErrKeyIsPrefix) || errors.Is(err, ErrPrefixIsObject) {
+		http.Error(w, clientError(r, err), http.StatusConflict)
+	} else if errors.Is(err, ErrQuotaExceeded) {
+		http.Error(w, "Недостаточно места в квоте хранилища", http.StatusInsufficientStorage)
+	} else if errors.Is(err, ErrRejected) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	} else if errors.Is(err, ErrUnsupportedType) {
+		http.Error(w, clientError(r, err), http.StatusUnsupportedMediaType)
+	} else if err != nil {
+		log.Printf("Ошибка копирования %s в %s: %v", logKey(source), logKey(key), logErr(err))
+		http.Error(w, "Ошибка копирования объекта", http.StatusInternalServerError)
+	} else {
+		w.Header().Set("Location", downloadURL(clientKey(r, key)))
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, "Объект %s скопирован в %s", clientKey(r, source), clientKey(r, key))
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestHandleCopy(t *testing.T) {
+	for _, args := range [][]string{nil, {"-write-back"}} {
+		ts, _ := newTestServer(t, append([]string{"-api-key", "secret", "-users", "alice:a-key,bob:b-key"}, args...)...)
+		alice := []string{"Authorization", "Bearer a-key"}
+		upload(t, ts, "src", "data", alice...)
+		if resp, body := do(t, ts, http.MethodPatch, "/meta/src", `{"ContentType": "text/csv", "Tags": {"env": "prod"}}`, alice...); resp.StatusCode != http.StatusOK {
+			t.Fatalf("PATCH /meta/src: %d %s", resp.StatusCode, body)
+		}
+		resp, _ := do(t, ts, http.MethodGet, "/download/src", "", alice...)
+		etag := resp.Header.Get("ETag")
+
+		tests := []struct {
+			name     string
+			path     string
+			header   []string
+			status   int
+			location string
+		}{
+			{"copy", "/copy/dir/dst?source=src", alice, http.StatusCreated, "/download/dir/dst"},
+			{"existing", "/copy/dir/dst?source=src", alice, http.StatusConflict, ""},
+			{"no source", "/copy/other", alice, http.StatusBadRequest, ""},
+			{"missing source", "/copy/other?source=missing", alice, http.StatusNotFound, ""},
+			{"bad source", "/copy/other?source=../x", alice, http.StatusBadRequest, ""},
+			// Путь копии занят файлом другого объекта
+			{"prefix is object", "/copy/src/nested?source=src", alice, http.StatusConflict, ""},
+			// Чужой закрытый объект копировать нельзя
+			{"other user", "/copy/bobs?source=src", []string{"Authorization", "Bearer b-key"}, http.StatusForbidden, ""},
+		}
+		for _, tt := range tests {
+			resp, body := do(t, ts, http.MethodPost, tt.path, "", tt.header...)
+			if resp.StatusCode != tt.status || resp.Header.Get("Location") != tt.location {
+				t.Errorf("%v: %s: %d %s, Location %q; want %d %q", args, tt.name, resp.StatusCode, body, resp.Header.Get("Location"), tt.status, tt.location)
+			}
+		}
+
+		// Копия — то же содержимое с тем же ETag, типом и тегами
+		resp, body := do(t, ts, http.MethodGet, "/download/dir/dst", "", alice...)
+		if body != "data" || resp.Header.Get("ETag") != etag || resp.Header.Get("Content-Type") != "text/csv" {
+			t.Errorf("%v: copy: %q, ETag %s (source %s), Content-Type %s", args, body, resp.Header.Get("ETag"), etag, resp.Header.Get("Content-Type"))
+		}
+		_, body = do(t, ts, http.MethodGet, "/meta/dir/dst", "", alice...)
+		var meta struct{ Tags map[string]string }
+		if err := json.Unmarshal([]byte(body), &meta); err != nil || !reflect.DeepEqual(meta.Tags, map[string]string{"env": "prod"}) {
+			t.Errorf("%v: copy tags %v, %v", args, meta.Tags, err)
+		}
+		// Копия принадлежит копирующему, а не владельцу исходного объекта
+		if resp, _ := do(t, ts, http.MethodGet, "/download/dir/dst", "", "Authorization", "Bearer b-key"); resp.StatusCode != http.StatusForbidden {
+			t.Errorf("%v: copy is readable by another user: %d", args, resp.StatusCode)
+		}
+	}
+}
+
+func TestCopyQuota(t *testing.T) {
+	ts, _ := newTestServer(t, "-disk-quota", "6")
+	upload(t, ts, "src", "data")
+	if resp, body := do(t, ts, http.MethodPost, "/copy/dst?source=src", ""); resp.StatusCode != http.StatusInsufficientStorage {
+		t.Errorf("copy over the quota: %d %s, want 507", resp.StatusCode, body)
+	}
+	if resp, _ := do(t, ts, http.MethodGet, "/download/dst", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("copy over the quota is saved: %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	CORS_METHODS = "GET, HEAD, POST, PUT, PATCH, DELETE"                         // МЕТОДЫ, РАЗРЕШЁННЫЕ ДЛЯ БРАУЗЕРОВ
+	CORS_HEADERS = "Authorization, Content-Type, If-Match, If-None-Match, Range" // ЗАГОЛОВКИ, РАЗРЕШЁННЫЕ ДЛЯ БРАУЗЕРОВ
+	CORS_EXPOSE  = "ETag, Location, Content-Length, Content-Range"               // ЗАГОЛОВКИ ОТВЕТА, ДОСТУПНЫЕ СКРИПТАМ
+	CORS_MAX_AGE = "600"                                                         // СКОЛЬКО СЕКУНД БРАУЗЕР КЭШИРУЕТ ОТВЕТ НА PREFLIGHT
+)
+
+// allowedOrigin — проверяет, разрешён ли источник списком (значение "*" разрешает любые)
+func allowedOrigin(origins []string, origin string) bool {
+	for _, o := range origins {
+		if o == "*" || o == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// WithCORS — разрешает браузерам с перечисленных источников обращаться к серверу,
+// в том числе загружать объекты через подписанные ссылки методом PUT
+func WithCORS(origins []string, next http.Handler) http.Handler {
+	if len(origins) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || !allowedOrigin(origins, origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Add("Vary", "Origin")
+		w.Header().Set("Access-Control-Expose-Headers", CORS_EXPOSE)
+
+		// Предварительный запрос браузера отвечаем сами, до проверки метода обработчиком
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", CORS_METHODS)
+			w.Header().Set("Access-Control-Allow-Headers", CORS_HEADERS)
+			w.Header().Set("Access-Control-Max-Age", CORS_MAX_AGE)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// splitList — разбирает список значений через запятую
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
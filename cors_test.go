@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	ts, _ := newTestServer(t, "-cors-origins", "https://app.example, https://other.example")
+	upload(t, ts, "obj", "data")
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		header  []string
+		status  int
+		allowed string
+		methods string
+	}{
+		{"preflight", http.MethodOptions, "/upload/new", []string{"Origin", "https://app.example", "Access-Control-Request-Method", "PUT"}, http.StatusNoContent, "https://app.example", CORS_METHODS},
+		{"second origin", http.MethodOptions, "/upload/new", []string{"Origin", "https://other.example", "Access-Control-Request-Method", "PUT"}, http.StatusNoContent, "https://other.example", CORS_METHODS},
+		{"foreign preflight", http.MethodOptions, "/upload/new", []string{"Origin", "https://evil.example", "Access-Control-Request-Method", "PUT"}, http.StatusMethodNotAllowed, "", ""},
+		{"simple request", http.MethodGet, "/download/obj", []string{"Origin", "https://app.example"}, http.StatusOK, "https://app.example", ""},
+		{"foreign request", http.MethodGet, "/download/obj", []string{"Origin", "https://evil.example"}, http.StatusOK, "", ""},
+		{"no origin", http.MethodGet, "/download/obj", nil, http.StatusOK, "", ""},
+	}
+	for _, tt := range tests {
+		resp, _ := do(t, ts, tt.method, tt.path, "", tt.header...)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: %d, want %d", tt.name, resp.StatusCode, tt.status)
+		}
+		if got := resp.Header.Get("Access-Control-Allow-Origin"); got != tt.allowed {
+			t.Errorf("%s: Access-Control-Allow-Origin %q, want %q", tt.name, got, tt.allowed)
+		}
+		if got := resp.Header.Get("Access-Control-Allow-Methods"); got != tt.methods {
+			t.Errorf("%s: Access-Control-Allow-Methods %q, want %q", tt.name, got, tt.methods)
+		}
+		if tt.allowed != "" && resp.Header.Get("Access-Control-Expose-Headers") != CORS_EXPOSE {
+			t.Errorf("%s: ETag and Location are not exposed to scripts", tt.name)
+		}
+	}
+}
+
+func TestCORSAnyOrigin(t *testing.T) {
+	ts, _ := newTestServer(t, "-cors-origins", "*")
+	resp, _ := do(t, ts, http.MethodOptions, "/upload/new", "", "Origin", "https://any.example", "Access-Control-Request-Method", "PUT")
+	if got := resp.Header.Get("Access-Control-Allow-Origin"); resp.StatusCode != http.StatusNoContent || got != "https://any.example" {
+		t.Errorf("preflight with -cors-origins *: %d, Access-Control-Allow-Origin %q", resp.StatusCode, got)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// DEFAULT_INLINE_TYPES — типы содержимого, которые браузер показывает сам, не выполняя
+// кода из объекта. HTML и SVG сюда не входят: в них может быть скрипт.
+const DEFAULT_INLINE_TYPES = "image/png,image/jpeg,image/gif,image/webp,application/pdf,text/plain,audio/mpeg,video/mp4"
+
+// DEFAULT_CONTENT_TYPE — ТИП ОБЪЕКТА ПО УМОЛЧАНИЮ, ЕСЛИ НИ РАСШИРЕНИЕ, НИ СОДЕРЖИМОЕ ЕГО НЕ ВЫДАЮТ
+const DEFAULT_CONTENT_TYPE = "application/octet-stream"
+
+// objectContentType — тип содержимого объекта: по расширению ключа, а если
+// расширение неизвестно — по первым байтам, как это делает http.ServeContent.
+// Когда и по байтам тип не определить, берётся -default-type.
+func (s *Storage) objectContentType(o obj) string {
+	if ctype := mime.TypeByExtension(filepath.Ext(o.name)); ctype != "" {
+		return ctype
+	}
+	// DetectContentType отвечает application/octet-stream, когда тип не распознан
+	if ctype := http.DetectContentType(o.body); ctype != DEFAULT_CONTENT_TYPE {
+		return ctype
+	}
+	return s.defaultType
+}
+
+// contentDisposition — значение Content-Disposition для объекта: inline для типов
+// из списка разрешённых, attachment для всех остальных
+func (s *Storage) contentDisposition(key, contentType string) string {
+	disposition := "attachment"
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && s.inlineTypes[mediaType] {
+		disposition = "inline"
+	}
+	if value := mime.FormatMediaType(disposition, map[string]string{"filename": dispositionFilename(key)}); value != "" {
+		return value
+	}
+	return disposition
+}
+
+// dispositionFilename — имя файла для сохранения объекта: последняя часть ключа
+// без управляющих символов, кавычек и обратных слешей
+func dispositionFilename(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, path.Base(key))
+}
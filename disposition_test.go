@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestContentDisposition(t *testing.T) {
+	ts, _ := newTestServer(t, "-inline-types", "image/png,text/plain")
+	tests := []struct {
+		key         string
+		body        string
+		disposition string
+	}{
+		{"photo.png", "\x89PNG\r\n\x1a\n", `inline; filename=photo.png`},
+		{"notes.txt", "hello", `inline; filename=notes.txt`},
+		{"page.html", "<html><script>alert(1)</script></html>", `attachment; filename=page.html`},
+		{"image.svg", "<svg/>", `attachment; filename=image.svg`},
+		{"dir/report.pdf", "%PDF-1.4", `attachment; filename=report.pdf`},
+		{"dir/my file.bin", "\x00\x01", `attachment; filename="my file.bin"`},
+	}
+	for _, tt := range tests {
+		upload(t, ts, tt.key, tt.body)
+		resp, _ := do(t, ts, http.MethodGet, downloadURL(tt.key), "")
+		if got := resp.Header.Get("Content-Disposition"); got != tt.disposition {
+			t.Errorf("%s: Content-Disposition %q, want %q", tt.key, got, tt.disposition)
+		}
+		// Браузер не угадывает тип по содержимому вопреки Content-Type
+		if got := resp.Header.Get("X-Content-Type-Options"); got != "nosniff" {
+			t.Errorf("%s: X-Content-Type-Options %q, want nosniff", tt.key, got)
+		}
+	}
+}
+
+func TestDispositionFilename(t *testing.T) {
+	tests := []struct{ key, want string }{
+		{"a/b/c.txt", "c.txt"},
+		{`say "hi".txt`, "say _hi_.txt"},
+		{"back\\slash", "back_slash"},
+		{"line\nbreak", "line_break"},
+	}
+	for _, tt := range tests {
+		if got := dispositionFilename(tt.key); got != tt.want {
+			t.Errorf("dispositionFilename(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestDefaultType(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  []string
+		key   string
+		body  string
+		meta  string // Тип, заданный через PATCH /meta/
+		ctype string
+	}{
+		{"unknown", nil, "blob", "\x00\x01\x02", "", "application/octet-stream"},
+		{"configured", []string{"-default-type", "text/plain"}, "blob", "\x00\x01\x02", "", "text/plain"},
+		{"extension wins", []string{"-default-type", "text/plain"}, "a.png", "\x00\x01\x02", "", "image/png"},
+		{"content wins", []string{"-default-type", "text/plain"}, "page", "<html><body>", "", "text/html; charset=utf-8"},
+		{"metadata wins", []string{"-default-type", "text/plain"}, "blob", "\x00\x01\x02", "image/gif", "image/gif"},
+	}
+	for _, tt := range tests {
+		ts, _ := newTestServer(t, tt.args...)
+		upload(t, ts, tt.key, tt.body)
+		if tt.meta != "" {
+			if resp, body := do(t, ts, http.MethodPatch, "/meta/"+tt.key, `{"ContentType": "`+tt.meta+`"}`); resp.StatusCode != http.StatusOK {
+				t.Fatalf("%s: PATCH /meta: %d %s", tt.name, resp.StatusCode, body)
+			}
+		}
+		resp, _ := do(t, ts, http.MethodGet, "/download/"+tt.key, "")
+		if got := resp.Header.Get("Content-Type"); resp.StatusCode != http.StatusOK || got != tt.ctype {
+			t.Errorf("%s: %d Content-Type %q, want %q", tt.name, resp.StatusCode, got, tt.ctype)
+		}
+	}
+
+	for _, value := range []string{"", "plain", "text/", "text/plain; =x"} {
+		if _, err := ParseConfig([]string{"-default-type", value}); err == nil {
+			t.Errorf("ParseConfig accepted -default-type %q", value)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	STAT_PREFIX_LEN      = len("/stat/")    // ДЛИНА ПРЕФИКСА ДЛЯ МАРШРУТА СВЕДЕНИЙ ОБ ОБЪЕКТЕ
+	MAX_STAT_KEYS        = 1000             // МАКСИМУМ КЛЮЧЕЙ В ОДНОМ ЗАПРОСЕ СВЕДЕНИЙ О НЕСКОЛЬКИХ ОБЪЕКТАХ
+	DOWNLOAD_COUNT_FLUSH = 10 * time.Second // КАК ЧАСТО СОХРАНЯТЬ СЧЁТЧИКИ СКАЧИВАНИЙ В МЕТАДАННЫЕ
+)
+
+// DownloadCounts — скачивания объектов, ещё не сохранённые в метаданные. Скачивание
+// только увеличивает счётчик в памяти, а в файлы метаданных счётчики пишутся пачкой
+// раз в -download-count-flush, чтобы не замедлять отдачу объектов.
+type DownloadCounts struct {
+	mu      sync.Mutex
+	pending map[string]int64
+}
+
+// NewDownloadCounts — конструктор пустых счётчиков
+func NewDownloadCounts() *DownloadCounts {
+	return &DownloadCounts{pending: make(map[string]int64)}
+}
+
+// Add — учитывает одно скачивание объекта
+func (d *DownloadCounts) Add(key string) {
+	d.mu.Lock()
+	d.pending[key]++
+	d.mu.Unlock()
+}
+
+// Pending — скачивания объекта, ещё не сохранённые в метаданные
+func (d *DownloadCounts) Pending(key string) int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.pending[key]
+}
+
+// Forget — отбрасывает несохранённые скачивания объекта (удалённого или перезаписанного)
+func (d *DownloadCounts) Forget(key string) {
+	d.mu.Lock()
+	delete(d.pending, key)
+	d.mu.Unlock()
+}
+
+// take — забирает все несохранённые счётчики
+func (d *DownloadCounts) take() map[string]int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	batch := d.pending
+	d.pending = make(map[string]int64)
+	return batch
+}
+
+// countDownload — учитывает отдачу объекта в метриках и, кроме HEAD, в счётчике объекта
+func (s *Storage) countDownload(r *http.Request, key string) {
+	s.metrics.Downloads.Add(1)
+	if r.Method != http.MethodHead {
+		s.downloadCounts.Add(key)
+	}
+}
+
+// DownloadCount — сколько раз объект скачивали: сохранённое в метаданных и ещё нет
+func (s *Storage) DownloadCount(key string) (int64, error) {
+	m, err := s.LoadMeta(key)
+	if err != nil {
+		return 0, err
+	}
+	return m.Downloads + s.downloadCounts.Pending(key), nil
+}
+
+// flushDownloadCounts — сохраняет накопленные счётчики скачиваний в метаданные.
+// Объекты, удалённые после скачивания, пропускаются, чтобы не оставлять метаданных без объекта.
+func (s *Storage) flushDownloadCounts() {
+	batch := s.downloadCounts.take()
+	if len(batch) == 0 {
+		return
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for key, n := range batch {
+		if !s.exists(key) {
+			continue
+		}
+		err := s.UpdateMeta(key, func(m *Meta) {
+			m.Downloads += n
+		})
+		if err != nil {
+			log.Printf("Ошибка сохранения счётчика скачиваний %s: %v", logKey(key), logErr(err))
+		}
+	}
+}
+
+// downloadCountLoop — раз в interval сохраняет счётчики скачиваний в метаданные
+func (s *Storage) downloadCountLoop(interval time.Duration) {
+	for range time.Tick(interval) {
+		s.flushDownloadCounts()
+	}
+}
+
+// HandleStat — обработчик для сведений об объекте: размер, время изменения, ETag
+// и число скачиваний
+func HandleStat(w http.ResponseWriter, r *http.Request, storage *Storage) {
+	// Получаем ключ (имя объекта) из URL
+	key := storage.RequestKey(r, r.URL.Path[STAT_PREFIX_LEN:])
+	if !checkKey(w, key) {
+		return
+	}
+	size, modTime, ok := storage.objectStat(key)
+	if !ok {
+		http.Error(w, "Объект не найден", http.StatusNotFound)
+		return
+	}
+	if !authorizeObject(w, r, storage, key, false) {
+		return
+	}
+	etag, err := storage.ETag(key)
+	if os.IsNotExist(err) {
+		http.Error(w, "Объект не найден", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Ошибка вычисления ETag %s: %v", logKey(key), logErr(err))
+	}
+	downloads, err := storage.DownloadCount(key)
+	if err != nil {
+		log.Printf("Ошибка чтения метаданных %s: %v", logKey(key), logErr(err))
+		http.Error(w, "Ошибка чтения метаданных", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Key       string
+		Size      int64
+		Modified  time.Time
+		ETag      string
+		Downloads int64
+	}{clientKey(r, key), size, modTime, etag, downloads})
+}
+
+// statEntry — сведения об одном объекте в ответе /stat; у отсутствующего Found == false
+type statEntry struct {
+	Key         string
+	Found       bool
+	Size        int64
+	Modified    time.Time
+	ETag        string
+	ContentType string
+}
+
+// statMeta — сведения об объекте только по метаданным и stat, не читая содержимое:
+// ETag — из сохранённого MD5 (пусто, если он ещё не вычислен), тип содержимого —
+// заданный через /meta/ или по расширению ключа
+func (s *Storage) statMeta(r *http.Request, key string) statEntry {
+	entry := statEntry{Key: clientKey(r, key)}
+	m, err := s.LoadMeta(key)
+	if err != nil || !m.canRead(Identity(r)) {
+		return entry
+	}
+	size, modTime, ok := s.objectStat(key)
+	if !ok {
+		return entry
+	}
+	entry.Found, entry.Size, entry.Modified = true, size, modTime
+	if sum, ok := m.Checksums["md5"]; ok {
+		entry.ETag = `"` + sum + `"`
+	}
+	entry.ContentType = m.ContentType
+	if entry.ContentType == "" {
+		entry.ContentType = mime.TypeByExtension(filepath.Ext(key))
+	}
+	return entry
+}
+
+// HandleStatBatch — обработчик для сведений о нескольких объектах одним запросом
+// (POST /stat с JSON-массивом ключей или GET /stat?key=a&key=b): размер, время
+// изменения, ETag и тип содержимого по порядку запрошенных ключей. Недопустимые,
+// отсутствующие и чужие закрытые объекты отмечаются Found: false.
+func HandleStatBatch(w http.ResponseWriter, r *http.Request, storage *Storage) {
+	keys, err := requestKeys(r)
+	if err != nil {
+		http.Error(w, "Ожидается JSON-массив ключей", http.StatusBadRequest)
+		return
+	}
+	if len(keys) == 0 {
+		http.Error(w, "Не указаны ключи объектов", http.StatusBadRequest)
+		return
+	}
+	if len(keys) > MAX_STAT_KEYS {
+		http.Error(w, fmt.Sprintf("Не больше %d ключей в одном запросе", MAX_STAT_KEYS), http.StatusBadRequest)
+		return
+	}
+
+	entries := make([]statEntry, 0, len(keys))
+	for _, requested := range keys {
+		key := storage.RequestKey(r, requested)
+		if validateKey(key) != nil {
+			entries = append(entries, statEntry{Key: requested})
+			continue
+		}
+		entries = append(entries, storage.statMeta(r, key))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// statDownloads — число скачиваний объекта из GET /stat/<key>
+func statDownloads(t *testing.T, ts *httptest.Server, key string) int64 {
+	t.Helper()
+	resp, body := do(t, ts, http.MethodGet, "/stat/"+key, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /stat/%s: %d %s", key, resp.StatusCode, body)
+	}
+	var stat struct {
+		Key       string
+		Size      int64
+		ETag      string
+		Downloads int64
+	}
+	if err := json.Unmarshal([]byte(body), &stat); err != nil {
+		t.Fatal(err)
+	}
+	if stat.Key != key || stat.Size != 4 || stat.ETag == "" {
+		t.Errorf("GET /stat/%s = %+v", key, stat)
+	}
+	return stat.Downloads
+}
+
+func TestDownloadCounts(t *testing.T) {
+	ts, storage := newTestServer(t)
+	upload(t, ts, "obj", "data")
+
+	steps := []struct {
+		name   string
+		method string
+		flush  bool
+		want   int64
+	}{
+		{"new object", "", false, 0},
+		{"download", http.MethodGet, false, 1},
+		// HEAD не отдаёт содержимое и скачиванием не считается
+		{"head", http.MethodHead, false, 1},
+		{"saved to metadata", "", true, 1},
+		{"download after save", http.MethodGet, false, 2},
+	}
+	for _, s := range steps {
+		if s.method != "" {
+			do(t, ts, s.method, "/download/obj", "")
+		}
+		if s.flush {
+			storage.flushDownloadCounts()
+			if m, err := storage.LoadMeta("obj"); err != nil || m.Downloads != s.want {
+				t.Errorf("%s: downloads in metadata %d, %v; want %d", s.name, m.Downloads, err, s.want)
+			}
+		}
+		if got := statDownloads(t, ts, "obj"); got != s.want {
+			t.Errorf("%s: %d downloads, want %d", s.name, got, s.want)
+		}
+	}
+
+	// Счётчики удалённого объекта не воскрешают его метаданные
+	do(t, ts, http.MethodGet, "/download/obj", "")
+	if resp, _ := do(t, ts, http.MethodDelete, "/delete/obj", ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("delete: %d", resp.StatusCode)
+	}
+	storage.flushDownloadCounts()
+	if resp, _ := do(t, ts, http.MethodGet, "/stat/obj", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("stat of deleted object: %d, want 404", resp.StatusCode)
+	}
+	upload(t, ts, "obj", "data")
+	if got := statDownloads(t, ts, "obj"); got != 0 {
+		t.Errorf("recreated object has %d downloads, want 0", got)
+	}
+	if _, err := ParseConfig([]string{"-download-count-flush", "-1s"}); err == nil {
+		t.Error("ParseConfig accepted a negative -download-count-flush")
+	}
+}
+
+func TestHandleStatBatch(t *testing.T) {
+	ts, _ := newTestServer(t, "-api-key", "secret", "-users", "alice:a-key,bob:b-key")
+	alice := []string{"Authorization", "Bearer a-key"}
+	upload(t, ts, "a.txt", "hello", alice...)
+	upload(t, ts, "dir/b.json", "{}", alice...)
+	upload(t, ts, "bobs", "private", "Authorization", "Bearer b-key")
+
+	// Отсутствующие, недопустимые и чужие закрытые объекты — Found: false на своём месте
+	keys := []string{"dir/b.json", "missing", "a.txt", "../x", "bobs"}
+	want := []statEntry{
+		{Key: "dir/b.json", Found: true, Size: 2, ETag: `"99914b932bd37a50b983c5e7c90ae93b"`, ContentType: "application/json"},
+		{Key: "missing"},
+		{Key: "a.txt", Found: true, Size: 5, ETag: `"5d41402abc4b2a76b9719d911017c592"`, ContentType: "text/plain; charset=utf-8"},
+		{Key: "../x"},
+		{Key: "bobs"},
+	}
+	body, _ := json.Marshal(keys)
+	query := "?key=" + strings.Join(keys, "&key=")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"get", http.MethodGet, "/stat" + query, "", http.StatusOK},
+		{"post", http.MethodPost, "/stat", string(body), http.StatusOK},
+		{"no keys", http.MethodGet, "/stat", "", http.StatusBadRequest},
+		{"empty array", http.MethodPost, "/stat", "[]", http.StatusBadRequest},
+		{"bad json", http.MethodPost, "/stat", "{", http.StatusBadRequest},
+		{"too many keys", http.MethodGet, "/stat?key=a" + strings.Repeat("&key=a", MAX_STAT_KEYS), "", http.StatusBadRequest},
+		{"wrong method", http.MethodDelete, "/stat", "", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		resp, got := do(t, ts, tt.method, tt.path, tt.body, alice...)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: %d %s, want %d", tt.name, resp.StatusCode, got, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		var entries []statEntry
+		if err := json.Unmarshal([]byte(got), &entries); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		for i := range entries {
+			if entries[i].Found == entries[i].Modified.IsZero() {
+				t.Errorf("%s: %s: Found %v, Modified %v", tt.name, entries[i].Key, entries[i].Found, entries[i].Modified)
+			}
+			entries[i].Modified = time.Time{}
+		}
+		if !reflect.DeepEqual(entries, want) {
+			t.Errorf("%s: %+v, want %+v", tt.name, entries, want)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// ENCODING_BASE64 — ЗНАЧЕНИЕ ?encoding= ДЛЯ ОТДАЧИ ОБЪЕКТА В JSON-КОНВЕРТЕ
+const ENCODING_BASE64 = "base64"
+
+// writeEnvelope — отдаёт объект JSON-конвертом с содержимым в base64 и метаданными,
+// для клиентов, которые умеют читать только JSON. Конверт на треть больше объекта
+// и собирается в памяти целиком, поэтому отдаётся только по явному ?encoding=base64.
+func writeEnvelope(w http.ResponseWriter, key string, data obj, contentType, etag string) {
+	// ETag и Content-Disposition относятся к самому объекту, а не к конверту
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Del("Content-Disposition")
+	w.Header().Del("ETag")
+	json.NewEncoder(w).Encode(struct {
+		Key         string
+		Size        int
+		ContentType string
+		ETag        string
+		Modified    time.Time
+		Data        []byte // encoding/json кодирует []byte в base64
+	}{key, len(data.body), contentType, etag, data.modTime, data.body})
+}
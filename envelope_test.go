@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestBase64Envelope(t *testing.T) {
+	// Объект больше порога читается с диска, а не из кэша
+	ts, _ := newTestServer(t, "-cache-threshold", "4")
+	content := "\x00\x01\xfe\xffbinary"
+	upload(t, ts, "dir/obj.bin", content, "Content-Type", "application/octet-stream")
+	resp, _ := do(t, ts, http.MethodGet, "/download/dir/obj.bin", "")
+	etag := resp.Header.Get("ETag")
+
+	tests := []struct {
+		path   string
+		header []string
+		status int
+	}{
+		{"/download/dir/obj.bin?encoding=base64", nil, http.StatusOK},
+		{"/download/dir/obj.bin?encoding=hex", nil, http.StatusBadRequest},
+		{"/download/dir/obj.bin?encoding=base64", []string{"If-None-Match", etag}, http.StatusNotModified},
+		{"/download/missing?encoding=base64", nil, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, ts, http.MethodGet, tt.path, "", tt.header...)
+		if resp.StatusCode != tt.status {
+			t.Errorf("GET %s %v: %d %s, want %d", tt.path, tt.header, resp.StatusCode, body, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		if resp.Header.Get("Content-Type") != "application/json" || resp.Header.Get("Content-Disposition") != "" || resp.Header.Get("ETag") != "" {
+			t.Errorf("GET %s: headers of the object leak into the envelope: %v", tt.path, resp.Header)
+		}
+		var env struct {
+			Key, ContentType, ETag string
+			Size                   int
+			Data                   []byte
+		}
+		if err := json.Unmarshal([]byte(body), &env); err != nil {
+			t.Fatalf("GET %s: %v", tt.path, err)
+		}
+		if env.Key != "dir/obj.bin" || env.Size != len(content) || string(env.Data) != content ||
+			env.ContentType != "application/octet-stream" || env.ETag != etag {
+			t.Errorf("GET %s = %+v", tt.path, env)
+		}
+	}
+}
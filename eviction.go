@@ -0,0 +1,139 @@
+package main
+
+import (
+	"container/heap"
+	"container/list"
+)
+
+const (
+	EVICT_LRU  = "lru"  // ВЫТЕСНЯТЬ ДАВНО НЕ ИСПОЛЬЗОВАВШИЕСЯ ОБЪЕКТЫ
+	EVICT_LFU  = "lfu"  // ВЫТЕСНЯТЬ РЕДКО ИСПОЛЬЗУЕМЫЕ ОБЪЕКТЫ
+	EVICT_FIFO = "fifo" // ВЫТЕСНЯТЬ ОБЪЕКТЫ В ПОРЯДКЕ ДОБАВЛЕНИЯ
+)
+
+// EvictionPolicy — порядок вытеснения объектов из кэша. Кэш сообщает политике
+// о добавлении, использовании и удалении объектов и спрашивает, кого вытеснить.
+type EvictionPolicy interface {
+	Added(key string)
+	Accessed(key string)
+	Removed(key string)
+	Victim() (string, bool) // Ключ объекта, который следует вытеснить первым
+}
+
+// newEvictionPolicy — политика вытеснения по её имени из конфигурации
+func newEvictionPolicy(name string) EvictionPolicy {
+	switch name {
+	case EVICT_LFU:
+		return newLFU()
+	case EVICT_FIFO:
+		return newQueuePolicy(false)
+	}
+	return newQueuePolicy(true)
+}
+
+// queuePolicy — вытеснение с конца очереди: LRU, если обращение переносит объект
+// в начало очереди, и FIFO, если не переносит
+type queuePolicy struct {
+	order        *list.List               // Ключи от новых к старым
+	items        map[string]*list.Element // Элементы order по ключу
+	moveOnAccess bool                     // Переносить ли объект в начало при обращении (LRU)
+}
+
+func newQueuePolicy(moveOnAccess bool) *queuePolicy {
+	return &queuePolicy{order: list.New(), items: make(map[string]*list.Element), moveOnAccess: moveOnAccess}
+}
+
+func (q *queuePolicy) Added(key string) {
+	q.items[key] = q.order.PushFront(key)
+}
+
+func (q *queuePolicy) Accessed(key string) {
+	if e, ok := q.items[key]; ok && q.moveOnAccess {
+		q.order.MoveToFront(e)
+	}
+}
+
+func (q *queuePolicy) Removed(key string) {
+	if e, ok := q.items[key]; ok {
+		q.order.Remove(e)
+		delete(q.items, key)
+	}
+}
+
+func (q *queuePolicy) Victim() (string, bool) {
+	e := q.order.Back()
+	if e == nil {
+		return "", false
+	}
+	return e.Value.(string), true
+}
+
+// lfuEntry — объект в политике LFU
+type lfuEntry struct {
+	key   string
+	hits  int64 // Число обращений
+	seq   int64 // Порядковый номер добавления: из одинаково редких вытесняется более старый
+	index int   // Позиция в куче
+}
+
+// lfuHeap — куча объектов от редко к часто используемым
+type lfuHeap []*lfuEntry
+
+func (h lfuHeap) Len() int { return len(h) }
+func (h lfuHeap) Less(i, j int) bool {
+	return h[i].hits < h[j].hits || h[i].hits == h[j].hits && h[i].seq < h[j].seq
+}
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+func (h *lfuHeap) Push(x interface{}) {
+	e := x.(*lfuEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+func (h *lfuHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+// lfuPolicy — вытеснение наименее часто используемых объектов
+type lfuPolicy struct {
+	heap  lfuHeap
+	items map[string]*lfuEntry
+	seq   int64
+}
+
+func newLFU() *lfuPolicy {
+	return &lfuPolicy{items: make(map[string]*lfuEntry)}
+}
+
+func (l *lfuPolicy) Added(key string) {
+	l.seq++
+	e := &lfuEntry{key: key, seq: l.seq}
+	l.items[key] = e
+	heap.Push(&l.heap, e)
+}
+
+func (l *lfuPolicy) Accessed(key string) {
+	if e, ok := l.items[key]; ok {
+		e.hits++
+		heap.Fix(&l.heap, e.index)
+	}
+}
+
+func (l *lfuPolicy) Removed(key string) {
+	if e, ok := l.items[key]; ok {
+		heap.Remove(&l.heap, e.index)
+		delete(l.items, key)
+	}
+}
+
+func (l *lfuPolicy) Victim() (string, bool) {
+	if len(l.heap) == 0 {
+		return "", false
+	}
+	return l.heap[0].key, true
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEvictionOrder(t *testing.T) {
+	// a, b и c добавлены по порядку, затем к a обратились дважды, к c — один раз
+	tests := []struct {
+		policy string
+		want   []string
+	}{
+		{EVICT_LRU, []string{"b", "a", "c"}},
+		{EVICT_FIFO, []string{"a", "b", "c"}},
+		{EVICT_LFU, []string{"b", "c", "a"}},
+	}
+	for _, tt := range tests {
+		p := newEvictionPolicy(tt.policy)
+		for _, key := range []string{"a", "b", "c"} {
+			p.Added(key)
+		}
+		for _, key := range []string{"a", "a", "c"} {
+			p.Accessed(key)
+		}
+		var got []string
+		for {
+			key, ok := p.Victim()
+			if !ok {
+				break
+			}
+			got = append(got, key)
+			p.Removed(key)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: eviction order %v, want %v", tt.policy, got, tt.want)
+		}
+	}
+}
+
+func TestCacheEvictionPolicy(t *testing.T) {
+	tests := []struct {
+		policy  string
+		evicted []string
+	}{
+		{EVICT_LRU, []string{"b", "a"}},
+		{EVICT_FIFO, []string{"a", "b"}},
+		// Из одинаково редких у LFU вытесняется добавленный раньше
+		{EVICT_LFU, []string{"b", "c"}},
+	}
+	for _, tt := range tests {
+		var evicted []string
+		c := NewCache(3, 0, newEvictionPolicy(tt.policy), func(o obj) { evicted = append(evicted, o.name) })
+		for _, key := range []string{"a", "b", "c"} {
+			c.Put(obj{name: key, body: []byte("x")})
+		}
+		c.Get("a")
+		c.Get("a")
+		c.Get("c")
+		c.Put(obj{name: "d", body: []byte("x")})
+		c.Get("d")
+		c.Put(obj{name: "e", body: []byte("x")})
+		if !reflect.DeepEqual(evicted, tt.evicted) {
+			t.Errorf("%s: evicted %v, want %v", tt.policy, evicted, tt.evicted)
+		}
+		if c.Len() != 3 || c.Size() != 3 {
+			t.Errorf("%s: %d objects of %d bytes after eviction, want 3 of 3", tt.policy, c.Len(), c.Size())
+		}
+	}
+
+	// Закреплённый объект политике не передаётся и не вытесняется
+	c := NewCache(2, 0, newEvictionPolicy(EVICT_FIFO), nil)
+	c.Pin("a")
+	c.Put(obj{name: "a", body: []byte("x")})
+	c.Put(obj{name: "b", body: []byte("x")})
+	c.Put(obj{name: "c", body: []byte("x")})
+	if !c.Contains("a") || c.Contains("b") || !c.Contains("c") {
+		t.Errorf("pinned cache keys %v, want a and c", c.Keys())
+	}
+}
+
+func TestCachePolicyConfig(t *testing.T) {
+	for _, policy := range []string{EVICT_LRU, EVICT_LFU, EVICT_FIFO} {
+		if _, err := ParseConfig([]string{"-cache-policy", policy}); err != nil {
+			t.Errorf("-cache-policy %s: %v", policy, err)
+		}
+	}
+	if _, err := ParseConfig([]string{"-cache-policy", "random"}); err == nil {
+		t.Error("unknown -cache-policy is accepted")
+	}
+}
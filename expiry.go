@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// EXPIRY_SWEEP — КАК ЧАСТО ПО УМОЛЧАНИЮ УДАЛЯТЬ ОБЪЕКТЫ С ИСТЁКШИМ EXPIRES
+const EXPIRY_SWEEP = time.Minute
+
+const (
+	TTL_REJECT = "reject" // СРОК ЖИЗНИ ВНЕ ПРЕДЕЛОВ — ЗАГРУЗКА ОТКЛОНЯЕТСЯ
+	TTL_CLAMP  = "clamp"  // СРОК ЖИЗНИ ВНЕ ПРЕДЕЛОВ ПРИВОДИТСЯ К БЛИЖАЙШЕМУ ПРЕДЕЛУ
+)
+
+// ErrTTLOutOfBounds — срок жизни из Expires короче -min-ttl или длиннее -max-ttl
+var ErrTTLOutOfBounds = errors.New("object lifetime is out of bounds")
+
+// Пределы срока жизни, который клиент задаёт заголовком Expires (0 — без предела);
+// задаются в main() из -min-ttl, -max-ttl и -ttl-bounds
+var (
+	minTTL, maxTTL time.Duration
+	clampTTL       bool
+)
+
+// expired — истёк ли срок жизни объекта, заданный заголовком Expires при загрузке
+func (m Meta) expired(now time.Time) bool {
+	return !m.Expires.IsZero() && !now.Before(m.Expires)
+}
+
+// parseExpires — срок жизни объекта из заголовка Expires загрузки (нулевой — бессрочный).
+// Срок вне -min-ttl и -max-ttl — ошибка ErrTTLOutOfBounds, а с -ttl-bounds clamp
+// он сдвигается к ближайшему пределу. Объект без Expires остаётся бессрочным.
+func parseExpires(r *http.Request) (time.Time, error) {
+	v := r.Header.Get("Expires")
+	if v == "" {
+		return time.Time{}, nil
+	}
+	expires, err := http.ParseTime(v)
+	if err != nil {
+		return expires, err
+	}
+	now := time.Now()
+	ttl := expires.Sub(now)
+	switch {
+	case minTTL > 0 && ttl < minTTL && clampTTL:
+		expires = now.Add(minTTL)
+	case maxTTL > 0 && ttl > maxTTL && clampTTL:
+		expires = now.Add(maxTTL)
+	case minTTL > 0 && ttl < minTTL:
+		return expires, fmt.Errorf("%w: expires in %v, minimum is %v", ErrTTLOutOfBounds, ttl.Round(time.Second), minTTL)
+	case maxTTL > 0 && ttl > maxTTL:
+		return expires, fmt.Errorf("%w: expires in %v, maximum is %v", ErrTTLOutOfBounds, ttl.Round(time.Second), maxTTL)
+	}
+	return expires, nil
+}
+
+// checkExpires — отвечает 400, если заголовок Expires загрузки не HTTP-дата
+// или задаёт срок жизни вне -min-ttl и -max-ttl
+func checkExpires(w http.ResponseWriter, r *http.Request) bool {
+	_, err := parseExpires(r)
+	if errors.Is(err, ErrTTLOutOfBounds) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if err != nil {
+		http.Error(w, "Некорректная дата в Expires", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// live — есть ли объект и не истёк ли его срок жизни. Истёкший объект, который ещё
+// не успели удалить, для загрузки считается отсутствующим и перезаписывается.
+func (s *Storage) live(key string) bool {
+	if !s.exists(key) {
+		return false
+	}
+	m, err := s.LoadMeta(key)
+	return err != nil || !m.expired(time.Now())
+}
+
+// Live — live для обработчиков, которые не держат мьютекс хранилища
+func (s *Storage) Live(key string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.live(key)
+}
+
+// expire — удаляет объект с истёкшим сроком жизни. Объект под сроком хранения (WORM)
+// остаётся до его окончания; возвращает, удалён ли объект.
+func (s *Storage) expire(key string) bool {
+	m, err := s.LoadMeta(key)
+	if err != nil || !m.expired(time.Now()) {
+		return false
+	}
+	// Объект, который тем временем перезаписали, удалять уже не нужно: его ETag другой
+	ifMatch := "*"
+	if sum := m.Checksums["md5"]; sum != "" {
+		ifMatch = `"` + sum + `"`
+	}
+	err = s.Delete(key, ifMatch)
+	if err != nil && !errors.Is(err, ErrLocked) && !errors.Is(err, ErrETagMismatch) {
+		log.Printf("Ошибка удаления истёкшего объекта %s: %v", logKey(key), logErr(err))
+	}
+	return err == nil
+}
+
+// ExpireObjects — удаляет с диска все объекты с истёкшим сроком жизни; возвращает их число.
+// Объекты удаляются после обхода: удаление убирает опустевшие директории, которые
+// обход ещё читает.
+func (s *Storage) ExpireObjects() (int, error) {
+	now := time.Now()
+	var keys []string
+	err := s.walkDiskKeys(func(key string) error {
+		if m, err := s.LoadMeta(key); err == nil && m.expired(now) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	expired := 0
+	for _, key := range keys {
+		if s.expire(key) {
+			expired++
+		}
+	}
+	return expired, err
+}
+
+// expiryLoop — раз в interval удаляет объекты с истёкшим сроком жизни
+func (s *Storage) expiryLoop(interval time.Duration) {
+	for range time.Tick(interval) {
+		expired, err := s.ExpireObjects()
+		if err != nil {
+			log.Printf("Ошибка удаления истёкших объектов: %v", logErr(err))
+		}
+		if expired > 0 {
+			log.Printf("Удалено объектов с истёкшим сроком жизни: %d", expired)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUploadExpires(t *testing.T) {
+	ts, _ := newTestServer(t)
+	past := time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)
+	future := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+
+	// Шаги выполняются по порядку над одним ключом
+	steps := []struct {
+		name     string
+		method   string
+		path     string
+		header   []string
+		status   int
+		expires  string // Заголовок Expires скачивания
+		download int
+	}{
+		{"bad date", http.MethodPost, "/upload/obj", []string{"Expires", "tomorrow"}, http.StatusBadRequest, "", http.StatusNotFound},
+		{"future", http.MethodPost, "/upload/obj", []string{"Expires", future}, http.StatusCreated, future, http.StatusOK},
+		{"live object", http.MethodPost, "/upload/obj", nil, http.StatusConflict, future, http.StatusOK},
+		{"overwrite with past date", http.MethodPut, "/upload/obj", []string{"If-Match", "*", "Expires", past}, http.StatusOK, "", http.StatusNotFound},
+		// Ключ истёкшего объекта свободен для новой загрузки
+		{"key is free", http.MethodPost, "/upload/obj", nil, http.StatusCreated, "", http.StatusOK},
+		{"s3 bad date", http.MethodPut, "/bucket/obj", []string{"Expires", "tomorrow"}, http.StatusBadRequest, "", http.StatusOK},
+	}
+	for _, s := range steps {
+		if resp, body := do(t, ts, s.method, s.path, s.name, s.header...); resp.StatusCode != s.status {
+			t.Errorf("%s: %s %s: %d %s, want %d", s.name, s.method, s.path, resp.StatusCode, body, s.status)
+		}
+		resp, _ := do(t, ts, http.MethodGet, "/download/obj", "")
+		if resp.StatusCode != s.download || resp.Header.Get("Expires") != s.expires {
+			t.Errorf("%s: download %d, Expires %q; want %d %q", s.name, resp.StatusCode, resp.Header.Get("Expires"), s.download, s.expires)
+		}
+	}
+}
+
+func TestExpireObjects(t *testing.T) {
+	storage, _ := newTestStorage(t)
+	past := time.Now().Add(-time.Minute)
+	objects := []struct {
+		key     string
+		expires time.Time
+		lock    bool
+		kept    bool
+	}{
+		{"expired", past, false, false},
+		{"nested/expired", past, false, false},
+		{"future", time.Now().Add(time.Hour), false, true},
+		{"forever", time.Time{}, false, true},
+		// Объект под сроком хранения удаляется не раньше его окончания
+		{"locked", past, true, true},
+	}
+	for _, o := range objects {
+		if err := storage.Save(o.key, []byte("data"), Meta{Expires: o.expires}); err != nil {
+			t.Fatal(err)
+		}
+		if o.lock {
+			if _, err := storage.SetRetention(o.key, time.Now().Add(time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	expired, err := storage.ExpireObjects()
+	if err != nil || expired != 2 {
+		t.Errorf("ExpireObjects = %d, %v; want 2", expired, err)
+	}
+	for _, o := range objects {
+		if got := storage.exists(o.key); got != o.kept {
+			t.Errorf("%s exists %v, want %v", o.key, got, o.kept)
+		}
+	}
+	if _, err := ParseConfig([]string{"-expiry-sweep", "-1s"}); err == nil {
+		t.Error("ParseConfig accepted a negative -expiry-sweep")
+	}
+}
+
+func TestTTLBounds(t *testing.T) {
+	tests := []struct {
+		mode   string
+		method string
+		path   string
+		ttl    time.Duration // 0 — без Expires
+		status int
+		want   time.Duration // Срок жизни сохранённого объекта (0 — бессрочный)
+	}{
+		{TTL_REJECT, http.MethodPost, "/upload/obj", 10 * time.Minute, http.StatusBadRequest, 0},
+		{TTL_REJECT, http.MethodPost, "/upload/obj", 48 * time.Hour, http.StatusBadRequest, 0},
+		{TTL_REJECT, http.MethodPost, "/upload/obj", 2 * time.Hour, http.StatusCreated, 2 * time.Hour},
+		{TTL_REJECT, http.MethodPost, "/upload/obj", 0, http.StatusCreated, 0},
+		{TTL_REJECT, http.MethodPut, "/bucket/obj", 10 * time.Minute, http.StatusBadRequest, 0},
+		{TTL_CLAMP, http.MethodPost, "/upload/obj", 10 * time.Minute, http.StatusCreated, time.Hour},
+		{TTL_CLAMP, http.MethodPost, "/upload/obj", 48 * time.Hour, http.StatusCreated, 24 * time.Hour},
+		{TTL_CLAMP, http.MethodPost, "/upload/obj", 2 * time.Hour, http.StatusCreated, 2 * time.Hour},
+		{TTL_CLAMP, http.MethodPut, "/bucket/obj", 10 * time.Minute, http.StatusOK, time.Hour},
+	}
+	for _, tt := range tests {
+		ts, _ := newTestServer(t, "-min-ttl", "1h", "-max-ttl", "24h", "-ttl-bounds", tt.mode)
+		header := []string{}
+		if tt.ttl > 0 {
+			header = append(header, "Expires", time.Now().Add(tt.ttl).UTC().Format(http.TimeFormat))
+		}
+		name := fmt.Sprintf("%s %s %v", tt.mode, tt.path, tt.ttl)
+		if resp, body := do(t, ts, tt.method, tt.path, "data", header...); resp.StatusCode != tt.status {
+			t.Errorf("%s: %d %s, want %d", name, resp.StatusCode, body, tt.status)
+			continue
+		}
+		if tt.status == http.StatusBadRequest {
+			continue
+		}
+		key := strings.TrimPrefix(strings.TrimPrefix(tt.path, "/upload/"), "/")
+		resp, _ := do(t, ts, http.MethodGet, "/download/"+key, "")
+		expires := resp.Header.Get("Expires")
+		if tt.want == 0 {
+			if expires != "" {
+				t.Errorf("%s: Expires %q, want none", name, expires)
+			}
+			continue
+		}
+		at, err := http.ParseTime(expires)
+		if diff := time.Until(at) - tt.want; err != nil || diff < -5*time.Second || diff > 5*time.Second {
+			t.Errorf("%s: Expires %q, want in %v", name, expires, tt.want)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"-min-ttl", "-1s"},
+		{"-max-ttl", "-1s"},
+		{"-min-ttl", "2h", "-max-ttl", "1h"},
+		{"-ttl-bounds", "drop"},
+	} {
+		if _, err := ParseConfig(args); err == nil {
+			t.Errorf("ParseConfig accepted %v", args)
+		}
+	}
+}
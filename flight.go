@@ -0,0 +1,45 @@
+package main
+
+import "sync"
+
+// flightCall — выполняющееся чтение объекта, результат которого ждут другие запросы
+type flightCall struct {
+	done chan struct{}
+	o    obj
+	ok   bool
+}
+
+// flightGroup — объединяет одновременные чтения одного ключа с диска: читает
+// только первый запрос, остальные получают его результат
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+// newFlightGroup — конструктор группы объединяемых чтений
+func newFlightGroup() *flightGroup {
+	return &flightGroup{calls: make(map[string]*flightCall)}
+}
+
+// Do — выполняет fn для ключа или, если fn для него уже выполняется, дожидается её результата
+func (g *flightGroup) Do(key string, fn func() (obj, bool)) (obj, bool) {
+	g.mu.Lock()
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		<-c.done
+		return c.o, c.ok
+	}
+	c := &flightCall{done: make(chan struct{})}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	// Даже при панике в fn ждущие запросы не должны зависнуть навсегда
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(c.done)
+	}()
+	c.o, c.ok = fn()
+	return c.o, c.ok
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFlightGroupCoalesces(t *testing.T) {
+	for _, n := range []int{1, 2, 10, 100} {
+		g := newFlightGroup()
+		var calls atomic.Int32
+		release := make(chan struct{})
+		fn := func() (obj, bool) {
+			calls.Add(1)
+			<-release
+			return obj{name: "k", body: []byte("data")}, true
+		}
+
+		var wg sync.WaitGroup
+		results := make([]obj, n)
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				results[i], _ = g.Do("k", fn)
+			}(i)
+		}
+		// Пока первое чтение не закончилось, остальные только ждут его результата
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		if got := calls.Load(); got != 1 {
+			t.Errorf("%d concurrent loads: fn called %d times, want 1", n, got)
+		}
+		for i, o := range results {
+			if string(o.body) != "data" {
+				t.Errorf("%d concurrent loads: caller %d got %q", n, i, o.body)
+			}
+		}
+		// Законченное чтение не запоминается: следующее читает заново
+		g.Do("k", func() (obj, bool) { calls.Add(1); return obj{}, false })
+		if got := calls.Load(); got != 2 {
+			t.Errorf("%d concurrent loads: load after completion was coalesced", n)
+		}
+	}
+}
+
+func TestFlightGroupPanic(t *testing.T) {
+	g := newFlightGroup()
+	func() {
+		defer func() { recover() }()
+		g.Do("k", func() (obj, bool) { panic("boom") })
+	}()
+	// После паники ключ не остаётся занятым навсегда
+	done := make(chan bool)
+	go func() {
+		_, ok := g.Do("k", func() (obj, bool) { return obj{}, true })
+		done <- ok
+	}()
+	select {
+	case ok := <-done:
+		if !ok {
+			t.Error("load after panic returned wrong result")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("load after panic hangs")
+	}
+}
+
+func TestCoalescedDownloads(t *testing.T) {
+	for _, coalesce := range []string{"true", "false"} {
+		dir := t.TempDir()
+		if err := os.WriteFile(dir+"/obj", []byte("on disk"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		ts, _ := newTestServer(t, "-storage-dir", dir, "-coalesce-loads="+coalesce)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp, err := ts.Client().Get(ts.URL + "/download/obj")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusOK {
+					t.Errorf("-coalesce-loads=%s: %d", coalesce, resp.StatusCode)
+				}
+			}()
+		}
+		wg.Wait()
+		// Прочитанный однажды объект дальше отдаётся из кэша
+		if resp, body := do(t, ts, http.MethodGet, "/download/obj", ""); resp.StatusCode != http.StatusOK || body != "on disk" {
+			t.Errorf("-coalesce-loads=%s: %d %q", coalesce, resp.StatusCode, body)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// listFolders — «папки» на уровне prefix: общие префиксы ключей до следующего delimiter
+// включительно, без повторов, по порядку. Обходится только директория префикса,
+// а размеры объектов не нужны, поэтому дерево папок строится без чтения файлов.
+func (s *Storage) listFolders(tenant, prefix, delimiter string) ([]string, error) {
+	full := prefix
+	if tenant != "" {
+		full = tenant + "/" + prefix
+	}
+	folders := make(map[string]bool)
+	add := func(key string) error {
+		if !strings.HasPrefix(key, full) {
+			return nil
+		}
+		rest := key[len(full):]
+		if i := strings.Index(rest, delimiter); i >= 0 {
+			folders[prefix+rest[:i+len(delimiter)]] = true
+		}
+		return nil
+	}
+
+	// Объекты отложенной записи есть пока только в кэше
+	order, _ := s.cachedKeys()
+	for _, key := range order {
+		add(key)
+	}
+	if err := s.walkPrefixKeys(full, add); err != nil {
+		return nil, err
+	}
+
+	list := make([]string, 0, len(folders))
+	for folder := range folders {
+		list = append(list, folder)
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+// handleListFolders — GET /list?foldersOnly=true&prefix=photos/&delimiter=/ — только
+// «папки» на уровне префикса, без объектов: для дерева папок, раскрываемого по уровням.
+// Разделитель по умолчанию "/"; страницы — как у списка объектов, по marker и limit.
+func handleListFolders(w http.ResponseWriter, r *http.Request, storage *Storage, marker string, limit int) {
+	q := r.URL.Query()
+	prefix := storage.NormalizeKey(q.Get("prefix"))
+	if !checkPrefix(w, prefix) {
+		return
+	}
+	delimiter := q.Get("delimiter")
+	if delimiter == "" {
+		delimiter = "/"
+	}
+
+	folders, err := storage.listFolders(Tenant(r), prefix, delimiter)
+	if err != nil {
+		log.Printf("Ошибка при чтении папок под префиксом %s: %v", logKey(prefix), logErr(err))
+		http.Error(w, "Ошибка чтения хранилища", http.StatusInternalServerError)
+		return
+	}
+	page := make([]string, 0)
+	for _, folder := range folders {
+		if folder <= marker {
+			continue
+		}
+		if limit > 0 && len(page) == limit {
+			w.Header().Set(TRUNCATED_HEADER, "true")
+			w.Header().Set(MARKER_HEADER, page[len(page)-1])
+			break
+		}
+		page = append(page, folder)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
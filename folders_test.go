@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestListFolders(t *testing.T) {
+	dir := t.TempDir()
+	// Папка только на диске и папки объектов в кэше выводятся вместе; хост без
+	// поддиректории видит и директории других хостов
+	if err := os.MkdirAll(dir+"/photos/2023", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dir+"/photos/2023/old", []byte("on disk"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ts, _ := newTestServer(t, "-storage-dir", dir, "-virtual-hosts", "a.test=tenant-a,127.0.0.1=")
+	for _, key := range []string{"top", "photos/2024/a", "photos/2024/b", "photos/2025/c", "photos/cover", "docs/x", "v1-a", "v1-b", "v2-c"} {
+		upload(t, ts, key, "1")
+	}
+	upload(t, ts, "photos/2026/d", "1", "Host", "a.test")
+
+	tests := []struct {
+		name      string
+		query     string
+		host      string
+		want      []string
+		truncated bool
+		marker    string
+	}{
+		{"root", "", "", []string{"docs/", "photos/", "tenant-a/"}, false, ""},
+		{"prefix", "&prefix=photos/", "", []string{"photos/2023/", "photos/2024/", "photos/2025/"}, false, ""},
+		{"no folders", "&prefix=photos/2024/", "", []string{}, false, ""},
+		{"delimiter", "&delimiter=-", "", []string{"tenant-", "v1-", "v2-"}, false, ""},
+		{"first page", "&prefix=photos/&limit=2", "", []string{"photos/2023/", "photos/2024/"}, true, "photos/2024/"},
+		{"next page", "&prefix=photos/&limit=2&marker=photos/2024/", "", []string{"photos/2025/"}, false, ""},
+		{"tenant", "&prefix=photos/", "a.test", []string{"photos/2026/"}, false, ""},
+	}
+	for _, tt := range tests {
+		header := []string{}
+		if tt.host != "" {
+			header = append(header, "Host", tt.host)
+		}
+		resp, body := do(t, ts, http.MethodGet, "/list?foldersOnly=true"+tt.query, "", header...)
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: %d %s", tt.name, resp.StatusCode, body)
+			continue
+		}
+		var got []string
+		if err := json.Unmarshal([]byte(body), &got); err != nil {
+			t.Fatalf("%s: %v: %s", tt.name, err, body)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: folders = %v, want %v", tt.name, got, tt.want)
+		}
+		truncated, marker := resp.Header.Get(TRUNCATED_HEADER) == "true", resp.Header.Get(MARKER_HEADER)
+		if truncated != tt.truncated || marker != tt.marker {
+			t.Errorf("%s: truncated %v marker %q, want %v %q", tt.name, truncated, marker, tt.truncated, tt.marker)
+		}
+	}
+
+	// Неверный префикс отвергается, как и у списка объектов
+	if resp, _ := do(t, ts, http.MethodGet, "/list?foldersOnly=true&prefix=../x", ""); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("foldersOnly with prefix ../x: %d, want 400", resp.StatusCode)
+	}
+}
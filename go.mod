@@ -1,3 +1,9 @@
 module e0m.ru/storage_server
 
 go 1.3
+
+require (
+	github.com/andybalholm/brotli v1.1.0
+	golang.org/x/net v0.6.0
+	golang.org/x/text v0.14.0
+)
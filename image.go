@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	DERIVED_DIR    = ".derived" // ДИРЕКТОРИЯ В ХРАНИЛИЩЕ ДЛЯ ПРОИЗВОДНЫХ ОБЪЕКТОВ (УМЕНЬШЕННЫХ КОПИЙ)
+	MAX_IMAGE_SIDE = 4096       // МАКСИМАЛЬНАЯ СТОРОНА ЗАПРАШИВАЕМОЙ КОПИИ В ПИКСЕЛЯХ
+)
+
+// ImageResizer — алгоритм масштабирования изображений
+type ImageResizer interface {
+	Resize(src image.Image, width, height int) image.Image
+}
+
+// NearestResizer — масштабирование по ближайшему соседу, без внешних зависимостей
+type NearestResizer struct{}
+
+// Resize — масштабирует изображение до width x height
+func (NearestResizer) Resize(src image.Image, width, height int) image.Image {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	b := src.Bounds()
+	for y := 0; y < height; y++ {
+		sy := b.Min.Y + y*b.Dy()/height
+		for x := 0; x < width; x++ {
+			sx := b.Min.X + x*b.Dx()/width
+			dst.Set(x, y, src.At(sx, sy))
+		}
+	}
+	return dst
+}
+
+// parseImageSize — разбирает запрошенные ширину и высоту (?w=&h=); 0 — сторона не задана
+func parseImageSize(q url.Values) (int, int, error) {
+	size := [2]int{}
+	for i, name := range []string{"w", "h"} {
+		v := q.Get(name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > MAX_IMAGE_SIDE {
+			return 0, 0, fmt.Errorf("invalid image %s: %q", name, v)
+		}
+		size[i] = n
+	}
+	return size[0], size[1], nil
+}
+
+// fitSize — размеры копии, вписанной в width x height с сохранением пропорций
+func fitSize(srcW, srcH, width, height int) (int, int) {
+	if width == 0 {
+		width = srcW * height / srcH
+	} else if height == 0 {
+		height = srcH * width / srcW
+	} else if srcW*height > srcH*width {
+		height = srcH * width / srcW
+	} else {
+		width = srcW * height / srcH
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+	return width, height
+}
+
+// isImage — проверяет, умеет ли сервер масштабировать объект такого типа
+func isImage(contentType string) bool {
+	switch contentType {
+	case "image/png", "image/jpeg", "image/gif":
+		return true
+	}
+	return false
+}
+
+// Thumbnail — возвращает уменьшенную копию изображения. Копия вычисляется при первом
+// запросе и сохраняется под производным ключом, зависящим от содержимого оригинала,
+// поэтому после изменения оригинала старая копия не отдаётся.
+// Для объектов, не являющихся изображениями, возвращает ok == false.
+func (s *Storage) Thumbnail(o obj, width, height int) (thumb obj, contentType string, ok bool, err error) {
+	contentType = http.DetectContentType(o.body)
+	if !isImage(contentType) {
+		return o, "", false, nil
+	}
+
+	etag, err := s.ETag(o.name)
+	if err != nil {
+		return o, "", false, err
+	}
+	derivedKey := fmt.Sprintf("%s-%dx%d", strings.Trim(etag, `"`), width, height)
+	path := storagePath(DERIVED_DIR) + "/" + derivedKey
+	if body, err := os.ReadFile(path); err == nil {
+		return obj{name: derivedKey, body: body, modTime: o.modTime}, contentType, true, nil
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(o.body))
+	if err != nil {
+		return o, "", false, err
+	}
+	w, h := fitSize(src.Bounds().Dx(), src.Bounds().Dy(), width, height)
+	dst := s.resizer.Resize(src, w, h)
+
+	var buf bytes.Buffer
+	switch contentType {
+	case "image/png":
+		err = png.Encode(&buf, dst)
+	case "image/jpeg":
+		err = jpeg.Encode(&buf, dst, nil)
+	case "image/gif":
+		err = gif.Encode(&buf, dst, nil)
+	}
+	if err != nil {
+		return o, "", false, err
+	}
+
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return o, "", false, err
+	}
+	return obj{name: derivedKey, body: buf.Bytes(), modTime: o.modTime}, contentType, true, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFitSize(t *testing.T) {
+	tests := []struct {
+		srcW, srcH, width, height int
+		wantW, wantH              int
+	}{
+		{40, 20, 10, 0, 10, 5},
+		{40, 20, 0, 4, 8, 4},
+		{40, 20, 10, 10, 10, 5},
+		{20, 40, 10, 10, 5, 10},
+		{1000, 1, 10, 0, 10, 1},
+	}
+	for _, tt := range tests {
+		w, h := fitSize(tt.srcW, tt.srcH, tt.width, tt.height)
+		if w != tt.wantW || h != tt.wantH {
+			t.Errorf("fitSize(%dx%d into %dx%d) = %dx%d, want %dx%d", tt.srcW, tt.srcH, tt.width, tt.height, w, h, tt.wantW, tt.wantH)
+		}
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	ts, _ := newTestServer(t)
+	src := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for x := 0; x < 40; x++ {
+		for y := 0; y < 20; y++ {
+			src.Set(x, y, color.RGBA{uint8(x * 6), uint8(y * 12), 0, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+	upload(t, ts, "photo", buf.String())
+	upload(t, ts, "text", "not an image")
+
+	tests := []struct {
+		path         string
+		status       int
+		wantW, wantH int
+	}{
+		{"/download/photo?w=10", http.StatusOK, 10, 5},
+		{"/download/photo?h=4", http.StatusOK, 8, 4},
+		{"/download/photo?w=10&h=10", http.StatusOK, 10, 5},
+		{"/download/photo?w=10", http.StatusOK, 10, 5},
+		{"/download/photo?w=0", http.StatusBadRequest, 0, 0},
+		{"/download/photo?w=5000", http.StatusBadRequest, 0, 0},
+		{"/download/photo?h=x", http.StatusBadRequest, 0, 0},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, ts, http.MethodGet, tt.path, "")
+		if resp.StatusCode != tt.status {
+			t.Errorf("GET %s: %d, want %d", tt.path, resp.StatusCode, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "image/png" {
+			t.Errorf("GET %s: Content-Type %q, want image/png", tt.path, ct)
+		}
+		thumb, err := png.Decode(strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("GET %s: %v", tt.path, err)
+		}
+		if b := thumb.Bounds(); b.Dx() != tt.wantW || b.Dy() != tt.wantH {
+			t.Errorf("GET %s: %dx%d, want %dx%d", tt.path, b.Dx(), b.Dy(), tt.wantW, tt.wantH)
+		}
+	}
+	// Каждый размер вычисляется один раз и хранится как производный объект
+	if entries, err := os.ReadDir(storagePath(DERIVED_DIR)); err != nil || len(entries) != 3 {
+		t.Errorf("derived objects: %d, %v; want 3", len(entries), err)
+	}
+
+	// Не изображение отдаётся без изменений
+	if resp, body := do(t, ts, http.MethodGet, "/download/text?w=10", ""); resp.StatusCode != http.StatusOK || body != "not an image" {
+		t.Errorf("GET text?w=10: %d %q", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+// endpoint — описание маршрута для стартовой страницы
+type endpoint struct {
+	Method      string
+	Path        string
+	Description string
+}
+
+// endpoints — маршруты сервера, перечисляемые на стартовой странице
+var endpoints = []endpoint{
+	{"POST, PUT", "/upload/<key>", "Загрузить объект (If-Match — перезаписать)"},
+	{"POST", "/upload", "Загрузить объект под ключом, который назначит сервер"},
+	{"GET", "/download/<key>", "Скачать объект (Range, ?w=&h= для изображений)"},
+	{"POST", "/copy/<key>", "Копия объекта ?source=<key> без загрузки в память"},
+	{"PATCH", "/patch/<key>", "Записать фрагмент по смещению X-Offset"},
+	{"POST", "/touch/<key>", "Обновить время изменения, не меняя содержимое"},
+	{"GET, POST, DELETE", "/pin/<key>", "Закрепить объект в кэше, чтобы он не вытеснялся"},
+	{"DELETE", "/delete/<key>", "Удалить объект"},
+	{"GET", "/list", "Список объектов (?minSize=&maxSize=, ?foldersOnly=true&prefix= — только папки, If-None-Match — 304)"},
+	{"GET", "/changelog", "Последние изменения объектов (?limit=&since=)"},
+	{"GET, POST", "/manifest", "Подписанный манифест объектов и его проверка (?prefix=)"},
+	{"GET", "/usage", "Число объектов и байт под префиксом (?prefix=)"},
+	{"GET, PUT, DELETE", "/alias/<key>", "Псевдоним, отдающий другой объект (?target=<key>)"},
+	{"GET, PATCH", "/meta/<key>", "Тип содержимого, Cache-Control и теги без перезагрузки объекта"},
+	{"GET", "/stat/<key>", "Размер, время изменения, ETag и число скачиваний"},
+	{"GET, POST", "/stat", "Размер, время изменения, ETag и тип нескольких объектов (?key=)"},
+	{"GET", "/checksum/<key>", "Контрольная сумма (?algo=sha256|md5|crc32)"},
+	{"GET, POST", "/zip", "Несколько объектов одним zip-архивом"},
+	{"POST", "/files/", "Возобновляемая загрузка по протоколу tus"},
+	{"GET", "/presign/<key>", "Подписанная ссылка на загрузку (method=GET&rate= — на скачивание со своей скоростью)"},
+	{"GET, PUT", "/acl/<key>", "Права доступа к объекту"},
+	{"POST", "/lock/<key>", "Срок хранения без изменений (WORM)"},
+	{"POST, DELETE", "/lease/<key>", "Аренда ключа для согласованной записи"},
+	{"GET, PUT, DELETE", "/<bucket>/<key>", "S3-совместимый доступ к объектам"},
+	{"GET", "/<bucket>?list-type=2", "S3 ListObjectsV2"},
+	{"GET", "/metrics", "Метрики Prometheus"},
+	{"GET", "/stats", "Метрики в JSON"},
+	{"GET", "/admin/config", "Действующая конфигурация"},
+	{"POST", "/admin/flush", "Сбросить отложенную запись на диск"},
+	{"POST", "/admin/reindex", "Пересканировать диск и обновить состояние в памяти"},
+	{"GET", "/admin/case-collisions", "Ключи, различающиеся только регистром (?prefix=)"},
+}
+
+// indexPage — стартовая страница для браузера
+var indexPage = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>storage_server</title></head>
+<body><h1>storage_server</h1><table>
+<tr><th>Метод</th><th>Путь</th><th>Описание</th></tr>
+{{range .}}<tr><td>{{.Method}}</td><td><code>{{.Path}}</code></td><td>{{.Description}}</td></tr>
+{{end}}</table></body></html>
+`))
+
+// HandleIndex — обработчик стартовой страницы: объект indexKey, если он задан,
+// иначе список маршрутов — HTML для браузера, JSON для остальных клиентов
+func HandleIndex(w http.ResponseWriter, r *http.Request, storage *Storage, indexKey string) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodHead) {
+		return
+	}
+	if indexKey != "" {
+		// Стартовую страницу выбрал администратор, её браузер показывает, даже если это HTML.
+		// У каждого виртуального хоста она своя, в его поддиректории
+		w.Header().Set("Content-Disposition", "inline")
+		serveObject(w, r, storage, tenantPath(r, indexKey))
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "text/html") {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		indexPage.Execute(w, endpoints)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Name      string
+		Endpoints []endpoint
+	}{"storage_server", endpoints})
+}
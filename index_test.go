@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHandleIndex(t *testing.T) {
+	ts, _ := newTestServer(t)
+	resp, body := do(t, ts, http.MethodGet, "/", "", "Accept", "text/html")
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") || !strings.Contains(body, "/upload/&lt;key&gt;") {
+		t.Errorf("GET / from a browser: %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	resp, body = do(t, ts, http.MethodGet, "/", "")
+	var index struct {
+		Name      string
+		Endpoints []endpoint
+	}
+	if err := json.Unmarshal([]byte(body), &index); err != nil || len(index.Endpoints) != len(endpoints) {
+		t.Errorf("GET / from a client: %d routes (%v), want %d", len(index.Endpoints), err, len(endpoints))
+	}
+	if resp, _ := do(t, ts, http.MethodPost, "/", ""); resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST /: %d, want 405", resp.StatusCode)
+	}
+}
+
+func TestIndexKey(t *testing.T) {
+	ts, _ := newTestServer(t, "-index-key", "site/index.html")
+	// Пока объекта нет, стартовой страницы тоже нет
+	if resp, _ := do(t, ts, http.MethodGet, "/", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET / before the index object exists: %d, want 404", resp.StatusCode)
+	}
+	upload(t, ts, "site/index.html", "<h1>Hello</h1>")
+
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		resp, body := do(t, ts, method, "/", "")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s /: %d", method, resp.StatusCode)
+		}
+		// HTML, выбранный администратором, браузер показывает, а не скачивает
+		if got := resp.Header.Get("Content-Disposition"); got != "inline" {
+			t.Errorf("%s /: Content-Disposition %q, want inline", method, got)
+		}
+		if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+			t.Errorf("%s /: Content-Type %q", method, ct)
+		}
+		if want := map[string]string{http.MethodGet: "<h1>Hello</h1>", http.MethodHead: ""}[method]; body != want {
+			t.Errorf("%s /: body %q, want %q", method, body, want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// inFlightRequest — выполняемый запрос, который можно прервать при остановке
+type inFlightRequest struct {
+	method string
+	path   string
+	id     string
+	start  time.Time
+	cancel context.CancelFunc
+}
+
+// InFlight — запросы, которые сейчас выполняются. Нужен, чтобы при остановке
+// прервать зависшие запросы по истечении -shutdown-timeout и записать в журнал, какие именно.
+type InFlight struct {
+	mu       sync.Mutex
+	next     uint64
+	requests map[uint64]*inFlightRequest
+}
+
+// NewInFlight — конструктор пустого списка выполняемых запросов
+func NewInFlight() *InFlight {
+	return &InFlight{requests: make(map[uint64]*inFlightRequest)}
+}
+
+// CancelAll — прерывает все выполняемые запросы (отменяет их контекст)
+// и возвращает их для журнала
+func (f *InFlight) CancelAll() []*inFlightRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	cancelled := make([]*inFlightRequest, 0, len(f.requests))
+	for _, req := range f.requests {
+		req.cancel()
+		cancelled = append(cancelled, req)
+	}
+	return cancelled
+}
+
+// WithInFlight — учитывает запрос в списке выполняемых на всё время обработки
+func WithInFlight(f *InFlight, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		req := &inFlightRequest{method: r.Method, path: r.URL.Path, id: RequestID(r), start: time.Now(), cancel: cancel}
+
+		f.mu.Lock()
+		f.next++
+		n := f.next
+		f.requests[n] = req
+		f.mu.Unlock()
+		defer func() {
+			f.mu.Lock()
+			delete(f.requests, n)
+			f.mu.Unlock()
+		}()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
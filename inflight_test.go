@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithInFlight(t *testing.T) {
+	f := NewInFlight()
+	started, done := make(chan struct{}), make(chan struct{})
+	handler := WithInFlight(f, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+	}))
+	go func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/upload/k", nil))
+		close(done)
+	}()
+	<-started
+
+	cancelled := f.CancelAll()
+	if len(cancelled) != 1 || cancelled[0].method != http.MethodPost || cancelled[0].path != "/upload/k" {
+		t.Fatalf("CancelAll = %+v, want the running POST /upload/k", cancelled)
+	}
+	// Отмена контекста прерывает обработчик, и запрос уходит из списка
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler is not cancelled")
+	}
+	if n := len(f.CancelAll()); n != 0 {
+		t.Errorf("%d requests in flight after the handler returned", n)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	logs := captureLog(t)
+	storage, cfg := newTestStorage(t, "-write-back", "-flush-interval", "1h")
+	server, inflight := NewServer(cfg, storage)
+	ts := httptest.NewUnstartedServer(server.Handler)
+	ts.Start()
+	t.Cleanup(ts.Close)
+
+	upload(t, ts, "queued", "data")
+	// Клиент начал загрузку и завис, не дописав тело
+	finish := holdRequest(t, ts, http.MethodPost, "/upload/stuck")
+
+	start := time.Now()
+	Shutdown(ts.Config, storage, inflight, 50*time.Millisecond)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Shutdown took %v with a stuck request", elapsed)
+	}
+	if code := finish("data"); code == http.StatusCreated {
+		t.Error("stuck upload completed after shutdown")
+	}
+	if !strings.Contains(logs.String(), "POST /upload/stuck") || !strings.Contains(logs.String(), "прерван при остановке") {
+		t.Errorf("cancelled request is not logged:\n%s", logs.String())
+	}
+	// Отложенная запись сброшена на диск до выхода
+	if data, err := os.ReadFile(storage.objectPath("queued")); err != nil || string(data) != "data" {
+		t.Errorf("queued object on disk after shutdown: %q, %v", data, err)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	NAME_MAX          = 255                     // МАКСИМАЛЬНАЯ ДЛИНА ИМЕНИ ФАЙЛА В БАЙТАХ (ОБЫЧНО NAME_MAX ФС)
+	MAX_KEY_COMPONENT = NAME_MAX - len(".json") // МЕТАДАННЫЕ ЛЕЖАТ В ФАЙЛЕ <КЛЮЧ>.json, ОН ТОЖЕ ДОЛЖЕН ВЛЕЗТЬ
+	MAX_KEY_DEPTH     = 32                      // МАКСИМУМ ЧАСТЕЙ ВЛОЖЕННОГО КЛЮЧА ПО УМОЛЧАНИЮ
+	NORMALIZE_LOWER   = "lower"                 // ПРИВОДИТЬ КЛЮЧИ К НИЖНЕМУ РЕГИСТРУ
+	NORMALIZE_NFC     = "nfc"                   // ПРИВОДИТЬ КЛЮЧИ К ЮНИКОДНОЙ ФОРМЕ NFC
+)
+
+// maxKeyDepth — максимум частей ключа через "/", задаётся флагом -max-key-depth при запуске
+var maxKeyDepth = MAX_KEY_DEPTH
+
+// NormalizeKey — приводит ключ из запроса к единому виду, если это включено в
+// конфигурации: к форме NFC (иначе "й" из одного и двух кодовых точек — разные
+// объекты) и к нижнему регистру (иначе Foo.txt и foo.txt сталкиваются на
+// нечувствительных к регистру ФС). Объекты, сохранённые до включения
+// нормализации под другим написанием, по нормализованному ключу не найдутся.
+func (s *Storage) NormalizeKey(key string) string {
+	if s.normalizeNFC {
+		key = norm.NFC.String(key)
+	}
+	if s.normalizeLower {
+		key = strings.ToLower(key)
+	}
+	return key
+}
+
+// validateKey — проверяет, что ключ можно безопасно использовать как путь к файлу.
+// Ключ может быть вложенным ("bucket/dir/name"), каждая его часть становится
+// директорией или файлом на диске.
+func validateKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("empty key")
+	}
+	if strings.ContainsRune(key, 0) {
+		return fmt.Errorf("key must not contain NUL bytes")
+	}
+	// Имена, начинающиеся с точки, на верхнем уровне заняты служебными директориями (.meta, .tmp)
+	if key[0] == '.' {
+		return fmt.Errorf("key must not start with '.'")
+	}
+	parts := strings.Split(key, "/")
+	// Очень глубокие ключи замедляют обход диска и упираются в ограничения ФС на длину пути
+	if len(parts) > maxKeyDepth {
+		return fmt.Errorf("key has %d path segments, at most %d are allowed", len(parts), maxKeyDepth)
+	}
+	for _, part := range parts {
+		// Пустые части, "." и ".." указывали бы за пределы объекта
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("key must not contain empty, '.' or '..' path segments")
+		}
+		// Слишком длинное имя файла ФС отвергла бы с невнятной ошибкой ENAMETOOLONG
+		if len(part) > MAX_KEY_COMPONENT {
+			return fmt.Errorf("key segment is %d bytes long, at most %d bytes are allowed", len(part), MAX_KEY_COMPONENT)
+		}
+	}
+	return nil
+}
+
+// checkKey — проверяет ключ из запроса и отвечает 400, если он недопустим
+func checkKey(w http.ResponseWriter, key string) bool {
+	if err := validateKey(key); err != nil {
+		http.Error(w, "Недопустимый ключ: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+var (
+	ErrKeyIsPrefix    = errors.New("key conflicts with existing objects nested under it")        // На месте файла объекта уже директория
+	ErrPrefixIsObject = errors.New("a prefix of the key is an existing object, not a directory") // Часть пути ключа — файл другого объекта
+)
+
+// checkKeyPath — проверяет, что объект с ключом можно записать рядом с уже сохранёнными:
+// на диске его путь не занят директорией вложенных объектов (a, когда есть a/b) и ни
+// одна из родительских директорий не является файлом другого объекта (a/b, когда есть a).
+// Вызывается с захваченным мьютексом.
+func (s *Storage) checkKeyPath(key string) error {
+	return s.backend.CheckKey(key)
+}
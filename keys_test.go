@@ -0,0 +1,150 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestValidateKey(t *testing.T) {
+	long := strings.Repeat("k", MAX_KEY_COMPONENT)
+	tests := []struct {
+		key   string
+		valid bool
+	}{
+		{"a", true},
+		{"dir/sub/file.txt", true},
+		{long, true},
+		{"dir/" + long, true},
+		{long + "k", false},
+		{"dir/" + long + "k/file", false},
+		{strings.Repeat("k", 300), false},
+		{"", false},
+		{"a\x00b", false},
+		{".meta", false},
+		{"a//b", false},
+		{"a/", false},
+		{"a/./b", false},
+		{"a/../b", false},
+	}
+	for _, tt := range tests {
+		if err := validateKey(tt.key); (err == nil) != tt.valid {
+			t.Errorf("validateKey(%.20q… len %d) = %v, want valid %v", tt.key, len(tt.key), err, tt.valid)
+		}
+	}
+}
+
+func TestLongKeyUpload(t *testing.T) {
+	ts, _ := newTestServer(t)
+	long := strings.Repeat("k", MAX_KEY_COMPONENT)
+	tests := []struct {
+		key    string
+		status int
+	}{
+		{long, http.StatusCreated},
+		{"dir/" + long, http.StatusCreated},
+		{long + "k", http.StatusBadRequest},
+		{strings.Repeat("k", 300), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		// Ключ за пределом ФС отклоняется с понятным 400, а не с 500 от ENAMETOOLONG
+		resp, body := do(t, ts, http.MethodPost, "/upload/"+tt.key, "data")
+		if resp.StatusCode != tt.status {
+			t.Errorf("upload key of %d bytes: %d %s, want %d", len(tt.key), resp.StatusCode, body, tt.status)
+		}
+		if tt.status == http.StatusBadRequest && !strings.Contains(body, "Недопустимый ключ") {
+			t.Errorf("upload key of %d bytes: message %q does not explain the key", len(tt.key), body)
+		}
+		if tt.status != http.StatusCreated {
+			continue
+		}
+		// Метаданные в <ключ>.json тоже помещаются под предел
+		if resp, _ := do(t, ts, http.MethodGet, "/checksum/"+tt.key, ""); resp.StatusCode != http.StatusOK {
+			t.Errorf("checksum of key of %d bytes: %d", len(tt.key), resp.StatusCode)
+		}
+	}
+}
+
+func TestNormalizeKeys(t *testing.T) {
+	// "й" одной кодовой точкой и как "и" с комбинируемой краткой
+	composed, decomposed := "\u0439.txt", "\u0438\u0306.txt"
+	tests := []struct {
+		flag           string
+		upload, lookup string
+		found          bool
+	}{
+		{"", "Foo.txt", "foo.txt", false},
+		{"", composed, decomposed, false},
+		{"lower", "Foo.txt", "foo.txt", true},
+		{"lower", "dir/FOO.txt", "Dir/foo.TXT", true},
+		{"lower", composed, decomposed, false},
+		{"nfc", composed, decomposed, true},
+		{"nfc", decomposed, composed, true},
+		{"nfc", "Foo.txt", "foo.txt", false},
+		{"lower,nfc", "\u0401" + decomposed, "\u0451" + composed, true},
+	}
+	for _, tt := range tests {
+		ts, _ := newTestServer(t, "-normalize-keys", tt.flag)
+		upload(t, ts, url.PathEscape(tt.upload), "data")
+		resp, _ := do(t, ts, http.MethodGet, "/download/"+url.PathEscape(tt.lookup), "")
+		if found := resp.StatusCode == http.StatusOK; found != tt.found {
+			t.Errorf("-normalize-keys %q: %q uploaded, %q found %v, want %v", tt.flag, tt.upload, tt.lookup, found, tt.found)
+		}
+	}
+	if _, err := ParseConfig([]string{"-normalize-keys", "upper"}); err == nil {
+		t.Error("-normalize-keys upper accepted, want error")
+	}
+}
+
+func TestMaxKeyDepth(t *testing.T) {
+	ts, _ := newTestServer(t, "-max-key-depth", "3")
+	tests := []struct {
+		key    string
+		status int
+	}{
+		{"k", http.StatusCreated},
+		{"a/b/c", http.StatusCreated},
+		{"a/b/c/d", http.StatusBadRequest},
+		{strings.Repeat("x/", 40) + "x", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if resp, body := do(t, ts, http.MethodPost, "/upload/"+tt.key, "data"); resp.StatusCode != tt.status {
+			t.Errorf("upload %s: %d %s, want %d", tt.key, resp.StatusCode, body, tt.status)
+		}
+	}
+	// Предел действует и при чтении: за ним объекта быть не может
+	if resp, _ := do(t, ts, http.MethodGet, "/download/a/b/c/d", ""); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("download of too deep key: %d, want 400", resp.StatusCode)
+	}
+	if _, err := ParseConfig([]string{"-max-key-depth", "0"}); err == nil {
+		t.Error("-max-key-depth 0 is accepted")
+	}
+}
+
+func TestKeyPathCollisions(t *testing.T) {
+	// С отложенной записью конфликт виден и до того, как объекты попали на диск
+	for _, args := range [][]string{nil, {"-write-back", "-flush-interval", "1h"}} {
+		ts, _ := newTestServer(t, args...)
+		upload(t, ts, "dir/obj", "1")
+		upload(t, ts, "file", "1")
+
+		tests := []struct {
+			key     string
+			message string
+		}{
+			{"dir", ErrKeyIsPrefix.Error() + ": dir"},
+			{"file/obj", ErrPrefixIsObject.Error() + ": file"},
+			{"dir/obj/deeper/obj", ErrPrefixIsObject.Error() + ": dir/obj"},
+		}
+		for _, tt := range tests {
+			resp, body := do(t, ts, http.MethodPost, "/upload/"+tt.key, "2")
+			if resp.StatusCode != http.StatusConflict || !strings.Contains(body, tt.message) {
+				t.Errorf("%v upload %s: %d %q, want 409 %q", args, tt.key, resp.StatusCode, body, tt.message)
+			}
+		}
+		// Соседние ключи с общим началом имени не конфликтуют
+		upload(t, ts, "dir2", "1")
+		upload(t, ts, "file.txt", "1")
+	}
+}
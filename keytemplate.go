@@ -0,0 +1,60 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+const (
+	KEY_TEMPLATE_RANDOM    = "random"    // 128 СЛУЧАЙНЫХ БИТ В HEX
+	KEY_TEMPLATE_UUID      = "uuid"      // СЛУЧАЙНЫЙ UUID ВЕРСИИ 4
+	KEY_TEMPLATE_TIMESTAMP = "timestamp" // ВРЕМЯ ЗАГРУЗКИ И СЛУЧАЙНЫЙ СУФФИКС: В СПИСКЕ КЛЮЧИ ИДУТ ПО ВРЕМЕНИ
+	KEY_TEMPLATE_HASH      = "hash"      // SHA-256 СОДЕРЖИМОГО: ОДИНАКОВОЕ СОДЕРЖИМОЕ ПОЛУЧАЕТ ОДИН КЛЮЧ
+	KEY_TEMPLATE_DATE      = "date"      // ДАТА ЗАГРУЗКИ ПАПКАМИ И UUID: 2024/01/15/<uuid>
+)
+
+// DATE_KEY_DEPTH — СКОЛЬКО ЧАСТЕЙ В КЛЮЧЕ ПО ШАБЛОНУ KEY_TEMPLATE_DATE
+const DATE_KEY_DEPTH = 4
+
+// checkKeyTemplate — проверяет имя шаблона ключей -key-template
+func checkKeyTemplate(name string) error {
+	switch name {
+	case KEY_TEMPLATE_RANDOM, KEY_TEMPLATE_UUID, KEY_TEMPLATE_TIMESTAMP, KEY_TEMPLATE_HASH, KEY_TEMPLATE_DATE:
+		return nil
+	}
+	return fmt.Errorf("unknown key template %q, expected %q, %q, %q, %q or %q", name,
+		KEY_TEMPLATE_RANDOM, KEY_TEMPLATE_UUID, KEY_TEMPLATE_TIMESTAMP, KEY_TEMPLATE_HASH, KEY_TEMPLATE_DATE)
+}
+
+// newUUID — случайный UUID версии 4 (RFC 4122)
+func newUUID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// generateKey — новый ключ для загрузки без ключа по шаблону -key-template. Ключ по
+// шаблону KEY_TEMPLATE_HASH зависит от содержимого data, остальные — нет.
+func (s *Storage) generateKey(data []byte) string {
+	now := time.Now().UTC()
+	switch s.keyTemplate {
+	case KEY_TEMPLATE_UUID:
+		return newUUID()
+	case KEY_TEMPLATE_TIMESTAMP:
+		// Доли секунды — чтобы ключи загрузок одной секунды тоже шли по порядку
+		return now.Format("20060102T150405.000000000Z") + "-" + randomID()
+	case KEY_TEMPLATE_HASH:
+		sum := sha256.Sum256(data)
+		return hex.EncodeToString(sum[:])
+	case KEY_TEMPLATE_DATE:
+		return now.Format("2006/01/02") + "/" + newUUID()
+	}
+	return randomID() + randomID()
+}
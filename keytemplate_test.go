@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeyTemplate(t *testing.T) {
+	const uuid = `[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}`
+	today := time.Now().UTC().Format("2006/01/02")
+	tests := []struct {
+		template string
+		key      string // Шаблон назначенного ключа
+	}{
+		{KEY_TEMPLATE_RANDOM, `[0-9a-f]{32}`},
+		{KEY_TEMPLATE_UUID, uuid},
+		{KEY_TEMPLATE_TIMESTAMP, `\d{8}T\d{6}\.\d{9}Z-[0-9a-f]+`},
+		{KEY_TEMPLATE_DATE, regexp.QuoteMeta(today) + "/" + uuid},
+	}
+	for _, tt := range tests {
+		ts, _ := newTestServer(t, "-key-template", tt.template)
+		pattern := regexp.MustCompile(`^/download/` + tt.key + `$`)
+		keys := make([]string, 0)
+		// Одинаковое содержимое получает разные ключи
+		for i := 0; i < 3; i++ {
+			resp, body := do(t, ts, http.MethodPost, "/upload", "same")
+			location := resp.Header.Get("Location")
+			if resp.StatusCode != http.StatusCreated || !pattern.MatchString(location) {
+				t.Fatalf("%s: %d Location %q %s", tt.template, resp.StatusCode, location, body)
+			}
+			if resp, body := do(t, ts, http.MethodGet, location, ""); resp.StatusCode != http.StatusOK || body != "same" {
+				t.Errorf("%s: GET %s: %d %q", tt.template, location, resp.StatusCode, body)
+			}
+			keys = append(keys, strings.TrimPrefix(location, "/download/"))
+		}
+		if keys[0] == keys[1] || keys[1] == keys[2] || keys[0] == keys[2] {
+			t.Errorf("%s: repeated keys %v", tt.template, keys)
+		}
+		// Ключи по времени в списке идут в порядке загрузки
+		if tt.template == KEY_TEMPLATE_TIMESTAMP && !sort.StringsAreSorted(keys) {
+			t.Errorf("%s: keys out of upload order: %v", tt.template, keys)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"-key-template", "sequence"},
+		{"-key-template", KEY_TEMPLATE_DATE, "-max-key-depth", "3"},
+	} {
+		if _, err := ParseConfig(args); err == nil {
+			t.Errorf("ParseConfig accepted %v", args)
+		}
+	}
+}
+
+func TestKeyTemplateHash(t *testing.T) {
+	ts, _ := newTestServer(t, "-key-template", KEY_TEMPLATE_HASH)
+	sum := func(data string) string {
+		h := sha256.Sum256([]byte(data))
+		return "/download/" + hex.EncodeToString(h[:])
+	}
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"first", "same", http.StatusCreated},
+		// То же содержимое — адрес уже сохранённого объекта, а не 409
+		{"duplicate", "same", http.StatusOK},
+		{"other content", "other", http.StatusCreated},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, ts, http.MethodPost, "/upload", tt.body)
+		if resp.StatusCode != tt.status || resp.Header.Get("Location") != sum(tt.body) {
+			t.Errorf("%s: %d Location %q %s, want %d %s", tt.name, resp.StatusCode, resp.Header.Get("Location"), body, tt.status, sum(tt.body))
+		}
+	}
+	if got := listNames(t, ts, ""); len(got) != 2 {
+		t.Errorf("GET /list = %v, want two objects", got)
+	}
+}
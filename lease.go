@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	LEASE_PREFIX_LEN = len("/lease/")   // ДЛИНА ПРЕФИКСА ДЛЯ МАРШРУТА АРЕНДЫ КЛЮЧЕЙ
+	LEASE_HEADER     = "X-Lease-Token"  // ЗАГОЛОВОК С ТОКЕНОМ АРЕНДЫ
+	LEASE_TTL        = 30 * time.Second // СРОК АРЕНДЫ ПО УМОЛЧАНИЮ
+	MAX_LEASE_TTL    = time.Hour        // МАКСИМАЛЬНЫЙ СРОК АРЕНДЫ
+)
+
+// lease — исключительная аренда ключа одним писателем
+type lease struct {
+	token   string
+	expires time.Time
+}
+
+// Leases — аренды ключей в памяти. Пока аренда не истекла, изменять объект
+// может только клиент, предъявивший её токен. В отличие от срока хранения (WORM),
+// аренда короткая и нужна писателям для взаимного исключения.
+type Leases struct {
+	mu     sync.Mutex
+	leases map[string]lease
+}
+
+// NewLeases — конструктор хранилища аренд
+func NewLeases() *Leases {
+	return &Leases{leases: make(map[string]lease)}
+}
+
+// active — действующая аренда ключа; истёкшие аренды удаляются. Вызывается с захваченным мьютексом.
+func (l *Leases) active(key string) (lease, bool) {
+	held, ok := l.leases[key]
+	if ok && time.Now().After(held.expires) {
+		delete(l.leases, key)
+		return lease{}, false
+	}
+	return held, ok
+}
+
+// Acquire — берёт аренду ключа на ttl или продлевает её, если token — токен текущей аренды.
+// Возвращает false, если ключ арендован другим клиентом.
+func (l *Leases) Acquire(key, token string, ttl time.Duration) (lease, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	held, ok := l.active(key)
+	if ok && held.token != token {
+		return lease{}, false
+	}
+	if !ok {
+		held.token = randomID()
+	}
+	held.expires = time.Now().Add(ttl)
+	l.leases[key] = held
+	return held, true
+}
+
+// Release — снимает аренду ключа, если token — её токен
+func (l *Leases) Release(key, token string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	held, ok := l.active(key)
+	if !ok || held.token != token {
+		return false
+	}
+	delete(l.leases, key)
+	return true
+}
+
+// Allows — может ли клиент с токеном token изменять объект
+func (l *Leases) Allows(key, token string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	held, ok := l.active(key)
+	return !ok || held.token == token
+}
+
+// checkLease — проверяет, что ключ не арендован другим писателем, и иначе отвечает 409
+func checkLease(w http.ResponseWriter, r *http.Request, storage *Storage, key string) bool {
+	if storage.leases.Allows(key, r.Header.Get(LEASE_HEADER)) {
+		return true
+	}
+	http.Error(w, "Объект арендован другим клиентом", http.StatusConflict)
+	return false
+}
+
+// HandleLease — обработчик аренды ключей: POST /lease/<key>?seconds=N берёт аренду
+// (или продлевает её с заголовком X-Lease-Token), DELETE с X-Lease-Token снимает.
+// Пока аренда действует, загрузка и удаление объекта без её токена отклоняются с 409.
+func HandleLease(w http.ResponseWriter, r *http.Request, storage *Storage) {
+	key := storage.RequestKey(r, r.URL.Path[LEASE_PREFIX_LEN:])
+	if !checkKey(w, key) {
+		return
+	}
+	token := r.Header.Get(LEASE_HEADER)
+
+	switch r.Method {
+	case http.MethodPost:
+		ttl := LEASE_TTL
+		if v := r.URL.Query().Get("seconds"); v != "" {
+			seconds, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || seconds <= 0 || time.Duration(seconds)*time.Second > MAX_LEASE_TTL {
+				http.Error(w, "Срок аренды задаётся параметром seconds от 1 до "+strconv.Itoa(int(MAX_LEASE_TTL/time.Second)), http.StatusBadRequest)
+				return
+			}
+			ttl = time.Duration(seconds) * time.Second
+		}
+		if !authorizeObject(w, r, storage, key, true) {
+			return
+		}
+		held, ok := storage.leases.Acquire(key, token, ttl)
+		if !ok {
+			http.Error(w, "Объект уже арендован другим клиентом", http.StatusConflict)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Key     string
+			Token   string
+			Expires time.Time
+		}{clientKey(r, key), held.token, held.expires})
+	case http.MethodDelete:
+		if !storage.leases.Release(key, token) {
+			http.Error(w, "Аренда не найдена или принадлежит другому клиенту", http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w, http.MethodPost, http.MethodDelete)
+	}
+}
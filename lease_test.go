@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestLeases(t *testing.T) {
+	l := NewLeases()
+	first, ok := l.Acquire("k", "", time.Minute)
+	if !ok || first.token == "" {
+		t.Fatalf("Acquire of a free key: %+v %v", first, ok)
+	}
+	tests := []struct {
+		name string
+		op   func() bool
+		want bool
+	}{
+		{"other writer acquires", func() bool { _, ok := l.Acquire("k", "other", time.Minute); return ok }, false},
+		{"holder renews", func() bool {
+			held, ok := l.Acquire("k", first.token, time.Minute)
+			return ok && held.token == first.token
+		}, true},
+		{"holder may write", func() bool { return l.Allows("k", first.token) }, true},
+		{"other may write", func() bool { return l.Allows("k", "other") }, false},
+		{"anyone may write a free key", func() bool { return l.Allows("free", "") }, true},
+		{"other releases", func() bool { return l.Release("k", "other") }, false},
+		{"holder releases", func() bool { return l.Release("k", first.token) }, true},
+		{"released key is free", func() bool { return l.Allows("k", "") }, true},
+	}
+	for _, tt := range tests {
+		if got := tt.op(); got != tt.want {
+			t.Errorf("%s: %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Истёкшая аренда больше никому не мешает
+	l.Acquire("short", "", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if !l.Allows("short", "") {
+		t.Error("expired lease still blocks writers")
+	}
+}
+
+func TestHandleLease(t *testing.T) {
+	ts, _ := newTestServer(t)
+	upload(t, ts, "obj", "v1")
+	resp, body := do(t, ts, http.MethodPost, "/lease/obj?seconds=60", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("acquire: %d %s", resp.StatusCode, body)
+	}
+	var held struct{ Token string }
+	if err := json.Unmarshal([]byte(body), &held); err != nil || held.Token == "" {
+		t.Fatalf("acquire: %s (%v)", body, err)
+	}
+	token := []string{LEASE_HEADER, held.Token}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header []string
+		status int
+	}{
+		{"bad ttl", http.MethodPost, "/lease/obj?seconds=0", nil, http.StatusBadRequest},
+		{"too long ttl", http.MethodPost, "/lease/obj?seconds=3601", nil, http.StatusBadRequest},
+		{"second writer", http.MethodPost, "/lease/obj", nil, http.StatusConflict},
+		{"overwrite without token", http.MethodPut, "/upload/obj", []string{"If-Match", "*"}, http.StatusConflict},
+		{"delete without token", http.MethodDelete, "/delete/obj", nil, http.StatusConflict},
+		{"overwrite with token", http.MethodPut, "/upload/obj", append([]string{"If-Match", "*"}, token...), http.StatusOK},
+		{"renew", http.MethodPost, "/lease/obj", token, http.StatusOK},
+		{"release without token", http.MethodDelete, "/lease/obj", nil, http.StatusConflict},
+		{"release", http.MethodDelete, "/lease/obj", token, http.StatusNoContent},
+		{"delete after release", http.MethodDelete, "/delete/obj", nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if resp, body := do(t, ts, tt.method, tt.path, "v2", tt.header...); resp.StatusCode != tt.status {
+			t.Errorf("%s: %d %s, want %d", tt.name, resp.StatusCode, body, tt.status)
+		}
+	}
+}
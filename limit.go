@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+
+	"golang.org/x/net/netutil"
+)
+
+const RETRY_AFTER = "1" // ЧЕРЕЗ СКОЛЬКО СЕКУНД КЛИЕНТУ СТОИТ ПОВТОРИТЬ ЗАПРОС ПРИ ПЕРЕГРУЗКЕ
+
+// Semaphore — ограничитель количества одновременно выполняемых операций.
+// Нулевой (nil) семафор ничего не ограничивает.
+type Semaphore chan struct{}
+
+// NewSemaphore — конструктор семафора на n одновременных операций
+func NewSemaphore(n int) Semaphore {
+	if n <= 0 {
+		return nil
+	}
+	return make(Semaphore, n)
+}
+
+// TryAcquire — занимает слот без ожидания, возвращает false если свободных слотов нет
+func (s Semaphore) TryAcquire() bool {
+	if s == nil {
+		return true
+	}
+	select {
+	case s <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Release — освобождает ранее занятый слот
+func (s Semaphore) Release() {
+	if s == nil {
+		return
+	}
+	<-s
+}
+
+// LimitConcurrency — обёртка над обработчиком, отвечающая 503 при превышении лимита
+// одновременных запросов вместо того, чтобы замедлять всех клиентов
+func LimitConcurrency(sem Semaphore, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !sem.TryAcquire() {
+			w.Header().Set("Retry-After", RETRY_AFTER)
+			http.Error(w, "Сервер перегружен, повторите запрос позже", http.StatusServiceUnavailable)
+			return
+		}
+		defer sem.Release()
+		next(w, r)
+	}
+}
+
+// ClientLimiter — ограничитель одновременных запросов одного клиента, чтобы один
+// активный клиент не занимал все слоты общего семафора. Нулевой (nil) ничего не ограничивает.
+type ClientLimiter struct {
+	mu     sync.Mutex
+	max    int            // Максимум одновременных запросов клиента
+	active map[string]int // Выполняемые запросы по клиентам
+}
+
+// NewClientLimiter — конструктор ограничителя на n одновременных запросов клиента
+func NewClientLimiter(n int) *ClientLimiter {
+	if n <= 0 {
+		return nil
+	}
+	return &ClientLimiter{max: n, active: make(map[string]int)}
+}
+
+// TryAcquire — занимает слот клиента без ожидания, возвращает false если клиент исчерпал лимит
+func (l *ClientLimiter) TryAcquire(client string) bool {
+	if l == nil {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[client] >= l.max {
+		return false
+	}
+	l.active[client]++
+	return true
+}
+
+// Release — освобождает слот клиента
+func (l *ClientLimiter) Release(client string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// Записи ушедших клиентов удаляются, чтобы карта не росла бесконечно
+	if l.active[client]--; l.active[client] <= 0 {
+		delete(l.active, client)
+	}
+}
+
+// clientID — кем считать клиента: авторизованный клиент по имени, аноним по IP-адресу
+func clientID(r *http.Request) string {
+	if id := Identity(r); id != "" {
+		return "user:" + id
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// LimitPerClient — обёртка над обработчиком, отвечающая 429 клиенту, превысившему
+// свой лимит одновременных запросов, не мешая остальным клиентам
+func LimitPerClient(limiter *ClientLimiter, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		client := clientID(r)
+		if !limiter.TryAcquire(client) {
+			w.Header().Set("Retry-After", RETRY_AFTER)
+			http.Error(w, "Слишком много одновременных запросов, повторите запрос позже", http.StatusTooManyRequests)
+			return
+		}
+		defer limiter.Release(client)
+		next(w, r)
+	}
+}
+
+// ErrMemoryBudget — буферизуемые тела загрузок не помещаются в общий бюджет памяти
+var ErrMemoryBudget = errors.New("upload memory budget exhausted")
+
+// MemoryBudget — общий для всех загрузок предел памяти под тела запросов, которые
+// читаются в память целиком. Лимит размера одного объекта не спасает от множества
+// одновременных загрузок; бюджет ограничивает их сумму. Нулевой (nil) ничего не ограничивает.
+type MemoryBudget struct {
+	mu    sync.Mutex
+	limit int64 // Предел в байтах
+	used  int64 // Занято сейчас всеми выполняемыми загрузками
+}
+
+// NewMemoryBudget — конструктор бюджета на limit байт
+func NewMemoryBudget(limit int64) *MemoryBudget {
+	if limit <= 0 {
+		return nil
+	}
+	return &MemoryBudget{limit: limit}
+}
+
+// TryReserve — занимает n байт без ожидания, возвращает false если бюджет исчерпан
+func (b *MemoryBudget) TryReserve(n int64) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.used+n > b.limit {
+		return false
+	}
+	b.used += n
+	return true
+}
+
+// Release — возвращает n байт в бюджет
+func (b *MemoryBudget) Release(n int64) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.used -= n
+	b.mu.Unlock()
+}
+
+// reservation — часть бюджета, занятая одним запросом
+type reservation struct {
+	budget   *MemoryBudget
+	reserved int64 // Занято этим запросом
+	read     int64 // Прочитано из тела (после распаковки)
+}
+
+// reader — оборачивает тело так, что каждый прочитанный сверх занятого байт
+// занимается в бюджете; при нехватке чтение прерывается ErrMemoryBudget
+func (res *reservation) reader(body io.Reader) io.Reader {
+	return readerFunc(func(p []byte) (int, error) {
+		n, err := body.Read(p)
+		res.read += int64(n)
+		if extra := res.read - res.reserved; extra > 0 {
+			if !res.budget.TryReserve(extra) {
+				return n, ErrMemoryBudget
+			}
+			res.reserved += extra
+		}
+		return n, err
+	})
+}
+
+// readerFunc — функция как io.Reader
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
+
+// memoryReservation — часть бюджета, занятая запросом в LimitMemory (nil — без бюджета)
+func memoryReservation(r *http.Request) *reservation {
+	res, _ := r.Context().Value(memoryKey).(*reservation)
+	return res
+}
+
+// LimitMemory — обёртка над обработчиком, читающим тело в память: тело известного
+// размера (Content-Length) занимает бюджет сразу, и при нехватке клиент сразу получает
+// 503, не передавая данные. Остальное занимается по мере чтения в readUploadBody.
+// Вся занятая часть возвращается после ответа, когда тело уже не нужно.
+func LimitMemory(budget *MemoryBudget, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if budget == nil {
+			next(w, r)
+			return
+		}
+		res := &reservation{budget: budget}
+		if r.ContentLength > 0 {
+			if !budget.TryReserve(r.ContentLength) {
+				w.Header().Set("Retry-After", RETRY_AFTER)
+				http.Error(w, "Сервер перегружен загрузками, повторите запрос позже", http.StatusServiceUnavailable)
+				return
+			}
+			res.reserved = r.ContentLength
+		}
+		defer func() { budget.Release(res.reserved) }()
+		next(w, r.WithContext(context.WithValue(r.Context(), memoryKey, res)))
+	}
+}
+
+// Listen — слушает addr, принимая не больше maxConns соединений одновременно (0 — без
+// ограничений). Лишние соединения ждут в очереди ядра, пока не закроется одно из принятых,
+// а не отклоняются, как запросы сверх -max-uploads.
+func Listen(addr string, maxConns int) (net.Listener, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil || maxConns <= 0 {
+		return ln, err
+	}
+	return netutil.LimitListener(ln, maxConns), nil
+}
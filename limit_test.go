@@ -0,0 +1,326 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// busyHandler — обработчик, который сообщает о начале в started и ждёт закрытия release
+func busyHandler(started chan<- struct{}, release <-chan struct{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}
+}
+
+func TestLimitConcurrency(t *testing.T) {
+	for _, limit := range []int{1, 2, 5} {
+		started, release := make(chan struct{}), make(chan struct{})
+		handler := LimitConcurrency(NewSemaphore(limit), busyHandler(started, release))
+
+		// limit запросов занимают все слоты и ждут
+		var wg sync.WaitGroup
+		codes := make([]int, limit)
+		for i := 0; i < limit; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				rec := httptest.NewRecorder()
+				handler(rec, httptest.NewRequest(http.MethodPost, "/upload/k", nil))
+				codes[i] = rec.Code
+			}(i)
+			<-started
+		}
+
+		// Следующий получает 503 сразу, не дожидаясь освобождения слота
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/upload/k", nil))
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("limit %d: request %d got %d, want 503", limit, limit+1, rec.Code)
+		}
+		if got := rec.Header().Get("Retry-After"); got != RETRY_AFTER {
+			t.Errorf("limit %d: Retry-After = %q, want %q", limit, got, RETRY_AFTER)
+		}
+
+		close(release)
+		wg.Wait()
+		for i, code := range codes {
+			if code != http.StatusOK {
+				t.Errorf("limit %d: request %d got %d, want 200", limit, i+1, code)
+			}
+		}
+		// Освободившийся слот снова доступен
+		go func() { <-started }()
+		rec = httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/upload/k", nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("limit %d: request after release got %d, want 200", limit, rec.Code)
+		}
+	}
+}
+
+func TestLimitConcurrencyUnlimited(t *testing.T) {
+	sem := NewSemaphore(0)
+	for i := 0; i < 100; i++ {
+		if !sem.TryAcquire() {
+			t.Fatalf("unlimited semaphore refused acquire %d", i+1)
+		}
+	}
+}
+
+func TestUploadLimit(t *testing.T) {
+	ts, _ := newTestServer(t, "-max-uploads", "2", "-max-downloads", "1")
+	upload(t, ts, "obj", "data")
+
+	// Две загрузки заняли оба слота: третья получает 503
+	finish := []func(string) int{
+		holdRequest(t, ts, http.MethodPost, "/upload/a"),
+		holdRequest(t, ts, http.MethodPost, "/upload/b"),
+	}
+	resp, _ := do(t, ts, http.MethodPost, "/upload/c", "data")
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") != RETRY_AFTER {
+		t.Errorf("third upload: %d Retry-After %q, want 503 with Retry-After %s", resp.StatusCode, resp.Header.Get("Retry-After"), RETRY_AFTER)
+	}
+	// У скачиваний свой лимит, занятые загрузки им не мешают
+	if resp, _ := do(t, ts, http.MethodGet, "/download/obj", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("download during uploads: %d, want 200", resp.StatusCode)
+	}
+
+	for i, f := range finish {
+		if code := f("data"); code != http.StatusCreated {
+			t.Errorf("held upload %d: %d, want 201", i+1, code)
+		}
+	}
+	if resp, _ := do(t, ts, http.MethodPost, "/upload/c", "data"); resp.StatusCode != http.StatusCreated {
+		t.Errorf("upload after slots freed: %d, want 201", resp.StatusCode)
+	}
+}
+
+func TestClientLimiter(t *testing.T) {
+	l := NewClientLimiter(2)
+	steps := []struct {
+		acquire bool // true — занять слот, false — освободить
+		client  string
+		ok      bool
+	}{
+		{true, "ip:1", true},
+		{true, "ip:1", true},
+		{true, "ip:1", false},
+		// Исчерпанный лимит одного клиента не мешает другому
+		{true, "ip:2", true},
+		{false, "ip:1", true},
+		{true, "ip:1", true},
+		{true, "ip:1", false},
+	}
+	for i, s := range steps {
+		if !s.acquire {
+			l.Release(s.client)
+			continue
+		}
+		if got := l.TryAcquire(s.client); got != s.ok {
+			t.Errorf("step %d: TryAcquire(%s) = %v, want %v", i+1, s.client, got, s.ok)
+		}
+	}
+	l.Release("ip:2")
+	if _, ok := l.active["ip:2"]; ok {
+		t.Errorf("released client is still tracked: %v", l.active)
+	}
+	if l := NewClientLimiter(0); !l.TryAcquire("ip:1") {
+		t.Error("unlimited client limiter refused acquire")
+	}
+}
+
+func TestClientID(t *testing.T) {
+	tests := []struct {
+		remote, identity, want string
+	}{
+		{"10.0.0.1:5555", "", "ip:10.0.0.1"},
+		{"[::1]:5555", "", "ip:::1"},
+		{"10.0.0.1:5555", "alice", "user:alice"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tt.remote
+		if tt.identity != "" {
+			r = withIdentity(r, tt.identity)
+		}
+		if got := clientID(r); got != tt.want {
+			t.Errorf("clientID(%s, %q) = %s, want %s", tt.remote, tt.identity, got, tt.want)
+		}
+	}
+}
+
+func TestPerClientLimit(t *testing.T) {
+	ts, _ := newTestServer(t, "-max-per-client", "1", "-api-key", "secret", "-users", "alice:a-key")
+	// Загрузка администратора занимает его единственный слот
+	finish := holdRequest(t, ts, http.MethodPost, "/upload/a", "Authorization", "Bearer secret")
+	resp, _ := do(t, ts, http.MethodPost, "/upload/b", "data", "Authorization", "Bearer secret")
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != RETRY_AFTER {
+		t.Errorf("second upload of the same client: %d, want 429 with Retry-After", resp.StatusCode)
+	}
+	// Другой клиент с того же IP-адреса считается отдельно
+	if resp, _ := do(t, ts, http.MethodPost, "/upload/c", "data", "Authorization", "Bearer a-key"); resp.StatusCode != http.StatusCreated {
+		t.Errorf("upload of another client: %d, want 201", resp.StatusCode)
+	}
+	if code := finish("data"); code != http.StatusCreated {
+		t.Errorf("held upload: %d, want 201", code)
+	}
+	if resp, _ := do(t, ts, http.MethodPost, "/upload/b", "data", "Authorization", "Bearer secret"); resp.StatusCode != http.StatusCreated {
+		t.Errorf("upload after the slot is freed: %d, want 201", resp.StatusCode)
+	}
+}
+
+func TestMemoryBudget(t *testing.T) {
+	b := NewMemoryBudget(10)
+	steps := []struct {
+		reserve int64 // > 0 — занять, < 0 — вернуть
+		ok      bool
+	}{
+		{6, true},
+		{5, false},
+		{4, true},
+		{1, false},
+		{-6, true},
+		{6, true},
+	}
+	for i, s := range steps {
+		if s.reserve < 0 {
+			b.Release(-s.reserve)
+			continue
+		}
+		if got := b.TryReserve(s.reserve); got != s.ok {
+			t.Errorf("step %d: TryReserve(%d) = %v, want %v", i+1, s.reserve, got, s.ok)
+		}
+	}
+	// Без предела бюджет не создаётся и ничего не ограничивает
+	if b := NewMemoryBudget(0); b != nil || !b.TryReserve(1<<40) {
+		t.Error("zero budget limits reservations")
+	}
+}
+
+func TestLimitMemory(t *testing.T) {
+	budget := NewMemoryBudget(10)
+	var reserved int64
+	handler := LimitMemory(budget, func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(memoryReservation(r).reader(r.Body))
+		reserved = budget.used
+	})
+	// Другая загрузка уже заняла 8 байт
+	budget.TryReserve(8)
+
+	tests := []struct {
+		name     string
+		body     io.Reader
+		status   int
+		reserved int64
+	}{
+		// Тело известного размера занимает бюджет до чтения
+		{"declared fits", strings.NewReader("12"), http.StatusOK, 10},
+		{"declared too large", strings.NewReader("12345"), http.StatusServiceUnavailable, 0},
+		// Тело без Content-Length занимает бюджет по мере чтения
+		{"streamed", io.MultiReader(strings.NewReader("1")), http.StatusOK, 9},
+	}
+	for _, tt := range tests {
+		reserved = 0
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/upload/b", tt.body))
+		if rec.Code != tt.status || reserved != tt.reserved {
+			t.Errorf("%s: %d with %d bytes reserved, want %d with %d", tt.name, rec.Code, reserved, tt.status, tt.reserved)
+		}
+		if tt.status == http.StatusServiceUnavailable && rec.Header().Get("Retry-After") != RETRY_AFTER {
+			t.Errorf("%s: no Retry-After", tt.name)
+		}
+		// После ответа занятое запросом возвращается в бюджет
+		if budget.used != 8 {
+			t.Errorf("%s: %d bytes reserved after the request, want 8", tt.name, budget.used)
+		}
+	}
+}
+
+func TestUploadMemory(t *testing.T) {
+	ts, _ := newTestServer(t, "-max-upload-memory", "10")
+	tests := []struct {
+		name     string
+		body     string
+		encoding string
+		status   int
+	}{
+		{"fits", "0123456789", "", http.StatusCreated},
+		{"declared too large", "0123456789a", "", http.StatusServiceUnavailable},
+		// Сжатое тело мало, но распакованное в бюджет не помещается
+		{"decompressed too large", gzipped(t, strings.Repeat("a", 100)), "gzip", http.StatusServiceUnavailable},
+	}
+	for i, tt := range tests {
+		var header []string
+		if tt.encoding != "" {
+			header = []string{"Content-Encoding", tt.encoding}
+		}
+		resp, body := do(t, ts, http.MethodPost, "/upload/"+strconv.Itoa(i), tt.body, header...)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: %d %s, want %d", tt.name, resp.StatusCode, body, tt.status)
+		}
+		if tt.status == http.StatusServiceUnavailable && resp.Header.Get("Retry-After") != RETRY_AFTER {
+			t.Errorf("%s: no Retry-After", tt.name)
+		}
+	}
+	// Отказ не оставляет занятым бюджет
+	upload(t, ts, "after", "0123456789")
+}
+
+func TestListenMaxConnections(t *testing.T) {
+	ln, err := Listen("127.0.0.1:0", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		// Соединение закрывается после ответа, а не остаётся ждать следующего запроса
+		w.Header().Set("Connection", "close")
+		w.Write([]byte("ok"))
+	}))
+	ts.Listener.Close()
+	ts.Listener = ln
+	ts.Start()
+	defer ts.Close()
+
+	// Первое соединение занято загрузкой, которая ещё не дописала тело
+	finish := holdRequest(t, ts, http.MethodPost, "/")
+	second := make(chan int, 1)
+	go func() {
+		// Отдельный клиент, чтобы запрос шёл по новому соединению
+		client := &http.Client{Transport: &http.Transport{}}
+		defer client.CloseIdleConnections()
+		resp, err := client.Get(ts.URL)
+		if err != nil {
+			second <- 0
+			return
+		}
+		resp.Body.Close()
+		second <- resp.StatusCode
+	}()
+
+	// Лишнее соединение ждёт, а не отклоняется
+	select {
+	case code := <-second:
+		t.Fatalf("second connection was served (%d) while the limit is taken", code)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if code := finish("data"); code != http.StatusOK {
+		t.Errorf("held request: %d, want 200", code)
+	}
+	// Закрытое соединение освобождает место для ждущего
+	select {
+	case code := <-second:
+		if code != http.StatusOK {
+			t.Errorf("second request: %d, want 200", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("second connection is not served after the first one closed")
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	NDJSON_TYPE      = "application/x-ndjson" // ТИП ОТВЕТА ДЛЯ ПОТОКОВОГО СПИСКА ОБЪЕКТОВ
+	LIST_FLUSH_EVERY = 1000                   // ЧЕРЕЗ СКОЛЬКО ЗАПИСЕЙ ОТПРАВЛЯТЬ НАКОПЛЕННОЕ КЛИЕНТУ
+	LIST_MAX_RESULTS = 10000                  // СКОЛЬКО ОБЪЕКТОВ ПО УМОЛЧАНИЮ ОТДАЁТ ОДИН ЗАПРОС СПИСКА
+	TRUNCATED_HEADER = "X-Is-Truncated"       // ЗАГОЛОВОК ОБРЕЗАННОГО СПИСКА: ОСТАЛЬНОЕ — НА СЛЕДУЮЩИХ СТРАНИЦАХ
+	MARKER_HEADER    = "X-Next-Marker"        // ЗАГОЛОВОК С КЛЮЧОМ, ПОСЛЕ КОТОРОГО НАЧИНАЕТСЯ СЛЕДУЮЩАЯ СТРАНИЦА
+)
+
+// HandleListNDJSON — выводит список объектов потоком, по JSON-объекту в строке.
+// Список пишется по мере обхода директории и периодически отправляется клиенту,
+// поэтому ни сервер, ни клиент не держат в памяти весь список.
+func HandleListNDJSON(w http.ResponseWriter, r *http.Request, storage *Storage, filter listFilter) {
+	order, cached := storage.cachedKeys()
+
+	w.Header().Set("Content-Type", NDJSON_TYPE)
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	written := 0
+	emit := func(entry List) error {
+		if err := enc.Encode(entry); err != nil {
+			return err
+		}
+		written++
+		if flusher != nil && written%LIST_FLUSH_EVERY == 0 {
+			flusher.Flush()
+		}
+		return nil
+	}
+
+	for _, key := range order {
+		if entry, ok := storage.listEntry(key, true, filter); ok {
+			if err := emit(entry); err != nil {
+				return
+			}
+		}
+	}
+	err := storage.walkDiskKeys(func(key string) error {
+		if cached.has(key) {
+			return nil
+		}
+		if entry, ok := storage.listEntry(key, false, filter); ok {
+			return emit(entry)
+		}
+		return nil
+	})
+	if err != nil {
+		// Заголовки уже отправлены, клиент увидит оборванный поток
+		log.Printf("Ошибка при потоковом выводе списка: %v", logErr(err))
+	}
+}
+
+// listPage — страница списка: подходящие под фильтр объекты с ключами после marker
+// в порядке ключей, не больше limit (0 — все). Возвращает ключ последнего объекта,
+// если за ним есть ещё. Размер узнаётся только у объектов страницы, поэтому
+// ограничение избавляет от обращения к каждому файлу большой директории.
+func (s *Storage) listPage(filter listFilter, marker string, limit int) ([]List, string, error) {
+	order, cached := s.cachedKeys()
+	files, err := s.diskKeys()
+	if err != nil {
+		return nil, "", err
+	}
+	keys := order
+	for _, f := range files {
+		if !cached.has(f) {
+			keys = append(keys, f)
+		}
+	}
+	sort.Strings(keys)
+
+	// Ключи хоста отличаются от имён в списке общим префиксом, порядок у них тот же
+	if marker != "" && filter.tenant != "" {
+		marker = filter.tenant + "/" + marker
+	}
+	page := make([]List, 0)
+	for _, key := range keys {
+		if key <= marker {
+			continue
+		}
+		entry, ok := s.listEntry(key, cached.has(key), filter)
+		if !ok {
+			continue
+		}
+		if limit > 0 && len(page) == limit {
+			return page, page[len(page)-1].Name, nil
+		}
+		page = append(page, entry)
+	}
+	return page, "", nil
+}
+
+// parseListPage — разбирает параметры marker и limit списка объектов и ограничивает
+// размер страницы пределом сервера max (0 — без предела)
+func parseListPage(q url.Values, max int) (string, int, error) {
+	limit := max
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return "", 0, fmt.Errorf("limit must be a positive number")
+		}
+		if max == 0 || n < max {
+			limit = n
+		}
+	}
+	return q.Get("marker"), limit, nil
+}
+
+// listFilter — ограничения на размер объектов в списке (-1 — без ограничения)
+// и поддиректория виртуального хоста, которой список ограничен
+type listFilter struct {
+	minSize int64
+	maxSize int64
+	tenant  string
+}
+
+// parseListFilter — разбирает параметры minSize и maxSize списка объектов
+func parseListFilter(q url.Values) (listFilter, error) {
+	f := listFilter{minSize: -1, maxSize: -1}
+	for name, bound := range map[string]*int64{"minSize": &f.minSize, "maxSize": &f.maxSize} {
+		v := q.Get(name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return f, fmt.Errorf("%s must be a non-negative number of bytes", name)
+		}
+		*bound = n
+	}
+	if f.minSize >= 0 && f.maxSize >= 0 && f.minSize > f.maxSize {
+		return f, fmt.Errorf("minSize must not exceed maxSize")
+	}
+	return f, nil
+}
+
+// match — подходит ли размер объекта под фильтр
+func (f listFilter) match(size int64) bool {
+	return (f.minSize < 0 || size >= f.minSize) && (f.maxSize < 0 || size <= f.maxSize)
+}
+
+// cachedSet — ключи объектов в кэше в каноническом виде (нормализованные, как ключи
+// запросов). Ключ с диска, совпадающий с ключом кэша, в список второй раз не попадает:
+// объект, который есть и в памяти, и на диске, виден в списке один раз — как кэшированный.
+type cachedSet struct {
+	storage *Storage
+	keys    map[string]bool
+}
+
+// add — запоминает ключ объекта в кэше
+func (c cachedSet) add(key string) {
+	c.keys[c.storage.NormalizeKey(key)] = true
+}
+
+// has — есть ли объект с этим ключом в кэше
+func (c cachedSet) has(key string) bool {
+	return c.keys[c.storage.NormalizeKey(key)]
+}
+
+// cachedKeys — снимок ключей кэша списком и множеством.
+// Мьютекс держится только на время снимка, а не всё время обхода диска и отправки списка.
+func (s *Storage) cachedKeys() ([]string, cachedSet) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := s.cache.Keys()
+	cached := cachedSet{storage: s, keys: make(map[string]bool, len(keys))}
+	for _, key := range keys {
+		cached.add(key)
+	}
+	return keys, cached
+}
+
+// listEntry — элемент списка с размером объекта, если объект подходит под фильтр.
+// Объекты, удалённые во время обхода, пропускаются.
+func (s *Storage) listEntry(key string, inCache bool, filter listFilter) (List, bool) {
+	name := key
+	if filter.tenant != "" {
+		if !strings.HasPrefix(key, filter.tenant+"/") {
+			return List{}, false
+		}
+		name = key[len(filter.tenant)+1:]
+	}
+	size, modTime, ok := s.objectStat(key)
+	if !ok || !filter.match(size) {
+		return List{}, false
+	}
+	return List{name, inCache, size, modTime}, true
+}
+
+// listETag — слабый ETag страницы списка: хэш ключей, размеров и времени изменения её
+// объектов, ключа следующей страницы и формата ответа. Пока объекты страницы не менялись,
+// ETag прежний, и опрашивающий клиент по If-None-Match получает 304 без повторной
+// передачи списка. Слабый — потому что отметка InCach может меняться и при том же ETag.
+func listETag(page []List, next string, ndjson bool) string {
+	h := md5.New()
+	fmt.Fprintf(h, "%v\x00%s\n", ndjson, next)
+	for _, entry := range page {
+		fmt.Fprintf(h, "%s\x00%d\x00%d\n", entry.Name, entry.Size, entry.modTime.UnixNano())
+	}
+	return `W/"` + hex.EncodeToString(h.Sum(nil)) + `"`
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestListNDJSON(t *testing.T) {
+	dir := t.TempDir()
+	// Объект только на диске и объекты в кэше выводятся одним потоком
+	if err := os.WriteFile(dir+"/disk", []byte("on disk"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ts, _ := newTestServer(t, "-storage-dir", dir)
+	upload(t, ts, "a", "1")
+	upload(t, ts, "b/c", "12345")
+
+	tests := []struct {
+		query  string
+		sorted bool
+		want   []string
+	}{
+		{"", false, []string{"a", "b/c", "disk"}},
+		{"?minSize=5", false, []string{"b/c", "disk"}},
+		{"?maxSize=1", false, []string{"a"}},
+		{"?limit=2", true, []string{"a", "b/c"}},
+		{"?limit=2&marker=b/c", true, []string{"disk"}},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, ts, http.MethodGet, "/list"+tt.query, "", "Accept", NDJSON_TYPE)
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != NDJSON_TYPE {
+			t.Fatalf("GET /list%s: %d %s", tt.query, resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+		names := make([]string, 0)
+		for _, line := range strings.Split(strings.TrimSuffix(body, "\n"), "\n") {
+			var entry List
+			if err := json.Unmarshal([]byte(line), &entry); err != nil {
+				t.Fatalf("GET /list%s: line %q: %v", tt.query, line, err)
+			}
+			names = append(names, entry.Name)
+		}
+		// Поток без страниц идёт в порядке обхода, а не по ключам
+		if !tt.sorted {
+			sort.Strings(names)
+		}
+		if !reflect.DeepEqual(names, tt.want) {
+			t.Errorf("GET /list%s = %v, want %v", tt.query, names, tt.want)
+		}
+	}
+
+	// Без Accept список по-прежнему один JSON-массив
+	if got := listNames(t, ts, ""); !reflect.DeepEqual(got, []string{"a", "b/c", "disk"}) {
+		t.Errorf("GET /list = %v", got)
+	}
+}
+
+func TestListSizeFilter(t *testing.T) {
+	ts, _ := newTestServer(t)
+	for key, size := range map[string]int{"empty": 0, "small": 3, "medium": 10, "large": 100} {
+		upload(t, ts, key, strings.Repeat("x", size))
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"empty", "large", "medium", "small"}},
+		{"?minSize=3", []string{"large", "medium", "small"}},
+		{"?maxSize=3", []string{"empty", "small"}},
+		{"?minSize=3&maxSize=10", []string{"medium", "small"}},
+		{"?minSize=0&maxSize=0", []string{"empty"}},
+		{"?minSize=11&maxSize=99", []string{}},
+	}
+	for _, tt := range tests {
+		if got := listNames(t, ts, tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("GET /list%s = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+	for _, query := range []string{"?minSize=-1", "?maxSize=x", "?minSize=1.5"} {
+		if resp, _ := do(t, ts, http.MethodGet, "/list"+query, ""); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("GET /list%s: %d, want 400", query, resp.StatusCode)
+		}
+	}
+}
+
+func TestListPaging(t *testing.T) {
+	dir := t.TempDir()
+	// Объект только на диске встаёт на своё место по порядку ключей
+	if err := os.WriteFile(dir+"/c", []byte("on disk"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ts, _ := newTestServer(t, "-storage-dir", dir, "-max-list-results", "2")
+	for _, key := range []string{"e", "a", "d", "b"} {
+		upload(t, ts, key, "1")
+	}
+
+	tests := []struct {
+		query string
+		pages [][]string
+	}{
+		{"", [][]string{{"a", "b"}, {"c", "d"}, {"e"}}},
+		{"limit=1", [][]string{{"a"}, {"b"}, {"c"}, {"d"}, {"e"}}},
+		// Страница не больше -max-list-results, даже если клиент просит больше
+		{"limit=10", [][]string{{"a", "b"}, {"c", "d"}, {"e"}}},
+		{"minSize=2", [][]string{{"c"}}},
+		{"marker=b", [][]string{{"c", "d"}, {"e"}}},
+	}
+	for _, tt := range tests {
+		var pages [][]string
+		marker := ""
+		for len(pages) < 10 {
+			q, _ := url.ParseQuery(tt.query)
+			if marker != "" {
+				q.Set("marker", marker)
+			}
+			query := "?" + q.Encode()
+			resp, body := do(t, ts, http.MethodGet, "/list"+query, "")
+			var entries []List
+			if err := json.Unmarshal([]byte(body), &entries); err != nil {
+				t.Fatalf("GET /list%s: %v", query, err)
+			}
+			var names []string
+			for _, e := range entries {
+				names = append(names, e.Name)
+			}
+			pages = append(pages, names)
+			truncated, next := resp.Header.Get(TRUNCATED_HEADER) == "true", resp.Header.Get(MARKER_HEADER)
+			if truncated != (next != "") {
+				t.Errorf("GET /list%s: %s %q, %s %q", query, TRUNCATED_HEADER, resp.Header.Get(TRUNCATED_HEADER), MARKER_HEADER, next)
+			}
+			if next == "" {
+				break
+			}
+			marker = next
+		}
+		if !reflect.DeepEqual(pages, tt.pages) {
+			t.Errorf("GET /list?%s pages %v, want %v", tt.query, pages, tt.pages)
+		}
+	}
+	for _, query := range []string{"?limit=0", "?limit=x"} {
+		if resp, _ := do(t, ts, http.MethodGet, "/list"+query, ""); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("GET /list%s: %d, want 400", query, resp.StatusCode)
+		}
+	}
+}
+
+func TestListDedup(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		disk []string // Файлы, оставшиеся на диске до запуска
+		want []List
+	}{
+		{"cached and on disk", nil, nil, []List{{Name: "dup", InCach: true, Size: 1}, {Name: "only", Size: 7}}},
+		// Файл с ключом в прежнем виде совпадает с ключом кэша после нормализации
+		{"normalized key", []string{"-normalize-keys", "lower"}, []string{"Dup"}, []List{{Name: "dup", InCach: true, Size: 1}, {Name: "only", Size: 7}}},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		for _, name := range append(tt.disk, "only") {
+			if err := os.WriteFile(dir+"/"+name, []byte("on disk"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		ts, _ := newTestServer(t, append([]string{"-storage-dir", dir}, tt.args...)...)
+		upload(t, ts, "dup", "1")
+
+		for _, accept := range []string{"", NDJSON_TYPE} {
+			_, body := do(t, ts, http.MethodGet, "/list", "", "Accept", accept)
+			var got []List
+			if accept == "" {
+				if err := json.Unmarshal([]byte(body), &got); err != nil {
+					t.Fatalf("%s: GET /list: %v", tt.name, err)
+				}
+			} else {
+				for _, line := range strings.Split(strings.TrimSuffix(body, "\n"), "\n") {
+					var entry List
+					if err := json.Unmarshal([]byte(line), &entry); err != nil {
+						t.Fatalf("%s: GET /list: line %q: %v", tt.name, line, err)
+					}
+					got = append(got, entry)
+				}
+			}
+			sort.Slice(got, func(i, j int) bool { return got[i].Name < got[j].Name })
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s: GET /list (Accept %q) = %+v, want %+v", tt.name, accept, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestListEncodedWhole(t *testing.T) {
+	ts, _ := newTestServer(t, "-max-list-results", "0")
+	// Список заметно больше буфера ответа сервера, чтобы он уходил несколькими порциями
+	for i := 0; i < 200; i++ {
+		upload(t, ts, fmt.Sprintf("dir/a-rather-long-object-name-%03d", i), strings.Repeat("x", 1+i%3))
+	}
+	tests := []struct {
+		query     string
+		count     int
+		truncated bool
+	}{
+		{"", 200, false},
+		{"?minSize=3", 66, false},
+		{"?limit=150", 150, true},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, ts, http.MethodGet, "/list"+tt.query, "")
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/json" {
+			t.Fatalf("GET /list%s: %d %s", tt.query, resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+		// Ответ — один JSON-массив целиком, без обрезанного хвоста
+		var entries []List
+		dec := json.NewDecoder(strings.NewReader(body))
+		if err := dec.Decode(&entries); err != nil || dec.More() || !strings.HasSuffix(body, "]\n") {
+			t.Fatalf("GET /list%s: %v, body ends with %q", tt.query, err, body[len(body)-10:])
+		}
+		if len(entries) != tt.count {
+			t.Errorf("GET /list%s: %d entries, want %d", tt.query, len(entries), tt.count)
+		}
+		if truncated := resp.Header.Get(TRUNCATED_HEADER) == "true"; truncated != tt.truncated {
+			t.Errorf("GET /list%s: truncated %v, want %v", tt.query, truncated, tt.truncated)
+		}
+	}
+}
+
+func TestListETag(t *testing.T) {
+	ts, _ := newTestServer(t)
+	upload(t, ts, "a", "1")
+	upload(t, ts, "b", "22")
+	get := func(query string, header ...string) (*http.Response, string) {
+		resp, body := do(t, ts, http.MethodGet, "/list"+query, "", header...)
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotModified {
+			t.Fatalf("GET /list%s: %d %s", query, resp.StatusCode, body)
+		}
+		return resp, body
+	}
+	first, _ := get("")
+	etag := first.Header.Get("ETag")
+	if !strings.HasPrefix(etag, `W/"`) || !strings.Contains(first.Header.Get("Vary"), "Accept") {
+		t.Fatalf("list ETag %q, Vary %q", etag, first.Header.Get("Vary"))
+	}
+	page, _ := get("?limit=1")
+	pageETag := page.Header.Get("ETag")
+
+	tests := []struct {
+		name   string
+		query  string
+		header []string
+		status int
+	}{
+		{"unchanged", "", []string{"If-None-Match", etag}, http.StatusNotModified},
+		{"strong form", "", []string{"If-None-Match", strings.TrimPrefix(etag, "W/")}, http.StatusNotModified},
+		{"one of several", "", []string{"If-None-Match", `"other", ` + etag}, http.StatusNotModified},
+		{"other etag", "", []string{"If-None-Match", `W/"other"`}, http.StatusOK},
+		{"other format", "", []string{"If-None-Match", etag, "Accept", NDJSON_TYPE}, http.StatusOK},
+		{"other page", "?limit=1", []string{"If-None-Match", etag}, http.StatusOK},
+		{"same page", "?limit=1", []string{"If-None-Match", pageETag}, http.StatusNotModified},
+	}
+	for _, tt := range tests {
+		resp, body := get(tt.query, tt.header...)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: %d, want %d", tt.name, resp.StatusCode, tt.status)
+		}
+		if tt.status == http.StatusNotModified && body != "" {
+			t.Errorf("%s: 304 with body %q", tt.name, body)
+		}
+	}
+
+	// Изменение объекта меняет ETag списка, но не страницы, на которой его нет
+	if resp, _ := do(t, ts, http.MethodPut, "/upload/b", "33", "If-Match", "*"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("overwrite b: %d", resp.StatusCode)
+	}
+	resp, _ := get("", "If-None-Match", etag)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") == etag {
+		t.Errorf("list after overwrite: %d, ETag %q", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+	etag = resp.Header.Get("ETag")
+	if resp, _ := get("?limit=1", "If-None-Match", pageETag); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("first page after overwrite of b: %d, want 304", resp.StatusCode)
+	}
+	// Новый объект тоже меняет ETag
+	upload(t, ts, "c", "1")
+	if resp, _ := get("", "If-None-Match", etag); resp.StatusCode != http.StatusOK {
+		t.Errorf("list after upload: %d, want 200", resp.StatusCode)
+	}
+}
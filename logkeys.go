@@ -0,0 +1,60 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	LOG_KEYS_FULL = "full" // КЛЮЧИ ОБЪЕКТОВ ПИШУТСЯ В ЖУРНАЛ КАК ЕСТЬ
+	LOG_KEYS_HASH = "hash" // ВМЕСТО КЛЮЧЕЙ В ЖУРНАЛ ПИШЕТСЯ ИХ УКОРОЧЕННЫЙ ХЭШ
+	LOG_HASH_LEN  = 12     // СКОЛЬКО HEX-СИМВОЛОВ SHA-256 КЛЮЧА ОСТАВЛЯТЬ В ЖУРНАЛЕ
+)
+
+// hashLogKeys — писать в журнал хэши ключей вместо самих ключей (флаг -log-keys hash)
+var hashLogKeys bool
+
+// logKey — ключ объекта для журнала. С -log-keys hash ключ, который может содержать
+// имена или идентификаторы пользователей, заменяется началом его SHA-256: записи
+// об одном объекте по-прежнему можно сопоставить, а сам ключ из журнала не узнать
+func logKey(key string) string {
+	if !hashLogKeys || key == "" {
+		return key
+	}
+	sum := sha256.Sum256([]byte(key))
+	return "#" + hex.EncodeToString(sum[:])[:LOG_HASH_LEN]
+}
+
+// logPath — путь запроса для журнала: первая часть (маршрут или S3-бакет) остаётся
+// как есть, ключ после неё пишется через logKey
+func logPath(path string) string {
+	if !hashLogKeys {
+		return path
+	}
+	i := strings.Index(strings.TrimPrefix(path, "/"), "/")
+	if i < 0 {
+		return path
+	}
+	return path[:i+2] + logKey(path[i+2:])
+}
+
+// logErr — ошибка для журнала: пути к файлам в ошибках ФС содержат ключи объектов,
+// поэтому с -log-keys hash они тоже заменяются хэшем
+func logErr(err error) error {
+	if !hashLogKeys {
+		return err
+	}
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		return fmt.Errorf("%s %s: %w", pathErr.Op, logKey(pathErr.Path), pathErr.Err)
+	}
+	var linkErr *os.LinkError
+	if errors.As(err, &linkErr) {
+		return fmt.Errorf("%s %s %s: %w", linkErr.Op, logKey(linkErr.Old), logKey(linkErr.New), linkErr.Err)
+	}
+	return err
+}
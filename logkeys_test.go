@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLogKeys(t *testing.T) {
+	const key = "users/alice@example.com/photo.jpg"
+	hashed := logKey(key)
+	if hashed != key {
+		t.Fatalf("logKey without -log-keys hash = %q", hashed)
+	}
+	hashLogKeys = true
+	t.Cleanup(func() { hashLogKeys = false })
+	hashed = logKey(key)
+	if !strings.HasPrefix(hashed, "#") || len(hashed) != 1+LOG_HASH_LEN || strings.Contains(hashed, "alice") {
+		t.Fatalf("logKey(%q) = %q", key, hashed)
+	}
+	if other := logKey(key + "2"); other == hashed {
+		t.Errorf("different keys have the same hash %q", other)
+	}
+
+	_, openErr := os.Open("/missing/" + key)
+	linkErr := os.Rename("/missing/"+key, "/missing/"+key+".new")
+	tests := []struct {
+		name, got, want string
+	}{
+		{"same key", logKey(key), hashed},
+		{"empty key", logKey(""), ""},
+		{"download path", logPath("/download/" + key), "/download/" + hashed},
+		{"s3 path", logPath("/bucket/" + key), "/bucket/" + hashed},
+		{"route only", logPath("/list"), "/list"},
+		{"path error", logErr(openErr).Error(), "open " + logKey("/missing/"+key) + ": no such file or directory"},
+		{"link error", logErr(linkErr).Error(), "rename " + logKey("/missing/"+key) + " " + logKey("/missing/"+key+".new") + ": no such file or directory"},
+		{"other error", logErr(ErrExists).Error(), ErrExists.Error()},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLogKeysServer(t *testing.T) {
+	const key = "users/alice@example.com/photo.jpg"
+	for _, mode := range []string{LOG_KEYS_FULL, LOG_KEYS_HASH} {
+		logs := captureLog(t)
+		ts, _ := newTestServer(t, "-log-keys", mode, "-slow-request", "1ns")
+		upload(t, ts, key, "data")
+		want := "/upload/" + key
+		if mode == LOG_KEYS_HASH {
+			want = "/upload/" + logKey(key)
+		}
+		if !strings.Contains(logs.String(), "POST "+want) {
+			t.Errorf("-log-keys %s: log lacks %q:\n%s", mode, want, logs.String())
+		}
+		if mode == LOG_KEYS_HASH && strings.Contains(logs.String(), "alice") {
+			t.Errorf("-log-keys hash: key in the log:\n%s", logs.String())
+		}
+		if resp, _ := do(t, ts, http.MethodGet, "/download/"+key, ""); resp.StatusCode != http.StatusOK {
+			t.Errorf("-log-keys %s: download: %d", mode, resp.StatusCode)
+		}
+	}
+	if _, err := ParseConfig([]string{"-log-keys", "none"}); err == nil {
+		t.Error("ParseConfig accepted -log-keys none")
+	}
+}
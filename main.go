@@ -1,198 +1,1316 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
 	"sync"
+	"syscall"
+	"time"
 )
 
 // curl --data-binary @/path/to/your/file --url https://localhost/upload/file
 
 const (
-	STORAGE_DIR         = "/storage"        // ДИРЕКТОРИЯ ДЛЯ ХРАНЕНИЯ ОБЪЕКТОВ
+	STORAGE_DIR         = "/storage"        // ДИРЕКТОРИЯ ДЛЯ ХРАНЕНИЯ ОБЪЕКТОВ ПО УМОЛЧАНИЮ
+	TMP_DIR             = ".tmp"            // ДИРЕКТОРИЯ ВРЕМЕННЫХ ФАЙЛОВ В ХРАНИЛИЩЕ (НА ТОЙ ЖЕ ФС, ЧТОБЫ РАБОТАЛ RENAME)
 	UPLOAD_PREFIX_LEN   = len("/upload/")   // ДЛИНА ПРЕФИКСА ДЛЯ МАРШРУТА ЗАГРУЗКИ
 	DOWNLOAD_PREFIX_LEN = len("/download/") // ДЛИНА ПРЕФИКСА ДЛЯ МАРШРУТА ЗАГРУЗКИ
+	DELETE_PREFIX_LEN   = len("/delete/")   // ДЛИНА ПРЕФИКСА ДЛЯ МАРШРУТА УДАЛЕНИЯ
+	SHUTDOWN_TIMEOUT    = 30 * time.Second  // СКОЛЬКО ПО УМОЛЧАНИЮ ЖДАТЬ ЗАВЕРШЕНИЯ ЗАПРОСОВ ПРИ ОСТАНОВКЕ
 )
 
 // Storage — структура для хранения объектов в памяти
 type Storage struct {
-	mu    sync.RWMutex   // Мьютекс для обеспечения потокобезопасности
-	files map[string]obj // Хэш-таблица для хранения данных объектов
+	mu             sync.RWMutex    // Мьютекс для обеспечения потокобезопасности
+	metaMu         sync.Mutex      // Мьютекс для изменения файлов метаданных
+	cache          *Cache          // Кэш данных объектов в памяти
+	backend        Backend         // Где хранится содержимое объектов (-backend)
+	mapper         KeyMapper       // Раскладка объектов на диске по их ключам
+	typeRoutes     []TypeRoute     // Директории для объектов по типу содержимого (-type-dirs)
+	metrics        Metrics         // Счётчики работы хранилища
+	wb             *writeBack      // Очередь отложенной записи на диск (nil — запись сразу)
+	resizer        ImageResizer    // Алгоритм масштабирования для уменьшенных копий изображений
+	scanner        Scanner         // Проверка содержимого загрузок до сохранения
+	maxObjectSize  int64           // Максимальный размер объекта в байтах (0 — без ограничений)
+	maxListResults int             // Сколько объектов отдаёт один запрос списка (0 — без ограничений)
+	quota          *DiskQuota      // Предел суммарного размера объектов на диске (nil — без квоты)
+	metaLimits     MetaLimits      // Пределы задаваемых метаданных объектов
+	streamBuffer   int             // Буфер отдачи объектов в байтах (0 — без своего буфера)
+	streamFlush    time.Duration   // Как часто отправлять буфер клиенту (0 — при заполнении)
+	bloom          *Bloom          // Фильтр ключей для быстрого ответа на запросы отсутствующих объектов (nil — выключен)
+	bloomKeys      int             // Расчётное число ключей для фильтра Блума
+	absent         *NegativeCache  // Недавно не найденные на диске ключи (nil — выключено)
+	changes        *ChangeLog      // Последние изменения объектов (nil — журнал выключен)
+	sealAfter      time.Duration   // Через сколько после записи объект становится только для чтения (0 — никогда)
+	compress       bool            // Сжимать текстовые объекты при скачивании, если клиент это принимает
+	downloadCounts *DownloadCounts // Скачивания объектов, ещё не сохранённые в метаданные
+	readers        *ObjectReaders  // Файлы объектов, отдаваемые потоком с диска
+	inlineTypes    map[string]bool // Типы содержимого, которые браузеру можно показывать, а не скачивать
+	defaultType    string          // Тип объекта, если ни расширение, ни содержимое его не выдают (-default-type)
+	allowedTypes   []string        // Типы и группы типов, которые можно загружать (пусто — любые)
+	keyTemplate    string          // Шаблон ключей, которые сервер назначает загрузкам без ключа
+	downloadRate   int64           // Скорость отдачи одного скачивания в байтах в секунду (0 — без ограничения)
+	flights        *flightGroup    // Объединение одновременных чтений одного ключа с диска (nil — выключено)
+	consistency    string          // Что верно при расхождении кэша с диском: CONSISTENCY_DISK или CONSISTENCY_CACHE
+	leases         *Leases         // Короткие аренды ключей для согласованной записи
+	aliases        *Aliases        // Псевдонимы ключей, отдающие другой объект
+	normalizeLower bool            // Ключи приводятся к нижнему регистру
+	normalizeNFC   bool            // Ключи приводятся к юникодной форме NFC
 }
 
 // NewStorage — конструктор для создания нового хранилища
-func NewStorage() *Storage {
-	return &Storage{
-		files: make(map[string]obj),
+func NewStorage(cfg *Config) *Storage {
+	s := &Storage{
+		mapper:         newKeyMapper(cfg.ShardWidth),
+		typeRoutes:     cfg.TypeRoutes,
+		resizer:        NearestResizer{},
+		scanner:        newScanner(cfg.Scanner),
+		maxObjectSize:  cfg.MaxObjectSize,
+		maxListResults: cfg.MaxListResults,
+		metaLimits:     MetaLimits{cfg.MaxTags, cfg.MaxTagKeyLen, cfg.MaxTagValueLen, cfg.MaxMetaSize},
+		streamBuffer:   cfg.StreamBuffer,
+		streamFlush:    cfg.StreamFlush,
+		inlineTypes:    make(map[string]bool),
+		defaultType:    cfg.DefaultType,
+		allowedTypes:   cfg.AllowedTypes,
+		keyTemplate:    cfg.KeyTemplate,
+		downloadRate:   cfg.DownloadRate,
+		consistency:    cfg.Consistency,
+		leases:         NewLeases(),
+		readers:        NewObjectReaders(),
 	}
+	s.backend = newBackend(cfg, s)
+	for _, n := range cfg.NormalizeKeys {
+		switch n {
+		case NORMALIZE_LOWER:
+			s.normalizeLower = true
+		case NORMALIZE_NFC:
+			s.normalizeNFC = true
+		}
+	}
+	for _, t := range cfg.InlineTypes {
+		s.inlineTypes[strings.ToLower(t)] = true
+	}
+	s.cache = NewCache(cfg.CacheSize, cfg.CacheThreshold, newEvictionPolicy(cfg.CachePolicy), func(o obj) {
+		s.metrics.Evictions.Add(1)
+		s.metrics.EvictedBytes.Add(int64(len(o.body)))
+	})
+	for _, key := range cfg.CachePin {
+		s.cache.Pin(s.NormalizeKey(key))
+	}
+	if cfg.WriteBack {
+		s.wb = newWriteBack(cfg.FlushInterval)
+		go s.writeBackLoop()
+	}
+	s.sealAfter = cfg.SealAfter
+	s.compress = cfg.Compress
+	s.quota = NewDiskQuota(cfg.DiskQuota, func() (int64, error) {
+		_, bytes, err := s.diskUsage()
+		return bytes, err
+	})
+	s.downloadCounts = NewDownloadCounts()
+	aliasesPath := storagePath(ALIASES_FILE)
+	aliases, err := LoadAliases(aliasesPath)
+	if err != nil {
+		log.Printf("Ошибка чтения псевдонимов %s: %v", aliasesPath, err)
+	}
+	s.aliases = aliases
+	if cfg.ChangeLogSize > 0 {
+		path := ""
+		if cfg.PersistChanges {
+			path = storagePath(CHANGELOG_FILE)
+		}
+		changes, err := NewChangeLog(cfg.ChangeLogSize, path)
+		if err != nil {
+			log.Printf("Ошибка чтения журнала изменений %s: %v", path, err)
+		}
+		s.changes = changes
+	}
+	if cfg.CountFlush > 0 {
+		go s.downloadCountLoop(cfg.CountFlush)
+	}
+	if cfg.CacheReport > 0 {
+		go s.cacheReportLoop(cfg.CacheReport, cfg.CacheWatermark)
+	}
+	if cfg.ExpirySweep > 0 {
+		go s.expiryLoop(cfg.ExpirySweep)
+	}
+	if cfg.NegativeTTL > 0 {
+		s.absent = NewNegativeCache(cfg.NegativeTTL, NEGATIVE_CACHE_SIZE)
+	}
+	if cfg.BloomKeys > 0 {
+		s.bloomKeys = cfg.BloomKeys
+		s.initBloom(cfg.BloomKeys)
+	}
+	if cfg.CoalesceLoads {
+		s.flights = newFlightGroup()
+	}
+	return s
 }
 
-// Save — метод для сохранения объекта в хранилище
-func (s *Storage) Save(key string, data []byte) error {
+// ErrExists — объект с таким ключом уже есть, а загрузка только создаёт новые
+var ErrExists = errors.New("object already exists")
+
+// GENERATE_KEY_ATTEMPTS — СКОЛЬКО КЛЮЧЕЙ ПРОБОВАТЬ ДЛЯ ЗАГРУЗКИ БЕЗ КЛЮЧА, ЕСЛИ НАЗНАЧЕННЫЙ ЗАНЯТ
+const GENERATE_KEY_ATTEMPTS = 5
+
+// Save — метод для сохранения объекта в хранилище вместе с его метаданными m
+func (s *Storage) Save(key string, data []byte, m Meta) error {
+	if err := s.checkContentType(key, data); err != nil {
+		return err
+	}
+	// Проверка может быть долгой, поэтому выполняется до захвата мьютекса
+	if err := s.scan(key, bytes.NewReader(data)); err != nil {
+		return err
+	}
 	s.mu.Lock()         // Захватываем мьютекс перед записью
 	defer s.mu.Unlock() // Освобождаем мьютекс после записи
-	if _, exists := s.files[key]; exists {
-		return fmt.Errorf("object %v already exists", key)
+	if s.live(key) {
+		return fmt.Errorf("%w: %v", ErrExists, key)
+	}
+	op := CHANGE_CREATE
+	if s.exists(key) {
+		// Истёкший, но ещё не удалённый объект перезаписывается
+		op = CHANGE_UPDATE
+	}
+	if err := s.write(key, data, m); err != nil {
+		return err
+	}
+	s.recordChange(op, key)
+	return nil
+}
+
+// Replace — метод для перезаписи существующего объекта. Перезапись выполняется,
+// только если ETag объекта совпадает с ifMatch (значением заголовка If-Match,
+// "*" — любой), и объект не защищён от изменений сроком хранения.
+// Владелец объекта при перезаписи сохраняется.
+func (s *Storage) Replace(key string, data []byte, ifMatch string, m Meta) error {
+	if err := s.checkContentType(key, data); err != nil {
+		return err
+	}
+	if err := s.scan(key, bytes.NewReader(data)); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.exists(key) {
+		return ErrETagMismatch
+	}
+	if err := s.checkMutable(key); err != nil {
+		return err
+	}
+	etag, err := s.ETag(key)
+	if err != nil {
+		return err
+	}
+	if !etagMatches(ifMatch, etag) {
+		return ErrETagMismatch
+	}
+	old, err := s.LoadMeta(key)
+	if err != nil {
+		return err
+	}
+	if old.Owner != "" {
+		m.Owner = old.Owner
+	}
+	if err := s.write(key, data, m); err != nil {
+		return err
+	}
+	s.recordChange(CHANGE_UPDATE, key)
+	return nil
+}
+
+// write — записывает данные и метаданные объекта; вызывается с захваченным мьютексом
+func (s *Storage) write(key string, data []byte, m Meta) error {
+	if err := s.checkKeyPath(key); err != nil {
+		return err
+	}
+	if err := s.quota.Reserve(int64(len(data))); err != nil {
+		return err
 	}
-	// Сохраняем данные в памяти
-	s.files[key] = obj{name: key, body: data}
+	if s.wb != nil {
+		// В режиме отложенной записи объект попадает на диск в фоне
+		o := obj{name: key, body: data, modTime: time.Now()}
+		s.cache.Put(o)
+		s.wb.add(o)
+	} else {
+		// Сохраняем данные в бэкенде
+		if err := s.backend.Write(key, data, false); err != nil {
+			log.Printf("Ошибка при сохранении файла %s: %v", logKey(key), logErr(err))
+			s.quota.Release(int64(len(data)))
+			return err
+		}
+		info, err := s.backend.Stat(key)
+		if err != nil {
+			return err
+		}
 
-	// Также сохраняем данные на диск
-	err := os.WriteFile(STORAGE_DIR+"/"+key, data, 0644)
+		// Также сохраняем данные в памяти
+		s.cache.Put(obj{name: key, body: data, modTime: info.ModTime()})
+	}
+
+	s.remember(key)
+	s.metrics.Uploads.Add(1)
+	sum := md5.Sum(data)
+	s.resetMeta(key, hex.EncodeToString(sum[:]), m)
+	return nil
+}
+
+// SaveFile — метод для сохранения объекта из готового временного файла.
+// Файл перемещается в хранилище целиком, не загружаясь в память. MD5 файла
+// для ETag, если он уже посчитан при загрузке, передаётся в sum (пусто — посчитать).
+func (s *Storage) SaveFile(key, tmpPath, sum string, m Meta) error {
+	// Проверку и MD5 для ETag выполняем до захвата мьютекса, чтение большого файла может быть долгим
+	if err := s.checkFileType(key, tmpPath); err != nil {
+		return err
+	}
+	if err := s.scanFile(key, tmpPath); err != nil {
+		return err
+	}
+	if sum == "" {
+		var err error
+		if sum, err = fileChecksum(tmpPath, "md5"); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.live(key) {
+		return fmt.Errorf("%w: %v", ErrExists, key)
+	}
+	op := CHANGE_CREATE
+	if s.exists(key) {
+		op = CHANGE_UPDATE
+	}
+
+	if err := s.checkKeyPath(key); err != nil {
+		return err
+	}
+	info, err := os.Stat(tmpPath)
 	if err != nil {
-		log.Printf("Ошибка при сохранении файла %s: %v", key, err)
+		return err
+	}
+	if err := s.quota.Reserve(info.Size()); err != nil {
+		return err
+	}
+	if err := s.backend.WriteFile(key, tmpPath); err != nil {
+		log.Printf("Ошибка при сохранении файла %s: %v", logKey(key), logErr(err))
+		s.quota.Release(info.Size())
 		return err
 	}
 
+	s.remember(key)
+	s.metrics.Uploads.Add(1)
+	s.resetMeta(key, sum, m)
+	s.recordChange(op, key)
 	return nil
 }
 
+// Delete — метод для удаления объекта из хранилища. Если ifMatch (значение заголовка
+// If-Match) не пусто, объект удаляется, только если его ETag совпадает.
+func (s *Storage) Delete(key, ifMatch string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ifMatch != "" {
+		if !s.exists(key) {
+			return ErrETagMismatch
+		}
+		etag, err := s.ETag(key)
+		if err != nil {
+			return err
+		}
+		if !etagMatches(ifMatch, etag) {
+			return ErrETagMismatch
+		}
+	}
+	if err := s.checkMutable(key); err != nil {
+		return err
+	}
+
+	s.cache.Remove(key)
+	wasPending := false
+	if s.wb != nil {
+		// Ждём завершения текущего сброса, иначе он может записать удалённый объект обратно
+		s.wb.flushMu.Lock()
+		defer s.wb.flushMu.Unlock()
+		wasPending = s.wb.remove(key)
+	}
+
+	// Объект, который сейчас отдаётся потоком, удалится после отдачи
+	err := s.backend.Remove(key)
+	if os.IsNotExist(err) && wasPending {
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+
+	s.downloadCounts.Forget(key)
+	if err := s.removeMeta(key); err != nil {
+		log.Printf("Ошибка при удалении метаданных %s: %v", logKey(key), logErr(err))
+	}
+	s.recordChange(CHANGE_DELETE, key)
+	return nil
+}
+
+// removeEmptyParents — удаляет опустевшие родительские директории файла вплоть до root,
+// чтобы после удаления вложенных объектов не оставалось пустых «папок»
+func removeEmptyParents(path, root string) {
+	for dir := filepath.Dir(path); dir != root && strings.HasPrefix(dir, root+"/"); dir = filepath.Dir(dir) {
+		// Непустую директорию os.Remove не удалит, на этом и останавливаемся
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
+
+// remember — отмечает ключ нового объекта в фильтре Блума и убирает его из кэша промахов
+func (s *Storage) remember(key string) {
+	if s.bloom != nil {
+		s.bloom.Add(key)
+	}
+	if s.absent != nil {
+		s.absent.Remove(key)
+	}
+}
+
+// exists — проверяет, есть ли объект в хранилище. Объект мог быть вытеснен
+// из кэша или ждать записи на диск, поэтому проверяются все места.
+func (s *Storage) exists(key string) bool {
+	if s.cache.Contains(key) || s.pending(key) {
+		return true
+	}
+	if s.absent != nil && s.absent.Contains(key) {
+		return false
+	}
+	// Директория на месте объекта — это вложенные объекты, а не он сам
+	info, err := s.backend.Stat(key)
+	return err == nil && !info.IsDir()
+}
+
+// Exists — exists для обработчиков, которые не держат мьютекс хранилища: без него
+// проверка кэша гонялась бы с его изменением в Load
+func (s *Storage) Exists(key string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.exists(key)
+}
+
+// resetMeta — заменяет метаданные нового объекта на fresh. Метаданные от прежнего
+// содержимого с тем же именем больше не актуальны, записываются новые сразу с MD5 для ETag.
+func (s *Storage) resetMeta(key, md5sum string, fresh Meta) {
+	fresh.Checksums = map[string]string{"md5": md5sum}
+	fresh.Written = time.Now()
+	s.downloadCounts.Forget(key)
+	err := s.UpdateMeta(key, func(m *Meta) {
+		*m = fresh
+	})
+	if err != nil {
+		log.Printf("Ошибка при сохранении метаданных %s: %v", logKey(key), logErr(err))
+	}
+}
+
 // Load — метод для загрузки объекта из хранилища
 func (s *Storage) Load(key string) (obj, bool) {
-	s.mu.Lock()         // Захватываем мьютекс перед чтением
-	defer s.mu.Unlock() // Освобождаем мьютекс после чтения
+	if data, exists, found := s.loadMemory(key); found {
+		return data, exists
+	}
+	return s.loadShared(key)
+}
+
+// Open — Load для отдачи объекта клиенту: объект, который кэш всё равно не сохранит
+// (больше -cache-size или -cache-threshold), не читается в память целиком, а отдаётся
+// потоком из открытого файла (obj при этом без содержимого). Пока файл не закрыт,
+// удаление объекта не мешает дочитать его.
+func (s *Storage) Open(key string) (obj, ObjectContent, bool) {
+	if data, exists, found := s.loadMemory(key); found {
+		return data, nil, exists
+	}
+	file, info, err := s.openObject(key)
+	if err == nil && !s.cache.Fits(info.Size()) {
+		s.metrics.DiskReads.Add(1)
+		return obj{name: key, modTime: info.ModTime()}, file, true
+	}
+	if err == nil {
+		file.Close()
+	}
+	// Отсутствующий объект Load запомнит в кэше промахов
+	data, exists := s.loadShared(key)
+	return data, nil, exists
+}
+
+// loadMemory — ищет объект в памяти: в кэше и очереди отложенной записи. found — ответ
+// получен без диска: объект найден или отсутствует заведомо (фильтр Блума, кэш промахов)
+func (s *Storage) loadMemory(key string) (data obj, exists, found bool) {
+	s.mu.Lock() // Захватываем мьютекс перед чтением
+	defer s.mu.Unlock()
 
 	// Проверяем наличие объекта в памяти
-	data, exists := s.files[key]
-	if exists {
-		return data, true
+	data, exists = s.cache.Get(key)
+	if exists && s.cacheConsistent(data) {
+		s.metrics.CacheHits.Add(1)
+		return data, true, true
+	}
+	s.metrics.CacheMisses.Add(1)
+
+	// Вытесненный из кэша объект может ещё ждать записи на диск
+	if s.wb != nil {
+		if data, exists := s.wb.get(key); exists {
+			s.cache.Put(data)
+			return data, true, true
+		}
 	}
 
-	// Если объект не найден в памяти, пытаемся загрузить его с диска
-	file, err := os.ReadFile(STORAGE_DIR + "/" + key)
+	// Заведомо отсутствующий ключ отклоняем, не обращаясь к диску
+	if s.bloom != nil && !s.bloom.MayContain(key) {
+		s.metrics.BloomRejections.Add(1)
+		return obj{}, false, true
+	}
+	// Ключ, которого только что не оказалось на диске, повторно не ищем
+	if s.absent != nil && s.absent.Contains(key) {
+		s.metrics.NegativeHits.Add(1)
+		return obj{}, false, true
+	}
+	return obj{}, false, false
+}
+
+// loadShared — читает объект с диска; одновременные запросы одного ключа читают
+// диск один раз и делят результат
+func (s *Storage) loadShared(key string) (obj, bool) {
+	if s.flights != nil {
+		return s.flights.Do(key, func() (obj, bool) {
+			return s.loadDisk(key)
+		})
+	}
+	return s.loadDisk(key)
+}
+
+// loadDisk — читает объект с диска и кэширует его в памяти
+func (s *Storage) loadDisk(key string) (obj, bool) {
+	// Чтения разных ключей идут параллельно, запись на время чтения блокируется
+	s.mu.RLock()
+	s.metrics.DiskReads.Add(1)
+	data, err := s.readObject(key)
 	if err != nil {
+		// Отсутствие запоминается до отпускания мьютекса: иначе созданный
+		// в этот момент объект оказался бы в кэше промахов
+		if s.absent != nil && os.IsNotExist(err) {
+			s.absent.Add(key)
+		}
+		s.mu.RUnlock()
 		return obj{}, false
 	}
+	s.mu.RUnlock()
 
-	// Если загрузка с диска успешна, кэшируем объект в памяти
-	s.files[key] = obj{name: key, body: file}
+	// Если загрузка с диска успешна, кэшируем объект в памяти. Пока мьютекс был
+	// отпущен, объект могли перезаписать или удалить — тогда прочитанное уже устарело
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if current, err := s.backend.Stat(key); err == nil && !s.cache.Contains(key) &&
+		current.ModTime().Equal(data.modTime) && current.Size() == int64(len(data.body)) {
+		s.cache.Put(data)
+	}
 	return data, true
 }
 
+// readObject — читает содержимое объекта из бэкенда целиком; вызывается с захваченным мьютексом
+func (s *Storage) readObject(key string) (obj, error) {
+	content, err := s.backend.Open(key)
+	if err != nil {
+		return obj{}, err
+	}
+	defer content.Close()
+	info, err := content.Stat()
+	if err != nil {
+		return obj{}, err
+	}
+	body, err := io.ReadAll(content)
+	if err != nil {
+		return obj{}, err
+	}
+	return obj{name: key, body: body, modTime: info.ModTime()}, nil
+}
+
+// pending — проверяет, ждёт ли объект записи на диск
+func (s *Storage) pending(key string) bool {
+	if s.wb == nil {
+		return false
+	}
+	_, ok := s.wb.get(key)
+	return ok
+}
+
 // Объект в хранилище
 type obj struct {
-	name string
-	body []byte
+	name    string
+	body    []byte
+	modTime time.Time // Время последнего изменения файла на диске
 }
 
-// HandleUpload — обработчик для загрузки объектов
+// HandleUpload — обработчик для загрузки объектов.
+// Новый объект: 201 Created и Location: /download/<key>; перезапись по If-Match: 200 OK.
+// POST /upload без ключа сохраняет объект под новым ключом, который назначает сервер.
 func HandleUpload(w http.ResponseWriter, r *http.Request, storage *Storage) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+	generated := r.URL.Path == "/upload"
+	// Назначенный ключ всегда новый, перезаписывать нечего
+	if generated && (r.Header.Get("If-Match") != "" || r.Header.Get(IF_NEWER_HEADER) != "") {
+		http.Error(w, "If-Match и "+IF_NEWER_HEADER+" требуют ключа объекта", http.StatusBadRequest)
 		return
 	}
 
-	// Получаем ключ (имя объекта) из URL
-	key := r.URL.Path[UPLOAD_PREFIX_LEN:]
+	// Получаем ключ (имя объекта) из URL или назначаем новый
+	var key string
+	if generated {
+		// Ключ по содержимому станет известен после чтения тела, до него проверяется любой
+		key = storage.RequestKey(r, storage.generateKey(nil))
+	} else {
+		key = storage.RequestKey(r, r.URL.Path[UPLOAD_PREFIX_LEN:])
+	}
+	if !checkKey(w, key) || !checkExpires(w, r) {
+		return
+	}
+	if v := r.URL.Query().Get("checkQuota"); v != "" {
+		handleQuotaCheck(w, storage, v)
+		return
+	}
+	// Всё, что проверяется без тела, проверяем до его чтения: с Expect: 100-continue
+	// клиент, получив отказ, большое тело так и не отправит
+	if err := checkDeclaredBody(r, storage.maxObjectSize); err != nil {
+		http.Error(w, err.Error(), uploadErrorStatus(err))
+		return
+	}
+	if !checkUploadType(w, r, storage, key) {
+		return
+	}
+	// Тело, которое заведомо не поместится в квоту, не читаем
+	if r.ContentLength > 0 && !checkQuota(w, storage, r.ContentLength) {
+		return
+	}
+	if !checkLease(w, r, storage, key) || !checkNotAlias(w, storage, key) {
+		return
+	}
+
+	// Сохраняем объект в хранилище. С заголовком If-Match существующий объект
+	// перезаписывается, если его ETag совпадает, без него — только создаётся новый
+	ifMatch := r.Header.Get("If-Match")
+
+	// При синхронизации (X-If-Newer: время изменения источника) объект копируется,
+	// только если источник новее, иначе 304 и передача не повторяется
+	var modified time.Time
+	if v := r.Header.Get(IF_NEWER_HEADER); v != "" {
+		var err error
+		if modified, err = http.ParseTime(v); err != nil {
+			http.Error(w, "Некорректная дата в "+IF_NEWER_HEADER, http.StatusBadRequest)
+			return
+		}
+	}
+	if ifMatch != "" {
+		if !authorizeObject(w, r, storage, key, true) || !checkSealed(w, r, storage, key) {
+			return
+		}
+		// Несовпадение ETag тоже видно без тела; под мьютексом Replace проверит его ещё раз
+		if !storage.Exists(key) {
+			http.Error(w, ErrETagMismatch.Error(), http.StatusPreconditionFailed)
+			return
+		}
+		if etag, err := storage.ETag(key); err == nil && !etagMatches(ifMatch, etag) {
+			http.Error(w, ErrETagMismatch.Error(), http.StatusPreconditionFailed)
+			return
+		}
+	} else if !generated && modified.IsZero() && storage.Live(key) {
+		writeExists(w, r, storage, key, fmt.Sprintf("%v: %v", ErrExists, clientKey(r, key)))
+		return
+	}
 
-	// Читаем тело запроса (данные объекта)
-	data, err := io.ReadAll(r.Body)
+	// Читаем тело запроса (данные объекта), сжатое gzip распаковываем
+	data, err := readUploadBody(r, storage.maxObjectSize)
+	defer r.Body.Close()
+	setRetryAfter(w, err)
+	if status := uploadErrorStatus(err); err != nil && status != http.StatusInternalServerError {
+		http.Error(w, err.Error(), status)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Ошибка чтения данных", http.StatusInternalServerError)
 		return
 	}
-	defer r.Body.Close()
+	if !checkQuota(w, storage, int64(len(data))) {
+		return
+	}
+	if generated && storage.keyTemplate == KEY_TEMPLATE_HASH {
+		key = storage.RequestKey(r, storage.generateKey(data))
+		// Такое содержимое уже загружено: отдаём адрес того же объекта, а не 409
+		if storage.Live(key) {
+			w.Header().Set("Location", downloadURL(clientKey(r, key)))
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprintf(w, "Объект %s уже сохранен", clientKey(r, key))
+			return
+		}
+	}
 
-	// Сохраняем объект в хранилище
-	err = storage.Save(key, data)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusConflict)
+	if !modified.IsZero() {
+		newer, exists := storage.sourceIsNewer(key, data, modified)
+		if !newer {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if exists && ifMatch == "" {
+			ifMatch = "*"
+			if !authorizeObject(w, r, storage, key, true) || !checkSealed(w, r, storage, key) {
+				return
+			}
+		}
+	}
+	if ifMatch != "" {
+		err = storage.Replace(key, data, ifMatch, uploadMeta(r))
 	} else {
-		// Отправляем ответ клиенту
+		err = storage.Save(key, data, uploadMeta(r))
+	}
+	// Случайный ключ может совпасть с существующим лишь с ничтожной вероятностью,
+	// но и тогда объект не перезаписывается, а получает другой ключ
+	for attempt := 1; generated && storage.keyTemplate != KEY_TEMPLATE_HASH && errors.Is(err, ErrExists) && attempt < GENERATE_KEY_ATTEMPTS; attempt++ {
+		key = storage.RequestKey(r, storage.generateKey(data))
+		err = storage.Save(key, data, uploadMeta(r))
+	}
+	if errors.Is(err, ErrLocked) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+	} else if errors.Is(err, ErrETagMismatch) {
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+	} else if errors.Is(err, ErrRejected) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	} else if errors.Is(err, ErrQuotaExceeded) {
+		http.Error(w, "Недостаточно места в квоте хранилища", http.StatusInsufficientStorage)
+	} else if errors.Is(err, ErrUnsupportedType) {
+		http.Error(w, clientError(r, err), http.StatusUnsupportedMediaType)
+	} else if errors.Is(err, ErrExists) {
+		writeExists(w, r, storage, key, clientError(r, err))
+	} else if err != nil {
+		http.Error(w, clientError(r, err), http.StatusConflict)
+	} else if ifMatch != "" {
+		// Перезапись существующего объекта
 		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, "Объект %s успешно сохранен", key)
+		fmt.Fprintf(w, "Объект %s успешно перезаписан", clientKey(r, key))
+	} else {
+		// Новый объект: 201 и адрес, по которому его можно скачать
+		w.Header().Set("Location", downloadURL(clientKey(r, key)))
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, "Объект %s успешно сохранен", clientKey(r, key))
 	}
 
 }
 
+// writeExists — отвечает 409 на создание уже существующего объекта. Если клиенту
+// можно читать объект, в ETag отдаётся его текущий ETag: с ним в If-Match клиент
+// перезапишет именно ту версию, которую видел.
+func writeExists(w http.ResponseWriter, r *http.Request, storage *Storage, key, msg string) {
+	if m, err := storage.LoadMeta(key); err == nil && m.canRead(Identity(r)) {
+		if etag, err := storage.ETag(key); err == nil {
+			w.Header().Set("ETag", etag)
+		}
+	}
+	http.Error(w, msg, http.StatusConflict)
+}
+
+// downloadURL — адрес для скачивания объекта
+func downloadURL(key string) string {
+	u := url.URL{Path: "/download/" + key}
+	return u.EscapedPath()
+}
+
 // HandleDownload — обработчик для загрузки объектов
 func HandleDownload(w http.ResponseWriter, r *http.Request, storage *Storage) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+	// Получаем ключ (имя объекта) из URL
+	key := storage.RequestKey(r, r.URL.Path[DOWNLOAD_PREFIX_LEN:])
+	if !checkKey(w, key) {
 		return
 	}
 
-	// Получаем ключ (имя объекта) из URL
-	key := r.URL.Path[DOWNLOAD_PREFIX_LEN:]
+	// Псевдоним отдаёт объект, на который указывает; Content-Location сообщает, какой именно
+	target, ok := resolveAlias(w, storage, key)
+	if !ok {
+		return
+	}
+	if target != key {
+		w.Header().Set("Content-Location", "/download/"+clientKey(r, target))
+	}
+	serveObject(w, r, storage, target)
+}
 
-	// Загружаем объект из хранилища
-	data, exists := storage.Load(key)
+// serveObject — отправляет объект клиенту (GET и HEAD)
+func serveObject(w http.ResponseWriter, r *http.Request, storage *Storage, key string) {
+	// Загружаем объект из хранилища; объект, который не держится в кэше, отдаётся
+	// потоком из файла и дочитывается, даже если его удалят во время скачивания
+	data, file, exists := storage.Open(key)
 	if !exists {
 		http.Error(w, "Объект не найден", http.StatusNotFound)
 		return
 	}
+	if file != nil {
+		defer file.Close()
+	}
+	if !authorizeObject(w, r, storage, key, false) {
+		return
+	}
+	m, err := storage.LoadMeta(key)
+	if err != nil {
+		log.Printf("Ошибка чтения метаданных %s: %v", logKey(key), logErr(err))
+	}
+	// Объект с истёкшим Expires уже не отдаётся, даже если его ещё не удалили
+	if m.expired(time.Now()) {
+		storage.expire(key)
+		http.Error(w, "Объект не найден", http.StatusNotFound)
+		return
+	}
+	if !m.Expires.IsZero() {
+		w.Header().Set("Expires", m.Expires.UTC().Format(http.TimeFormat))
+	}
 
-	// Отправляем данные объекта клиенту
-	w.WriteHeader(http.StatusOK)
-	w.Write(data.body)
+	// Объект-перенаправление (короткая ссылка, переехавшая страница) вместо содержимого
+	// отдаёт Location; переход учитывается как скачивание
+	if m.Redirect != "" {
+		code := m.RedirectCode
+		if code == 0 {
+			code = http.StatusMovedPermanently
+		}
+		storage.countDownload(r, key)
+		http.Redirect(w, r, m.Redirect, code)
+		return
+	}
+
+	// ETag нужен для условных запросов, в том числе If-Range при докачке
+	etag, err := storage.ETag(key)
+	if err != nil {
+		log.Printf("Ошибка вычисления ETag %s: %v", logKey(key), logErr(err))
+	}
+
+	// Уменьшенной копии, перекодированию и конверту нужно всё содержимое сразу
+	if q := r.URL.Query(); file != nil && (q.Get("w") != "" || q.Get("h") != "" || q.Get("charset") != "" || q.Get("encoding") != "") {
+		if data.body, err = io.ReadAll(file); err != nil {
+			log.Printf("Ошибка чтения файла %s: %v", logKey(key), logErr(err))
+			http.Error(w, "Ошибка чтения объекта", http.StatusInternalServerError)
+			return
+		}
+		file = nil
+	}
+
+	// Для изображений по запросу (?w=&h=) отдаём уменьшенную копию,
+	// остальные объекты отдаются без изменений
+	if q := r.URL.Query(); q.Get("w") != "" || q.Get("h") != "" {
+		width, height, err := parseImageSize(q)
+		if err != nil {
+			http.Error(w, "Некорректный размер изображения", http.StatusBadRequest)
+			return
+		}
+		thumb, contentType, ok, err := storage.Thumbnail(data, width, height)
+		if err != nil {
+			log.Printf("Ошибка масштабирования %s: %v", logKey(key), logErr(err))
+			http.Error(w, "Ошибка масштабирования изображения", http.StatusInternalServerError)
+			return
+		}
+		if ok {
+			data, etag = thumb, `"`+thumb.name+`"`
+			w.Header().Set("Content-Type", contentType)
+		}
+	}
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+
+	// Безопасные типы браузер показывает сам, остальное скачивается файлом, чтобы
+	// загруженный кем-то HTML не выполнился в браузере (если вызывающий не решил иначе)
+	// Тип, заданный в метаданных, важнее определённого по содержимому
+	if m.CacheControl != "" {
+		w.Header().Set("Cache-Control", m.CacheControl)
+	}
+	contentType := w.Header().Get("Content-Type")
+	if contentType == "" {
+		contentType = m.ContentType
+		if contentType == "" {
+			contentType = storage.objectContentType(obj{name: key, body: objectHead(data, file)})
+		}
+		w.Header().Set("Content-Type", contentType)
+	}
+
+	// Текстовые объекты по запросу (?charset=) перекодируются для старых клиентов.
+	// У перекодированного содержимого свой ETag, чтобы кэши не путали его с исходным
+	if charset := r.URL.Query().Get("charset"); charset != "" {
+		text, textType, ok, err := Transcode(data, contentType, charset)
+		if errors.Is(err, ErrUnknownCharset) {
+			http.Error(w, "Неизвестная кодировка "+charset, http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, ErrUnencodable) {
+			http.Error(w, "Текст объекта нельзя представить в кодировке "+charset, http.StatusNotAcceptable)
+			return
+		}
+		if ok {
+			data, contentType = text, textType
+			w.Header().Set("Content-Type", contentType)
+			if etag != "" {
+				w.Header().Set("ETag", strings.TrimSuffix(etag, `"`)+"-"+strings.ToLower(charset)+`"`)
+			}
+		}
+	}
+
+	// Клиентам, читающим только JSON, объект отдаётся конвертом с base64
+	if v := r.URL.Query().Get("encoding"); v != "" {
+		if v != ENCODING_BASE64 {
+			http.Error(w, "Поддерживается только encoding="+ENCODING_BASE64, http.StatusBadRequest)
+			return
+		}
+		if status := checkConditions(r, w.Header().Get("ETag"), data.modTime); status != 0 {
+			w.Header().Del("ETag")
+			writeConditional(w, status, data.modTime)
+			return
+		}
+		storage.countDownload(r, key)
+		writeEnvelope(w, clientKey(r, key), data, contentType, w.Header().Get("ETag"))
+		return
+	}
+
+	// Объект из файла отдаётся потоком; ServeContent выставит Content-Length по размеру
+	// открытого файла, а не по пути, где объект могли уже перезаписать
+	content := io.ReadSeeker(bytes.NewReader(data.body))
+	size := int64(len(data.body))
+	if file != nil {
+		content = file
+		if info, err := file.Stat(); err == nil {
+			size = info.Size()
+		}
+	}
+
+	// Сжимаемые объекты отдаются сжатыми (br или gzip), если клиент это принимает.
+	// Диапазоны отдаются без сжатия: Range относится к несжатому содержимому
+	encoding := ""
+	if storage.compress && compressible(contentType) && size >= COMPRESS_MIN_SIZE {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if encoding = negotiateEncoding(r); encoding != "" && r.Header.Get("Range") == "" {
+			if etag := w.Header().Get("ETag"); etag != "" {
+				w.Header().Set("ETag", strings.TrimSuffix(etag, `"`)+"-"+encoding+`"`)
+			}
+		} else {
+			encoding = ""
+		}
+	}
+
+	if w.Header().Get("Content-Disposition") == "" {
+		w.Header().Set("Content-Disposition", storage.contentDisposition(key, contentType))
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	// Условные заголовки проверяются по итоговому ETag (с учётом перекодирования и сжатия)
+	// до учёта скачивания: ответ 304 объект не отдаёт. Range и If-Range разбирает ServeContent
+	if status := checkConditions(r, w.Header().Get("ETag"), data.modTime); status != 0 {
+		writeConditional(w, status, data.modTime)
+		return
+	}
+	storage.countDownload(r, key)
+
+	// Отправляем данные объекта клиенту. ServeContent выставляет Content-Length по размеру
+	// объекта и обрабатывает Range и If-Range: диапазон отдаётся, только если объект
+	// не изменился с момента начала скачивания. Несколько диапазонов в одном Range
+	// ServeContent отдаёт ответом multipart/byteranges (RFC 7233) с типом объекта в каждой части.
+	cw := &countingWriter{ResponseWriter: w}
+	out := http.ResponseWriter(cw)
+	var cz *compressWriter
+	if encoding != "" {
+		cz = newCompressWriter(out, encoding)
+		out = cz
+	}
+	var sw *streamWriter
+	if storage.streamBuffer > 0 {
+		sw = newStreamWriter(cw, storage.streamBuffer, storage.streamFlush)
+		out = sw
+	}
+	if rate := downloadRate(r, storage); rate > 0 {
+		content = newThrottledReader(r.Context(), content, rate)
+	}
+	http.ServeContent(out, r, key, data.modTime, content)
+	if sw != nil {
+		sw.Flush()
+	}
+	// У ответа на HEAD нет тела, и конец сжатого потока дописывать некуда
+	if cz != nil && r.Method != http.MethodHead {
+		cz.Close()
+	}
+
+	// Клиент отключился, не дочитав ответ: запись в соединение завершилась ошибкой
+	if cw.err != nil || r.Context().Err() != nil {
+		storage.metrics.AbortedDownloads.Add(1)
+		log.Printf("Скачивание %s прервано клиентом (запрос %s): отправлено %d из %d байт", logKey(key), RequestID(r), cw.n, size)
+	}
 }
 
-// HandleList — обработчик для вывода списка всех объектов
-func HandleList(w http.ResponseWriter, r *http.Request, storage *Storage) {
-	type List struct {
-		Name   string
-		InCach bool
+// HandleDelete — обработчик для удаления объектов
+func HandleDelete(w http.ResponseWriter, r *http.Request, storage *Storage) {
+	// Получаем ключ (имя объекта) из URL
+	key := storage.RequestKey(r, r.URL.Path[DELETE_PREFIX_LEN:])
+	if !checkKey(w, key) {
+		return
+	}
+
+	if !authorizeObject(w, r, storage, key, true) || !checkLease(w, r, storage, key) || !checkSealed(w, r, storage, key) {
+		return
+	}
+	// С заголовком If-Match объект удаляется, только если его ETag совпадает
+	err := storage.Delete(key, r.Header.Get("If-Match"))
+	if errors.Is(err, ErrLocked) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
 	}
-	if r.Method != http.MethodGet {
-		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+	if errors.Is(err, ErrETagMismatch) {
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		return
+	}
+	if os.IsNotExist(err) {
+		http.Error(w, "Объект не найден", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Ошибка при удалении объекта %s: %v", logKey(key), logErr(err))
+		http.Error(w, "Ошибка удаления объекта", http.StatusInternalServerError)
 		return
 	}
 
-	// Захватываем мьютекс для доступа к хэш-таблице объектов
-	storage.mu.Lock()
-	defer storage.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Объект %s успешно удален", clientKey(r, key))
+}
 
-	// Создаем список ключей (имен объектов)
-	files, err := os.ReadDir(STORAGE_DIR)
+// List — элемент списка объектов
+type List struct {
+	Name    string
+	InCach  bool
+	Size    int64
+	modTime time.Time // Время изменения — только для ETag списка, в JSON не попадает
+}
+
+// HandleList — обработчик для вывода списка всех объектов.
+// Параметры minSize и maxSize оставляют только объекты с размером в этих пределах (в байтах),
+// limit и marker выдают список страницами не больше -max-list-results объектов,
+// foldersOnly=true вместо объектов выдаёт «папки» на уровне prefix.
+// Ответ со страницей несёт ETag: с If-None-Match неизменившийся список — 304.
+func HandleList(w http.ResponseWriter, r *http.Request, storage *Storage) {
+	filter, err := parseListFilter(r.URL.Query())
 	if err != nil {
-		log.Panicf("Не получилось прочитать дерикторию %v: %v", STORAGE_DIR, err)
+		http.Error(w, "Некорректный фильтр размера: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Клиент виртуального хоста видит только объекты своей поддиректории
+	filter.tenant = Tenant(r)
+	marker, limit, err := parseListPage(r.URL.Query(), storage.maxListResults)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.URL.Query().Get("foldersOnly") == "true" {
+		handleListFolders(w, r, storage, marker, limit)
+		return
 	}
+	ndjson := strings.Contains(r.Header.Get("Accept"), NDJSON_TYPE)
 
-	keys := make([]List, 0, len(files))
+	// Огромные списки без ограничения клиент может получать потоком, по объекту в строке
+	if ndjson && limit == 0 && marker == "" {
+		HandleListNDJSON(w, r, storage, filter)
+		return
+	}
 
-	for key := range storage.files {
-		keys = append(keys, List{key, true})
+	// Создаем список ключей (имен объектов) по порядку; не поместившиеся в страницу
+	// клиент получит, повторив запрос с marker из X-Next-Marker
+	keys, next, err := storage.listPage(filter, marker, limit)
+	if err != nil {
+		log.Printf("Не получилось прочитать директорию %v: %v", storageDir, logErr(err))
+		http.Error(w, "Ошибка чтения хранилища", http.StatusInternalServerError)
+		return
+	}
+	if next != "" {
+		w.Header().Set(TRUNCATED_HEADER, "true")
+		w.Header().Set(MARKER_HEADER, next)
+	}
+	// Неизменившийся список повторно не передаём
+	etag := listETag(keys, next, ndjson)
+	w.Header().Set("ETag", etag)
+	w.Header().Add("Vary", "Accept")
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatchesWeak(inm, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
 	}
 
-	for _, f := range files {
-		if _, exist := storage.files[f.Name()]; !exist {
-			keys = append(keys, List{f.Name(), false})
+	if ndjson {
+		w.Header().Set("Content-Type", NDJSON_TYPE)
+		enc := json.NewEncoder(w)
+		for _, entry := range keys {
+			if err := enc.Encode(entry); err != nil {
+				return
+			}
 		}
+		return
 	}
 
-	// Кодируем список ключей в формат JSON и отправляем клиенту
+	// Кодируем список ключей в формат JSON целиком до ответа: ошибка посреди кодирования
+	// дала бы клиенту обрезанный JSON с уже отправленным 200
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(keys); err != nil {
+		log.Printf("Ошибка кодирования списка объектов: %v", logErr(err))
+		w.Header().Del(TRUNCATED_HEADER)
+		w.Header().Del(MARKER_HEADER)
+		w.Header().Del("ETag")
+		http.Error(w, "Ошибка формирования списка объектов", http.StatusInternalServerError)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(keys)
+	w.Write(body.Bytes())
 }
 
-func main() {
-	// Проверяем наличие директории для хранения объектов
-	if _, err := os.Stat(STORAGE_DIR); os.IsNotExist(err) {
-		err := os.Mkdir(STORAGE_DIR, 0755)
-		if err != nil {
-			log.Fatalf("Ошибка создания директории %s: %v", STORAGE_DIR, err)
+// applyConfig — переносит настройки, общие для всего процесса, в переменные пакета
+func applyConfig(cfg *Config) {
+	storageDir = cfg.StorageDir
+	maxKeyDepth = cfg.MaxKeyDepth
+	tmpDir = cfg.TempDir
+	hashLogKeys = cfg.LogKeys == LOG_KEYS_HASH
+	minTTL, maxTTL, clampTTL = cfg.MinTTL, cfg.MaxTTL, cfg.TTLBounds == TTL_CLAMP
+}
+
+// prepareDirs — создаёт директорию хранилища и служебные директории, если их ещё нет
+func prepareDirs(cfg *Config) error {
+	dirs := []string{storageDir, storagePath(META_DIR), storagePath(TMP_DIR), tusDir(), storagePath(DERIVED_DIR)}
+	for _, route := range cfg.TypeRoutes {
+		// Временные файлы корня лежат на его ФС, чтобы запись завершалась переименованием
+		dirs = append(dirs, route.Dir+"/"+TMP_DIR)
+	}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	// Создаем новое хранилище
-	storage := NewStorage()
-
-	// Настраиваем маршруты для обработки HTTP-запросов
-	http.HandleFunc("/upload/", func(w http.ResponseWriter, r *http.Request) {
+// NewServer — HTTP-сервер хранилища со всеми маршрутами; inflight — выполняемые им
+// запросы, которые Shutdown прерывает, если они не завершились за -shutdown-timeout
+func NewServer(cfg *Config, storage *Storage) (server *http.Server, inflight *InFlight) {
+	// Настраиваем маршруты для обработки HTTP-запросов; пути приводятся к единому виду
+	mux := NewRouter()
+	auth := NewAuth(cfg)
+	// Загрузки и скачивания ограничиваются отдельными семафорами, а внутри них —
+	// лимитом на одного клиента, чтобы один клиент не занял все слоты
+	uploadSem, uploadClients := NewSemaphore(cfg.MaxUploads), NewClientLimiter(cfg.MaxPerClient)
+	downloadSem, downloadClients := NewSemaphore(cfg.MaxDownloads), NewClientLimiter(cfg.MaxPerClient)
+	uploads := func(next http.HandlerFunc) http.HandlerFunc {
+		return LimitPerClient(uploadClients, LimitConcurrency(uploadSem, next))
+	}
+	downloads := func(next http.HandlerFunc) http.HandlerFunc {
+		return LimitPerClient(downloadClients, LimitConcurrency(downloadSem, next))
+	}
+	// Тела, читаемые в память целиком, вместе не превышают общий бюджет памяти
+	// (tus пишет тело сразу в файл и в бюджете не учитывается)
+	uploadMemory := NewMemoryBudget(cfg.MaxUploadMemory)
+	buffered := func(next http.HandlerFunc) http.HandlerFunc {
+		return LimitMemory(uploadMemory, next)
+	}
+	// Изменяющие запросы требуют API-ключа, загрузка — ключа или подписанной ссылки
+	mux.HandleFunc("/upload/", RequireAuth(auth, true, uploads(buffered(func(w http.ResponseWriter, r *http.Request) {
 		HandleUpload(w, r, storage)
-	})
-	http.HandleFunc("/download/", func(w http.ResponseWriter, r *http.Request) {
+	}))), http.MethodPost, http.MethodPut)
+	mux.HandleFunc("/upload", RequireAuth(auth, false, uploads(buffered(func(w http.ResponseWriter, r *http.Request) {
+		HandleUpload(w, r, storage)
+	}))), http.MethodPost)
+	mux.HandleFunc("/copy/", RequireAuth(auth, false, uploads(func(w http.ResponseWriter, r *http.Request) {
+		HandleCopy(w, r, storage)
+	})), http.MethodPost)
+	mux.HandleFunc("/presign/", RequireAuth(auth, false, func(w http.ResponseWriter, r *http.Request) {
+		HandlePresign(w, r, auth)
+	}), http.MethodGet)
+	mux.HandleFunc("/download/", downloads(WithDownloadRate(auth, cfg.DownloadRate, func(w http.ResponseWriter, r *http.Request) {
 		HandleDownload(w, r, storage)
-	})
-	http.HandleFunc("/list", func(w http.ResponseWriter, r *http.Request) {
+	})), http.MethodGet, http.MethodHead)
+	mux.HandleFunc("/lock/", RequireAuth(auth, false, func(w http.ResponseWriter, r *http.Request) {
+		HandleLock(w, r, storage)
+	}), http.MethodPost)
+	mux.HandleFunc("/lease/", RequireAuth(auth, false, func(w http.ResponseWriter, r *http.Request) {
+		HandleLease(w, r, storage)
+	}), http.MethodPost, http.MethodDelete)
+	mux.HandleFunc("/acl/", RequireAuth(auth, false, func(w http.ResponseWriter, r *http.Request) {
+		HandleACL(w, r, storage)
+	}), http.MethodGet, http.MethodPut)
+	mux.HandleFunc("/patch/", RequireAuth(auth, false, uploads(buffered(func(w http.ResponseWriter, r *http.Request) {
+		HandlePatch(w, r, storage)
+	}))), http.MethodPatch)
+	mux.HandleFunc("/delete/", RequireAuth(auth, false, func(w http.ResponseWriter, r *http.Request) {
+		HandleDelete(w, r, storage)
+	}), http.MethodDelete)
+	mux.HandleFunc("/touch/", RequireAuth(auth, false, func(w http.ResponseWriter, r *http.Request) {
+		HandleTouch(w, r, storage)
+	}), http.MethodPost)
+	mux.HandleFunc("/pin/", RequireAuth(auth, false, func(w http.ResponseWriter, r *http.Request) {
+		HandlePin(w, r, storage)
+	}), http.MethodGet, http.MethodPost, http.MethodDelete)
+	tus := NewTusUploads(storage)
+	if cfg.TempMaxAge > 0 {
+		go tus.reapLoop(cfg.TempMaxAge)
+	}
+	mux.HandleFunc(TUS_PREFIX, RequireAuth(auth, false, uploads(func(w http.ResponseWriter, r *http.Request) {
+		HandleTus(w, r, tus)
+	})))
+	mux.HandleFunc("/alias/", RequireAuth(auth, false, func(w http.ResponseWriter, r *http.Request) {
+		HandleAlias(w, r, storage)
+	}), http.MethodGet, http.MethodPut, http.MethodDelete)
+	mux.HandleFunc("/meta/", RequireAuth(auth, false, func(w http.ResponseWriter, r *http.Request) {
+		HandleMeta(w, r, storage)
+	}), http.MethodGet, http.MethodPatch)
+	mux.HandleFunc("/stat/", func(w http.ResponseWriter, r *http.Request) {
+		HandleStat(w, r, storage)
+	}, http.MethodGet)
+	mux.HandleFunc("/stat", func(w http.ResponseWriter, r *http.Request) {
+		HandleStatBatch(w, r, storage)
+	}, http.MethodGet, http.MethodPost)
+	mux.HandleFunc("/checksum/", func(w http.ResponseWriter, r *http.Request) {
+		HandleChecksum(w, r, storage)
+	}, http.MethodGet)
+	mux.HandleFunc("/zip", downloads(func(w http.ResponseWriter, r *http.Request) {
+		HandleZip(w, r, storage)
+	}), http.MethodGet, http.MethodPost)
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		HandleMetrics(w, r, storage)
+	}, http.MethodGet)
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		HandleStats(w, r, storage)
+	}, http.MethodGet)
+	mux.HandleFunc("/admin/flush", RequireAuth(auth, false, func(w http.ResponseWriter, r *http.Request) {
+		HandleFlush(w, r, storage)
+	}), http.MethodPost)
+	mux.HandleFunc("/admin/reindex", RequireAuth(auth, false, func(w http.ResponseWriter, r *http.Request) {
+		HandleReindex(w, r, storage)
+	}), http.MethodPost)
+	mux.HandleFunc("/admin/case-collisions", RequireAuth(auth, false, func(w http.ResponseWriter, r *http.Request) {
+		HandleCaseCollisions(w, r, storage, cfg)
+	}), http.MethodGet)
+	mux.HandleFunc("/admin/config", RequireAuth(auth, false, func(w http.ResponseWriter, r *http.Request) {
+		HandleConfig(w, r, cfg)
+	}), http.MethodGet)
+	mux.HandleFunc("/usage", func(w http.ResponseWriter, r *http.Request) {
+		HandleUsage(w, r, storage)
+	}, http.MethodGet)
+	mux.HandleFunc("/manifest", func(w http.ResponseWriter, r *http.Request) {
+		HandleManifest(w, r, storage, auth)
+	}, http.MethodGet, http.MethodPost)
+	mux.HandleFunc("/list", func(w http.ResponseWriter, r *http.Request) {
 		HandleList(w, r, storage)
+	}, http.MethodGet)
+	mux.HandleFunc("/changelog", func(w http.ResponseWriter, r *http.Request) {
+		HandleChangeLog(w, r, storage)
+	}, http.MethodGet)
+	// Остальные пути — S3-совместимый API: /<bucket>/<key>. Чтение открыто,
+	// как у /download/, изменения требуют API-ключа (подписи AWS не поддерживаются)
+	s3 := func(w http.ResponseWriter, r *http.Request) {
+		HandleS3(w, r, storage)
+	}
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			HandleIndex(w, r, storage, cfg.IndexKey)
+		} else if isReadMethod(r) {
+			downloads(s3)(w, r)
+		} else {
+			RequireAuth(auth, false, uploads(buffered(s3)))(w, r)
+		}
 	})
 
-	// Запускаем HTTP-сервер на порту 8080
-	log.Println("Сервер запущен на порту 8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	// Каждый запрос получает идентификатор и учитывается среди выполняемых, паника
+	// в обработчике не роняет сервер, слишком долгие запросы попадают в журнал
+	inflight = NewInFlight()
+	server = &http.Server{
+		Addr:    ":8080",
+		Handler: WithRequestID(WithInFlight(inflight, WithSlowLog(cfg.SlowRequest, WithAccessLog(cfg.AccessLogSample, WithRecovery(WithCORS(cfg.CORSOrigins, WithIdentity(auth, WithVirtualHosts(cfg.VirtualHosts, mux)))))))),
+	}
+	return server, inflight
+}
+
+func main() {
+	// Разбираем флаги командной строки
+	cfg, err := ParseConfig(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Ошибка конфигурации: %v", err)
+	}
+	applyConfig(cfg)
+
+	// Проверяем наличие директории для хранения объектов и её служебных директорий
+	if err := prepareDirs(cfg); err != nil {
+		log.Fatalf("Ошибка создания директории: %v", err)
+	}
+	warnCrossDevice()
+
+	// Создаем новое хранилище
+	storage := NewStorage(cfg)
+
+	// В режиме самопроверки сервер не запускается
+	if cfg.SelfTest {
+		if err := SelfTest(storage); err != nil {
+			log.Fatalf("Самопроверка не пройдена: %v", err)
+		}
+		log.Println("Самопроверка пройдена")
+		return
+	}
+	server, inflight := NewServer(cfg, storage)
+
+	// Запускаем HTTP-сервер на порту 8080; с -max-connections лишние соединения ждут своей очереди
+	ln, err := Listen(server.Addr, cfg.MaxConnections)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go func() {
+		log.Println("Сервер запущен на порту 8080")
+		if err := server.Serve(ln); err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	// Ждём сигнала завершения и останавливаем сервер, дав запросам завершиться
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+	log.Println("Остановка сервера")
+	Shutdown(server, storage, inflight, cfg.ShutdownTimeout)
+}
+
+// Shutdown — корректно останавливает сервер: дожидается текущих запросов не дольше
+// timeout, затем прерывает оставшиеся и закрывает соединения, чтобы остановку не
+// задержал зависший клиент, и сбрасывает на диск всё, что ещё не записано
+func Shutdown(server *http.Server, storage *Storage, inflight *InFlight, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); errors.Is(err, context.DeadlineExceeded) {
+		for _, req := range inflight.CancelAll() {
+			log.Printf("Запрос %s %s (запрос %s) прерван при остановке, выполнялся %v",
+				req.method, logPath(req.path), req.id, time.Since(req.start).Round(time.Millisecond))
+		}
+		if err := server.Close(); err != nil {
+			log.Printf("Ошибка закрытия соединений: %v", err)
+		}
+	} else if err != nil {
+		log.Printf("Ошибка остановки сервера: %v", err)
+	}
+
+	flushed, err := storage.Flush()
+	if err != nil {
+		log.Printf("Ошибка сброса на диск при остановке: %v", logErr(err))
+	}
+	restored, err := storage.PersistCacheOnly()
+	if err != nil {
+		log.Printf("Ошибка записи объектов из кэша при остановке: %v", logErr(err))
+	}
+	storage.flushDownloadCounts()
+	log.Printf("При остановке записано на диск объектов: %d", flushed+restored)
 }
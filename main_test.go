@@ -0,0 +1,428 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// discardLog — куда пишется журнал сервера в тестах: в выводе тестов он только мешает
+var discardLog = io.Discard
+
+func TestMain(m *testing.M) {
+	log.SetOutput(discardLog)
+	os.Exit(m.Run())
+}
+
+// newTestStorage — хранилище с флагами args во временной директории теста. Фоновые
+// очистка временных файлов, удаление истёкших объектов и сохранение счётчиков скачиваний
+// выключены: они пережили бы тест и читали бы настройки следующего, а тесты вызывают
+// Reap, ExpireObjects и flushDownloadCounts сами.
+func newTestStorage(t *testing.T, args ...string) (*Storage, *Config) {
+	t.Helper()
+	cfg, err := ParseConfig(append([]string{"-storage-dir", t.TempDir(), "-temp-max-age", "0", "-expiry-sweep", "0", "-download-count-flush", "0"}, args...))
+	if err != nil {
+		t.Fatalf("ParseConfig(%q): %v", args, err)
+	}
+	applyConfig(cfg)
+	// Настройки пакета не переходят в следующие тесты
+	t.Cleanup(func() {
+		defaults, _ := ParseConfig(nil)
+		applyConfig(defaults)
+	})
+	if err := prepareDirs(cfg); err != nil {
+		t.Fatalf("prepareDirs: %v", err)
+	}
+	return NewStorage(cfg), cfg
+}
+
+// newTestServer — сервер со всеми маршрутами над хранилищем из newTestStorage
+func newTestServer(t *testing.T, args ...string) (*httptest.Server, *Storage) {
+	t.Helper()
+	storage, cfg := newTestStorage(t, args...)
+	server, _ := NewServer(cfg, storage)
+	ts := httptest.NewServer(server.Handler)
+	t.Cleanup(ts.Close)
+	return ts, storage
+}
+
+// do — выполняет запрос к тестовому серверу и читает ответ целиком; header — пары имя, значение
+func do(t *testing.T, ts *httptest.Server, method, path, body string, header ...string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("NewRequest %s %s: %v", method, path, err)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	// Заголовок Host клиент берёт не из Header, а из req.Host
+	if host := req.Header.Get("Host"); host != "" {
+		req.Host = host
+	}
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("%s %s: reading body: %v", method, path, err)
+	}
+	return resp, string(data)
+}
+
+// upload — создаёт объект и проверяет, что он создан
+func upload(t *testing.T, ts *httptest.Server, key, body string, header ...string) {
+	t.Helper()
+	if resp, msg := do(t, ts, http.MethodPost, "/upload/"+key, body, header...); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("upload %s: %d %s", key, resp.StatusCode, msg)
+	}
+}
+
+// holdRequest — начинает запрос с телом и ждёт, пока обработчик не начнёт читать тело
+// (сервер ответит 100 Continue): с этого момента запрос занимает свой слот. Возвращённая
+// функция дописывает тело rest и возвращает код ответа.
+func holdRequest(t *testing.T, ts *httptest.Server, method, path string, header ...string) func(rest string) int {
+	t.Helper()
+	pr, pw := io.Pipe()
+	req, err := http.NewRequest(method, ts.URL+path, pr)
+	if err != nil {
+		t.Fatalf("NewRequest %s %s: %v", method, path, err)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	req.Header.Set("Expect", "100-continue")
+	reading := make(chan struct{})
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		Got100Continue: func() { close(reading) },
+	}))
+	client := &http.Client{Transport: &http.Transport{ExpectContinueTimeout: time.Minute}}
+	t.Cleanup(client.CloseIdleConnections)
+
+	done := make(chan int, 1)
+	go func() {
+		resp, err := client.Do(req)
+		if err != nil {
+			done <- 0
+			return
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		done <- resp.StatusCode
+	}()
+	select {
+	case <-reading:
+	case code := <-done:
+		t.Fatalf("%s %s finished with %d before reading the body", method, path, code)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s %s: handler did not start reading the body", method, path)
+	}
+	return func(rest string) int {
+		io.WriteString(pw, rest)
+		pw.Close()
+		return <-done
+	}
+}
+
+func TestDownloadIfRange(t *testing.T) {
+	ts, _ := newTestServer(t)
+	upload(t, ts, "obj", "0123456789")
+	resp, _ := do(t, ts, http.MethodGet, "/download/obj", "")
+	etag, modified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if etag == "" || modified == "" {
+		t.Fatalf("download lacks validators: ETag %q, Last-Modified %q", etag, modified)
+	}
+
+	tests := []struct {
+		name    string
+		ifRange string
+		status  int
+		body    string
+	}{
+		{"no If-Range", "", http.StatusPartialContent, "234"},
+		{"matching ETag", etag, http.StatusPartialContent, "234"},
+		{"stale ETag", `"0123"`, http.StatusOK, "0123456789"},
+		{"matching date", modified, http.StatusPartialContent, "234"},
+		{"older date", "Mon, 02 Jan 2006 15:04:05 GMT", http.StatusOK, "0123456789"},
+	}
+	for _, tt := range tests {
+		header := []string{"Range", "bytes=2-4"}
+		if tt.ifRange != "" {
+			header = append(header, "If-Range", tt.ifRange)
+		}
+		resp, body := do(t, ts, http.MethodGet, "/download/obj", "", header...)
+		if resp.StatusCode != tt.status || body != tt.body {
+			t.Errorf("%s: %d %q, want %d %q", tt.name, resp.StatusCode, body, tt.status, tt.body)
+		}
+	}
+}
+
+func TestDownloadMultiRange(t *testing.T) {
+	ts, _ := newTestServer(t)
+	upload(t, ts, "obj.txt", "0123456789abcdefghij")
+
+	type part struct{ contentRange, body string }
+	tests := []struct {
+		name   string
+		ranges string
+		status int
+		parts  []part // Для одного диапазона — сам ответ
+	}{
+		{"single", "bytes=2-4", http.StatusPartialContent, []part{{"bytes 2-4/20", "234"}}},
+		{"two", "bytes=0-1,10-12", http.StatusPartialContent, []part{{"bytes 0-1/20", "01"}, {"bytes 10-12/20", "abc"}}},
+		{"suffix", "bytes=0-0,-2", http.StatusPartialContent, []part{{"bytes 0-0/20", "0"}, {"bytes 18-19/20", "ij"}}},
+		{"unsatisfiable", "bytes=30-40,50-60", http.StatusRequestedRangeNotSatisfiable, nil},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, ts, http.MethodGet, "/download/obj.txt", "", "Range", tt.ranges)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: %d, want %d", tt.name, resp.StatusCode, tt.status)
+			continue
+		}
+		if tt.parts == nil {
+			continue
+		}
+		if len(tt.parts) == 1 {
+			if got := (part{resp.Header.Get("Content-Range"), body}); got != tt.parts[0] {
+				t.Errorf("%s: %+v, want %+v", tt.name, got, tt.parts[0])
+			}
+			continue
+		}
+		mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		if err != nil || mediaType != "multipart/byteranges" {
+			t.Fatalf("%s: Content-Type %q, %v", tt.name, resp.Header.Get("Content-Type"), err)
+		}
+		reader := multipart.NewReader(strings.NewReader(body), params["boundary"])
+		for i, want := range tt.parts {
+			p, err := reader.NextPart()
+			if err != nil {
+				t.Fatalf("%s: part %d: %v", tt.name, i, err)
+			}
+			data, _ := io.ReadAll(p)
+			if got := (part{p.Header.Get("Content-Range"), string(data)}); got != want {
+				t.Errorf("%s: part %d = %+v, want %+v", tt.name, i, got, want)
+			}
+			// Каждая часть — с типом самого объекта
+			if ctype := p.Header.Get("Content-Type"); !strings.HasPrefix(ctype, "text/plain") {
+				t.Errorf("%s: part %d Content-Type %q", tt.name, i, ctype)
+			}
+		}
+		if _, err := reader.NextPart(); err != io.EOF {
+			t.Errorf("%s: extra parts after %d: %v", tt.name, len(tt.parts), err)
+		}
+	}
+}
+
+// listNames — имена объектов из ответа GET /list с параметрами query
+func listNames(t *testing.T, ts *httptest.Server, query string) []string {
+	t.Helper()
+	resp, body := do(t, ts, http.MethodGet, "/list"+query, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /list%s: %d %s", query, resp.StatusCode, body)
+	}
+	var entries []List
+	if err := json.Unmarshal([]byte(body), &entries); err != nil {
+		t.Fatalf("GET /list%s: %v", query, err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	return names
+}
+
+func TestUploadStatusAndLocation(t *testing.T) {
+	ts, _ := newTestServer(t)
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		header   []string
+		status   int
+		location string
+	}{
+		{"create", http.MethodPost, "/upload/obj", nil, http.StatusCreated, "/download/obj"},
+		{"create nested", http.MethodPut, "/upload/dir/a%20b", nil, http.StatusCreated, "/download/dir/a%20b"},
+		{"create existing", http.MethodPost, "/upload/obj", nil, http.StatusConflict, ""},
+		{"overwrite", http.MethodPut, "/upload/obj", []string{"If-Match", "*"}, http.StatusOK, ""},
+		{"overwrite stale ETag", http.MethodPut, "/upload/obj", []string{"If-Match", `"0123"`}, http.StatusPreconditionFailed, ""},
+		{"overwrite missing", http.MethodPut, "/upload/missing", []string{"If-Match", "*"}, http.StatusPreconditionFailed, ""},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, ts, tt.method, tt.path, "data", tt.header...)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: %d %s, want %d", tt.name, resp.StatusCode, body, tt.status)
+		}
+		if got := resp.Header.Get("Location"); got != tt.location {
+			t.Errorf("%s: Location %q, want %q", tt.name, got, tt.location)
+		}
+	}
+}
+
+func TestGeneratedKeyUpload(t *testing.T) {
+	ts, _ := newTestServer(t)
+	tests := []struct {
+		name   string
+		method string
+		header []string
+		status int
+	}{
+		{"post", http.MethodPost, nil, http.StatusCreated},
+		{"post again", http.MethodPost, nil, http.StatusCreated},
+		// Назначенный ключ всегда новый: перезаписывать и сверять нечего
+		{"If-Match", http.MethodPost, []string{"If-Match", "*"}, http.StatusBadRequest},
+		{"X-If-Newer", http.MethodPost, []string{IF_NEWER_HEADER, time.Now().UTC().Format(http.TimeFormat)}, http.StatusBadRequest},
+		{"put", http.MethodPut, nil, http.StatusMethodNotAllowed},
+	}
+	generatedURL := regexp.MustCompile(`^/download/[0-9a-f]{32}$`)
+	seen := make(map[string]bool)
+	for _, tt := range tests {
+		resp, body := do(t, ts, tt.method, "/upload", tt.name, tt.header...)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: %d %s, want %d", tt.name, resp.StatusCode, body, tt.status)
+			continue
+		}
+		if tt.status != http.StatusCreated {
+			continue
+		}
+		// Ключ, назначенный сервером, клиент узнаёт из Location и тела ответа
+		location := resp.Header.Get("Location")
+		key := strings.TrimPrefix(location, "/download/")
+		if !generatedURL.MatchString(location) || !strings.Contains(body, key) || seen[key] {
+			t.Errorf("%s: Location %q, body %q", tt.name, location, body)
+			continue
+		}
+		seen[key] = true
+		if resp, body := do(t, ts, http.MethodGet, location, ""); resp.StatusCode != http.StatusOK || body != tt.name {
+			t.Errorf("%s: GET %s: %d %q", tt.name, location, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestUploadConflictETag(t *testing.T) {
+	ts, _ := newTestServer(t, "-api-key", "secret", "-users", "alice:a-key,bob:b-key")
+	alice, bob, admin := "Bearer a-key", "Bearer b-key", "Bearer secret"
+	upload(t, ts, "obj", "v1", "Authorization", alice)
+	resp, _ := do(t, ts, http.MethodHead, "/download/obj", "", "Authorization", alice)
+	etag := resp.Header.Get("ETag")
+	tus := []string{"Tus-Resumable", TUS_VERSION, "Upload-Length", "2", "Upload-Metadata", "key " + base64.StdEncoding.EncodeToString([]byte("obj"))}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header []string
+		etag   string
+	}{
+		{"owner", http.MethodPost, "/upload/obj", []string{"Authorization", alice}, etag},
+		{"admin", http.MethodPost, "/upload/obj", []string{"Authorization", admin}, etag},
+		// ETag чужого объекта не раскрывается
+		{"other user", http.MethodPost, "/upload/obj", []string{"Authorization", bob}, ""},
+		{"tus owner", http.MethodPost, "/files/", append([]string{"Authorization", alice}, tus...), etag},
+		{"tus other user", http.MethodPost, "/files/", append([]string{"Authorization", bob}, tus...), ""},
+		// Конфликт с путём другого объекта — не существующий объект, ETag у него нет
+		{"prefix is object", http.MethodPost, "/upload/obj/nested", []string{"Authorization", alice}, ""},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, ts, tt.method, tt.path, "v2", tt.header...)
+		if resp.StatusCode != http.StatusConflict {
+			t.Errorf("%s: %d %s, want 409", tt.name, resp.StatusCode, body)
+		}
+		if got := resp.Header.Get("ETag"); got != tt.etag {
+			t.Errorf("%s: ETag %q, want %q", tt.name, got, tt.etag)
+		}
+	}
+
+	// С ETag из ответа 409 клиент перезаписывает ту версию, которую видел
+	resp, _ = do(t, ts, http.MethodPost, "/upload/obj", "v2", "Authorization", alice)
+	if resp, body := do(t, ts, http.MethodPut, "/upload/obj", "v2", "Authorization", alice, "If-Match", resp.Header.Get("ETag")); resp.StatusCode != http.StatusOK {
+		t.Errorf("overwrite with the ETag from 409: %d %s", resp.StatusCode, body)
+	}
+}
+
+func TestDeleteIfMatch(t *testing.T) {
+	ts, _ := newTestServer(t)
+	upload(t, ts, "obj", "v1")
+	resp, _ := do(t, ts, http.MethodGet, "/download/obj", "")
+	etag := resp.Header.Get("ETag")
+
+	tests := []struct {
+		name    string
+		ifMatch string
+		status  int
+		exists  bool
+	}{
+		{"stale ETag", `"0123"`, http.StatusPreconditionFailed, true},
+		{"one of stale ETags", `"0123", "4567"`, http.StatusPreconditionFailed, true},
+		{"matching ETag", etag, http.StatusOK, false},
+		// Условие к отсутствующему объекту не выполняется, как и требует RFC 9110
+		{"already deleted", etag, http.StatusPreconditionFailed, false},
+	}
+	for _, tt := range tests {
+		if resp, body := do(t, ts, http.MethodDelete, "/delete/obj", "", "If-Match", tt.ifMatch); resp.StatusCode != tt.status {
+			t.Errorf("%s: %d %s, want %d", tt.name, resp.StatusCode, body, tt.status)
+		}
+		// При несовпадении объект остаётся нетронутым
+		resp, body := do(t, ts, http.MethodGet, "/download/obj", "")
+		if exists := resp.StatusCode == http.StatusOK; exists != tt.exists || exists && body != "v1" {
+			t.Errorf("%s: object after delete: %d %q", tt.name, resp.StatusCode, body)
+		}
+	}
+
+	upload(t, ts, "any", "v1")
+	if resp, _ := do(t, ts, http.MethodDelete, "/delete/any", "", "If-Match", "*"); resp.StatusCode != http.StatusOK {
+		t.Errorf("If-Match *: %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestDownloadContentLength(t *testing.T) {
+	// Объекты больше -cache-threshold отдаются с диска, остальные — из кэша
+	ts, _ := newTestServer(t, "-cache-size", "1024", "-cache-threshold", "8")
+	upload(t, ts, "cached", "0123")
+	upload(t, ts, "disk", "0123456789abcdef")
+
+	tests := []struct {
+		method string
+		path   string
+		header []string
+		status int
+		length string
+	}{
+		{http.MethodGet, "/download/cached", nil, http.StatusOK, "4"},
+		{http.MethodHead, "/download/cached", nil, http.StatusOK, "4"},
+		{http.MethodGet, "/download/disk", nil, http.StatusOK, "16"},
+		{http.MethodHead, "/download/disk", nil, http.StatusOK, "16"},
+		{http.MethodHead, "/download/disk", []string{"Range", "bytes=0-9"}, http.StatusPartialContent, "10"},
+		{http.MethodHead, "/download/missing", nil, http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, ts, tt.method, tt.path, "", tt.header...)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s %s: %d, want %d", tt.method, tt.path, resp.StatusCode, tt.status)
+			continue
+		}
+		if tt.length == "" {
+			continue
+		}
+		if got := resp.Header.Get("Content-Length"); got != tt.length {
+			t.Errorf("%s %s: Content-Length %q, want %s", tt.method, tt.path, got, tt.length)
+		}
+		// HEAD отвечает теми же заголовками, но без тела
+		if tt.method == http.MethodHead && body != "" {
+			t.Errorf("HEAD %s returned a body %q", tt.path, body)
+		}
+	}
+}
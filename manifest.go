@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+)
+
+// MANIFEST_ALGO — АЛГОРИТМ КОНТРОЛЬНЫХ СУММ ОБЪЕКТОВ В МАНИФЕСТЕ
+const MANIFEST_ALGO = "sha256"
+
+// ManifestEntry — объект в манифесте
+type ManifestEntry struct {
+	Key    string
+	Size   int64
+	SHA256 string
+}
+
+// Manifest — список объектов под префиксом с размерами и контрольными суммами,
+// подписанный HMAC-SHA256 API-ключом сервера. По нему клиент проверяет, что скачал
+// набор объектов целиком и без изменений, а сервер — что набор не изменился с тех пор.
+type Manifest struct {
+	Prefix    string
+	Created   time.Time
+	Objects   []ManifestEntry
+	Signature string
+}
+
+// manifestSignature — HMAC-подпись префикса, времени создания и всех объектов манифеста
+func manifestSignature(secret string, m Manifest) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n", m.Prefix, m.Created.UTC().Format(time.RFC3339Nano))
+	for _, e := range m.Objects {
+		fmt.Fprintf(mac, "%s\n%d\n%s\n", e.Key, e.Size, e.SHA256)
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// manifestEntries — доступные клиенту объекты под префиксом (уже с поддиректорией хоста)
+// с размерами и контрольными суммами, по порядку ключей. Ключи — такие, какими их видит клиент.
+func (s *Storage) manifestEntries(r *http.Request, prefix string) ([]ManifestEntry, error) {
+	entries := make([]ManifestEntry, 0)
+	err := s.walkPrefixKeys(prefix, func(key string) error {
+		if m, err := s.LoadMeta(key); err != nil || !m.canRead(Identity(r)) {
+			return nil
+		}
+		info, err := s.backend.Stat(key)
+		if err != nil {
+			// Объект могли удалить во время обхода
+			return nil
+		}
+		sum, err := s.Checksum(key, MANIFEST_ALGO)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		entries = append(entries, ManifestEntry{clientKey(r, key), info.Size(), sum})
+		return nil
+	})
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries, err
+}
+
+// verifyManifest — сравнивает манифест с объектами в хранилище: каких объектов
+// из манифеста нет, какие изменились и какие появились под префиксом сверх него
+func verifyManifest(m Manifest, current []ManifestEntry) (missing, changed, extra []string) {
+	missing, changed, extra = make([]string, 0), make([]string, 0), make([]string, 0)
+	now := make(map[string]ManifestEntry, len(current))
+	for _, e := range current {
+		now[e.Key] = e
+	}
+	for _, e := range m.Objects {
+		c, ok := now[e.Key]
+		switch {
+		case !ok:
+			missing = append(missing, e.Key)
+		case c != e:
+			changed = append(changed, e.Key)
+		}
+		delete(now, e.Key)
+	}
+	for _, e := range current {
+		if _, ok := now[e.Key]; ok {
+			extra = append(extra, e.Key)
+		}
+	}
+	return missing, changed, extra
+}
+
+// HandleManifest — обработчик манифестов целостности: GET /manifest?prefix= выдаёт
+// подписанный манифест объектов под префиксом, POST /manifest с манифестом в теле
+// проверяет его подпись и сверяет с текущим содержимым хранилища.
+// Подпись ставится API-ключом, поэтому без -api-key манифесты недоступны.
+func HandleManifest(w http.ResponseWriter, r *http.Request, storage *Storage, auth *Auth) {
+	if !auth.Enabled() {
+		http.Error(w, "Манифест подписывается API-ключом, запустите сервер с -api-key", http.StatusNotImplemented)
+		return
+	}
+
+	var m Manifest
+	if r.Method == http.MethodPost {
+		if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+			http.Error(w, "Ожидается JSON-манифест с полями Prefix, Created, Objects и Signature", http.StatusBadRequest)
+			return
+		}
+	} else {
+		m.Prefix = storage.NormalizeKey(r.URL.Query().Get("prefix"))
+		m.Created = time.Now().UTC()
+	}
+	if !checkPrefix(w, m.Prefix) {
+		return
+	}
+
+	current, err := storage.manifestEntries(r, tenantPath(r, m.Prefix))
+	if err != nil {
+		log.Printf("Ошибка составления манифеста %s: %v", logKey(m.Prefix), logErr(err))
+		http.Error(w, "Ошибка чтения хранилища", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodGet {
+		m.Objects = current
+		m.Signature = manifestSignature(auth.apiKey, m)
+		json.NewEncoder(w).Encode(m)
+		return
+	}
+
+	// Неподписанный сервером манифест сверяется так же, но считается недействительным
+	signed := hmac.Equal([]byte(m.Signature), []byte(manifestSignature(auth.apiKey, m)))
+	missing, changed, extra := verifyManifest(m, current)
+	json.NewEncoder(w).Encode(struct {
+		Valid          bool
+		SignatureValid bool
+		Missing        []string
+		Changed        []string
+		Extra          []string
+	}{signed && len(missing)+len(changed)+len(extra) == 0, signed, missing, changed, extra})
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// manifestCheck — ответ POST /manifest
+type manifestCheck struct {
+	Valid, SignatureValid   bool
+	Missing, Changed, Extra []string
+}
+
+func TestManifest(t *testing.T) {
+	ts, _ := newTestServer(t, "-api-key", "secret")
+	admin := []string{"Authorization", "Bearer secret"}
+	upload(t, ts, "set/a", "aaa", admin...)
+	upload(t, ts, "set/b", "bb", admin...)
+	upload(t, ts, "other", "x", admin...)
+
+	resp, body := do(t, ts, http.MethodGet, "/manifest?prefix=set/", "", admin...)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /manifest: %d %s", resp.StatusCode, body)
+	}
+	var m Manifest
+	if err := json.Unmarshal([]byte(body), &m); err != nil {
+		t.Fatal(err)
+	}
+	want := []ManifestEntry{
+		{"set/a", 3, "9834876dcfb05cb167a5c24953eba58c4ac89b1adf57f28f2f9d09af107ee8f0"},
+		{"set/b", 2, "3b64db95cb55c763391c707108489ae18b4112d783300de38e033b4c98c3deaf"},
+	}
+	if m.Prefix != "set/" || !reflect.DeepEqual(m.Objects, want) || m.Signature == "" {
+		t.Fatalf("manifest %+v, want objects %+v", m, want)
+	}
+	original, _ := json.Marshal(m)
+	tampered := m
+	tampered.Objects = []ManifestEntry{m.Objects[0]}
+	forged, _ := json.Marshal(tampered)
+
+	check := func(manifest []byte) manifestCheck {
+		t.Helper()
+		resp, body := do(t, ts, http.MethodPost, "/manifest", string(manifest), admin...)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("POST /manifest: %d %s", resp.StatusCode, body)
+		}
+		var c manifestCheck
+		if err := json.Unmarshal([]byte(body), &c); err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	none := []string{}
+	if got := check(original); !reflect.DeepEqual(got, manifestCheck{true, true, none, none, none}) {
+		t.Errorf("unchanged set: %+v", got)
+	}
+	// Подпись покрывает список объектов: убранный из манифеста объект её ломает
+	if got := check(forged); got.Valid || got.SignatureValid {
+		t.Errorf("forged manifest: %+v", got)
+	}
+
+	if resp, _ := do(t, ts, http.MethodPut, "/upload/set/a", "changed", append(admin, "If-Match", "*")...); resp.StatusCode != http.StatusOK {
+		t.Fatalf("overwrite: %d", resp.StatusCode)
+	}
+	do(t, ts, http.MethodDelete, "/delete/set/b", "", admin...)
+	upload(t, ts, "set/c", "c", admin...)
+	if got := check(original); !reflect.DeepEqual(got, manifestCheck{false, true, []string{"set/b"}, []string{"set/a"}, []string{"set/c"}}) {
+		t.Errorf("changed set: %+v", got)
+	}
+
+	// Закрытые объекты в чужой манифест не попадают
+	_, body = do(t, ts, http.MethodGet, "/manifest?prefix=set/", "")
+	if err := json.Unmarshal([]byte(body), &m); err != nil || len(m.Objects) != 0 {
+		t.Errorf("anonymous manifest: %s", body)
+	}
+	ts, _ = newTestServer(t)
+	if resp, _ := do(t, ts, http.MethodGet, "/manifest", ""); resp.StatusCode != http.StatusNotImplemented {
+		t.Errorf("GET /manifest without -api-key: %d, want 501", resp.StatusCode)
+	}
+}
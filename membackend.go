@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryBackend — бэкенд -backend memory: содержимое объектов только в памяти процесса
+// и пропадает с перезапуском, метаданные при этом остаются в -storage-dir. Ключи
+// не конфликтуют друг с другом: a и a/b могут существовать одновременно.
+type MemoryBackend struct {
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+}
+
+// memoryObject — сохранённое содержимое; срез не изменяется, запись заменяет его новым
+type memoryObject struct {
+	data    []byte
+	modTime time.Time
+}
+
+// NewMemoryBackend — конструктор пустого бэкенда
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{objects: make(map[string]memoryObject)}
+}
+
+// get — объект по ключу или ошибка os.ErrNotExist, как у файла
+func (b *MemoryBackend) get(op, key string) (memoryObject, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	o, ok := b.objects[key]
+	if !ok {
+		return memoryObject{}, &os.PathError{Op: op, Path: key, Err: os.ErrNotExist}
+	}
+	return o, nil
+}
+
+// Stat — размер и время изменения объекта
+func (b *MemoryBackend) Stat(key string) (os.FileInfo, error) {
+	o, err := b.get("stat", key)
+	if err != nil {
+		return nil, err
+	}
+	return memoryInfo{key, o}, nil
+}
+
+// Open — снимок содержимого: перезапись и удаление объекта его не меняют
+func (b *MemoryBackend) Open(key string) (ObjectContent, error) {
+	o, err := b.get("open", key)
+	if err != nil {
+		return nil, err
+	}
+	return &memoryContent{Reader: bytes.NewReader(o.data), info: memoryInfo{key, o}}, nil
+}
+
+// Write — заменяет содержимое; durable в памяти ничего не меняет
+func (b *MemoryBackend) Write(key string, data []byte, durable bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.objects[key] = memoryObject{data: data, modTime: time.Now()}
+	return nil
+}
+
+// WriteFile — читает временный файл в память и удаляет его
+func (b *MemoryBackend) WriteFile(key, tmpPath string) error {
+	data, err := os.ReadFile(tmpPath)
+	if err != nil {
+		return err
+	}
+	if err := b.Write(key, data, false); err != nil {
+		return err
+	}
+	return os.Remove(tmpPath)
+}
+
+// WriteAt — заменяет содержимое копией с записанными по смещению данными
+func (b *MemoryBackend) WriteAt(key string, data []byte, offset int64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	o, ok := b.objects[key]
+	if !ok {
+		return &os.PathError{Op: "write", Path: key, Err: os.ErrNotExist}
+	}
+	b.objects[key] = memoryObject{data: patchBytes(o.data, offset, data), modTime: time.Now()}
+	return nil
+}
+
+// Remove — удаляет объект; открытые снимки дочитываются
+func (b *MemoryBackend) Remove(key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.objects[key]; !ok {
+		return &os.PathError{Op: "remove", Path: key, Err: os.ErrNotExist}
+	}
+	delete(b.objects, key)
+	return nil
+}
+
+// Touch — меняет время изменения объекта
+func (b *MemoryBackend) Touch(key string, t time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	o, ok := b.objects[key]
+	if !ok {
+		return &os.PathError{Op: "chtimes", Path: key, Err: os.ErrNotExist}
+	}
+	o.modTime = t
+	b.objects[key] = o
+	return nil
+}
+
+// CheckKey — в памяти любой ключ можно записать рядом с остальными
+func (b *MemoryBackend) CheckKey(key string) error {
+	return nil
+}
+
+// Walk — обходит ключи с prefix по порядку. Ключи собираются до вызовов fn, так что
+// fn может изменять объекты
+func (b *MemoryBackend) Walk(prefix string, fn func(key string) error) error {
+	b.mu.RLock()
+	keys := make([]string, 0, len(b.objects))
+	for key := range b.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	b.mu.RUnlock()
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := fn(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// memoryInfo — os.FileInfo объекта в памяти
+type memoryInfo struct {
+	key string
+	o   memoryObject
+}
+
+func (i memoryInfo) Name() string       { return path.Base(i.key) }
+func (i memoryInfo) Size() int64        { return int64(len(i.o.data)) }
+func (i memoryInfo) Mode() os.FileMode  { return 0644 }
+func (i memoryInfo) ModTime() time.Time { return i.o.modTime }
+func (i memoryInfo) IsDir() bool        { return false }
+func (i memoryInfo) Sys() interface{}   { return nil }
+
+// memoryContent — открытый снимок содержимого объекта в памяти
+type memoryContent struct {
+	*bytes.Reader
+	info memoryInfo
+}
+
+// Stat — размер и время изменения снимка
+func (c *memoryContent) Stat() (os.FileInfo, error) {
+	return c.info, nil
+}
+
+// Close — снимку закрывать нечего
+func (c *memoryContent) Close() error {
+	return nil
+}
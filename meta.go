@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const META_DIR = ".meta" // ДИРЕКТОРИЯ В ХРАНИЛИЩЕ ДЛЯ ФАЙЛОВ МЕТАДАННЫХ ОБЪЕКТОВ
+
+// Meta — метаданные объекта, хранящиеся в отдельном JSON-файле
+type Meta struct {
+	Checksums    map[string]string // Вычисленные контрольные суммы по алгоритмам
+	LockUntil    time.Time         // До этого момента объект нельзя перезаписать или удалить
+	Owner        string            // Владелец объекта (пусто — загружен без авторизации)
+	Public       bool              // Объект открыт для чтения всем
+	Written      time.Time         // Время последней записи содержимого
+	Downloads    int64             // Сколько раз объект скачивали (без ещё не сохранённых скачиваний)
+	ContentType  string            // Тип содержимого, заданный через PATCH /meta/ (пусто — по содержимому)
+	CacheControl string            // Заголовок Cache-Control при скачивании (пусто — не отправляется)
+	Tags         map[string]string // Теги объекта
+	Redirect     string            // Куда перенаправляет скачивание объекта (пусто — отдаётся содержимое)
+	RedirectCode int               // Код перенаправления: 301, 302, 307 или 308 (0 — 301)
+	Expires      time.Time         // С этого момента объект считается удалённым (пусто — бессрочный)
+}
+
+// metaPath — путь к файлу метаданных объекта (с той же раскладкой, что и объекты)
+func (s *Storage) metaPath(key string) string {
+	return storagePath(META_DIR) + "/" + s.mapper.Path(key) + ".json"
+}
+
+// LoadMeta — читает метаданные объекта; для объекта без метаданных возвращает пустые
+func (s *Storage) LoadMeta(key string) (Meta, error) {
+	var m Meta
+	data, err := os.ReadFile(s.metaPath(key))
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return m, err
+	}
+	err = json.Unmarshal(data, &m)
+	return m, err
+}
+
+// SaveMeta — записывает метаданные объекта
+func (s *Storage) SaveMeta(key string, m Meta) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	path := s.metaPath(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// UpdateMeta — атомарно читает, изменяет и записывает метаданные объекта
+func (s *Storage) UpdateMeta(key string, update func(m *Meta)) error {
+	s.metaMu.Lock()
+	defer s.metaMu.Unlock()
+
+	m, err := s.LoadMeta(key)
+	if err != nil {
+		return err
+	}
+	update(&m)
+	return s.SaveMeta(key, m)
+}
+
+// removeMeta — удаляет метаданные объекта, если они есть
+func (s *Storage) removeMeta(key string) error {
+	s.metaMu.Lock()
+	defer s.metaMu.Unlock()
+
+	path := s.metaPath(key)
+	err := os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err == nil {
+		removeEmptyParents(path, storagePath(META_DIR))
+	}
+	return err
+}
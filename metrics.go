@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+)
+
+// Metrics — счётчики работы хранилища
+type Metrics struct {
+	Uploads          atomic.Int64 // Сохранённые объекты
+	Downloads        atomic.Int64 // Отданные клиентам объекты
+	AbortedDownloads atomic.Int64 // Скачивания, прерванные отключением клиента
+	CacheHits        atomic.Int64 // Обращения, обслуженные из кэша в памяти
+	CacheMisses      atomic.Int64 // Обращения, не найденные в кэше
+	Evictions        atomic.Int64 // Объекты, вытесненные из кэша
+	EvictedBytes     atomic.Int64 // Суммарный размер вытесненных объектов
+
+	BloomRejections atomic.Int64 // Запросы отсутствующих объектов, отклонённые фильтром Блума без обращения к диску
+	NegativeHits    atomic.Int64 // Запросы недавно не найденных объектов, отклонённые кэшем промахов
+	DiskReads       atomic.Int64 // Чтения объектов с диска
+	CacheMismatches atomic.Int64 // Объекты в кэше, разошедшиеся с файлом на диске
+
+	CacheWatermarkAlerts atomic.Int64 // Сколько раз заполнение кэша достигало -cache-watermark
+}
+
+// HitRatio — доля обращений, обслуженных из кэша, за всё время работы
+func (m *Metrics) HitRatio() float64 {
+	hits, misses := m.CacheHits.Load(), m.CacheMisses.Load()
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
+
+// HandleMetrics — обработчик для выдачи метрик в текстовом формате Prometheus
+func HandleMetrics(w http.ResponseWriter, r *http.Request, storage *Storage) {
+	m := &storage.metrics
+	storage.mu.RLock()
+	cacheObjects, cacheBytes := storage.cache.Len(), storage.cache.Size()
+	storage.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writeMetric(w, "storage_uploads_total", "counter", "Сохранённые объекты", m.Uploads.Load())
+	writeMetric(w, "storage_downloads_total", "counter", "Отданные клиентам объекты", m.Downloads.Load())
+	writeMetric(w, "storage_downloads_aborted_total", "counter", "Скачивания, прерванные отключением клиента", m.AbortedDownloads.Load())
+	writeMetric(w, "storage_cache_hits_total", "counter", "Обращения, обслуженные из кэша", m.CacheHits.Load())
+	writeMetric(w, "storage_cache_misses_total", "counter", "Обращения, не найденные в кэше", m.CacheMisses.Load())
+	writeMetric(w, "storage_cache_hit_ratio", "gauge", "Доля обращений, обслуженных из кэша", m.HitRatio())
+	writeMetric(w, "storage_cache_evictions_total", "counter", "Объекты, вытесненные из кэша", m.Evictions.Load())
+	writeMetric(w, "storage_cache_evicted_bytes_total", "counter", "Байты, вытесненные из кэша", m.EvictedBytes.Load())
+	writeMetric(w, "storage_bloom_rejections_total", "counter", "Запросы отсутствующих объектов, отклонённые без обращения к диску", m.BloomRejections.Load())
+	writeMetric(w, "storage_negative_cache_hits_total", "counter", "Запросы недавно не найденных объектов, отклонённые без обращения к диску", m.NegativeHits.Load())
+	writeMetric(w, "storage_disk_reads_total", "counter", "Чтения объектов с диска", m.DiskReads.Load())
+	writeMetric(w, "storage_cache_mismatches_total", "counter", "Объекты в кэше, разошедшиеся с файлом на диске", m.CacheMismatches.Load())
+	writeMetric(w, "storage_cache_objects", "gauge", "Объекты в кэше", cacheObjects)
+	writeMetric(w, "storage_cache_bytes", "gauge", "Байты в кэше", cacheBytes)
+	writeMetric(w, "storage_cache_capacity_bytes", "gauge", "Ёмкость кэша в байтах (0 — без ограничений)", storage.cache.Capacity())
+	writeMetric(w, "storage_cache_watermark_alerts_total", "counter", "Сколько раз заполнение кэша достигало порога предупреждения", m.CacheWatermarkAlerts.Load())
+	writeMetric(w, "storage_write_back_pending", "gauge", "Объекты, ожидающие отложенной записи на диск", storage.pendingWrites())
+}
+
+// writeMetric — записывает одну метрику с описанием и типом
+func writeMetric(w http.ResponseWriter, name, kind, help string, value interface{}) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, kind, name, value)
+}
+
+// diskUsage — число объектов на диске и их суммарный размер
+func (s *Storage) diskUsage() (objects, bytes int64, err error) {
+	err = s.walkDiskKeys(func(key string) error {
+		info, err := s.backend.Stat(key)
+		if err != nil {
+			// Объект могли удалить во время обхода
+			return nil
+		}
+		objects++
+		bytes += info.Size()
+		return nil
+	})
+	return objects, bytes, err
+}
+
+// HandleStats — обработчик для выдачи снимка метрик в JSON, для тех, у кого нет Prometheus
+func HandleStats(w http.ResponseWriter, r *http.Request, storage *Storage) {
+	objects, diskBytes, err := storage.diskUsage()
+	if err != nil {
+		log.Printf("Ошибка подсчёта объектов на диске: %v", logErr(err))
+		http.Error(w, "Ошибка чтения хранилища", http.StatusInternalServerError)
+		return
+	}
+
+	m := &storage.metrics
+	storage.mu.RLock()
+	cacheObjects, cacheBytes := storage.cache.Len(), storage.cache.Size()
+	storage.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Uploads          int64
+		Downloads        int64
+		AbortedDownloads int64
+		CacheHits        int64
+		CacheMisses      int64
+		HitRatio         float64
+		Evictions        int64
+		BloomRejections  int64
+		NegativeHits     int64
+		DiskReads        int64
+		CacheObjects     int
+		CacheBytes       int64
+		PendingWrites    int
+		Objects          int64
+		DiskBytes        int64
+	}{
+		m.Uploads.Load(), m.Downloads.Load(), m.AbortedDownloads.Load(), m.CacheHits.Load(), m.CacheMisses.Load(), m.HitRatio(),
+		m.Evictions.Load(), m.BloomRejections.Load(), m.NegativeHits.Load(), m.DiskReads.Load(),
+		cacheObjects, cacheBytes, storage.pendingWrites(), objects, diskBytes,
+	})
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// metrics — значения метрик GET /metrics по их именам
+func metrics(t *testing.T, ts *httptest.Server) map[string]string {
+	t.Helper()
+	resp, body := do(t, ts, http.MethodGet, "/metrics", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /metrics: %d", resp.StatusCode)
+	}
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		if line := scanner.Text(); !strings.HasPrefix(line, "#") {
+			if name, value, ok := strings.Cut(line, " "); ok {
+				values[name] = value
+			}
+		}
+	}
+	return values
+}
+
+func TestEvictionMetrics(t *testing.T) {
+	ts, _ := newTestServer(t, "-cache-size", "10")
+	upload(t, ts, "a", "aaaaaa")
+	upload(t, ts, "b", "bbbbbb")
+	do(t, ts, http.MethodGet, "/download/b", "")
+	do(t, ts, http.MethodGet, "/download/a", "")
+
+	got := metrics(t, ts)
+	for _, tt := range []struct{ name, want string }{
+		{"storage_cache_evictions_total", "2"},
+		{"storage_cache_evicted_bytes_total", "12"},
+		{"storage_cache_hits_total", "1"},
+		{"storage_cache_misses_total", "1"},
+		{"storage_cache_hit_ratio", "0.5"},
+		{"storage_cache_objects", "1"},
+		{"storage_cache_bytes", "6"},
+		{"storage_cache_capacity_bytes", "10"},
+	} {
+		if got[tt.name] != tt.want {
+			t.Errorf("%s = %q, want %q", tt.name, got[tt.name], tt.want)
+		}
+	}
+}
+
+func TestHitRatio(t *testing.T) {
+	tests := []struct {
+		hits, misses int64
+		want         float64
+	}{
+		{0, 0, 0},
+		{3, 0, 1},
+		{0, 3, 0},
+		{3, 1, 0.75},
+	}
+	for _, tt := range tests {
+		var m Metrics
+		m.CacheHits.Store(tt.hits)
+		m.CacheMisses.Store(tt.misses)
+		if got := m.HitRatio(); got != tt.want {
+			t.Errorf("HitRatio(%d hits, %d misses) = %v, want %v", tt.hits, tt.misses, got, tt.want)
+		}
+	}
+}
+
+func TestHandleStats(t *testing.T) {
+	ts, _ := newTestServer(t)
+	upload(t, ts, "a", "12345")
+	upload(t, ts, "b", "123")
+	do(t, ts, http.MethodGet, "/download/a", "")
+	do(t, ts, http.MethodGet, "/download/a", "")
+	do(t, ts, http.MethodGet, "/download/missing", "")
+
+	resp, body := do(t, ts, http.MethodGet, "/stats", "")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("GET /stats: %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	var stats map[string]float64
+	if err := json.Unmarshal([]byte(body), &stats); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		field string
+		want  float64
+	}{
+		{"Uploads", 2},
+		{"Downloads", 2},
+		{"CacheHits", 2},
+		{"CacheObjects", 2},
+		{"CacheBytes", 8},
+		{"Objects", 2},
+		{"DiskBytes", 8},
+		{"PendingWrites", 0},
+	} {
+		if got, ok := stats[tt.field]; !ok || got != tt.want {
+			t.Errorf("%s = %v (present %v), want %v", tt.field, got, ok, tt.want)
+		}
+	}
+	if ratio := stats["HitRatio"]; ratio <= 0 || ratio > 1 {
+		t.Errorf("HitRatio = %v, want within (0, 1]", ratio)
+	}
+}
+
+func TestAbortedDownloads(t *testing.T) {
+	ts, _ := newTestServer(t)
+	logs := captureLog(t)
+	// Объект больше буферов сокета: ответ не уместится в них целиком
+	upload(t, ts, "large", strings.Repeat("x", 16<<20))
+	upload(t, ts, "small", "data")
+	do(t, ts, http.MethodGet, "/download/small", "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/download/large", nil)
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Read(make([]byte, 1024))
+	cancel()
+	resp.Body.Close()
+
+	// Счётчик растёт, когда обработчик заметит отключение
+	deadline := time.Now().Add(5 * time.Second)
+	for metrics(t, ts)["storage_downloads_aborted_total"] != "1" {
+		if time.Now().After(deadline) {
+			t.Fatalf("aborted downloads = %s, want 1", metrics(t, ts)["storage_downloads_aborted_total"])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := metrics(t, ts)["storage_downloads_total"]; got != "2" {
+		t.Errorf("downloads = %s, want 2", got)
+	}
+	if !strings.Contains(logs.String(), "Скачивание large прервано клиентом") {
+		t.Errorf("abort is not logged:\n%s", logs.String())
+	}
+}
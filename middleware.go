@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// ctxKey — тип ключей для значений, хранящихся в контексте запроса
+type ctxKey int
+
+const (
+	requestIDKey ctxKey = iota // Идентификатор запроса
+	identityKey                // Имя авторизованного клиента
+	tenantKey                  // Поддиректория хранилища виртуального хоста
+	memoryKey                  // Часть бюджета памяти, занятая телом запроса
+	rateKey                    // Ограничение скорости скачивания в байтах в секунду
+)
+
+// RequestID — возвращает идентификатор запроса, присвоенный WithRequestID
+func RequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey).(string)
+	return id
+}
+
+// randomID — генерирует случайный идентификатор (запроса, загрузки и т. п.)
+func randomID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// WithRequestID — присваивает запросу идентификатор (или берёт переданный клиентом
+// в X-Request-ID) и возвращает его в ответе
+func WithRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if id == "" {
+			id = randomID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey, id)))
+	})
+}
+
+// WithRecovery — перехватывает панику в обработчике, логирует стек вызовов
+// и отвечает клиенту 500 вместо падения горутины
+func WithRecovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			// ErrAbortHandler — штатный способ прервать ответ, его не перехватываем
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+			log.Printf("Паника при обработке %s %s (запрос %s): %v\n%s", r.Method, logPath(r.URL.Path), RequestID(r), rec, debug.Stack())
+			http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// countingBody — тело запроса, считающее прочитанные байты
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+// countingWriter — ответ, запоминающий код, число отправленных байтов и первую ошибку записи
+type countingWriter struct {
+	http.ResponseWriter
+	status int
+	n      int64
+	err    error
+}
+
+func (w *countingWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.n += int64(n)
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	return n, err
+}
+
+// Flush — потоковые ответы (список, архив) должны уходить клиенту по частям и через обёртку
+func (w *countingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap — даёт http.ResponseController добраться до исходного ответа
+func (w *countingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// WithSlowLog — предупреждает в журнале о запросах дольше threshold: метод, путь,
+// объём принятых и отправленных данных и время обработки (0 — выключено)
+func WithSlowLog(threshold time.Duration, next http.Handler) http.Handler {
+	if threshold <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		body := &countingBody{ReadCloser: r.Body}
+		r.Body = body
+		cw := &countingWriter{ResponseWriter: w}
+		next.ServeHTTP(cw, r)
+
+		if elapsed := time.Since(start); elapsed > threshold {
+			log.Printf("Медленный запрос %s %s (запрос %s): код %d, принято %d байт, отправлено %d байт, %v",
+				r.Method, logPath(r.URL.Path), RequestID(r), cw.status, body.n, cw.n, elapsed.Round(time.Millisecond))
+		}
+	})
+}
+
+// WithAccessLog — пишет в журнал запросы: каждый неуспешный (код 400 и выше) и каждый
+// sample-й успешный, чтобы при большом трафике журнал не разрастался, а ошибки
+// в нём оставались все (0 — журнал запросов выключен, 1 — писать все запросы)
+func WithAccessLog(sample int, next http.Handler) http.Handler {
+	if sample <= 0 {
+		return next
+	}
+	var served atomic.Int64
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		body := &countingBody{ReadCloser: r.Body}
+		r.Body = body
+		cw := &countingWriter{ResponseWriter: w}
+		next.ServeHTTP(cw, r)
+
+		status := cw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if status < http.StatusBadRequest && served.Add(1)%int64(sample) != 0 {
+			return
+		}
+		log.Printf("Запрос %s %s (запрос %s): код %d, принято %d байт, отправлено %d байт, %v",
+			r.Method, logPath(r.URL.Path), RequestID(r), status, body.n, cw.n, time.Since(start).Round(time.Millisecond))
+	})
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureLog — перенаправляет журнал в буфер до конца теста
+func captureLog(t *testing.T) *bytes.Buffer {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(discardLog) })
+	return &logs
+}
+
+func TestWithRecovery(t *testing.T) {
+	logs := captureLog(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) { panic("boom") })
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) })
+	ts := httptest.NewServer(WithRequestID(WithRecovery(mux)))
+	defer ts.Close()
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/panic", http.StatusInternalServerError},
+		{"/ok", http.StatusOK},
+		{"/panic", http.StatusInternalServerError},
+		{"/ok", http.StatusOK},
+	}
+	for _, tt := range tests {
+		resp, _ := do(t, ts, http.MethodGet, tt.path, "", "X-Request-ID", "req-1")
+		if resp.StatusCode != tt.status {
+			t.Errorf("GET %s: %d, want %d", tt.path, resp.StatusCode, tt.status)
+		}
+		if id := resp.Header.Get("X-Request-ID"); id != "req-1" {
+			t.Errorf("GET %s: X-Request-ID = %q, want req-1", tt.path, id)
+		}
+	}
+	// Стек паники попадает в журнал вместе с идентификатором запроса
+	if !strings.Contains(logs.String(), "req-1") || !strings.Contains(logs.String(), "boom") {
+		t.Errorf("panic log lacks request ID or value:\n%s", logs.String())
+	}
+}
+
+func TestWithRequestIDGenerates(t *testing.T) {
+	rec := httptest.NewRecorder()
+	var seen string
+	WithRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestID(r)
+	})).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if seen == "" || rec.Header().Get("X-Request-ID") != seen {
+		t.Errorf("request ID %q, response header %q", seen, rec.Header().Get("X-Request-ID"))
+	}
+}
+
+func TestListReadErrorIs500(t *testing.T) {
+	ts, _ := newTestServer(t)
+	upload(t, ts, "a", "1")
+	// Пропавшая директория хранилища — ошибка чтения, а не паника
+	if err := os.RemoveAll(storageDir); err != nil {
+		t.Fatal(err)
+	}
+	resp, _ := do(t, ts, http.MethodGet, "/list", "")
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("GET /list without storage dir: %d, want 500", resp.StatusCode)
+	}
+	if resp, _ := do(t, ts, http.MethodGet, "/metrics", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("server is down after a list error: %d", resp.StatusCode)
+	}
+}
+
+func TestWithSlowLog(t *testing.T) {
+	handler := func(delay time.Duration) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.ReadAll(r.Body)
+			time.Sleep(delay)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte("abc"))
+		})
+	}
+	tests := []struct {
+		name      string
+		threshold time.Duration
+		delay     time.Duration
+		logged    bool
+	}{
+		{"slow", 10 * time.Millisecond, 30 * time.Millisecond, true},
+		{"fast", time.Second, 0, false},
+		{"disabled", 0, 30 * time.Millisecond, false},
+	}
+	for _, tt := range tests {
+		logs := captureLog(t)
+		rec := httptest.NewRecorder()
+		WithSlowLog(tt.threshold, handler(tt.delay)).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/upload/k", strings.NewReader("hello")))
+		if rec.Code != http.StatusCreated || rec.Body.String() != "abc" {
+			t.Errorf("%s: response %d %q changed by the middleware", tt.name, rec.Code, rec.Body.String())
+		}
+		if got := logs.Len() > 0; got != tt.logged {
+			t.Errorf("%s: logged %v, want %v:\n%s", tt.name, got, tt.logged, logs.String())
+		}
+		if tt.logged {
+			for _, part := range []string{"POST /upload/k", "код 201", "принято 5 байт", "отправлено 3 байт"} {
+				if !strings.Contains(logs.String(), part) {
+					t.Errorf("%s: log lacks %q:\n%s", tt.name, part, logs.String())
+				}
+			}
+		}
+	}
+}
+
+func TestWithAccessLog(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		if r.URL.Path == "/fail" {
+			http.Error(w, "нет", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("abc"))
+	})
+	// Шесть успешных запросов и две ошибки вперемешку
+	paths := []string{"/ok", "/ok", "/fail", "/ok", "/ok", "/ok", "/fail", "/ok"}
+	tests := []struct {
+		sample int
+		ok     int // Сколько успешных запросов попадёт в журнал
+	}{
+		{0, 0},
+		{1, 6},
+		{3, 2},
+		{10, 0},
+	}
+	for _, tt := range tests {
+		logs := captureLog(t)
+		h := WithAccessLog(tt.sample, handler)
+		for _, path := range paths {
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, path, strings.NewReader("hello")))
+		}
+		ok, failed := strings.Count(logs.String(), "POST /ok"), strings.Count(logs.String(), "POST /fail")
+		// Ошибки пишутся всегда, если журнал запросов включён
+		wantFailed := 2
+		if tt.sample == 0 {
+			wantFailed = 0
+		}
+		if ok != tt.ok || failed != wantFailed {
+			t.Errorf("sample %d: logged %d ok and %d failed, want %d and %d:\n%s", tt.sample, ok, failed, tt.ok, wantFailed, logs.String())
+		}
+		if tt.sample == 1 {
+			for _, part := range []string{"POST /ok", "код 200", "принято 5 байт", "отправлено 3 байт", "POST /fail (запрос ", "код 404"} {
+				if !strings.Contains(logs.String(), part) {
+					t.Errorf("sample 1: log lacks %q:\n%s", part, logs.String())
+				}
+			}
+		}
+	}
+	if _, err := ParseConfig([]string{"-access-log-sample", "-1"}); err == nil {
+		t.Error("ParseConfig accepted a negative -access-log-sample")
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// NEGATIVE_CACHE_SIZE — СКОЛЬКО ОТСУТСТВУЮЩИХ КЛЮЧЕЙ ПОМНИТ КЭШ ПРОМАХОВ
+const NEGATIVE_CACHE_SIZE = 10000
+
+// NegativeCache — недавно не найденные на диске ключи. Повторный запрос такого
+// ключа в течение ttl отклоняется без обращения к диску. В отличие от фильтра Блума,
+// кэш знает точные ключи и забывает их сам, поэтому замечает и объекты,
+// появившиеся в обход сервера, — но не раньше, чем через ttl.
+type NegativeCache struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	limit int                  // Максимум ключей, чтобы кэш не рос без предела
+	keys  map[string]time.Time // Когда отсутствие ключа перестаёт считаться верным
+}
+
+// NewNegativeCache — кэш промахов на limit ключей, каждый помнится ttl
+func NewNegativeCache(ttl time.Duration, limit int) *NegativeCache {
+	return &NegativeCache{ttl: ttl, limit: limit, keys: make(map[string]time.Time)}
+}
+
+// Add — запоминает, что ключа нет на диске
+func (c *NegativeCache) Add(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if len(c.keys) >= c.limit {
+		// Сначала выбрасываем устаревшие ключи, при нехватке места — любой
+		for k, expires := range c.keys {
+			if now.After(expires) {
+				delete(c.keys, k)
+			}
+		}
+		for k := range c.keys {
+			if len(c.keys) < c.limit {
+				break
+			}
+			delete(c.keys, k)
+		}
+	}
+	c.keys[key] = now.Add(c.ttl)
+}
+
+// Contains — известно ли, что ключа нет на диске
+func (c *NegativeCache) Contains(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires, ok := c.keys[key]
+	if ok && time.Now().After(expires) {
+		delete(c.keys, key)
+		return false
+	}
+	return ok
+}
+
+// Remove — забывает ключ, например когда объект с ним только что создан
+func (c *NegativeCache) Remove(key string) {
+	c.mu.Lock()
+	delete(c.keys, key)
+	c.mu.Unlock()
+}
+
+// Reset — забывает все ключи
+func (c *NegativeCache) Reset() {
+	c.mu.Lock()
+	c.keys = make(map[string]time.Time)
+	c.mu.Unlock()
+}
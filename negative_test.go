@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestNegativeCache(t *testing.T) {
+	c := NewNegativeCache(50*time.Millisecond, 2)
+	c.Add("a")
+	if !c.Contains("a") || c.Contains("b") {
+		t.Fatal("Contains after Add is wrong")
+	}
+	c.Remove("a")
+	if c.Contains("a") {
+		t.Error("removed key is still known")
+	}
+
+	// Сверх предела ключи не копятся
+	for _, key := range []string{"a", "b", "c"} {
+		c.Add(key)
+	}
+	if n := len(c.keys); n != 2 || !c.Contains("c") {
+		t.Errorf("%d keys after overflow, last added known %v", n, c.Contains("c"))
+	}
+	// Через ttl отсутствие ключа перестаёт считаться верным
+	time.Sleep(60 * time.Millisecond)
+	if c.Contains("c") {
+		t.Error("key is known after ttl")
+	}
+}
+
+func TestNegativeTTL(t *testing.T) {
+	// Без фильтра Блума каждый промах иначе шёл бы на диск
+	ts, storage := newTestServer(t, "-bloom-keys", "0", "-negative-ttl", "100ms")
+	steps := []struct {
+		name        string
+		key         string
+		status      int
+		reads, hits string
+	}{
+		{"first miss reads the disk", "missing", http.StatusNotFound, "1", "0"},
+		{"repeated miss skips it", "missing", http.StatusNotFound, "1", "1"},
+		{"another key", "other", http.StatusNotFound, "2", "1"},
+	}
+	for _, s := range steps {
+		if resp, _ := do(t, ts, http.MethodGet, "/download/"+s.key, ""); resp.StatusCode != s.status {
+			t.Errorf("%s: %d, want %d", s.name, resp.StatusCode, s.status)
+		}
+		m := metrics(t, ts)
+		if m["storage_disk_reads_total"] != s.reads || m["storage_negative_cache_hits_total"] != s.hits {
+			t.Errorf("%s: disk reads %s, negative hits %s; want %s, %s", s.name,
+				m["storage_disk_reads_total"], m["storage_negative_cache_hits_total"], s.reads, s.hits)
+		}
+	}
+
+	// Созданный через сервер объект виден сразу
+	upload(t, ts, "missing", "data")
+	if resp, _ := do(t, ts, http.MethodGet, "/download/missing", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("created object: %d, want 200", resp.StatusCode)
+	}
+	// Добавленный в обход сервера — только через ttl
+	if err := os.WriteFile(storage.objectPath("other"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if resp, _ := do(t, ts, http.MethodGet, "/download/other", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("object added behind the server within ttl: %d, want 404", resp.StatusCode)
+	}
+	time.Sleep(120 * time.Millisecond)
+	if resp, _ := do(t, ts, http.MethodGet, "/download/other", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("object added behind the server after ttl: %d, want 200", resp.StatusCode)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const (
+	META_PREFIX_LEN   = len("/meta/") // ДЛИНА ПРЕФИКСА ДЛЯ МАРШРУТА МЕТАДАННЫХ ОБЪЕКТА
+	MAX_TAGS          = 10            // МАКСИМУМ ТЕГОВ У ОБЪЕКТА ПО УМОЛЧАНИЮ, КАК В S3
+	MAX_TAG_KEY_LEN   = 128           // МАКСИМАЛЬНАЯ ДЛИНА ИМЕНИ ТЕГА ПО УМОЛЧАНИЮ
+	MAX_TAG_VALUE_LEN = 256           // МАКСИМАЛЬНАЯ ДЛИНА ЗНАЧЕНИЯ ТЕГА ПО УМОЛЧАНИЮ
+	MAX_META_SIZE     = 8192          // МАКСИМУМ БАЙТ ЗАДАВАЕМЫХ МЕТАДАННЫХ ОБЪЕКТА ПО УМОЛЧАНИЮ
+)
+
+// ErrMetaTooLarge — задаваемые метаданные объекта вместе больше -max-meta-size
+var ErrMetaTooLarge = errors.New("object metadata exceeds the maximum size")
+
+// MetaLimits — пределы задаваемых через /meta/ метаданных, чтобы файлы метаданных
+// и их копии в памяти не разрастались
+type MetaLimits struct {
+	Tags        int // Максимум тегов у объекта
+	TagKeyLen   int // Максимальная длина имени тега в байтах
+	TagValueLen int // Максимальная длина значения тега в байтах
+	Size        int // Максимум байт типа содержимого, Cache-Control, перенаправления и тегов вместе
+}
+
+// userMetaSize — сколько байт занимают задаваемые метаданные объекта
+func userMetaSize(m Meta) int {
+	size := len(m.ContentType) + len(m.CacheControl) + len(m.Redirect)
+	for k, v := range m.Tags {
+		size += len(k) + len(v)
+	}
+	return size
+}
+
+// redirectCodes — допустимые коды перенаправления объекта (0 — по умолчанию, 301)
+var redirectCodes = map[int]bool{
+	0:                            true,
+	http.StatusMovedPermanently:  true,
+	http.StatusFound:             true,
+	http.StatusTemporaryRedirect: true,
+	http.StatusPermanentRedirect: true,
+}
+
+// MetaUpdate — изменение метаданных объекта без перезаписи содержимого. Поле nil
+// остаётся как было, пустое значение сбрасывает его; Tags заменяются целиком.
+type MetaUpdate struct {
+	ContentType  *string            // Тип содержимого (пусто — определять по содержимому)
+	CacheControl *string            // Значение заголовка Cache-Control при скачивании
+	Tags         *map[string]string // Теги объекта
+	Redirect     *string            // Адрес перенаправления при скачивании (пусто — отдавать содержимое)
+	RedirectCode *int               // Код перенаправления (0 — 301)
+}
+
+// validate — проверяет, что значения можно отдать в заголовках ответа и что теги
+// не выходят за пределы limits
+func (u MetaUpdate) validate(limits MetaLimits) error {
+	if u.ContentType != nil && *u.ContentType != "" {
+		if _, _, err := mime.ParseMediaType(*u.ContentType); err != nil {
+			return fmt.Errorf("invalid content type %q", *u.ContentType)
+		}
+	}
+	if u.CacheControl != nil && strings.ContainsAny(*u.CacheControl, "\r\n") {
+		return fmt.Errorf("cache control must be a single line")
+	}
+	if u.Redirect != nil && *u.Redirect != "" {
+		target, err := url.Parse(*u.Redirect)
+		if err != nil || strings.ContainsAny(*u.Redirect, "\r\n") ||
+			!(target.Scheme == "http" || target.Scheme == "https") && !strings.HasPrefix(*u.Redirect, "/") {
+			return fmt.Errorf("redirect must be an http(s) url or an absolute path")
+		}
+	}
+	if u.RedirectCode != nil && !redirectCodes[*u.RedirectCode] {
+		return fmt.Errorf("redirect code must be 301, 302, 307 or 308")
+	}
+	if u.Tags != nil {
+		if len(*u.Tags) > limits.Tags {
+			return fmt.Errorf("at most %d tags are allowed", limits.Tags)
+		}
+		for k, v := range *u.Tags {
+			if k == "" || len(k) > limits.TagKeyLen || len(v) > limits.TagValueLen {
+				return fmt.Errorf("tag names must be 1-%d bytes and values up to %d bytes", limits.TagKeyLen, limits.TagValueLen)
+			}
+		}
+	}
+	return nil
+}
+
+// UpdateObjectMeta — изменяет тип содержимого, Cache-Control, теги и перенаправление объекта, не трогая
+// его содержимое (и поэтому ETag). Объект под сроком хранения не изменяется, а если
+// метаданные вместе выйдут больше -max-meta-size, возвращается ErrMetaTooLarge.
+func (s *Storage) UpdateObjectMeta(key string, u MetaUpdate) (Meta, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.exists(key) {
+		return Meta{}, os.ErrNotExist
+	}
+	if err := s.checkMutable(key); err != nil {
+		return Meta{}, err
+	}
+	var updated Meta
+	tooLarge := false
+	err := s.UpdateMeta(key, func(m *Meta) {
+		next := *m
+		if u.ContentType != nil {
+			next.ContentType = *u.ContentType
+		}
+		if u.CacheControl != nil {
+			next.CacheControl = *u.CacheControl
+		}
+		if u.Tags != nil {
+			next.Tags = *u.Tags
+		}
+		if u.Redirect != nil {
+			next.Redirect = *u.Redirect
+		}
+		if u.RedirectCode != nil {
+			next.RedirectCode = *u.RedirectCode
+		}
+		// Размер проверяется по итоговым метаданным: изменение одного поля может
+		// переполнить их вместе с остальными; тогда метаданные остаются как были
+		if userMetaSize(next) > s.metaLimits.Size {
+			tooLarge = true
+			return
+		}
+		*m = next
+		updated = next
+	})
+	if err == nil && tooLarge {
+		err = fmt.Errorf("%w: %d bytes", ErrMetaTooLarge, s.metaLimits.Size)
+	}
+	return updated, err
+}
+
+// HandleMeta — обработчик метаданных объекта: GET отдаёт тип содержимого, Cache-Control,
+// теги и перенаправление, PATCH с JSON {"ContentType", "CacheControl", "Tags", "Redirect",
+// "RedirectCode"} изменяет переданные поля без повторной загрузки содержимого.
+func HandleMeta(w http.ResponseWriter, r *http.Request, storage *Storage) {
+	key := storage.RequestKey(r, r.URL.Path[META_PREFIX_LEN:])
+	if !checkKey(w, key) {
+		return
+	}
+	if !storage.Exists(key) {
+		http.Error(w, "Объект не найден", http.StatusNotFound)
+		return
+	}
+	write := r.Method == http.MethodPatch
+	if !authorizeObject(w, r, storage, key, write) {
+		return
+	}
+
+	m, err := storage.LoadMeta(key)
+	if err != nil {
+		log.Printf("Ошибка чтения метаданных %s: %v", logKey(key), logErr(err))
+		http.Error(w, "Ошибка чтения метаданных", http.StatusInternalServerError)
+		return
+	}
+	if write {
+		var u MetaUpdate
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			http.Error(w, "Ожидается JSON с полями ContentType, CacheControl, Tags, Redirect и RedirectCode", http.StatusBadRequest)
+			return
+		}
+		if err := u.validate(storage.metaLimits); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !checkLease(w, r, storage, key) || !checkSealed(w, r, storage, key) {
+			return
+		}
+		m, err = storage.UpdateObjectMeta(key, u)
+		switch {
+		case os.IsNotExist(err):
+			http.Error(w, "Объект не найден", http.StatusNotFound)
+			return
+		case errors.Is(err, ErrLocked):
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		case errors.Is(err, ErrMetaTooLarge):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			log.Printf("Ошибка изменения метаданных %s: %v", logKey(key), logErr(err))
+			http.Error(w, "Ошибка изменения метаданных", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Key          string
+		ContentType  string
+		CacheControl string
+		Tags         map[string]string
+		Redirect     string
+		RedirectCode int
+	}{clientKey(r, key), m.ContentType, m.CacheControl, m.Tags, m.Redirect, m.RedirectCode})
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHandleMeta(t *testing.T) {
+	ts, _ := newTestServer(t)
+	upload(t, ts, "obj", "\xef\xf0\xe8\xe2\xe5\xf2")
+	resp, _ := do(t, ts, http.MethodGet, "/download/obj", "")
+	etag := resp.Header.Get("ETag")
+
+	tooManyTags := make(map[string]string)
+	for i := 0; i <= MAX_TAGS; i++ {
+		tooManyTags[strings.Repeat("t", i+1)] = "v"
+	}
+	manyTags, _ := json.Marshal(map[string]interface{}{"Tags": tooManyTags})
+
+	type meta struct {
+		ContentType, CacheControl string
+		Tags                      map[string]string
+	}
+	steps := []struct {
+		name   string
+		body   string
+		status int
+		want   meta
+	}{
+		{"content type", `{"ContentType": "text/plain; charset=windows-1251"}`, http.StatusOK,
+			meta{"text/plain; charset=windows-1251", "", nil}},
+		// Непереданные поля остаются как были
+		{"cache control and tags", `{"CacheControl": "max-age=60", "Tags": {"env": "prod"}}`, http.StatusOK,
+			meta{"text/plain; charset=windows-1251", "max-age=60", map[string]string{"env": "prod"}}},
+		{"invalid content type", `{"ContentType": "text/"}`, http.StatusBadRequest, meta{}},
+		{"multiline cache control", `{"CacheControl": "a\r\nSet-Cookie: x"}`, http.StatusBadRequest, meta{}},
+		{"too many tags", string(manyTags), http.StatusBadRequest, meta{}},
+		{"empty tag name", `{"Tags": {"": "v"}}`, http.StatusBadRequest, meta{}},
+		{"not json", `ContentType`, http.StatusBadRequest, meta{}},
+		{"reset cache control", `{"CacheControl": ""}`, http.StatusOK,
+			meta{"text/plain; charset=windows-1251", "", map[string]string{"env": "prod"}}},
+	}
+	for _, s := range steps {
+		resp, body := do(t, ts, http.MethodPatch, "/meta/obj", s.body)
+		if resp.StatusCode != s.status {
+			t.Errorf("%s: %d %s, want %d", s.name, resp.StatusCode, body, s.status)
+			continue
+		}
+		if s.status != http.StatusOK {
+			continue
+		}
+		var got meta
+		if err := json.Unmarshal([]byte(body), &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, s.want) {
+			t.Errorf("%s: metadata %+v, want %+v", s.name, got, s.want)
+		}
+	}
+
+	// Скачивание отдаёт заданные заголовки, а содержимое и ETag не меняются
+	resp, body := do(t, ts, http.MethodGet, "/download/obj", "")
+	if resp.Header.Get("Content-Type") != "text/plain; charset=windows-1251" || resp.Header.Get("ETag") != etag || body != "\xef\xf0\xe8\xe2\xe5\xf2" {
+		t.Errorf("download after PATCH /meta: %v %q", resp.Header, body)
+	}
+	// Заданная кодировка — исходная для перекодирования
+	if _, body := do(t, ts, http.MethodGet, "/download/obj?charset=utf-8", ""); body != "привет" {
+		t.Errorf("transcoded from the metadata charset: %q, want привет", body)
+	}
+	if resp, _ := do(t, ts, http.MethodPatch, "/meta/missing", `{"CacheControl": "no-cache"}`); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("PATCH /meta/missing: %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestObjectRedirect(t *testing.T) {
+	ts, _ := newTestServer(t)
+	// Перенаправление проверяется по ответу сервера, а не по странице, куда оно ведёт
+	ts.Client().CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	upload(t, ts, "bucket/link", "data")
+
+	steps := []struct {
+		name     string
+		body     string
+		status   int // Ответ на PATCH /meta/
+		path     string
+		download int
+		location string
+	}{
+		{"absolute url", `{"Redirect": "https://example.com/page"}`, http.StatusOK, "/download/bucket/link", http.StatusMovedPermanently, "https://example.com/page"},
+		{"s3 download", `{}`, http.StatusOK, "/bucket/link", http.StatusMovedPermanently, "https://example.com/page"},
+		{"temporary", `{"RedirectCode": 307}`, http.StatusOK, "/download/bucket/link", http.StatusTemporaryRedirect, "https://example.com/page"},
+		{"path", `{"Redirect": "/download/other"}`, http.StatusOK, "/download/bucket/link", http.StatusTemporaryRedirect, "/download/other"},
+		{"javascript url", `{"Redirect": "javascript:alert(1)"}`, http.StatusBadRequest, "/download/bucket/link", http.StatusTemporaryRedirect, "/download/other"},
+		{"relative path", `{"Redirect": "other"}`, http.StatusBadRequest, "/download/bucket/link", http.StatusTemporaryRedirect, "/download/other"},
+		{"header injection", `{"Redirect": "/a\r\nSet-Cookie: x"}`, http.StatusBadRequest, "/download/bucket/link", http.StatusTemporaryRedirect, "/download/other"},
+		{"unsupported code", `{"RedirectCode": 303}`, http.StatusBadRequest, "/download/bucket/link", http.StatusTemporaryRedirect, "/download/other"},
+		// Пустой Redirect снова отдаёт содержимое
+		{"reset", `{"Redirect": ""}`, http.StatusOK, "/download/bucket/link", http.StatusOK, ""},
+	}
+	for _, s := range steps {
+		if resp, body := do(t, ts, http.MethodPatch, "/meta/bucket/link", s.body); resp.StatusCode != s.status {
+			t.Errorf("%s: PATCH /meta/: %d %s, want %d", s.name, resp.StatusCode, body, s.status)
+		}
+		resp, body := do(t, ts, http.MethodGet, s.path, "")
+		if resp.StatusCode != s.download || resp.Header.Get("Location") != s.location {
+			t.Errorf("%s: GET %s: %d, Location %q; want %d %q", s.name, s.path, resp.StatusCode, resp.Header.Get("Location"), s.download, s.location)
+		}
+		if s.download == http.StatusOK && body != "data" {
+			t.Errorf("%s: GET %s: %q", s.name, s.path, body)
+		}
+	}
+	// Каждый переход по ссылке — скачивание
+	if got := statDownloads(t, ts, "bucket/link"); got != int64(len(steps)) {
+		t.Errorf("downloads = %d, want %d", got, len(steps))
+	}
+}
+
+func TestMetaLimits(t *testing.T) {
+	ts, _ := newTestServer(t, "-max-tags", "2", "-max-tag-key-len", "3", "-max-tag-value-len", "4", "-max-meta-size", "20")
+	upload(t, ts, "obj", "data")
+
+	type meta struct {
+		ContentType, CacheControl string
+		Tags                      map[string]string
+	}
+	// После отвергнутого изменения метаданные остаются как после последнего принятого
+	steps := []struct {
+		name   string
+		body   string
+		status int
+		want   meta
+	}{
+		{"tags", `{"Tags": {"a": "1", "b": "2"}}`, http.StatusOK, meta{"", "", map[string]string{"a": "1", "b": "2"}}},
+		{"too many tags", `{"Tags": {"a": "1", "b": "2", "c": "3"}}`, http.StatusBadRequest, meta{"", "", map[string]string{"a": "1", "b": "2"}}},
+		{"long tag name", `{"Tags": {"abcd": "1"}}`, http.StatusBadRequest, meta{"", "", map[string]string{"a": "1", "b": "2"}}},
+		{"long tag value", `{"Tags": {"a": "12345"}}`, http.StatusBadRequest, meta{"", "", map[string]string{"a": "1", "b": "2"}}},
+		{"fits the size", `{"ContentType": "text/plain"}`, http.StatusOK, meta{"text/plain", "", map[string]string{"a": "1", "b": "2"}}},
+		// Поле само по себе короткое, но вместе с остальными метаданные больше -max-meta-size
+		{"over the size", `{"CacheControl": "max-age=60"}`, http.StatusBadRequest, meta{"text/plain", "", map[string]string{"a": "1", "b": "2"}}},
+		{"fits after reset", `{"CacheControl": "max-age=60", "Tags": {}}`, http.StatusOK, meta{"text/plain", "max-age=60", map[string]string{}}},
+	}
+	for _, s := range steps {
+		if resp, body := do(t, ts, http.MethodPatch, "/meta/obj", s.body); resp.StatusCode != s.status {
+			t.Errorf("%s: %d %s, want %d", s.name, resp.StatusCode, body, s.status)
+		}
+		_, body := do(t, ts, http.MethodGet, "/meta/obj", "")
+		var got meta
+		if err := json.Unmarshal([]byte(body), &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, s.want) {
+			t.Errorf("%s: metadata %+v, want %+v", s.name, got, s.want)
+		}
+	}
+
+	for _, args := range [][]string{{"-max-tags", "-1"}, {"-max-tag-key-len", "0"}, {"-max-tag-value-len", "-1"}, {"-max-meta-size", "-1"}} {
+		if _, err := ParseConfig(args); err == nil {
+			t.Errorf("ParseConfig(%q) accepted invalid limits", args)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	PATCH_PREFIX_LEN = len("/patch/") // ДЛИНА ПРЕФИКСА ДЛЯ МАРШРУТА ЧАСТИЧНОЙ ЗАПИСИ
+	OFFSET_HEADER    = "X-Offset"     // ЗАГОЛОВОК СО СМЕЩЕНИЕМ ЧАСТИЧНОЙ ЗАПИСИ
+	MAX_PATCH_GAP    = 1 << 20        // НАСКОЛЬКО ДАЛЬШЕ КОНЦА ОБЪЕКТА МОЖНО НАЧАТЬ ЗАПИСЬ (1 МиБ НУЛЕЙ)
+)
+
+// ErrOffsetTooFar — смещение слишком далеко за концом объекта
+var ErrOffsetTooFar = fmt.Errorf("offset is more than %d bytes past the end of the object", MAX_PATCH_GAP)
+
+// Patch — записывает data в существующий объект начиная с offset, не перезаписывая
+// его целиком. Запись за концом объекта удлиняет его, промежуток заполняется нулями,
+// но не длиннее MAX_PATCH_GAP: объект из очереди отложенной записи изменяется в памяти,
+// и огромное смещение не должно оборачиваться огромным выделением. Как и Replace,
+// учитывает If-Match и срок хранения. Возвращает новый ETag.
+func (s *Storage) Patch(key string, offset int64, data []byte, ifMatch string) (string, error) {
+	// Проверяется только записываемый фрагмент: читать ради этого весь объект слишком дорого
+	if err := s.scan(key, bytes.NewReader(data)); err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.exists(key) {
+		return "", os.ErrNotExist
+	}
+	if err := s.checkMutable(key); err != nil {
+		return "", err
+	}
+	if ifMatch != "" {
+		etag, err := s.ETag(key)
+		if err != nil {
+			return "", err
+		}
+		if !etagMatches(ifMatch, etag) {
+			return "", ErrETagMismatch
+		}
+	}
+
+	if s.wb != nil {
+		// Не даём фоновому сбросу записать прежнюю версию поверх изменённой
+		s.wb.flushMu.Lock()
+		defer s.wb.flushMu.Unlock()
+	}
+	o, queued := s.wbPending(key)
+	size := int64(len(o.body))
+	if !queued {
+		info, err := s.backend.Stat(key)
+		if err != nil {
+			return "", err
+		}
+		size = info.Size()
+	}
+	// После этой проверки offset+len(data) не переполняется: оба слагаемых ограничены
+	if offset > size+MAX_PATCH_GAP {
+		return "", ErrOffsetTooFar
+	}
+	if s.maxObjectSize > 0 && offset+int64(len(data)) > s.maxObjectSize {
+		return "", ErrTooLarge
+	}
+
+	// Объект мог и не вырасти, но до следующего обхода диска считаем с запасом
+	if err := s.quota.Reserve(int64(len(data))); err != nil {
+		return "", err
+	}
+
+	var sum string
+	if queued {
+		// Объект ещё не на диске — изменяем его в очереди отложенной записи
+		body := patchBytes(o.body, offset, data)
+		o = obj{name: key, body: body, modTime: time.Now()}
+		s.cache.Put(o)
+		s.wb.add(o)
+		md := md5.Sum(body)
+		sum = hex.EncodeToString(md[:])
+	} else {
+		if err := s.backend.WriteAt(key, data, offset); err != nil {
+			log.Printf("Ошибка частичной записи файла %s: %v", logKey(key), logErr(err))
+			s.quota.Release(int64(len(data)))
+			return "", err
+		}
+		// Копия в кэше устарела; при следующем чтении объект загрузится с диска
+		s.cache.Remove(key)
+		var err error
+		if sum, err = s.contentChecksum(key, "md5"); err != nil {
+			return "", err
+		}
+	}
+
+	// Прежние контрольные суммы относятся к старому содержимому, оставляем только MD5
+	err := s.UpdateMeta(key, func(m *Meta) {
+		m.Checksums = map[string]string{"md5": sum}
+		m.Written = time.Now()
+	})
+	s.recordChange(CHANGE_UPDATE, key)
+	return `"` + sum + `"`, err
+}
+
+// wbPending — возвращает объект из очереди отложенной записи, если он там есть
+func (s *Storage) wbPending(key string) (obj, bool) {
+	if s.wb == nil {
+		return obj{}, false
+	}
+	return s.wb.get(key)
+}
+
+// patchBytes — возвращает копию body с data, записанными по смещению offset. Что offset
+// не дальше MAX_PATCH_GAP за концом body, проверяет вызывающий (Patch)
+func patchBytes(body []byte, offset int64, data []byte) []byte {
+	size := int64(len(body))
+	if end := offset + int64(len(data)); end > size {
+		size = end
+	}
+	out := make([]byte, size)
+	copy(out, body)
+	copy(out[offset:], data)
+	return out
+}
+
+// HandlePatch — обработчик частичной записи: PATCH /patch/<key> с заголовком X-Offset
+// записывает тело запроса в существующий объект по указанному смещению
+func HandlePatch(w http.ResponseWriter, r *http.Request, storage *Storage) {
+	// Получаем ключ (имя объекта) из URL и смещение из заголовка
+	key := storage.RequestKey(r, r.URL.Path[PATCH_PREFIX_LEN:])
+	if !checkKey(w, key) {
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get(OFFSET_HEADER), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "Некорректное смещение в "+OFFSET_HEADER, http.StatusBadRequest)
+		return
+	}
+
+	data, err := readUploadBody(r, storage.maxObjectSize)
+	defer r.Body.Close()
+	setRetryAfter(w, err)
+	if status := uploadErrorStatus(err); err != nil && status != http.StatusInternalServerError {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Ошибка чтения данных", http.StatusInternalServerError)
+		return
+	}
+
+	if !authorizeObject(w, r, storage, key, true) || !checkLease(w, r, storage, key) || !checkSealed(w, r, storage, key) ||
+		!checkQuota(w, storage, int64(len(data))) {
+		return
+	}
+	etag, err := storage.Patch(key, offset, data, r.Header.Get("If-Match"))
+	switch {
+	case os.IsNotExist(err):
+		http.Error(w, "Объект не найден", http.StatusNotFound)
+	case errors.Is(err, ErrLocked):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, ErrETagMismatch):
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+	case errors.Is(err, ErrOffsetTooFar):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, ErrQuotaExceeded):
+		http.Error(w, "Недостаточно места в квоте хранилища", http.StatusInsufficientStorage)
+	case errors.Is(err, ErrRejected):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case err != nil:
+		log.Printf("Ошибка частичной записи объекта %s: %v", logKey(key), logErr(err))
+		http.Error(w, "Ошибка записи объекта", http.StatusInternalServerError)
+	default:
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "Объект %s успешно изменен", clientKey(r, key))
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestPatch(t *testing.T) {
+	for _, args := range [][]string{nil, {"-write-back"}} {
+		ts, storage := newTestServer(t, append([]string{"-max-object-size", "20"}, args...)...)
+		upload(t, ts, "obj", "hello world")
+
+		tests := []struct {
+			name    string
+			key     string
+			offset  string
+			body    string
+			ifMatch string
+			status  int
+			content string
+		}{
+			{"overwrite middle", "obj", "6", "WORLD", "", http.StatusOK, "hello WORLD"},
+			// Промежуток за концом объекта заполняется нулями
+			{"past the end", "obj", "13", "!!", "", http.StatusOK, "hello WORLD\x00\x00!!"},
+			{"matching ETag", "obj", "0", "H", "*", http.StatusOK, "Hello WORLD\x00\x00!!"},
+			{"stale ETag", "obj", "0", "x", `"0123"`, http.StatusPreconditionFailed, "Hello WORLD\x00\x00!!"},
+			{"too large", "obj", "19", "ab", "", http.StatusRequestEntityTooLarge, "Hello WORLD\x00\x00!!"},
+			{"negative offset", "obj", "-1", "x", "", http.StatusBadRequest, "Hello WORLD\x00\x00!!"},
+			{"far past the end", "obj", strconv.Itoa(15 + MAX_PATCH_GAP + 1), "x", "", http.StatusBadRequest, "Hello WORLD\x00\x00!!"},
+			// offset+len(data) переполнил бы int64 и прошёл бы проверку размера
+			{"overflowing offset", "obj", strconv.FormatInt(math.MaxInt64, 10), "xy", "", http.StatusBadRequest, "Hello WORLD\x00\x00!!"},
+			{"no offset", "obj", "", "x", "", http.StatusBadRequest, "Hello WORLD\x00\x00!!"},
+			{"missing object", "missing", "0", "x", "", http.StatusNotFound, ""},
+		}
+		for _, tt := range tests {
+			header := []string{OFFSET_HEADER, tt.offset}
+			if tt.ifMatch != "" {
+				header = append(header, "If-Match", tt.ifMatch)
+			}
+			resp, body := do(t, ts, http.MethodPatch, "/patch/"+tt.key, tt.body, header...)
+			if resp.StatusCode != tt.status {
+				t.Errorf("%v %s: %d %s, want %d", args, tt.name, resp.StatusCode, body, tt.status)
+			}
+			etag := resp.Header.Get("ETag")
+
+			resp, body = do(t, ts, http.MethodGet, "/download/"+tt.key, "")
+			if tt.content != "" && body != tt.content {
+				t.Errorf("%v %s: content %q, want %q", args, tt.name, body, tt.content)
+			}
+			// Новый ETag из ответа PATCH совпадает с ETag изменённого объекта
+			if tt.status == http.StatusOK && etag != resp.Header.Get("ETag") {
+				t.Errorf("%v %s: PATCH ETag %s, download ETag %s", args, tt.name, etag, resp.Header.Get("ETag"))
+			}
+		}
+		if resp, _ := do(t, ts, http.MethodPost, "/admin/flush", ""); resp.StatusCode != http.StatusOK {
+			t.Errorf("%v: flush: %d", args, resp.StatusCode)
+		}
+		// Изменения отложенной записи доходят до диска
+		if data, err := os.ReadFile(storage.objectPath("obj")); err != nil || string(data) != "Hello WORLD\x00\x00!!" {
+			t.Errorf("%v: on disk %q, %v", args, data, err)
+		}
+	}
+}
+
+func TestPatchHugeOffset(t *testing.T) {
+	// Без -max-object-size размер ограничивает только MAX_PATCH_GAP: с -write-back
+	// объект изменяется в памяти, и смещение в терабайт не должно его выделять
+	for _, args := range [][]string{nil, {"-write-back"}} {
+		ts, _ := newTestServer(t, args...)
+		upload(t, ts, "obj", "abc")
+		for _, offset := range []string{"1099511627776", strconv.FormatInt(math.MaxInt64, 10)} {
+			if resp, body := do(t, ts, http.MethodPatch, "/patch/obj", "x", OFFSET_HEADER, offset); resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("%v offset %s: %d %s, want 400", args, offset, resp.StatusCode, body)
+			}
+		}
+		// Промежуток ровно в MAX_PATCH_GAP ещё допустим
+		if resp, body := do(t, ts, http.MethodPatch, "/patch/obj", "z", OFFSET_HEADER, strconv.Itoa(3+MAX_PATCH_GAP)); resp.StatusCode != http.StatusOK {
+			t.Fatalf("%v patch at the gap limit: %d %s", args, resp.StatusCode, body)
+		}
+		if _, body := do(t, ts, http.MethodGet, "/download/obj", ""); len(body) != 3+MAX_PATCH_GAP+1 || body[len(body)-1] != 'z' {
+			t.Errorf("%v: object is %d bytes after patch, want %d", args, len(body), 3+MAX_PATCH_GAP+1)
+		}
+	}
+}
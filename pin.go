@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+const PIN_PREFIX_LEN = len("/pin/") // ДЛИНА ПРЕФИКСА ДЛЯ МАРШРУТА ЗАКРЕПЛЕНИЯ ОБЪЕКТОВ В КЭШЕ
+
+// Pin — закрепляет объект в кэше, чтобы его не вытеснили другие (например, часто
+// читаемый индекс), и сразу загружает его в кэш. Объект больше -cache-threshold
+// или не поместившийся рядом с другими закреплёнными остаётся на диске, но
+// закрепляется, как только попадёт в кэш.
+func (s *Storage) Pin(key string) {
+	s.mu.Lock()
+	s.cache.Pin(key)
+	s.mu.Unlock()
+	s.Load(key)
+}
+
+// Unpin — снимает закрепление объекта в кэше
+func (s *Storage) Unpin(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cache.Unpin(key)
+}
+
+// pinned — закреплён ли объект в кэше
+func (s *Storage) pinned(key string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cache.Pinned(key)
+}
+
+// cached — есть ли объект в кэше
+func (s *Storage) cached(key string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cache.Contains(key)
+}
+
+// HandlePin — обработчик закрепления объектов в кэше: POST /pin/<key> закрепляет,
+// DELETE снимает закрепление, GET показывает состояние. Закрепления, сделанные
+// через API, живут до перезапуска; постоянные задаются флагом -cache-pin.
+func HandlePin(w http.ResponseWriter, r *http.Request, storage *Storage) {
+	key := storage.RequestKey(r, r.URL.Path[PIN_PREFIX_LEN:])
+	if !checkKey(w, key) {
+		return
+	}
+	if r.Method == http.MethodPost && !storage.Exists(key) {
+		http.Error(w, "Объект не найден", http.StatusNotFound)
+		return
+	}
+	if !authorizeObject(w, r, storage, key, false) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		storage.Pin(key)
+	case http.MethodDelete:
+		storage.Unpin(key)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Key    string
+		Pinned bool
+		Cached bool
+	}{clientKey(r, key), storage.pinned(key), storage.cached(key)})
+}
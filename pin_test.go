@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestHandlePin(t *testing.T) {
+	ts, storage := newTestServer(t, "-cache-size", "8", "-cache-pin", "idx")
+	upload(t, ts, "idx", "1234")
+
+	type pinState struct {
+		Key            string
+		Pinned, Cached bool
+	}
+	// Кэш на два объекта по 4 байта; шаги выполняются по порядку
+	steps := []struct {
+		name   string
+		upload string // Объект, загружаемый перед запросом
+		method string
+		key    string
+		status int
+		want   pinState
+	}{
+		{"pinned by flag", "", http.MethodGet, "idx", http.StatusOK, pinState{"idx", true, true}},
+		// Загрузки вытесняют друг друга, а не закреплённый объект
+		{"flag pin survives", "a", http.MethodGet, "idx", http.StatusOK, pinState{"idx", true, true}},
+		{"evicted", "b", http.MethodGet, "a", http.StatusOK, pinState{"a", false, false}},
+		// Закрепление сразу загружает объект в кэш
+		{"pin loads", "", http.MethodPost, "a", http.StatusOK, pinState{"a", true, true}},
+		// Вытеснять больше некого: новый объект не кэшируется
+		{"full of pins", "c", http.MethodGet, "c", http.StatusOK, pinState{"c", false, false}},
+		{"unpin", "", http.MethodDelete, "a", http.StatusOK, pinState{"a", false, true}},
+		{"unpinned is evicted", "d", http.MethodGet, "a", http.StatusOK, pinState{"a", false, false}},
+		{"missing", "", http.MethodPost, "missing", http.StatusNotFound, pinState{}},
+		{"bad key", "", http.MethodPost, "../x", http.StatusBadRequest, pinState{}},
+	}
+	for _, s := range steps {
+		if s.upload != "" {
+			upload(t, ts, s.upload, "1234")
+		}
+		resp, body := do(t, ts, s.method, "/pin/"+s.key, "")
+		if resp.StatusCode != s.status {
+			t.Errorf("%s: %s /pin/%s: %d %s, want %d", s.name, s.method, s.key, resp.StatusCode, body, s.status)
+			continue
+		}
+		if s.status != http.StatusOK {
+			continue
+		}
+		var got pinState
+		if err := json.Unmarshal([]byte(body), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got != s.want {
+			t.Errorf("%s: %+v, want %+v", s.name, got, s.want)
+		}
+	}
+	// Незакэшированные объекты по-прежнему читаются с диска
+	for _, key := range []string{"a", "b", "c", "d", "idx"} {
+		if resp, body := do(t, ts, http.MethodGet, "/download/"+key, ""); resp.StatusCode != http.StatusOK || body != "1234" {
+			t.Errorf("GET /download/%s: %d %q", key, resp.StatusCode, body)
+		}
+	}
+	if storage.cache.Size() > 8 {
+		t.Errorf("cache holds %d bytes, capacity 8", storage.cache.Size())
+	}
+}
@@ -0,0 +1,25 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// FALLOC_FL_KEEP_SIZE — РЕЗЕРВИРОВАТЬ МЕСТО, НЕ МЕНЯЯ РАЗМЕР ФАЙЛА
+const FALLOC_FL_KEEP_SIZE = 0x1
+
+// preallocate — заранее резервирует на диске size байт под файл. Размер файла не
+// меняется, поэтому смещение докачки по-прежнему равно размеру файла. Если ФС
+// не поддерживает резервирование, возвращает nil: файл просто растёт по мере записи.
+func preallocate(file *os.File, size int64) error {
+	if size <= 0 {
+		return nil
+	}
+	err := syscall.Fallocate(int(file.Fd()), FALLOC_FL_KEEP_SIZE, 0, size)
+	if err == syscall.EOPNOTSUPP || err == syscall.ENOSYS {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,48 @@
+//go:build linux
+
+package main
+
+import (
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestPreallocate(t *testing.T) {
+	for _, size := range []int64{0, 1, 1 << 20} {
+		file, err := os.CreateTemp(t.TempDir(), "prealloc-*")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := preallocate(file, size); err != nil {
+			t.Fatalf("preallocate(%d): %v", size, err)
+		}
+		info, err := file.Stat()
+		file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Размер не меняется: смещение докачки tus равно размеру файла
+		if info.Size() != 0 {
+			t.Errorf("preallocate(%d): file size %d, want 0", size, info.Size())
+		}
+		// На ФС без резервирования блоки не выделяются, и это не ошибка
+		if blocks := info.Sys().(*syscall.Stat_t).Blocks * 512; blocks != 0 && blocks < size {
+			t.Errorf("preallocate(%d): %d bytes reserved", size, blocks)
+		}
+	}
+}
+
+func TestTusCreateTooLarge(t *testing.T) {
+	ts, _ := newTestServer(t)
+	// Столько места нет ни на одном диске: загрузка отклоняется сразу, а не на середине
+	resp, body := do(t, ts, http.MethodPost, "/files/", "", "Tus-Resumable", TUS_VERSION,
+		"Upload-Length", "1125899906842624", "Upload-Metadata", "key aHVnZQ==")
+	if resp.StatusCode != http.StatusInsufficientStorage && resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("create of 1 PiB upload: %d %s, want 507 or 413", resp.StatusCode, body)
+	}
+	if entries, err := os.ReadDir(tusDir()); err != nil || len(entries) != 0 {
+		t.Errorf("rejected upload left %d files (%v)", len(entries), err)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import "os"
+
+// preallocate — на этой платформе резервирование места не поддерживается,
+// файл растёт по мере записи
+func preallocate(file *os.File, size int64) error {
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// QUOTA_REFRESH — КАК ЧАСТО ПЕРЕСЧИТЫВАТЬ ЗАНЯТОЕ МЕСТО ОБХОДОМ ДИСКА ДЛЯ -disk-quota
+const QUOTA_REFRESH = 5 * time.Second
+
+// ErrQuotaExceeded — загрузка не помещается в -disk-quota
+var ErrQuotaExceeded = errors.New("upload does not fit in the disk quota")
+
+// DiskQuota — предел суммарного размера объектов на диске. Занятое место считается
+// обходом диска не чаще раза в QUOTA_REFRESH, а записи между обходами резервируются
+// в нём заранее (Reserve), поэтому и одновременные загрузки не проскакивают квоту;
+// место, освобождённое удалениями, учитывается при следующем обходе.
+// Нулевая (nil) квота ничего не ограничивает.
+type DiskQuota struct {
+	limit    int64
+	measure  func() (int64, error) // Обход диска: суммарный размер объектов
+	mu       sync.Mutex
+	used     int64 // Измеренное обходом место вместе с резервами после него
+	base     int64 // Место по последнему обходу
+	measured time.Time
+}
+
+// NewDiskQuota — квота на limit байт (0 — без квоты, возвращает nil)
+func NewDiskQuota(limit int64, measure func() (int64, error)) *DiskQuota {
+	if limit <= 0 {
+		return nil
+	}
+	return &DiskQuota{limit: limit, measure: measure}
+}
+
+// Used — сколько байт занято объектами
+func (q *DiskQuota) Used() (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.usedLocked()
+}
+
+// usedLocked — Used с уже захваченным q.mu
+func (q *DiskQuota) usedLocked() (int64, error) {
+	if time.Since(q.measured) > QUOTA_REFRESH {
+		used, err := q.measure()
+		if err != nil {
+			return 0, err
+		}
+		q.used, q.base, q.measured = used, used, time.Now()
+	}
+	return q.used, nil
+}
+
+// Available — сколько байт ещё можно загрузить; без квоты — -1
+func (q *DiskQuota) Available() (int64, error) {
+	if q == nil {
+		return -1, nil
+	}
+	used, err := q.Used()
+	if err != nil || used >= q.limit {
+		return 0, err
+	}
+	return q.limit - used, nil
+}
+
+// Check — возвращает ErrQuotaExceeded, если загрузка size байт не помещается в квоту.
+// Перезапись считается целиком, без вычета прежнего размера объекта. Это только
+// предварительная проверка до чтения тела, место под запись занимает Reserve.
+func (q *DiskQuota) Check(size int64) error {
+	available, err := q.Available()
+	if err != nil {
+		return err
+	}
+	if available >= 0 && size > available {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// Reserve — занимает size байт под запись до следующего обхода диска или возвращает
+// ErrQuotaExceeded, если они не помещаются. Проверка и резерв выполняются под одним
+// q.mu, так что одновременные записи вместе не превысят квоту. Если запись не удалась,
+// резерв возвращается через Release.
+func (q *DiskQuota) Reserve(size int64) error {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	used, err := q.usedLocked()
+	if err != nil {
+		return err
+	}
+	if size > q.limit-used {
+		return ErrQuotaExceeded
+	}
+	q.used += size
+	return nil
+}
+
+// Release — возвращает резерв size байт несостоявшейся записи. Если между Reserve
+// и Release прошёл обход диска, резерва в used уже нет, и меньше обхода used не станет
+func (q *DiskQuota) Release(size int64) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	if q.used -= size; q.used < q.base {
+		q.used = q.base
+	}
+	q.mu.Unlock()
+}
+
+// checkQuota — отвечает 507, если загрузка size байт не помещается в -disk-quota
+func checkQuota(w http.ResponseWriter, storage *Storage, size int64) bool {
+	err := storage.quota.Check(size)
+	if errors.Is(err, ErrQuotaExceeded) {
+		http.Error(w, "Недостаточно места в квоте хранилища", http.StatusInsufficientStorage)
+		return false
+	}
+	if err != nil {
+		log.Printf("Ошибка подсчёта занятого места: %v", logErr(err))
+		http.Error(w, "Ошибка чтения хранилища", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// handleQuotaCheck — предварительная проверка загрузки (?checkQuota=<size>): отвечает 200,
+// если объект такого размера помещается в квоту, и 507, если нет. Тело не читается
+// и ничего не сохраняется, поэтому большой файл не придётся передавать зря.
+func handleQuotaCheck(w http.ResponseWriter, storage *Storage, value string) {
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size < 0 {
+		http.Error(w, "checkQuota задаётся размером загрузки в байтах", http.StatusBadRequest)
+		return
+	}
+	if storage.maxObjectSize > 0 && size > storage.maxObjectSize {
+		http.Error(w, ErrTooLarge.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if !checkQuota(w, storage, size) {
+		return
+	}
+	available, _ := storage.quota.Available()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Size      int64
+		Available int64
+	}{size, available})
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDiskQuota(t *testing.T) {
+	ts, _ := newTestServer(t, "-disk-quota", "10", "-max-object-size", "8")
+
+	// Шаги выполняются по порядку: каждая загрузка уменьшает свободное место
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		body      string
+		header    []string
+		status    int
+		available int64 // Для ответа на ?checkQuota=
+	}{
+		{"check empty", http.MethodPost, "/upload/a?checkQuota=4", "", nil, http.StatusOK, 10},
+		{"upload", http.MethodPost, "/upload/a", "123456", nil, http.StatusCreated, 0},
+		{"check fits", http.MethodPost, "/upload/b?checkQuota=4", "", nil, http.StatusOK, 4},
+		{"check too big", http.MethodPost, "/upload/b?checkQuota=5", "", nil, http.StatusInsufficientStorage, 0},
+		{"check over max object size", http.MethodPost, "/upload/b?checkQuota=9", "", nil, http.StatusRequestEntityTooLarge, 0},
+		{"check bad size", http.MethodPost, "/upload/b?checkQuota=x", "", nil, http.StatusBadRequest, 0},
+		{"upload too big", http.MethodPost, "/upload/b", "12345", nil, http.StatusInsufficientStorage, 0},
+		// Перезапись считается целиком, без вычета прежнего размера
+		{"overwrite", http.MethodPut, "/upload/a", "123456", []string{"If-Match", "*"}, http.StatusInsufficientStorage, 0},
+		{"patch too big", http.MethodPatch, "/patch/a", "12345", []string{"X-Offset", "6"}, http.StatusInsufficientStorage, 0},
+		{"s3 put too big", http.MethodPut, "/bucket/b", "12345", nil, http.StatusInsufficientStorage, 0},
+		{"upload rest", http.MethodPost, "/upload/b", "1234", nil, http.StatusCreated, 0},
+		{"check full", http.MethodPost, "/upload/c?checkQuota=1", "", nil, http.StatusInsufficientStorage, 0},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, ts, tt.method, tt.path, tt.body, tt.header...)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: %s %s: %d %s, want %d", tt.name, tt.method, tt.path, resp.StatusCode, body, tt.status)
+			continue
+		}
+		if resp.StatusCode == http.StatusOK && strings.Contains(tt.path, "checkQuota") {
+			var got struct{ Size, Available int64 }
+			if err := json.Unmarshal([]byte(body), &got); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if got.Available != tt.available {
+				t.Errorf("%s: Available %d, want %d", tt.name, got.Available, tt.available)
+			}
+		}
+	}
+	// Не поместившиеся загрузки ничего не сохранили
+	for path, want := range map[string]string{"/download/a": "123456", "/download/b": "1234"} {
+		if resp, body := do(t, ts, http.MethodGet, path, ""); resp.StatusCode != http.StatusOK || body != want {
+			t.Errorf("GET %s: %d %q, want %q", path, resp.StatusCode, body, want)
+		}
+	}
+}
+
+func TestDiskQuotaDisabled(t *testing.T) {
+	ts, storage := newTestServer(t)
+	if storage.quota != nil {
+		t.Fatalf("quota without -disk-quota: %+v", storage.quota)
+	}
+	resp, body := do(t, ts, http.MethodPost, "/upload/a?checkQuota=1000000", "")
+	var got struct{ Size, Available int64 }
+	if err := json.Unmarshal([]byte(body), &got); resp.StatusCode != http.StatusOK || err != nil || got.Available != -1 {
+		t.Errorf("checkQuota without quota: %d %s", resp.StatusCode, body)
+	}
+	if _, err := ParseConfig([]string{"-disk-quota", "-1"}); err == nil {
+		t.Error("ParseConfig accepted a negative -disk-quota")
+	}
+}
+
+func TestDiskQuotaReserve(t *testing.T) {
+	q := NewDiskQuota(10, func() (int64, error) { return 1, nil })
+	// Одновременно резервируют больше, чем помещается: проходят только три по 3 байта
+	var wg sync.WaitGroup
+	var reserved atomic.Int64
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := q.Reserve(3); err == nil {
+				reserved.Add(1)
+			} else if !errors.Is(err, ErrQuotaExceeded) {
+				t.Errorf("reserve: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := reserved.Load(); n != 3 {
+		t.Errorf("%d reservations of 3 bytes fit in 9 free bytes, want 3", n)
+	}
+	// Резерв несостоявшейся записи возвращается, но не ниже измеренного обходом
+	q.Release(3)
+	if err := q.Reserve(3); err != nil {
+		t.Errorf("reserve after release: %v", err)
+	}
+	q.Release(100)
+	if used, err := q.Used(); err != nil || used != 1 {
+		t.Errorf("used after release = %d, %v, want 1", used, err)
+	}
+}
+
+func TestDiskQuotaConcurrentUploads(t *testing.T) {
+	ts, _ := newTestServer(t, "-disk-quota", "10")
+	var wg sync.WaitGroup
+	var created atomic.Int64
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			switch resp, body := do(t, ts, http.MethodPost, fmt.Sprintf("/upload/k%d", i), "1234"); resp.StatusCode {
+			case http.StatusCreated:
+				created.Add(1)
+			case http.StatusInsufficientStorage:
+			default:
+				t.Errorf("upload k%d: %d %s", i, resp.StatusCode, body)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := created.Load(); n != 2 {
+		t.Errorf("%d uploads of 4 bytes fit in a 10 byte quota, want 2", n)
+	}
+}
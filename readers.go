@@ -0,0 +1,125 @@
+package main
+
+import (
+	"os"
+	"sync"
+)
+
+// openFile — файл объекта, открытый для потокового чтения одним или несколькими запросами
+type openFile struct {
+	readers int    // Сколько запросов читают файл
+	trash   string // Куда файл перенесён после удаления объекта (пусто — не удалён)
+}
+
+// ObjectReaders — файлы объектов, которые сейчас отдаются потоком с диска. Удаление
+// объекта не прерывает их отдачу ни на одной ОС: если файл читается, он не удаляется,
+// а переносится в TMP_DIR хранилища, и удаляется, когда его закроет последний читающий запрос.
+// Ключ при этом освобождается сразу: объекта уже нет, и его можно загрузить заново.
+type ObjectReaders struct {
+	mu   sync.Mutex
+	open map[string]*openFile
+}
+
+// NewObjectReaders — конструктор без открытых файлов
+func NewObjectReaders() *ObjectReaders {
+	return &ObjectReaders{open: make(map[string]*openFile)}
+}
+
+// acquire — отмечает ещё одно чтение файла объекта
+func (o *ObjectReaders) acquire(key string) *openFile {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	f := o.open[key]
+	if f == nil {
+		f = &openFile{}
+		o.open[key] = f
+	}
+	f.readers++
+	return f
+}
+
+// release — завершает чтение; последнее чтение удалённого объекта удаляет его файл
+func (o *ObjectReaders) release(key string, f *openFile) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	f.readers--
+	if f.readers > 0 {
+		return
+	}
+	if f.trash != "" {
+		os.Remove(f.trash)
+	} else if o.open[key] == f {
+		delete(o.open, key)
+	}
+}
+
+// remove — удаляет файл объекта, а если он сейчас читается — переносит в staging
+// (на той же ФС) до завершения чтения; вызывается с захваченным мьютексом хранилища
+func (o *ObjectReaders) remove(key, path, staging string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	f := o.open[key]
+	if f == nil {
+		return os.Remove(path)
+	}
+
+	trash, err := os.CreateTemp(staging, "deleted-*")
+	if err != nil {
+		return err
+	}
+	trash.Close()
+	if err := os.Rename(path, trash.Name()); err != nil {
+		os.Remove(trash.Name())
+		return err
+	}
+	// Новые чтения ключа относятся уже к новому объекту
+	f.trash = trash.Name()
+	delete(o.open, key)
+	return nil
+}
+
+// objectFile — файл объекта, открытый FSBackend.Open. Close завершает чтение
+// и, если объект тем временем удалили, удаляет файл.
+type objectFile struct {
+	*os.File
+	readers *ObjectReaders
+	key     string
+	open    *openFile
+	once    sync.Once
+}
+
+// Close — закрывает файл и завершает чтение объекта
+func (f *objectFile) Close() error {
+	err := f.File.Close()
+	f.once.Do(func() { f.readers.release(f.key, f.open) })
+	return err
+}
+
+// openObject — открывает содержимое объекта для потокового чтения. Пока оно
+// не закрыто, удаление объекта не мешает дочитать его.
+func (s *Storage) openObject(key string) (ObjectContent, os.FileInfo, error) {
+	// Открытие и учёт чтения под мьютексом, чтобы удаление не прошло между ними
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	content, err := s.backend.Open(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := content.Stat()
+	if err != nil {
+		content.Close()
+		return nil, nil, err
+	}
+	return content, info, nil
+}
+
+// objectHead — первые байты объекта для определения типа по содержимому: из памяти
+// или, если объект отдаётся потоком, из открытого содержимого (ReadAt не сдвигает позицию чтения)
+func objectHead(data obj, file ObjectContent) []byte {
+	if file == nil {
+		return data.body
+	}
+	head := make([]byte, SNIFF_LEN)
+	n, _ := file.ReadAt(head, 0)
+	return head[:n]
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDeleteWhileReading(t *testing.T) {
+	for _, readers := range []int{0, 1, 2} {
+		storage, _ := newTestStorage(t)
+		if err := storage.Save("k", []byte("old"), Meta{}); err != nil {
+			t.Fatal(err)
+		}
+		path := storage.objectPath("k")
+		var files []ObjectContent
+		for i := 0; i < readers; i++ {
+			f, _, err := storage.openObject("k")
+			if err != nil {
+				t.Fatal(err)
+			}
+			files = append(files, f)
+		}
+
+		if err := storage.Delete("k", ""); err != nil {
+			t.Fatalf("%d readers: Delete: %v", readers, err)
+		}
+		// Ключ свободен сразу, даже пока старый файл дочитывается
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%d readers: object file is still in place: %v", readers, err)
+		}
+		if err := storage.Save("k", []byte("new"), Meta{}); err != nil {
+			t.Fatalf("%d readers: Save after delete: %v", readers, err)
+		}
+
+		for i, f := range files {
+			if data, err := io.ReadAll(f); err != nil || string(data) != "old" {
+				t.Errorf("%d readers: reader %d got %q, %v", readers, i, data, err)
+			}
+			f.Close()
+			// Повторный Close не завершает чтение второй раз
+			f.Close()
+			trash, _ := filepath.Glob(storagePath(TMP_DIR) + "/deleted-*")
+			if last := i == len(files)-1; last != (len(trash) == 0) {
+				t.Errorf("%d readers: after closing reader %d the temp dir holds %d files", readers, i, len(trash))
+			}
+		}
+		// Закрытие старого файла не трогает новый объект под тем же ключом
+		if data, err := os.ReadFile(path); err != nil || string(data) != "new" {
+			t.Errorf("%d readers: new object %q, %v", readers, data, err)
+		}
+		if len(storage.readers.open) != 0 {
+			t.Errorf("%d readers: readers still tracked: %v", readers, storage.readers.open)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+const MAX_REAP_INTERVAL = time.Hour // КАК ЧАСТО, НЕ РЕЖЕ, ИСКАТЬ ЗАБРОШЕННЫЕ ВРЕМЕННЫЕ ФАЙЛЫ
+
+// Reap — удаляет из директории временных файлов файлы, не изменявшиеся дольше maxAge:
+// брошенные возобновляемые загрузки и остатки прерванных записей.
+// Загрузку, в которую сейчас пишет PATCH, не трогает: её блокировка захватывается
+// на время проверки, а после записи файл снова свежий. Возвращает число удалённых загрузок и файлов.
+func (t *TusUploads) Reap(maxAge time.Duration) (int, error) {
+	deadline := time.Now().Add(-maxAge)
+	reaped := 0
+
+	// Данные и сведения загрузки лежат рядом, брошенным может остаться любой из двух файлов
+	ids := make(map[string]bool)
+	err := readDirBatches(tusDir(), func(e os.DirEntry) error {
+		ids[strings.TrimSuffix(e.Name(), ".json")] = true
+		return nil
+	})
+	if err != nil {
+		return reaped, err
+	}
+	for id := range ids {
+		if t.reapUpload(id, deadline) {
+			reaped++
+		}
+	}
+
+	// Остатки прерванных копирований из -temp-dir лежат в TMP_DIR на ФС хранилища,
+	// а для корней -type-dirs — в их собственных временных директориях
+	dirs := []string{tmpDir}
+	for _, dir := range t.storage.stagingDirs() {
+		if dir != tmpDir {
+			dirs = append(dirs, dir)
+		}
+	}
+	for _, dir := range dirs {
+		err = readDirBatches(dir, func(e os.DirEntry) error {
+			if e.IsDir() {
+				return nil
+			}
+			info, err := e.Info()
+			if err == nil && info.ModTime().Before(deadline) && os.Remove(dir+"/"+e.Name()) == nil {
+				reaped++
+			}
+			return nil
+		})
+		if err != nil {
+			return reaped, err
+		}
+	}
+	return reaped, nil
+}
+
+// reapUpload — удаляет загрузку id, если ни один её файл не изменялся после deadline
+func (t *TusUploads) reapUpload(id string, deadline time.Time) bool {
+	unlock := t.lock(id)
+	defer unlock()
+	for _, path := range []string{tusDataPath(id), tusInfoPath(id)} {
+		if info, err := os.Stat(path); err == nil && !info.ModTime().Before(deadline) {
+			return false
+		}
+	}
+	os.Remove(tusDataPath(id))
+	os.Remove(tusInfoPath(id))
+	t.forget(id)
+	return true
+}
+
+// reapLoop — удаляет заброшенные временные файлы при запуске и затем периодически
+func (t *TusUploads) reapLoop(maxAge time.Duration) {
+	interval := maxAge / 2
+	if interval > MAX_REAP_INTERVAL {
+		interval = MAX_REAP_INTERVAL
+	}
+	for {
+		reaped, err := t.Reap(maxAge)
+		if err != nil {
+			log.Printf("Ошибка очистки временных файлов: %v", logErr(err))
+		}
+		if reaped > 0 {
+			log.Printf("Удалено заброшенных временных файлов и загрузок: %d", reaped)
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReap(t *testing.T) {
+	storage, _ := newTestStorage(t)
+	uploads := NewTusUploads(storage)
+	old := time.Now().Add(-2 * time.Hour)
+
+	files := []struct {
+		path   string
+		old    bool
+		reaped bool
+	}{
+		{tusDataPath("abandoned"), true, true},
+		{tusInfoPath("abandoned"), true, true},
+		// Загрузка, в которую недавно писали, жива, даже если её сведения старые
+		{tusDataPath("active"), false, false},
+		{tusInfoPath("active"), true, false},
+		{tusInfoPath("half"), true, true},
+		{tmpDir + "/upload-123", true, true},
+		{tmpDir + "/upload-456", false, false},
+	}
+	for _, f := range files {
+		if err := os.WriteFile(f.path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if f.old {
+			if err := os.Chtimes(f.path, old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// Две брошенные загрузки и один временный файл
+	if n, err := uploads.Reap(time.Hour); err != nil || n != 3 {
+		t.Errorf("Reap = %d, %v; want 3", n, err)
+	}
+	for _, f := range files {
+		_, err := os.Stat(f.path)
+		if reaped := os.IsNotExist(err); reaped != f.reaped {
+			t.Errorf("%s: reaped %v, want %v", f.path, reaped, f.reaped)
+		}
+	}
+	if n, err := uploads.Reap(time.Hour); err != nil || n != 0 {
+		t.Errorf("second Reap = %d, %v; want 0", n, err)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// ReindexResult — что изменилось после пересканирования диска
+type ReindexResult struct {
+	Objects     int   // Объекты на диске
+	Bytes       int64 // Их суммарный размер
+	Discovered  int   // Объекты, о которых фильтр Блума не знал (добавлены в обход сервера)
+	StaleCached int   // Объекты, убранные из кэша: на диске их нет или размер другой
+}
+
+// Reindex — пересканирует хранилище и перестраивает состояние в памяти: фильтр
+// Блума и кэш. Из кэша убираются только объекты, разошедшиеся с диском, остальные
+// остаются. Запись на время сканирования блокируется, чтобы новые объекты не потерялись.
+func (s *Storage) Reindex() (ReindexResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result ReindexResult
+	sizes := make(map[string]int64)
+	err := s.walkDiskKeys(func(key string) error {
+		info, err := s.backend.Stat(key)
+		if err != nil {
+			return nil
+		}
+		sizes[key] = info.Size()
+		result.Objects++
+		result.Bytes += info.Size()
+		if s.bloom != nil && !s.bloom.MayContain(key) {
+			result.Discovered++
+		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	for _, key := range s.cache.Keys() {
+		if s.pending(key) {
+			continue
+		}
+		data, _ := s.cache.Peek(key)
+		if size, ok := sizes[key]; !ok || size != int64(len(data.body)) {
+			s.cache.Remove(key)
+			result.StaleCached++
+		}
+	}
+
+	// Объекты, добавленные в обход сервера, больше не считаются отсутствующими
+	if s.absent != nil {
+		s.absent.Reset()
+	}
+	if s.bloom != nil {
+		expected := s.bloomKeys
+		if len(sizes)*2 > expected {
+			expected = len(sizes) * 2
+		}
+		bloom := NewBloom(expected)
+		for key := range sizes {
+			bloom.Add(key)
+		}
+		if s.wb != nil {
+			s.wb.mu.Lock()
+			for key := range s.wb.pending {
+				bloom.Add(key)
+			}
+			s.wb.mu.Unlock()
+		}
+		s.bloom = bloom
+	}
+	return result, nil
+}
+
+// HandleReindex — обработчик для пересканирования диска (POST /admin/reindex)
+func HandleReindex(w http.ResponseWriter, r *http.Request, storage *Storage) {
+	result, err := storage.Reindex()
+	if err != nil {
+		log.Printf("Ошибка пересканирования диска: %v", logErr(err))
+		http.Error(w, "Ошибка пересканирования диска", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Диск пересканирован: объектов %d, новых %d, убрано из кэша %d", result.Objects, result.Discovered, result.StaleCached)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
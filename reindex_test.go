@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestReindex(t *testing.T) {
+	ts, storage := newTestServer(t)
+	upload(t, ts, "same", "1234")
+	upload(t, ts, "changed", "1234")
+	upload(t, ts, "removed", "1234")
+	// Фильтр Блума отсекает объект, о котором сервер не знает
+	if resp, _ := do(t, ts, http.MethodGet, "/download/added", ""); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("GET unknown object: %d, want 404", resp.StatusCode)
+	}
+
+	// Изменения на диске в обход сервера
+	if err := os.WriteFile(storage.objectPath("added"), []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(storage.objectPath("changed"), []byte("123456"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(storage.objectPath("removed")); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp, _ := do(t, ts, http.MethodGet, "/admin/reindex", ""); resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET /admin/reindex: %d, want 405", resp.StatusCode)
+	}
+	resp, body := do(t, ts, http.MethodPost, "/admin/reindex", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /admin/reindex: %d %s", resp.StatusCode, body)
+	}
+	var got ReindexResult
+	if err := json.Unmarshal([]byte(body), &got); err != nil {
+		t.Fatal(err)
+	}
+	if want := (ReindexResult{Objects: 3, Bytes: 13, Discovered: 1, StaleCached: 2}); got != want {
+		t.Errorf("reindex result %+v, want %+v", got, want)
+	}
+
+	// Совпавший с диском объект остаётся в кэше, разошедшиеся отдаются с диска
+	tests := []struct {
+		key    string
+		status int
+		body   string
+	}{
+		{"same", http.StatusOK, "1234"},
+		{"changed", http.StatusOK, "123456"},
+		{"added", http.StatusOK, "new"},
+		{"removed", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, ts, http.MethodGet, "/download/"+tt.key, "")
+		if resp.StatusCode != tt.status || tt.body != "" && body != tt.body {
+			t.Errorf("GET %s after reindex: %d %q, want %d %q", tt.key, resp.StatusCode, body, tt.status, tt.body)
+		}
+	}
+	if !storage.cache.Contains("same") {
+		t.Error("object matching the disk was dropped from the cache")
+	}
+}
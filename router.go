@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Router — ServeMux, приводящий путь запроса к единому виду до выбора маршрута:
+// повторные слеши схлопываются, завершающий слеш отбрасывается везде, кроме
+// самих маршрутов-поддеревьев. Так /download//foo, /download/foo/ и /download/foo
+// указывают на один объект, а /list/ — на /list, а не на S3-бакет «list».
+// Стандартный ServeMux в таких случаях отвечал бы редиректом 301, после которого
+// клиенты теряют тело PUT/POST.
+type Router struct {
+	*http.ServeMux
+	subtrees map[string]bool // Зарегистрированные шаблоны вида /prefix/
+}
+
+// NewRouter — создаёт пустой маршрутизатор
+func NewRouter() *Router {
+	return &Router{ServeMux: http.NewServeMux(), subtrees: make(map[string]bool)}
+}
+
+// HandleFunc — регистрирует обработчик и запоминает шаблоны-поддеревья. Если заданы
+// methods, маршрут принимает только их: на остальные методы отвечает 405 с Allow ещё
+// до авторизации и ограничений обработчика. Без methods метод проверяет сам обработчик
+// (так устроены маршруты, методы которых зависят от пути, — tus и S3).
+func (rt *Router) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request), methods ...string) {
+	if strings.HasSuffix(pattern, "/") {
+		rt.subtrees[pattern] = true
+	}
+	if len(methods) > 0 {
+		next := handler
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			if allowMethods(w, r, methods...) {
+				next(w, r)
+			}
+		}
+	}
+	rt.ServeMux.HandleFunc(pattern, handler)
+}
+
+// cleanPath — схлопывает повторные слеши и убирает завершающий слеш, если путь
+// не совпадает с шаблоном-поддеревом. Сегменты «.» и «..» не трогаем: их
+// по-прежнему разбирает ServeMux, а ключи с ними отвергает validateKey
+func (rt *Router) cleanPath(p string) string {
+	for strings.Contains(p, "//") {
+		p = strings.ReplaceAll(p, "//", "/")
+	}
+	if len(p) > 1 && strings.HasSuffix(p, "/") && !rt.subtrees[p] {
+		p = strings.TrimSuffix(p, "/")
+	}
+	return p
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if p := rt.cleanPath(r.URL.Path); p != r.URL.Path {
+		// Как http.StripPrefix: исходный запрос не меняем, подменяем копию URL
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = p
+		r2.URL.RawPath = ""
+		r = r2
+	}
+	rt.ServeMux.ServeHTTP(w, r)
+}
+
+// allowMethods — проверяет метод запроса. На остальные методы отвечает 405 с заголовком
+// Allow: без него ответ нарушает HTTP (RFC 9110, раздел 15.5.6), и клиенты не знают,
+// каким методом повторить запрос
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	methodNotAllowed(w, methods...)
+	return false
+}
+
+// methodNotAllowed — отвечает 405 со списком поддерживаемых маршрутом методов в Allow
+func methodNotAllowed(w http.ResponseWriter, methods ...string) {
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCleanPath(t *testing.T) {
+	rt := NewRouter()
+	rt.HandleFunc("/download/", func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		path, want string
+	}{
+		{"/", "/"},
+		{"/download/foo", "/download/foo"},
+		{"/download//foo", "/download/foo"},
+		{"///download///dir//foo", "/download/dir/foo"},
+		{"/download/foo/", "/download/foo"},
+		{"/list/", "/list"},
+		// Сам шаблон-поддерево сохраняет завершающий слеш
+		{"/download/", "/download/"},
+		{"/download//", "/download/"},
+		{"/download/./foo", "/download/./foo"},
+	}
+	for _, tt := range tests {
+		if got := rt.cleanPath(tt.path); got != tt.want {
+			t.Errorf("cleanPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRouterSlashes(t *testing.T) {
+	ts, _ := newTestServer(t)
+	// Тело PUT/POST не теряется: вместо редиректа путь приводится к виду маршрута
+	upload(t, ts, "/dir//obj/", "data")
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/download/dir/obj", http.StatusOK, "data"},
+		{"/download//dir//obj", http.StatusOK, "data"},
+		{"/download/dir/obj/", http.StatusOK, "data"},
+		{"/list/", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, ts, http.MethodGet, tt.path, "")
+		if resp.StatusCode != tt.status || tt.body != "" && body != tt.body {
+			t.Errorf("GET %s: %d %q, want %d %q", tt.path, resp.StatusCode, body, tt.status, tt.body)
+		}
+	}
+	if names := listNames(t, ts, "/"); len(names) != 1 || names[0] != "dir/obj" {
+		t.Errorf("GET /list/ = %v, want [dir/obj]", names)
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	ts, _ := newTestServer(t)
+	upload(t, ts, "obj", "data")
+
+	tests := []struct {
+		method, path, allow string
+	}{
+		{http.MethodDelete, "/upload/obj", "POST, PUT"},
+		{http.MethodPost, "/download/obj", "GET, HEAD"},
+		{http.MethodGet, "/delete/obj", "DELETE"},
+		{http.MethodGet, "/patch/obj", "PATCH"},
+		{http.MethodGet, "/touch/obj", "POST"},
+		{http.MethodGet, "/lease/obj", "POST, DELETE"},
+		{http.MethodPost, "/alias/a", "GET, PUT, DELETE"},
+		{http.MethodPut, "/meta/obj", "GET, PATCH"},
+		{http.MethodDelete, "/acl/obj", "GET, PUT"},
+		{http.MethodPost, "/stat/obj", "GET"},
+		{http.MethodDelete, "/stat", "GET, POST"},
+		{http.MethodPost, "/checksum/obj", "GET"},
+		{http.MethodPost, "/list", "GET"},
+		{http.MethodPost, "/metrics", "GET"},
+		{http.MethodPost, "/usage", "GET"},
+		{http.MethodDelete, "/manifest", "GET, POST"},
+		{http.MethodGet, "/admin/flush", "POST"},
+		{http.MethodGet, "/admin/reindex", "POST"},
+		{http.MethodPost, "/admin/config", "GET"},
+		{http.MethodPost, "/", "GET, HEAD"},
+		{http.MethodPost, "/bucket/obj", "GET, HEAD, PUT, DELETE"},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, ts, tt.method, tt.path, "")
+		if resp.StatusCode != http.StatusMethodNotAllowed {
+			t.Errorf("%s %s: %d %s, want 405", tt.method, tt.path, resp.StatusCode, body)
+			continue
+		}
+		if got := resp.Header.Get("Allow"); got != tt.allow {
+			t.Errorf("%s %s: Allow %q, want %q", tt.method, tt.path, got, tt.allow)
+		}
+	}
+
+	// Методы tus зависят от пути: создание загрузки или её части
+	tus := []string{"Tus-Resumable", TUS_VERSION}
+	for path, allow := range map[string]string{"/files/": "POST, OPTIONS", "/files/id": "HEAD, PATCH, OPTIONS"} {
+		resp, _ := do(t, ts, http.MethodGet, path, "", tus...)
+		if resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") != allow {
+			t.Errorf("GET %s: %d, Allow %q, want 405 %q", path, resp.StatusCode, resp.Header.Get("Allow"), allow)
+		}
+	}
+}
+
+func TestRouterMethods(t *testing.T) {
+	rt := NewRouter()
+	called := 0
+	handler := func(w http.ResponseWriter, r *http.Request) { called++ }
+	rt.HandleFunc("/fixed", handler, http.MethodGet, http.MethodHead)
+	rt.HandleFunc("/any/", handler)
+	tests := []struct {
+		method, path string
+		status       int
+		allow        string
+		called       bool
+	}{
+		{http.MethodGet, "/fixed", http.StatusOK, "", true},
+		{http.MethodHead, "/fixed/", http.StatusOK, "", true},
+		{http.MethodPost, "/fixed", http.StatusMethodNotAllowed, "GET, HEAD", false},
+		// Маршрут без списка методов проверяет метод сам
+		{http.MethodDelete, "/any/x", http.StatusOK, "", true},
+	}
+	for _, tt := range tests {
+		called = 0
+		rec := httptest.NewRecorder()
+		rt.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Code != tt.status || rec.Header().Get("Allow") != tt.allow || (called > 0) != tt.called {
+			t.Errorf("%s %s: %d Allow %q called %v; want %d %q %v", tt.method, tt.path, rec.Code, rec.Header().Get("Allow"), called > 0, tt.status, tt.allow, tt.called)
+		}
+	}
+
+	// На чужой метод 405 приходит раньше проверки ключа и авторизации
+	ts, _ := newTestServer(t, "-api-key", "secret")
+	for _, tt := range []struct{ method, path string }{
+		{http.MethodDelete, "/download/obj"},
+		{http.MethodPatch, "/upload/a%00b"},
+		{http.MethodPost, "/list"},
+		{http.MethodGet, "/delete/obj"},
+	} {
+		if resp, body := do(t, ts, tt.method, tt.path, ""); resp.StatusCode != http.StatusMethodNotAllowed {
+			t.Errorf("anonymous %s %s: %d %s, want 405", tt.method, tt.path, resp.StatusCode, body)
+		}
+	}
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	S3_XMLNS        = "http://s3.amazonaws.com/doc/2006-03-01/" // ПРОСТРАНСТВО ИМЁН XML-ОТВЕТОВ S3
+	S3_MAX_KEYS     = 1000                                      // МАКСИМУМ КЛЮЧЕЙ В ОДНОЙ СТРАНИЦЕ СПИСКА
+	S3_TIME_LAYOUT  = "2006-01-02T15:04:05.000Z"                // ФОРМАТ ВРЕМЕНИ В СПИСКЕ ОБЪЕКТОВ
+	S3_STORAGE      = "STANDARD"                                // КЛАСС ХРАНЕНИЯ, СООБЩАЕМЫЙ КЛИЕНТАМ
+	MIN_BUCKET_NAME = 3                                         // МИНИМАЛЬНАЯ ДЛИНА ИМЕНИ БАКЕТА
+	MAX_BUCKET_NAME = 63                                        // МАКСИМАЛЬНАЯ ДЛИНА ИМЕНИ БАКЕТА
+)
+
+// s3Error — ошибка в формате S3
+type s3Error struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string
+	Message   string
+	Resource  string
+	RequestId string
+}
+
+// s3Object — элемент списка объектов ListObjectsV2
+type s3Object struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int64
+	StorageClass string
+}
+
+// s3Prefix — общий префикс ключей при группировке по разделителю
+type s3Prefix struct {
+	Prefix string
+}
+
+// s3ListResult — ответ ListObjectsV2
+type s3ListResult struct {
+	XMLName               xml.Name `xml:"ListBucketResult"`
+	Xmlns                 string   `xml:"xmlns,attr"`
+	Name                  string
+	Prefix                string
+	Delimiter             string `xml:",omitempty"`
+	StartAfter            string `xml:",omitempty"`
+	ContinuationToken     string `xml:",omitempty"`
+	NextContinuationToken string `xml:",omitempty"`
+	KeyCount              int
+	MaxKeys               int
+	IsTruncated           bool
+	Contents              []s3Object
+	CommonPrefixes        []s3Prefix
+}
+
+// writeS3Error — отправляет клиенту ошибку в формате S3
+func writeS3Error(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	// У ответа на HEAD тела нет, клиенту остаётся только код
+	if r.Method == http.MethodHead {
+		return
+	}
+	io.WriteString(w, xml.Header)
+	xml.NewEncoder(w).Encode(s3Error{Code: code, Message: message, Resource: r.URL.Path, RequestId: RequestID(r)})
+}
+
+// validateBucket — проверяет имя бакета по правилам S3: строчные латинские буквы,
+// цифры, точки и дефисы, в начале и в конце — буква или цифра
+func validateBucket(bucket string) bool {
+	if len(bucket) < MIN_BUCKET_NAME || len(bucket) > MAX_BUCKET_NAME {
+		return false
+	}
+	for i := 0; i < len(bucket); i++ {
+		c := bucket[i]
+		alnum := c >= 'a' && c <= 'z' || c >= '0' && c <= '9'
+		if !alnum && (c != '.' && c != '-' || i == 0 || i == len(bucket)-1) {
+			return false
+		}
+	}
+	return true
+}
+
+// isReadMethod — не изменяет ли запрос хранилище
+func isReadMethod(r *http.Request) bool {
+	return r.Method == http.MethodGet || r.Method == http.MethodHead
+}
+
+// HandleS3 — обработчик S3-совместимого API: GET/HEAD/PUT/DELETE /<bucket>/<key>
+// и GET /<bucket>?list-type=2 (ListObjectsV2). Объект хранится под ключом <bucket>/<key>.
+func HandleS3(w http.ResponseWriter, r *http.Request, storage *Storage) {
+	bucket, object, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket == "" {
+		writeS3Error(w, r, http.StatusNotImplemented, "NotImplemented", "Список бакетов не поддерживается")
+		return
+	}
+	if !validateBucket(bucket) {
+		writeS3Error(w, r, http.StatusBadRequest, "InvalidBucketName", "Недопустимое имя бакета")
+		return
+	}
+
+	if object == "" {
+		if r.Method != http.MethodGet {
+			writeS3Error(w, r, http.StatusNotImplemented, "NotImplemented", "Операции над бакетами не поддерживаются")
+			return
+		}
+		if r.URL.Query().Get("list-type") != "2" {
+			writeS3Error(w, r, http.StatusNotImplemented, "NotImplemented", "Поддерживается только ListObjectsV2 (list-type=2)")
+			return
+		}
+		handleS3List(w, r, storage, bucket)
+		return
+	}
+
+	key := storage.RequestKey(r, bucket+"/"+object)
+	if err := validateKey(key); err != nil {
+		writeS3Error(w, r, http.StatusBadRequest, "InvalidArgument", "Недопустимый ключ: "+err.Error())
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		exists := storage.Exists(key)
+		if !exists {
+			writeS3Error(w, r, http.StatusNotFound, "NoSuchKey", "Объект не найден")
+			return
+		}
+		serveObject(w, r, storage, key)
+	case http.MethodPut:
+		handleS3Put(w, r, storage, key)
+	case http.MethodDelete:
+		handleS3Delete(w, r, storage, key)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, DELETE")
+		writeS3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
+	}
+}
+
+// handleS3Put — PutObject: создаёт объект или, как в S3, перезаписывает существующий
+func handleS3Put(w http.ResponseWriter, r *http.Request, storage *Storage, key string) {
+	if _, err := parseExpires(r); errors.Is(err, ErrTTLOutOfBounds) {
+		writeS3Error(w, r, http.StatusBadRequest, "InvalidArgument", err.Error())
+		return
+	} else if err != nil {
+		writeS3Error(w, r, http.StatusBadRequest, "InvalidArgument", "Некорректная дата в Expires")
+		return
+	}
+	// Отказ по заголовкам — до чтения тела, чтобы клиент с Expect: 100-continue его не передавал
+	if err := checkDeclaredBody(r, storage.maxObjectSize); err != nil {
+		status, code := uploadErrorStatus(err), "InvalidRequest"
+		if status == http.StatusRequestEntityTooLarge {
+			code = "EntityTooLarge"
+		}
+		writeS3Error(w, r, status, code, err.Error())
+		return
+	}
+	if err := storage.checkDeclaredType(key, r.Header.Get("Content-Type")); err != nil {
+		writeS3Error(w, r, http.StatusUnsupportedMediaType, "InvalidRequest", err.Error())
+		return
+	}
+	if !checkLease(w, r, storage, key) || !checkNotAlias(w, storage, key) {
+		return
+	}
+	declared := r.ContentLength
+	if declared < 0 {
+		declared = 0
+	}
+	if err := storage.quota.Check(declared); errors.Is(err, ErrQuotaExceeded) {
+		writeS3Error(w, r, http.StatusInsufficientStorage, "QuotaExceeded", "Недостаточно места в квоте хранилища")
+		return
+	}
+
+	data, err := readUploadBody(r, storage.maxObjectSize)
+	defer r.Body.Close()
+	setRetryAfter(w, err)
+	switch status := uploadErrorStatus(err); {
+	case err == nil:
+	case status == http.StatusRequestEntityTooLarge:
+		writeS3Error(w, r, status, "EntityTooLarge", err.Error())
+		return
+	case status != http.StatusInternalServerError:
+		writeS3Error(w, r, status, "InvalidRequest", err.Error())
+		return
+	default:
+		writeS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения данных")
+		return
+	}
+	if err := storage.quota.Check(int64(len(data))); err != nil {
+		if errors.Is(err, ErrQuotaExceeded) {
+			writeS3Error(w, r, http.StatusInsufficientStorage, "QuotaExceeded", "Недостаточно места в квоте хранилища")
+		} else {
+			log.Printf("Ошибка подсчёта занятого места: %v", logErr(err))
+			writeS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения хранилища")
+		}
+		return
+	}
+
+	exists := storage.Exists(key)
+	if exists {
+		if !authorizeObject(w, r, storage, key, true) || !s3CheckSealed(w, r, storage, key) {
+			return
+		}
+		err = storage.Replace(key, data, "*", uploadMeta(r))
+	} else {
+		err = storage.Save(key, data, uploadMeta(r))
+	}
+	if errors.Is(err, ErrLocked) {
+		writeS3Error(w, r, http.StatusForbidden, "AccessDenied", err.Error())
+		return
+	}
+	if errors.Is(err, ErrRejected) {
+		writeS3Error(w, r, http.StatusUnprocessableEntity, "InvalidRequest", err.Error())
+		return
+	}
+	if errors.Is(err, ErrUnsupportedType) {
+		writeS3Error(w, r, http.StatusUnsupportedMediaType, "InvalidRequest", err.Error())
+		return
+	}
+	if errors.Is(err, ErrQuotaExceeded) {
+		writeS3Error(w, r, http.StatusInsufficientStorage, "QuotaExceeded", "Недостаточно места в квоте хранилища")
+		return
+	}
+	if err != nil {
+		// Объект успели создать или удалить параллельным запросом
+		writeS3Error(w, r, http.StatusConflict, "OperationAborted", err.Error())
+		return
+	}
+
+	if etag, err := storage.ETag(key); err == nil {
+		w.Header().Set("ETag", etag)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleS3Delete — DeleteObject: как и S3, отвечает 204 и на отсутствующий объект
+func handleS3Delete(w http.ResponseWriter, r *http.Request, storage *Storage, key string) {
+	if !authorizeObject(w, r, storage, key, true) || !checkLease(w, r, storage, key) || !s3CheckSealed(w, r, storage, key) {
+		return
+	}
+	err := storage.Delete(key, r.Header.Get("If-Match"))
+	if errors.Is(err, ErrLocked) {
+		writeS3Error(w, r, http.StatusForbidden, "AccessDenied", err.Error())
+		return
+	}
+	if errors.Is(err, ErrETagMismatch) {
+		writeS3Error(w, r, http.StatusPreconditionFailed, "PreconditionFailed", err.Error())
+		return
+	}
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("Ошибка при удалении объекта %s: %v", logKey(key), logErr(err))
+		writeS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка удаления объекта")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// bucketKeys — отсортированные ключи объектов бакета (без имени бакета), начинающиеся с prefix
+func (s *Storage) bucketKeys(bucket, prefix string) ([]string, error) {
+	full := bucket + "/" + prefix
+	seen := make(map[string]bool)
+	add := func(key string) error {
+		if strings.HasPrefix(key, full) {
+			seen[key[len(bucket)+1:]] = true
+		}
+		return nil
+	}
+
+	s.mu.RLock()
+	for _, key := range s.cache.Keys() {
+		add(key)
+	}
+	if s.wb != nil {
+		s.wb.mu.Lock()
+		for key := range s.wb.pending {
+			add(key)
+		}
+		s.wb.mu.Unlock()
+	}
+	s.mu.RUnlock()
+	if err := s.walkDiskKeys(add); err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// objectStat — размер и время изменения объекта без чтения его содержимого
+func (s *Storage) objectStat(key string) (int64, time.Time, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.wb != nil {
+		if o, ok := s.wb.get(key); ok {
+			return int64(len(o.body)), o.modTime, true
+		}
+	}
+	info, err := s.backend.Stat(key)
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+	return info.Size(), info.ModTime(), true
+}
+
+// handleS3List — ListObjectsV2 с параметрами prefix, delimiter, max-keys,
+// start-after и continuation-token. Недоступные клиенту объекты в список не попадают.
+func handleS3List(w http.ResponseWriter, r *http.Request, storage *Storage, bucket string) {
+	q := r.URL.Query()
+	result := s3ListResult{
+		Xmlns:             S3_XMLNS,
+		Name:              bucket,
+		Prefix:            storage.NormalizeKey(q.Get("prefix")),
+		Delimiter:         q.Get("delimiter"),
+		StartAfter:        q.Get("start-after"),
+		ContinuationToken: q.Get("continuation-token"),
+		MaxKeys:           S3_MAX_KEYS,
+	}
+	if v := q.Get("max-keys"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeS3Error(w, r, http.StatusBadRequest, "InvalidArgument", "Недопустимое значение max-keys")
+			return
+		}
+		if n < S3_MAX_KEYS {
+			result.MaxKeys = n
+		}
+	}
+
+	// Токен продолжения — последний выданный ключ или общий префикс
+	marker := result.StartAfter
+	if result.ContinuationToken != "" {
+		token, err := base64.RawURLEncoding.DecodeString(result.ContinuationToken)
+		if err != nil {
+			writeS3Error(w, r, http.StatusBadRequest, "InvalidArgument", "Недопустимый continuation-token")
+			return
+		}
+		marker = string(token)
+	}
+
+	// Бакет виртуального хоста лежит в его поддиректории
+	dir := tenantPath(r, bucket)
+	keys, err := storage.bucketKeys(dir, result.Prefix)
+	if err != nil {
+		log.Printf("Ошибка при чтении списка объектов бакета %s: %v", bucket, logErr(err))
+		writeS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения списка объектов")
+		return
+	}
+
+	last := ""
+	for _, key := range keys {
+		if key <= marker || result.Delimiter != "" && strings.HasSuffix(marker, result.Delimiter) && strings.HasPrefix(key, marker) {
+			continue
+		}
+
+		// Ключи с разделителем после префикса сворачиваются в общий префикс
+		entry := key
+		if result.Delimiter != "" {
+			if i := strings.Index(key[len(result.Prefix):], result.Delimiter); i >= 0 {
+				entry = key[:len(result.Prefix)+i+len(result.Delimiter)]
+			}
+		}
+		if entry != key && entry == last {
+			continue
+		}
+
+		full := dir + "/" + key
+		if entry == key && !canList(r, storage, full) {
+			continue
+		}
+		if result.KeyCount == result.MaxKeys {
+			result.IsTruncated = true
+			result.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(last))
+			break
+		}
+
+		if entry != key {
+			result.CommonPrefixes = append(result.CommonPrefixes, s3Prefix{entry})
+		} else {
+			size, modTime, ok := storage.objectStat(full)
+			if !ok {
+				continue
+			}
+			etag, _ := storage.ETag(full)
+			result.Contents = append(result.Contents, s3Object{key, modTime.UTC().Format(S3_TIME_LAYOUT), etag, size, S3_STORAGE})
+		}
+		last = entry
+		result.KeyCount++
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	io.WriteString(w, xml.Header)
+	xml.NewEncoder(w).Encode(result)
+}
+
+// s3CheckSealed — как checkSealed, но с ошибкой в формате S3
+func s3CheckSealed(w http.ResponseWriter, r *http.Request, storage *Storage, key string) bool {
+	sealed, err := storage.Sealed(key)
+	if err != nil {
+		log.Printf("Ошибка чтения метаданных %s: %v", logKey(key), logErr(err))
+		writeS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения метаданных")
+		return false
+	}
+	if sealed && !sealOverride(r) {
+		writeS3Error(w, r, http.StatusForbidden, "AccessDenied", ErrSealed.Error())
+		return false
+	}
+	return true
+}
+
+// canList — может ли клиент видеть объект в списке
+func canList(r *http.Request, storage *Storage, key string) bool {
+	m, err := storage.LoadMeta(key)
+	return err == nil && m.canRead(Identity(r))
+}
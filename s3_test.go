@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestS3Object(t *testing.T) {
+	ts, _ := newTestServer(t)
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		code   string
+	}{
+		{"put", http.MethodPut, "/bucket/dir/obj", "v1", http.StatusOK, ""},
+		{"get", http.MethodGet, "/bucket/dir/obj", "", http.StatusOK, ""},
+		{"overwrite", http.MethodPut, "/bucket/dir/obj", "v2", http.StatusOK, ""},
+		{"head", http.MethodHead, "/bucket/dir/obj", "", http.StatusOK, ""},
+		{"get missing", http.MethodGet, "/bucket/missing", "", http.StatusNotFound, "NoSuchKey"},
+		{"bad bucket", http.MethodGet, "/Bucket/obj", "", http.StatusBadRequest, "InvalidBucketName"},
+		{"short bucket", http.MethodPut, "/ab/obj", "x", http.StatusBadRequest, "InvalidBucketName"},
+		{"bad key", http.MethodPut, "/bucket/a%00b", "x", http.StatusBadRequest, "InvalidArgument"},
+		{"list buckets", http.MethodGet, "/bucket", "", http.StatusNotImplemented, "NotImplemented"},
+		{"patch", http.MethodPatch, "/bucket/dir/obj", "", http.StatusMethodNotAllowed, "MethodNotAllowed"},
+		{"delete", http.MethodDelete, "/bucket/dir/obj", "", http.StatusNoContent, ""},
+		{"delete again", http.MethodDelete, "/bucket/dir/obj", "", http.StatusNoContent, ""},
+		{"get deleted", http.MethodGet, "/bucket/dir/obj", "", http.StatusNotFound, "NoSuchKey"},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, ts, tt.method, tt.path, tt.body)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: %d %s, want %d", tt.name, resp.StatusCode, body, tt.status)
+			continue
+		}
+		if tt.code == "" {
+			continue
+		}
+		var s3err s3Error
+		if err := xml.Unmarshal([]byte(body), &s3err); err != nil || s3err.Code != tt.code {
+			t.Errorf("%s: error %q (%v), want code %s", tt.name, s3err.Code, err, tt.code)
+		}
+	}
+	// Объект S3 — обычный объект под ключом <бакет>/<ключ>
+	upload(t, ts, "bucket/native", "native")
+	if resp, body := do(t, ts, http.MethodGet, "/bucket/native", ""); resp.StatusCode != http.StatusOK || body != "native" {
+		t.Errorf("S3 get of /upload object: %d %q", resp.StatusCode, body)
+	}
+}
+
+func TestS3ListObjectsV2(t *testing.T) {
+	ts, _ := newTestServer(t)
+	for _, key := range []string{"a", "b/1", "b/2", "c/x/1", "d"} {
+		upload(t, ts, "bucket/"+key, "data")
+	}
+	upload(t, ts, "other/a", "data")
+
+	list := func(query url.Values) s3ListResult {
+		query.Set("list-type", "2")
+		resp, body := do(t, ts, http.MethodGet, "/bucket?"+query.Encode(), "")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("list %v: %d %s", query, resp.StatusCode, body)
+		}
+		var result s3ListResult
+		if err := xml.Unmarshal([]byte(body), &result); err != nil {
+			t.Fatalf("list %v: %v", query, err)
+		}
+		return result
+	}
+	tests := []struct {
+		query    url.Values
+		keys     []string
+		prefixes []string
+	}{
+		{url.Values{}, []string{"a", "b/1", "b/2", "c/x/1", "d"}, nil},
+		{url.Values{"prefix": {"b/"}}, []string{"b/1", "b/2"}, nil},
+		{url.Values{"delimiter": {"/"}}, []string{"a", "d"}, []string{"b/", "c/"}},
+		{url.Values{"prefix": {"c/"}, "delimiter": {"/"}}, nil, []string{"c/x/"}},
+		{url.Values{"start-after": {"b/1"}}, []string{"b/2", "c/x/1", "d"}, nil},
+	}
+	for _, tt := range tests {
+		result := list(tt.query)
+		var keys, prefixes []string
+		for _, o := range result.Contents {
+			keys = append(keys, o.Key)
+		}
+		for _, p := range result.CommonPrefixes {
+			prefixes = append(prefixes, p.Prefix)
+		}
+		if !reflect.DeepEqual(keys, tt.keys) || !reflect.DeepEqual(prefixes, tt.prefixes) {
+			t.Errorf("list %v: keys %v prefixes %v, want %v %v", tt.query, keys, prefixes, tt.keys, tt.prefixes)
+		}
+	}
+
+	// Страницы по max-keys вместе дают весь список, общий префикс не повторяется
+	// (внутри страницы объекты и общие префиксы перечисляются отдельно)
+	var pages []string
+	query := url.Values{"max-keys": {"2"}, "delimiter": {"/"}}
+	for i := 0; i < 10; i++ {
+		result := list(query)
+		for _, o := range result.Contents {
+			pages = append(pages, o.Key)
+		}
+		for _, p := range result.CommonPrefixes {
+			pages = append(pages, p.Prefix)
+		}
+		if !result.IsTruncated {
+			break
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+	sort.Strings(pages)
+	if want := []string{"a", "b/", "c/", "d"}; !reflect.DeepEqual(pages, want) {
+		t.Errorf("paged list = %v, want %v", pages, want)
+	}
+}
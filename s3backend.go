@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+)
+
+// ErrBackendNotImplemented — бэкенд выбран и настроен, но операций ещё не умеет
+var ErrBackendNotImplemented = errors.New("s3 backend is not implemented yet")
+
+// S3Backend — бэкенд -backend s3: объекты в бакете внешнего S3-совместимого
+// хранилища. Пока это заготовка за интерфейсом Backend: настройки проверяются
+// при запуске, а каждая операция возвращает ErrBackendNotImplemented.
+type S3Backend struct {
+	Endpoint string // Адрес хранилища (-s3-endpoint)
+	Bucket   string // Бакет для объектов (-s3-bucket)
+}
+
+// NewS3Backend — конструктор по адресу хранилища и бакету
+func NewS3Backend(endpoint, bucket string) *S3Backend {
+	return &S3Backend{Endpoint: endpoint, Bucket: bucket}
+}
+
+// checkS3Config — адрес хранилища и бакет заданы, ключи доступа — оба или ни одного
+func checkS3Config(cfg *Config) error {
+	if cfg.S3Endpoint == "" || cfg.S3Bucket == "" {
+		return fmt.Errorf("-backend %s requires -s3-endpoint and -s3-bucket", BACKEND_S3)
+	}
+	u, err := url.Parse(cfg.S3Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("s3 endpoint %q must be an http or https URL", cfg.S3Endpoint)
+	}
+	if !validateBucket(cfg.S3Bucket) {
+		return fmt.Errorf("invalid s3 bucket name %q", cfg.S3Bucket)
+	}
+	if (cfg.S3AccessKey == "") != (cfg.S3SecretKey == "") {
+		return fmt.Errorf("-s3-access-key and -s3-secret-key must be set together")
+	}
+	return nil
+}
+
+// Операции бэкенда: пока все возвращают ErrBackendNotImplemented
+func (b *S3Backend) Stat(key string) (os.FileInfo, error) {
+	return nil, ErrBackendNotImplemented
+}
+
+func (b *S3Backend) Open(key string) (ObjectContent, error) {
+	return nil, ErrBackendNotImplemented
+}
+
+func (b *S3Backend) Write(key string, data []byte, durable bool) error {
+	return ErrBackendNotImplemented
+}
+
+func (b *S3Backend) WriteFile(key, tmpPath string) error {
+	return ErrBackendNotImplemented
+}
+
+func (b *S3Backend) WriteAt(key string, data []byte, offset int64) error {
+	return ErrBackendNotImplemented
+}
+
+func (b *S3Backend) Remove(key string) error {
+	return ErrBackendNotImplemented
+}
+
+func (b *S3Backend) Touch(key string, t time.Time) error {
+	return ErrBackendNotImplemented
+}
+
+func (b *S3Backend) CheckKey(key string) error {
+	return ErrBackendNotImplemented
+}
+
+func (b *S3Backend) Walk(prefix string, fn func(key string) error) error {
+	return ErrBackendNotImplemented
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	SCANNER_NONE  = "none"  // ЗАГРУЗКИ НЕ ПРОВЕРЯЮТСЯ
+	SCANNER_EICAR = "eicar" // ПРОВЕРКА ПО СИГНАТУРЕ ТЕСТОВОГО ФАЙЛА EICAR
+)
+
+// ErrRejected — загрузка отклонена проверкой содержимого
+var ErrRejected = errors.New("object rejected by content scanner")
+
+// Scanner — проверка содержимого загружаемого объекта до его сохранения (например,
+// антивирусом). Ошибка означает, что объект сохранять нельзя.
+type Scanner interface {
+	Scan(key string, data io.Reader) error
+}
+
+// NopScanner — пропускает любое содержимое
+type NopScanner struct{}
+
+// Scan — ничего не проверяет
+func (NopScanner) Scan(key string, data io.Reader) error {
+	return nil
+}
+
+// eicarSignature — тестовая сигнатура EICAR, которую антивирусы распознают как вирус.
+// Собрана из частей, чтобы сам исходник не срабатывал в антивирусах.
+var eicarSignature = []byte(`X5O!P%@AP[4\PZX54(P^)7CC)7}$` + `EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`)
+
+// SignatureScanner — пример проверки: отклоняет объекты, содержащие одну из сигнатур
+type SignatureScanner struct {
+	Signatures [][]byte
+}
+
+// Scan — ищет сигнатуры в содержимом потоком, не читая его целиком в память
+func (s SignatureScanner) Scan(key string, data io.Reader) error {
+	longest := 0
+	for _, sig := range s.Signatures {
+		if len(sig) > longest {
+			longest = len(sig)
+		}
+	}
+	if longest == 0 {
+		return nil
+	}
+
+	// Окно хранит хвост предыдущего блока, чтобы найти сигнатуру на границе блоков
+	reader := bufio.NewReader(data)
+	block := make([]byte, 64*1024)
+	window := make([]byte, 0, longest-1+len(block))
+	for {
+		n, err := reader.Read(block)
+		window = append(window, block[:n]...)
+		for _, sig := range s.Signatures {
+			if len(sig) > 0 && bytes.Contains(window, sig) {
+				return fmt.Errorf("object %v contains a known malware signature", key)
+			}
+		}
+		if len(window) > longest-1 {
+			window = append(window[:0], window[len(window)-(longest-1):]...)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// newScanner — проверка содержимого по её имени из конфигурации
+func newScanner(name string) Scanner {
+	if name == SCANNER_EICAR {
+		return SignatureScanner{Signatures: [][]byte{eicarSignature}}
+	}
+	return NopScanner{}
+}
+
+// scan — проверяет содержимое объекта; при отказе возвращает ошибку ErrRejected
+func (s *Storage) scan(key string, data io.Reader) error {
+	if err := s.scanner.Scan(key, data); err != nil {
+		return fmt.Errorf("%w: %v", ErrRejected, err)
+	}
+	return nil
+}
+
+// scanFile — проверяет содержимое файла, ещё не ставшего объектом
+func (s *Storage) scanFile(key, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return s.scan(key, file)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSignatureScanner(t *testing.T) {
+	clean := strings.Repeat("a", 64*1024-10)
+	tests := []struct {
+		name       string
+		signatures [][]byte
+		data       string
+		rejected   bool
+	}{
+		{"clean", [][]byte{eicarSignature}, "hello", false},
+		{"signature", [][]byte{eicarSignature}, "prefix " + string(eicarSignature), true},
+		// Сигнатура на границе блоков чтения находится по хвосту предыдущего блока
+		{"across blocks", [][]byte{eicarSignature}, clean + string(eicarSignature) + clean, true},
+		{"second signature", [][]byte{[]byte("zzz"), []byte("bad")}, "a bad one", true},
+		{"no signatures", nil, string(eicarSignature), false},
+	}
+	for _, tt := range tests {
+		err := SignatureScanner{Signatures: tt.signatures}.Scan("k", strings.NewReader(tt.data))
+		if got := err != nil; got != tt.rejected {
+			t.Errorf("%s: Scan = %v, want rejected %v", tt.name, err, tt.rejected)
+		}
+	}
+}
+
+func TestUploadScanner(t *testing.T) {
+	ts, storage := newTestServer(t, "-scanner", SCANNER_EICAR)
+	infected := "prefix " + string(eicarSignature)
+	upload(t, ts, "clean", "hello")
+
+	tests := []struct {
+		name   string
+		method string
+		key    string
+		body   string
+		header []string
+		status int
+	}{
+		{"infected upload", http.MethodPost, "bad", infected, nil, http.StatusUnprocessableEntity},
+		{"clean upload", http.MethodPost, "good", "hello", nil, http.StatusCreated},
+		{"infected overwrite", http.MethodPut, "clean", infected, []string{"If-Match", "*"}, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		if resp, body := do(t, ts, tt.method, "/upload/"+tt.key, tt.body, tt.header...); resp.StatusCode != tt.status {
+			t.Errorf("%s: %d %s, want %d", tt.name, resp.StatusCode, body, tt.status)
+		}
+	}
+	// Отклонённое содержимое не сохраняется и не заменяет прежнее
+	if resp, _ := do(t, ts, http.MethodGet, "/download/bad", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("rejected object is stored: %d", resp.StatusCode)
+	}
+	if _, body := do(t, ts, http.MethodGet, "/download/clean", ""); body != "hello" {
+		t.Errorf("rejected overwrite changed the object: %q", body)
+	}
+
+	// Готовый файл проверяется так же, как тело запроса
+	tmp := filepath.Join(t.TempDir(), "upload")
+	if err := os.WriteFile(tmp, []byte(infected), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.SaveFile("file", tmp, "", Meta{}); !errors.Is(err, ErrRejected) {
+		t.Errorf("SaveFile of infected file = %v, want ErrRejected", err)
+	}
+	if storage.Exists("file") {
+		t.Error("rejected file is stored")
+	}
+	if err := (NopScanner{}).Scan("k", bytes.NewReader([]byte(infected))); err != nil {
+		t.Errorf("NopScanner rejected content: %v", err)
+	}
+}
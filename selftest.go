@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+)
+
+const SELFTEST_SIZE = 64 * 1024 // РАЗМЕР ТЕСТОВОГО ОБЪЕКТА САМОПРОВЕРКИ В БАЙТАХ
+
+// SelfTest — проверяет работу хранилища на настоящей директории: записывает тестовый
+// объект, читает его из памяти и с диска, сверяет контрольную сумму, ищет в списке
+// и удаляет. Возвращает ошибку первого неудавшегося шага.
+func SelfTest(s *Storage) error {
+	key := "selftest-" + randomID()
+	data := make([]byte, SELFTEST_SIZE)
+	if _, err := rand.Read(data); err != nil {
+		return fmt.Errorf("generate data: %v", err)
+	}
+	sum := sha256.Sum256(data)
+
+	steps := []struct {
+		name string
+		run  func() error
+	}{
+		{"запись", func() error {
+			if err := s.Save(key, data, Meta{}); err != nil {
+				return err
+			}
+			_, err := s.Flush()
+			return err
+		}},
+		{"чтение из кэша", func() error { return selfTestLoad(s, key, data) }},
+		{"чтение с диска", func() error {
+			s.mu.Lock()
+			s.cache.Remove(key)
+			s.mu.Unlock()
+			return selfTestLoad(s, key, data)
+		}},
+		{"контрольная сумма", func() error {
+			got, err := s.Checksum(key, "sha256")
+			if err != nil {
+				return err
+			}
+			if got != hex.EncodeToString(sum[:]) {
+				return fmt.Errorf("sha256 mismatch: %s", got)
+			}
+			return nil
+		}},
+		{"список", func() error {
+			keys, err := s.diskKeys()
+			if err != nil {
+				return err
+			}
+			for _, k := range keys {
+				if k == key {
+					return nil
+				}
+			}
+			return fmt.Errorf("object %v is not listed", key)
+		}},
+		{"удаление", func() error {
+			if err := s.Delete(key, ""); err != nil {
+				return err
+			}
+			if _, ok := s.Load(key); ok {
+				return fmt.Errorf("object %v is still readable after delete", key)
+			}
+			return nil
+		}},
+	}
+
+	for _, step := range steps {
+		if err := step.run(); err != nil {
+			log.Printf("Самопроверка: %s — ОШИБКА: %v", step.name, err)
+			// Не оставляем тестовый объект в хранилище
+			s.Delete(key, "")
+			return fmt.Errorf("%s: %v", step.name, err)
+		}
+		log.Printf("Самопроверка: %s — OK", step.name)
+	}
+	return nil
+}
+
+// selfTestLoad — читает тестовый объект и сверяет его содержимое
+func selfTestLoad(s *Storage, key string, want []byte) error {
+	o, ok := s.Load(key)
+	if !ok {
+		return fmt.Errorf("object %v not found", key)
+	}
+	if !bytes.Equal(o.body, want) {
+		return fmt.Errorf("object %v content mismatch", key)
+	}
+	return nil
+}
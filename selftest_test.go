@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSelfTest(t *testing.T) {
+	tests := [][]string{
+		nil,
+		{"-write-back"},
+		{"-shard-width", "2"},
+		{"-cache-size", "1"},
+	}
+	for _, args := range tests {
+		storage, _ := newTestStorage(t, args...)
+		if err := SelfTest(storage); err != nil {
+			t.Errorf("SelfTest with %q: %v", args, err)
+		}
+		// Тестовый объект не остаётся в хранилище
+		if keys, err := storage.diskKeys(); err != nil || len(keys) != 0 {
+			t.Errorf("SelfTest with %q left %v (%v)", args, keys, err)
+		}
+	}
+}
+
+func TestSelfTestFailure(t *testing.T) {
+	storage, _ := newTestStorage(t)
+	if err := os.RemoveAll(storageDir); err != nil {
+		t.Fatal(err)
+	}
+	// Ошибка называет шаг, на котором самопроверка остановилась
+	if err := SelfTest(storage); err == nil || !strings.HasPrefix(err.Error(), "запись: ") {
+		t.Errorf("SelfTest without storage dir: %v, want write step error", err)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+)
+
+const MAX_SHARD_WIDTH = 4 // МАКСИМУМ HEX-СИМВОЛОВ ХЭША В ИМЕНИ ПОДДИРЕКТОРИИ (65536 ПОДДИРЕКТОРИЙ)
+
+// KeyMapper — раскладка объектов на диске: путь файла объекта по его ключу и обратно —
+// ключи всех файлов под корнем. Клиенты видят плоское пространство ключей, раскладка
+// скрыта внутри хранилища. Той же раскладкой хранятся и файлы метаданных.
+type KeyMapper interface {
+	// Path — путь файла объекта относительно корня, части через "/"
+	Path(key string) string
+	// Walk — вызывает fn для ключей объектов под root, начинающихся с prefix. Может
+	// вызвать fn и для других ключей, если отсечь их дороже, чем отфильтровать
+	Walk(root, prefix string, fn func(key string) error) error
+}
+
+// newKeyMapper — раскладка по флагу -shard-width: плоская или по хэшу ключа
+func newKeyMapper(shardWidth int) KeyMapper {
+	if shardWidth == 0 {
+		return IdentityMapper{}
+	}
+	return HashedMapper{Width: shardWidth}
+}
+
+// IdentityMapper — плоская раскладка: путь файла совпадает с ключом, вложенный ключ
+// "a/b/c" лежит в директориях a/b
+type IdentityMapper struct{}
+
+// Path — ключ и есть путь
+func (IdentityMapper) Path(key string) string {
+	return key
+}
+
+// Walk — обходит только директорию префикса: вне её объектов с таким префиксом нет
+func (IdentityMapper) Walk(root, prefix string, fn func(key string) error) error {
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		dir := prefix[:i]
+		// Нет такой директории (или на её месте объект) — под префиксом ничего нет
+		if info, err := os.Stat(root + "/" + dir); err != nil || !info.IsDir() {
+			return nil
+		}
+		return readDirBatches(root+"/"+dir, func(e os.DirEntry) error {
+			return walkKeys(root+"/"+dir, e, dir+"/", fn)
+		})
+	}
+	return readDirBatches(root, func(e os.DirEntry) error {
+		// Служебные поддиректории (например, метаданные) не являются объектами
+		if e.Name()[0] == '.' {
+			return nil
+		}
+		return walkKeys(root, e, "", fn)
+	})
+}
+
+// HashedMapper — раскладка по хэшу: объект лежит в поддиректории из первых Width
+// hex-символов MD5 ключа, чтобы в одной директории не скапливались миллионы файлов
+type HashedMapper struct {
+	Width int
+}
+
+// Path — поддиректория по хэшу ключа, затем сам ключ
+func (m HashedMapper) Path(key string) string {
+	sum := md5.Sum([]byte(key))
+	return hex.EncodeToString(sum[:])[:m.Width] + "/" + key
+}
+
+// Walk — ключи с общим префиксом разбросаны по всем поддиректориям, поэтому обходятся все
+func (m HashedMapper) Walk(root, prefix string, fn func(key string) error) error {
+	return readDirBatches(root, func(e os.DirEntry) error {
+		// При раскладке по хэшу объекты лежат только внутри поддиректорий
+		if e.Name()[0] == '.' || !e.IsDir() || len(e.Name()) != m.Width {
+			return nil
+		}
+		return readDirBatches(root+"/"+e.Name(), func(f os.DirEntry) error {
+			return walkKeys(root+"/"+e.Name(), f, "", fn)
+		})
+	})
+}
+
+// objectPath — путь к файлу объекта на диске (под корнем по типу содержимого, см. -type-dirs)
+func (s *Storage) objectPath(key string) string {
+	return s.objectRoot(key) + "/" + s.mapper.Path(key)
+}
+
+// DIR_BATCH — СКОЛЬКО ЗАПИСЕЙ ДИРЕКТОРИИ ЧИТАТЬ ЗА РАЗ ПРИ ОБХОДЕ
+const DIR_BATCH = 1024
+
+// diskKeys — список ключей всех объектов, сохранённых на диске
+func (s *Storage) diskKeys() ([]string, error) {
+	keys := make([]string, 0)
+	err := s.walkDiskKeys(func(key string) error {
+		keys = append(keys, key)
+		return nil
+	})
+	return keys, err
+}
+
+// walkDiskKeys — обходит ключи сохранённых объектов, включая вложенные ("a/b/c").
+// На диске директории читаются порциями, поэтому память не зависит от числа объектов.
+func (s *Storage) walkDiskKeys(fn func(key string) error) error {
+	return s.backend.Walk("", fn)
+}
+
+// walkPrefixKeys — обходит ключи объектов на диске, начинающиеся с prefix; сколько
+// директорий при этом читается, зависит от раскладки
+func (s *Storage) walkPrefixKeys(prefix string, fn func(key string) error) error {
+	return s.backend.Walk(prefix, func(key string) error {
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		return fn(key)
+	})
+}
+
+// walkRoots — обходит ключи под каждым корнем объектов. Файл, которому по -type-dirs
+// место под другим корнем, объектом не считается: по его ключу он не читается.
+func (s *Storage) walkRoots(prefix string, fn func(key string) error) error {
+	roots := s.objectRoots()
+	if len(roots) == 1 {
+		return s.mapper.Walk(storageDir, prefix, fn)
+	}
+	for _, root := range roots {
+		err := s.mapper.Walk(root, prefix, func(key string) error {
+			if s.objectRoot(key) != root {
+				return nil
+			}
+			return fn(key)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkKeys — вызывает fn для ключа файла e или рекурсивно для всех файлов директории e
+func walkKeys(dir string, e os.DirEntry, prefix string, fn func(key string) error) error {
+	key := prefix + e.Name()
+	if !e.IsDir() {
+		return fn(key)
+	}
+	return readDirBatches(dir+"/"+e.Name(), func(f os.DirEntry) error {
+		return walkKeys(dir+"/"+e.Name(), f, key+"/", fn)
+	})
+}
+
+// readDirBatches — вызывает fn для каждой записи директории, читая её порциями по DIR_BATCH
+func readDirBatches(path string, fn func(e os.DirEntry) error) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	for {
+		entries, err := dir.ReadDir(DIR_BATCH)
+		for _, e := range entries {
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestShardLayout(t *testing.T) {
+	keys := []string{"a", "b/c", "photo.jpg"}
+	tests := []struct {
+		width int
+		path  func(key string) string
+	}{
+		{0, func(key string) string { return key }},
+		{1, HashedMapper{Width: 1}.Path},
+		{2, HashedMapper{Width: 2}.Path},
+		{MAX_SHARD_WIDTH, HashedMapper{Width: MAX_SHARD_WIDTH}.Path},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		width := []string{"-storage-dir", dir, "-shard-width", strconv.Itoa(tt.width)}
+		ts, _ := newTestServer(t, width...)
+		for _, key := range keys {
+			upload(t, ts, key, "data "+key)
+			if _, err := os.Stat(dir + "/" + tt.path(key)); err != nil {
+				t.Errorf("width %d: object %s is not at %s: %v", tt.width, key, tt.path(key), err)
+			}
+		}
+
+		// Новый сервер над той же директорией находит объекты обходом раскладки, а не по кэшу
+		ts, storage := newTestServer(t, width...)
+		if got := listNames(t, ts, ""); !reflect.DeepEqual(got, keys) {
+			t.Errorf("width %d: list = %v, want %v", tt.width, got, keys)
+		}
+		var prefixed []string
+		storage.walkPrefixKeys("b/", func(key string) error {
+			prefixed = append(prefixed, key)
+			return nil
+		})
+		if !reflect.DeepEqual(prefixed, []string{"b/c"}) {
+			t.Errorf("width %d: keys with prefix b/ = %v, want [b/c]", tt.width, prefixed)
+		}
+		for _, key := range keys {
+			if resp, body := do(t, ts, http.MethodGet, "/download/"+key, ""); resp.StatusCode != http.StatusOK || body != "data "+key {
+				t.Errorf("width %d: download %s: %d %q", tt.width, key, resp.StatusCode, body)
+			}
+		}
+	}
+}
+
+func TestShardWidthValidation(t *testing.T) {
+	for _, width := range []string{"-1", "5"} {
+		if _, err := ParseConfig([]string{"-shard-width", width}); err == nil {
+			t.Errorf("-shard-width %s accepted, want error", width)
+		}
+	}
+}
+
+func TestKeyMapperWalk(t *testing.T) {
+	keys := []string{"a", "ab", "b/c", "b/d/e", "photo.jpg"}
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{"", keys},
+		{"a", []string{"a", "ab"}},
+		{"b/", []string{"b/c", "b/d/e"}},
+		{"b/d/", []string{"b/d/e"}},
+		{"missing/", nil},
+		// На месте директории префикса объект — под префиксом ничего нет
+		{"a/", nil},
+	}
+	for _, mapper := range []KeyMapper{IdentityMapper{}, HashedMapper{Width: 1}, HashedMapper{Width: 3}} {
+		root := t.TempDir()
+		for _, key := range keys {
+			path := root + "/" + mapper.Path(key)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(key), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// Служебные директории под корнем объектами не считаются
+		if err := os.MkdirAll(root+"/.meta/x", 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(root+"/.meta/x/y", nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, tt := range tests {
+			var got []string
+			err := mapper.Walk(root, tt.prefix, func(key string) error {
+				// Walk может выдать и лишние ключи, отсеиваются они вызывающим
+				if strings.HasPrefix(key, tt.prefix) {
+					got = append(got, key)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("%T: Walk(%q): %v", mapper, tt.prefix, err)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%T%+v: Walk(%q) = %v, want %v", mapper, mapper, tt.prefix, got, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"time"
+)
+
+// streamWriter — ответ с буфером заданного размера, который отправляется клиенту
+// целиком при заполнении и не реже чем раз в interval. На медленных каналах клиент
+// получает данные равномерно, а не редкими большими порциями.
+type streamWriter struct {
+	http.ResponseWriter
+	buf      *bufio.Writer
+	interval time.Duration // 0 — отправлять только при заполнении буфера
+	last     time.Time     // Когда буфер последний раз отправлялся клиенту
+}
+
+// newStreamWriter — оборачивает ответ буфером size байт
+func newStreamWriter(w http.ResponseWriter, size int, interval time.Duration) *streamWriter {
+	return &streamWriter{ResponseWriter: w, buf: bufio.NewWriterSize(w, size), interval: interval, last: time.Now()}
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	n, err := s.buf.Write(p)
+	if err == nil && s.interval > 0 && time.Since(s.last) >= s.interval {
+		s.Flush()
+	}
+	return n, err
+}
+
+// Flush — отправляет клиенту всё накопленное в буфере
+func (s *streamWriter) Flush() {
+	s.buf.Flush()
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+	s.last = time.Now()
+}
+
+// Unwrap — даёт http.ResponseController добраться до исходного ответа
+func (s *streamWriter) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
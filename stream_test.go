@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// chunkRecorder — ответ, запоминающий каждую порцию, дошедшую до соединения
+type chunkRecorder struct {
+	*httptest.ResponseRecorder
+	chunks []string
+}
+
+func (c *chunkRecorder) Write(p []byte) (int, error) {
+	c.chunks = append(c.chunks, string(p))
+	return c.ResponseRecorder.Write(p)
+}
+
+func TestStreamWriter(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int
+		interval time.Duration
+		writes   []string
+		chunks   []string
+	}{
+		{"by buffer size", 4, 0, []string{"ab", "cd", "ef"}, []string{"abcd", "ef"}},
+		{"larger than buffer", 4, 0, []string{"abcdefgh", "i"}, []string{"abcdefgh", "i"}},
+		// Интервал меньше паузы между записями: каждая уходит сразу
+		{"by interval", 1024, time.Nanosecond, []string{"ab", "cd", "ef"}, []string{"ab", "cd", "ef"}},
+	}
+	for _, tt := range tests {
+		rec := &chunkRecorder{ResponseRecorder: httptest.NewRecorder()}
+		sw := newStreamWriter(rec, tt.size, tt.interval)
+		for _, w := range tt.writes {
+			time.Sleep(time.Millisecond)
+			sw.Write([]byte(w))
+		}
+		sw.Flush()
+		if !reflect.DeepEqual(rec.chunks, tt.chunks) {
+			t.Errorf("%s: chunks %q, want %q", tt.name, rec.chunks, tt.chunks)
+		}
+		if !rec.Flushed {
+			t.Errorf("%s: Flush did not reach the connection", tt.name)
+		}
+	}
+}
+
+func TestStreamBufferDownload(t *testing.T) {
+	ts, _ := newTestServer(t, "-stream-buffer", "16", "-stream-flush", "10ms")
+	body := strings.Repeat("0123456789", 100)
+	upload(t, ts, "obj", body)
+	tests := []struct {
+		header []string
+		status int
+		body   string
+	}{
+		{nil, http.StatusOK, body},
+		{[]string{"Range", "bytes=5-24"}, http.StatusPartialContent, body[5:25]},
+	}
+	for _, tt := range tests {
+		resp, got := do(t, ts, http.MethodGet, "/download/obj", "", tt.header...)
+		if resp.StatusCode != tt.status || got != tt.body {
+			t.Errorf("GET %v: %d, %d bytes, want %d, %d bytes", tt.header, resp.StatusCode, len(got), tt.status, len(tt.body))
+		}
+	}
+	for _, args := range [][]string{{"-stream-buffer", "-1"}, {"-stream-flush", "-1s"}} {
+		if _, err := ParseConfig(args); err == nil {
+			t.Errorf("%v is accepted", args)
+		}
+	}
+}
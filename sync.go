@@ -0,0 +1,27 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"time"
+)
+
+// IF_NEWER_HEADER — ЗАГОЛОВОК ЗАГРУЗКИ С ВРЕМЕНЕМ ИЗМЕНЕНИЯ ИСХОДНОГО ОБЪЕКТА (HTTP-ДАТА)
+const IF_NEWER_HEADER = "X-If-Newer"
+
+// sourceIsNewer — нужно ли копировать объект при односторонней синхронизации:
+// объекта ещё нет, либо источник изменён позже него и отличается содержимым.
+// exists сообщает, есть ли объект сейчас, чтобы копия могла его перезаписать.
+func (s *Storage) sourceIsNewer(key string, data []byte, modified time.Time) (newer, exists bool) {
+	_, current, exists := s.objectStat(key)
+	if !exists {
+		return true, false
+	}
+	// HTTP-дата точна до секунды, поэтому и время объекта сравнивается с точностью до секунды
+	if !modified.After(current.Truncate(time.Second)) {
+		return false, true
+	}
+	sum := md5.Sum(data)
+	etag, err := s.ETag(key)
+	return err != nil || etag != `"`+hex.EncodeToString(sum[:])+`"`, true
+}
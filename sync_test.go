@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestUploadIfNewer(t *testing.T) {
+	ts, _ := newTestServer(t)
+	past := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	future := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		modified string
+		status   int
+		content  string
+	}{
+		{"missing object", "/upload/obj", "v1", past, http.StatusCreated, "v1"},
+		{"older source", "/upload/obj", "v2", past, http.StatusNotModified, "v1"},
+		{"newer source, same content", "/upload/obj", "v1", future, http.StatusNotModified, "v1"},
+		{"newer source", "/upload/obj", "v2", future, http.StatusOK, "v2"},
+		{"bad date", "/upload/obj", "v3", "yesterday", http.StatusBadRequest, "v2"},
+	}
+	for _, tt := range tests {
+		if resp, body := do(t, ts, http.MethodPost, tt.path, tt.body, IF_NEWER_HEADER, tt.modified); resp.StatusCode != tt.status {
+			t.Errorf("%s: %d %s, want %d", tt.name, resp.StatusCode, body, tt.status)
+		}
+		if _, body := do(t, ts, http.MethodGet, "/download/obj", ""); body != tt.content {
+			t.Errorf("%s: object is %q, want %q", tt.name, body, tt.content)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	RATE_PARAM     = "rate"   // ПАРАМЕТР, КОТОРЫМ КЛИЕНТ САМ СНИЖАЕТ СКОРОСТЬ СВОЕГО СКАЧИВАНИЯ
+	SIGNED_RATE    = "X-Rate" // ПАРАМЕТР ПОДПИСАННОЙ ССЫЛКИ СО СКОРОСТЬЮ СКАЧИВАНИЯ ВМЕСТО -download-rate
+	THROTTLE_TICKS = 10       // НА СКОЛЬКО ПОРЦИЙ В СЕКУНДУ ДЕЛИТСЯ ОГРАНИЧЕННАЯ ОТДАЧА
+)
+
+// throttledReader — содержимое объекта, читаемое не быстрее rate байт в секунду.
+// Чтение идёт порциями по rate/THROTTLE_TICKS, и после каждой порции читатель ждёт,
+// пока прочитанное не уложится в скорость, поэтому данные уходят равномерно, а
+// одно большое скачивание не занимает весь канал. Seek не ограничивается: им
+// ServeContent лишь узнаёт размер и переходит к диапазону Range.
+type throttledReader struct {
+	io.ReadSeeker
+	ctx   context.Context
+	rate  int64     // Байт в секунду
+	start time.Time // Когда началось чтение
+	read  int64     // Сколько прочитано с начала
+}
+
+// newThrottledReader — ограничивает чтение из r скоростью rate байт в секунду; ожидание
+// прерывается отменой ctx (клиент отключился или сервер останавливается)
+func newThrottledReader(ctx context.Context, r io.ReadSeeker, rate int64) *throttledReader {
+	return &throttledReader{ReadSeeker: r, ctx: ctx, rate: rate}
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if t.start.IsZero() {
+		t.start = time.Now()
+	}
+	chunk := t.rate / THROTTLE_TICKS
+	if chunk < 1 {
+		chunk = 1
+	}
+	if int64(len(p)) > chunk {
+		p = p[:chunk]
+	}
+	n, err := t.ReadSeeker.Read(p)
+	t.read += int64(n)
+
+	due := t.start.Add(time.Duration(float64(t.read) / float64(t.rate) * float64(time.Second)))
+	if wait := time.Until(due); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-t.ctx.Done():
+			return n, t.ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return n, err
+}
+
+// downloadRate — ограничение скорости скачивания для запроса: выбранное WithDownloadRate,
+// а для остальных маршрутов отдачи (S3, стартовая страница) — -download-rate. 0 — без ограничения.
+func downloadRate(r *http.Request, storage *Storage) int64 {
+	if rate, ok := r.Context().Value(rateKey).(int64); ok {
+		return rate
+	}
+	return storage.downloadRate
+}
+
+// rateSignature — HMAC-подпись ссылки на скачивание со скоростью rate. Подпись
+// отличается от подписи ссылки на загрузку методом, так что одну нельзя выдать за другую.
+func rateSignature(secret, path string, expires, rate int64) string {
+	return presignSignature(secret, http.MethodGet, path, expires, RATE_PARAM+"="+strconv.FormatInt(rate, 10))
+}
+
+// WithDownloadRate — выбирает ограничение скорости скачивания: -download-rate (global),
+// скорость из подписанной ссылки (X-Rate, её выдаёт администратор и она может быть выше
+// общей или без ограничения — 0) и, наконец, ?rate=, которым клиент может только снизить
+// скорость. Неверная или просроченная подпись — 403.
+func WithDownloadRate(auth *Auth, global int64, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		rate := global
+		if v := q.Get(SIGNED_RATE); v != "" {
+			signed, err := strconv.ParseInt(v, 10, 64)
+			expires, eerr := strconv.ParseInt(q.Get("X-Expires"), 10, 64)
+			valid := auth.Enabled() && err == nil && signed >= 0 && eerr == nil && time.Now().Unix() <= expires &&
+				hmac.Equal([]byte(q.Get("X-Signature")), []byte(rateSignature(auth.apiKey, tenantPath(r, r.URL.Path), expires, signed)))
+			if !valid {
+				http.Error(w, "Подпись ссылки недействительна или срок её действия истёк", http.StatusForbidden)
+				return
+			}
+			rate = signed
+		}
+		if v := q.Get(RATE_PARAM); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n <= 0 {
+				http.Error(w, "rate должен быть положительным числом байт в секунду", http.StatusBadRequest)
+				return
+			}
+			if rate == 0 || n < rate {
+				rate = n
+			}
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), rateKey, rate)))
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThrottledReader(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 300)
+	r := newThrottledReader(context.Background(), bytes.NewReader(data), 1000)
+	start := time.Now()
+	buf := make([]byte, len(data))
+	// Одно чтение отдаёт не больше порции rate/THROTTLE_TICKS
+	if n, _ := r.Read(buf); n != 1000/THROTTLE_TICKS {
+		t.Errorf("first read = %d bytes, want %d", n, 1000/THROTTLE_TICKS)
+	}
+	rest, err := io.ReadAll(r)
+	if err != nil || len(rest) != len(data)-1000/THROTTLE_TICKS {
+		t.Fatalf("ReadAll = %d bytes, %v", len(rest), err)
+	}
+	// 300 байт при 1000 байт в секунду — не быстрее 0,3 секунды
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("300 bytes at 1000 B/s took %v", elapsed)
+	}
+
+	// Отмена прерывает ожидание
+	ctx, cancel := context.WithCancel(context.Background())
+	r = newThrottledReader(ctx, bytes.NewReader(data), 10)
+	cancel()
+	start = time.Now()
+	if _, err := io.ReadAll(r); err != context.Canceled || time.Since(start) > time.Second {
+		t.Errorf("canceled read: %v after %v", err, time.Since(start))
+	}
+}
+
+func TestWithDownloadRate(t *testing.T) {
+	on, off := NewAuth(&Config{APIKey: "secret"}), NewAuth(&Config{})
+	expires := time.Now().Add(time.Hour).Unix()
+	signed := func(rate int64, expires int64) string {
+		return "X-Expires=" + strconv.FormatInt(expires, 10) + "&X-Rate=" + strconv.FormatInt(rate, 10) +
+			"&X-Signature=" + rateSignature("secret", "/download/obj", expires, rate)
+	}
+	tests := []struct {
+		name   string
+		auth   *Auth
+		global int64
+		query  string
+		status int
+		rate   int64
+	}{
+		{"global", on, 1000, "", http.StatusOK, 1000},
+		{"unlimited", on, 0, "", http.StatusOK, 0},
+		{"client lowers", on, 1000, "rate=500", http.StatusOK, 500},
+		{"client cannot raise", on, 1000, "rate=5000", http.StatusOK, 1000},
+		{"client limits unlimited", on, 0, "rate=500", http.StatusOK, 500},
+		{"zero rate", on, 1000, "rate=0", http.StatusBadRequest, 0},
+		{"bad rate", on, 1000, "rate=fast", http.StatusBadRequest, 0},
+		{"signed unlimited", on, 1000, signed(0, expires), http.StatusOK, 0},
+		{"signed higher", on, 1000, signed(5000, expires), http.StatusOK, 5000},
+		{"signed then lowered", on, 1000, signed(5000, expires) + "&rate=100", http.StatusOK, 100},
+		{"tampered rate", on, 1000, strings.Replace(signed(5000, expires), "X-Rate=5000", "X-Rate=9000", 1), http.StatusForbidden, 0},
+		{"expired", on, 1000, signed(0, time.Now().Add(-time.Minute).Unix()), http.StatusForbidden, 0},
+		{"auth disabled", off, 1000, signed(0, expires), http.StatusForbidden, 0},
+	}
+	for _, tt := range tests {
+		var rate int64 = -1
+		h := WithDownloadRate(tt.auth, tt.global, func(w http.ResponseWriter, r *http.Request) {
+			rate = downloadRate(r, nil)
+		})
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodGet, "/download/obj?"+tt.query, nil))
+		if rec.Code != tt.status {
+			t.Errorf("%s: %d, want %d", tt.name, rec.Code, tt.status)
+			continue
+		}
+		if tt.status == http.StatusOK && rate != tt.rate {
+			t.Errorf("%s: rate %d, want %d", tt.name, rate, tt.rate)
+		}
+	}
+}
+
+func TestSignedDownloadRate(t *testing.T) {
+	ts, _ := newTestServer(t, "-api-key", "secret", "-users", "alice:a-key", "-download-rate", "100")
+	admin := []string{"Authorization", "Bearer secret"}
+	body := strings.Repeat("x", 50)
+	upload(t, ts, "obj", body, admin...)
+	timed := func(path string) time.Duration {
+		start := time.Now()
+		if resp, got := do(t, ts, http.MethodGet, path, "", admin...); resp.StatusCode != http.StatusOK || got != body {
+			t.Fatalf("GET %s: %d %q", path, resp.StatusCode, got)
+		}
+		return time.Since(start)
+	}
+
+	// Ссылку со своей скоростью выдаёт только администратор
+	for _, tt := range []struct {
+		name   string
+		query  string
+		header []string
+		status int
+	}{
+		{"user", "?method=GET", []string{"Authorization", "Bearer a-key"}, http.StatusForbidden},
+		{"anonymous", "?method=GET", nil, http.StatusUnauthorized},
+		{"bad rate", "?method=GET&rate=-1", admin, http.StatusBadRequest},
+	} {
+		if resp, msg := do(t, ts, http.MethodGet, "/presign/obj"+tt.query, "", tt.header...); resp.StatusCode != tt.status {
+			t.Errorf("presign %s: %d %s, want %d", tt.name, resp.StatusCode, msg, tt.status)
+		}
+	}
+	resp, msg := do(t, ts, http.MethodGet, "/presign/obj?method=GET&rate=0", "", admin...)
+	var link struct{ Method, URL string }
+	if resp.StatusCode != http.StatusOK || json.Unmarshal([]byte(msg), &link) != nil || link.Method != http.MethodGet {
+		t.Fatalf("presign GET: %d %s", resp.StatusCode, msg)
+	}
+
+	// 50 байт при -download-rate 100 — не быстрее полусекунды, по ссылке — без ограничения
+	if elapsed := timed("/download/obj"); elapsed < 400*time.Millisecond {
+		t.Errorf("download at 100 B/s took %v", elapsed)
+	}
+	if elapsed := timed(link.URL); elapsed > 300*time.Millisecond {
+		t.Errorf("signed unlimited download took %v", elapsed)
+	}
+	if _, err := ParseConfig([]string{"-download-rate", "-1"}); err == nil {
+		t.Error("ParseConfig accepted a negative -download-rate")
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// storageDir — директория для хранения объектов (флаг -storage-dir)
+var storageDir = STORAGE_DIR
+
+// storagePath — путь к служебному файлу или директории name в хранилище
+func storagePath(name string) string {
+	return storageDir + "/" + name
+}
+
+// tmpDir — директория для временных файлов (флаг -temp-dir), по умолчанию TMP_DIR хранилища
+var tmpDir = STORAGE_DIR + "/" + TMP_DIR
+
+// tusDir — директория для незавершённых возобновляемых загрузок
+func tusDir() string {
+	return tmpDir + "/tus"
+}
+
+// checkServiceDir — проверяет директорию из -temp-dir или -type-dirs: внутри хранилища
+// root её файлы допустимы только в служебной директории верхнего уровня (с точкой
+// в начале имени), иначе они попадут в список объектов
+func checkServiceDir(root, dir string) error {
+	if !filepath.IsAbs(dir) {
+		return fmt.Errorf("directory must be an absolute path")
+	}
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return nil
+	}
+	if rel == "." || rel[0] != '.' {
+		return fmt.Errorf("directory inside %s must be a top-level directory starting with a dot", root)
+	}
+	return nil
+}
+
+// warnCrossDevice — предупреждает, если временные файлы лежат на другой ФС, чем
+// хранилище: там rename невозможен, и готовые загрузки копируются, а не перемещаются
+func warnCrossDevice() {
+	probe, err := os.CreateTemp(tmpDir, "probe-*")
+	if err != nil {
+		log.Printf("Ошибка проверки директории временных файлов %s: %v", tmpDir, err)
+		return
+	}
+	probe.Close()
+	defer os.Remove(probe.Name())
+
+	dst := storagePath(TMP_DIR) + "/" + filepath.Base(probe.Name())
+	err = os.Rename(probe.Name(), dst)
+	if errors.Is(err, syscall.EXDEV) {
+		log.Printf("Предупреждение: %s и %s на разных файловых системах, завершённые загрузки будут копироваться", tmpDir, storageDir)
+		return
+	}
+	os.Remove(dst)
+}
+
+// moveFile — перемещает временный файл в хранилище. Между файловыми системами rename
+// невозможен, тогда файл копируется в staging (на ФС хранилища) и уже оттуда
+// переименовывается, так что объект и тогда появляется целиком
+func moveFile(src, dst, staging string) error {
+	err := os.Rename(src, dst)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.CreateTemp(staging, "move-*")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(out.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(out.Name(), dst)
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return err
+	}
+	return os.Remove(src)
+}
+
+// writeFileAtomic — записывает файл объекта через временный файл в staging (на той же ФС)
+// и переименование: после прерванной или неудачной записи (нет места, ошибка диска)
+// не остаётся ни обрезанного объекта, ни временного файла, а прежнее содержимое
+// сохраняется целиком. С durable файл перед переименованием сбрасывается на диск (fsync).
+func writeFileAtomic(staging, path string, data []byte, durable bool) error {
+	out, err := os.CreateTemp(staging, "write-*")
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(data)
+	if err == nil && durable {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(out.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(out.Name(), path)
+	}
+	if err != nil {
+		os.Remove(out.Name())
+	}
+	return err
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// crossDeviceDir — временная директория на другой ФС, чем t.TempDir(); без такой ФС тест пропускается
+func crossDeviceDir(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("/dev/shm", "temp-dir-")
+	if err != nil {
+		t.Skipf("no second file system: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	probe := dir + "/probe"
+	if err := os.WriteFile(probe, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(probe, t.TempDir()+"/probe"); !errors.Is(err, syscall.EXDEV) {
+		t.Skipf("%s is on the same file system as the test directory: %v", dir, err)
+	}
+	return dir
+}
+
+func TestMoveFile(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"same file system", t.TempDir()},
+		{"cross device", crossDeviceDir(t)},
+	}
+	for _, tt := range tests {
+		dir, staging := t.TempDir(), t.TempDir()
+		src, dst := tt.src+"/upload", dir+"/obj"
+		if err := os.WriteFile(src, []byte("data"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := moveFile(src, dst, staging); err != nil {
+			t.Fatalf("%s: moveFile: %v", tt.name, err)
+		}
+		if data, err := os.ReadFile(dst); err != nil || string(data) != "data" {
+			t.Errorf("%s: moved file %q, %v", tt.name, data, err)
+		}
+		if _, err := os.Stat(src); !os.IsNotExist(err) {
+			t.Errorf("%s: source is still there: %v", tt.name, err)
+		}
+		// Промежуточная копия переименована, а не оставлена в staging
+		if entries, _ := os.ReadDir(staging); len(entries) != 0 {
+			t.Errorf("%s: staging dir is not empty: %v", tt.name, entries)
+		}
+	}
+}
+
+func TestCrossDeviceTempDir(t *testing.T) {
+	logs := captureLog(t)
+	ts, _ := newTestServer(t, "-temp-dir", crossDeviceDir(t))
+	warnCrossDevice()
+	if !strings.Contains(logs.String(), "на разных файловых системах") {
+		t.Errorf("no cross-device warning in the log:\n%s", logs.String())
+	}
+
+	// Завершённая возобновляемая загрузка копируется в хранилище
+	tus := []string{"Tus-Resumable", TUS_VERSION}
+	resp, _ := do(t, ts, http.MethodPost, "/files/", "", append([]string{"Upload-Length", "4", "Upload-Metadata", "key " + base64.StdEncoding.EncodeToString([]byte("obj"))}, tus...)...)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create upload: %d", resp.StatusCode)
+	}
+	if resp, body := do(t, ts, http.MethodPatch, resp.Header.Get("Location"), "data", append([]string{"Content-Type", TUS_CHUNK_TYPE, "Upload-Offset", "0"}, tus...)...); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("upload chunk: %d %s", resp.StatusCode, body)
+	}
+	if resp, body := do(t, ts, http.MethodGet, "/download/obj", ""); resp.StatusCode != http.StatusOK || body != "data" {
+		t.Errorf("download of copied upload: %d %q", resp.StatusCode, body)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(dir string) (staging, path string)
+		durable  bool
+		fails    bool
+		previous string // Содержимое, которое должно остаться под path
+	}{
+		{"new file", func(dir string) (string, string) { return dir, dir + "/obj" }, false, false, ""},
+		{"replace durable", func(dir string) (string, string) {
+			os.WriteFile(dir+"/obj", []byte("old"), 0644)
+			return dir, dir + "/obj"
+		}, true, false, ""},
+		{"no staging dir", func(dir string) (string, string) {
+			os.WriteFile(dir+"/obj", []byte("old"), 0644)
+			return dir + "/missing", dir + "/obj"
+		}, false, true, "old"},
+		{"rename fails", func(dir string) (string, string) {
+			os.MkdirAll(dir+"/obj/sub", 0755)
+			return dir, dir + "/obj"
+		}, false, true, ""},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		staging, path := tt.setup(dir)
+		err := writeFileAtomic(staging, path, []byte("data"), tt.durable)
+		if (err != nil) != tt.fails {
+			t.Fatalf("%s: writeFileAtomic: %v, want failure %v", tt.name, err, tt.fails)
+		}
+		if !tt.fails {
+			if data, err := os.ReadFile(path); err != nil || string(data) != "data" {
+				t.Errorf("%s: written file %q, %v", tt.name, data, err)
+			}
+			if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0644 {
+				t.Errorf("%s: file mode %v, %v, want 0644", tt.name, info.Mode().Perm(), err)
+			}
+		} else if tt.previous != "" {
+			if data, err := os.ReadFile(path); err != nil || string(data) != tt.previous {
+				t.Errorf("%s: previous content %q, %v, want %q", tt.name, data, err, tt.previous)
+			}
+		}
+		// Временный файл не остаётся ни после записи, ни после ошибки
+		if leftovers, _ := filepath.Glob(dir + "/write-*"); len(leftovers) != 0 {
+			t.Errorf("%s: temp files left: %v", tt.name, leftovers)
+		}
+	}
+
+	// Загрузки и перезаписи через сервер тоже не оставляют временных файлов
+	ts, _ := newTestServer(t)
+	upload(t, ts, "obj", "old")
+	if resp, _ := do(t, ts, http.MethodPut, "/upload/obj", "new", "If-Match", "*"); resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		t.Fatalf("overwrite: %d", resp.StatusCode)
+	}
+	if data, err := os.ReadFile(storagePath("obj")); err != nil || string(data) != "new" {
+		t.Errorf("stored object %q, %v", data, err)
+	}
+	if leftovers, _ := filepath.Glob(storagePath(TMP_DIR) + "/write-*"); len(leftovers) != 0 {
+		t.Errorf("temp files left in the storage: %v", leftovers)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+const TOUCH_PREFIX_LEN = len("/touch/") // ДЛИНА ПРЕФИКСА ДЛЯ МАРШРУТА ОБНОВЛЕНИЯ ВРЕМЕНИ ИЗМЕНЕНИЯ
+
+// Touch — переносит время изменения объекта на текущее, не трогая содержимое (и ETag),
+// как touch(1): объект считается свежим для вытеснения из кэша и для очистки
+// по времени изменения. Возвращает новое время изменения.
+func (s *Storage) Touch(key string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.exists(key) {
+		return time.Time{}, os.ErrNotExist
+	}
+
+	now := time.Now()
+	if s.wb != nil {
+		s.wb.flushMu.Lock()
+		defer s.wb.flushMu.Unlock()
+	}
+	if o, ok := s.wbPending(key); ok {
+		// Объект ещё не на диске, а файл при сбросе получит время сброса — не раньше текущего
+		o.modTime = now
+		s.wb.add(o)
+	} else if err := s.backend.Touch(key, now); err != nil {
+		return time.Time{}, err
+	}
+	s.cache.Touch(key, now)
+	return now, nil
+}
+
+// HandleTouch — обработчик для обновления времени изменения объекта: POST /touch/<key>
+func HandleTouch(w http.ResponseWriter, r *http.Request, storage *Storage) {
+	key := storage.RequestKey(r, r.URL.Path[TOUCH_PREFIX_LEN:])
+	if !checkKey(w, key) {
+		return
+	}
+	if !storage.Exists(key) {
+		http.Error(w, "Объект не найден", http.StatusNotFound)
+		return
+	}
+	if !authorizeObject(w, r, storage, key, true) || !checkLease(w, r, storage, key) {
+		return
+	}
+
+	modTime, err := storage.Touch(key)
+	if os.IsNotExist(err) {
+		http.Error(w, "Объект не найден", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Ошибка обновления времени изменения %s: %v", logKey(key), logErr(err))
+		http.Error(w, "Ошибка обновления объекта", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Время изменения объекта %s обновлено", clientKey(r, key))
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestHandleTouch(t *testing.T) {
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, args := range [][]string{nil, {"-write-back"}} {
+		ts, storage := newTestServer(t, append([]string{"-api-key", "secret", "-users", "alice:a-key,bob:b-key"}, args...)...)
+		alice := []string{"Authorization", "Bearer a-key"}
+		upload(t, ts, "obj", "data", alice...)
+		if args == nil {
+			if err := os.Chtimes(storage.objectPath("obj"), old, old); err != nil {
+				t.Fatal(err)
+			}
+			storage.cache.Touch("obj", old)
+		}
+		resp, _ := do(t, ts, http.MethodHead, "/download/obj", "", alice...)
+		etag := resp.Header.Get("ETag")
+
+		tests := []struct {
+			name   string
+			method string
+			path   string
+			header []string
+			status int
+		}{
+			{"other user", http.MethodPost, "/touch/obj", []string{"Authorization", "Bearer b-key"}, http.StatusForbidden},
+			{"anonymous", http.MethodPost, "/touch/obj", nil, http.StatusUnauthorized},
+			{"wrong method", http.MethodGet, "/touch/obj", alice, http.StatusMethodNotAllowed},
+			{"missing", http.MethodPost, "/touch/missing", alice, http.StatusNotFound},
+			{"owner", http.MethodPost, "/touch/obj", alice, http.StatusOK},
+		}
+		var touched string
+		for _, tt := range tests {
+			resp, body := do(t, ts, tt.method, tt.path, "", tt.header...)
+			if resp.StatusCode != tt.status {
+				t.Errorf("%v: %s: %d %s, want %d", args, tt.name, resp.StatusCode, body, tt.status)
+			}
+			if tt.status == http.StatusOK {
+				touched = resp.Header.Get("Last-Modified")
+			}
+		}
+		modified, err := http.ParseTime(touched)
+		if err != nil || !modified.After(old) {
+			t.Fatalf("%v: Last-Modified after touch %q, %v", args, touched, err)
+		}
+
+		// Содержимое и ETag те же, время изменения — новое
+		resp, body := do(t, ts, http.MethodGet, "/download/obj", "", alice...)
+		if body != "data" || resp.Header.Get("ETag") != etag || resp.Header.Get("Last-Modified") != touched {
+			t.Errorf("%v: after touch: %q, ETag %s (was %s), Last-Modified %s (touch %s)", args, body,
+				resp.Header.Get("ETag"), etag, resp.Header.Get("Last-Modified"), touched)
+		}
+		if _, err := storage.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if info, err := os.Stat(storage.objectPath("obj")); err != nil || info.ModTime().Before(modified) {
+			t.Errorf("%v: file on disk: %v, %v; want modified at %v or later", args, info.ModTime(), err, modified)
+		}
+	}
+}
+
+func TestTouchEviction(t *testing.T) {
+	ts, storage := newTestServer(t, "-cache-size", "8")
+	upload(t, ts, "a", "1234")
+	upload(t, ts, "b", "1234")
+	// После touch давно не использованным остаётся b, его и вытесняет новый объект
+	if resp, _ := do(t, ts, http.MethodPost, "/touch/a", ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("touch: %d", resp.StatusCode)
+	}
+	upload(t, ts, "c", "1234")
+	for key, cached := range map[string]bool{"a": true, "b": false, "c": true} {
+		if got := storage.cache.Contains(key); got != cached {
+			t.Errorf("%s cached %v, want %v", key, got, cached)
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// Реализация протокола возобновляемых загрузок tus 1.0.0 (https://tus.io/protocols/resumable-upload)
+// с расширением creation. Незавершённые загрузки хранятся во временной директории
+// и по завершении перемещаются в хранилище как обычные объекты.
+const (
+	TUS_VERSION    = "1.0.0"         // ПОДДЕРЖИВАЕМАЯ ВЕРСИЯ ПРОТОКОЛА TUS
+	TUS_PREFIX     = "/files/"       // МАРШРУТ ДЛЯ ВОЗОБНОВЛЯЕМЫХ ЗАГРУЗОК
+	TUS_PREFIX_LEN = len(TUS_PREFIX) // ДЛИНА ПРЕФИКСА ДЛЯ МАРШРУТА ВОЗОБНОВЛЯЕМЫХ ЗАГРУЗОК
+	TUS_CHUNK_TYPE = "application/offset+octet-stream"
+)
+
+// tusInfo — сведения о незавершённой загрузке, хранящиеся рядом с её данными
+type tusInfo struct {
+	Key      string // Ключ, под которым объект будет сохранён по завершении
+	Length   int64  // Полный размер объекта, объявленный при создании
+	Meta     Meta   // Метаданные объекта (владелец, права доступа), заданные при создании
+	MD5State []byte // Состояние MD5 после первых Hashed байт, чтобы не перечитывать их по завершении
+	Hashed   int64  // Сколько байт загрузки учтено в MD5State
+}
+
+// TusUploads — состояние возобновляемых загрузок
+type TusUploads struct {
+	storage *Storage
+	mu      sync.Mutex             // Мьютекс для доступа к locks
+	locks   map[string]*sync.Mutex // Блокировки загрузок, чтобы два PATCH не писали одновременно
+}
+
+// NewTusUploads — конструктор состояния возобновляемых загрузок
+func NewTusUploads(storage *Storage) *TusUploads {
+	return &TusUploads{storage: storage, locks: make(map[string]*sync.Mutex)}
+}
+
+// lock — захватывает блокировку загрузки и возвращает функцию её освобождения
+func (t *TusUploads) lock(id string) func() {
+	t.mu.Lock()
+	l, ok := t.locks[id]
+	if !ok {
+		l = &sync.Mutex{}
+		t.locks[id] = l
+	}
+	t.mu.Unlock()
+
+	l.Lock()
+	return l.Unlock
+}
+
+// forget — убирает блокировку завершённой загрузки
+func (t *TusUploads) forget(id string) {
+	t.mu.Lock()
+	delete(t.locks, id)
+	t.mu.Unlock()
+}
+
+func tusDataPath(id string) string { return tusDir() + "/" + id }
+func tusInfoPath(id string) string { return tusDir() + "/" + id + ".json" }
+
+// loadTusInfo — читает сведения о загрузке
+func loadTusInfo(id string) (tusInfo, error) {
+	var info tusInfo
+	data, err := os.ReadFile(tusInfoPath(id))
+	if err != nil {
+		return info, err
+	}
+	err = json.Unmarshal(data, &info)
+	return info, err
+}
+
+// saveTusInfo — сохраняет сведения о загрузке
+func saveTusInfo(id string, info tusInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(tusInfoPath(id), data, 0644)
+}
+
+// hash — MD5 первых size байт загрузки. Состояние хэша сохраняется после каждой части,
+// поэтому дочитывается с диска только то, что в него не попало (после сбоя или обрыва)
+func (info tusInfo) hash(id string, size int64) (hash.Hash, error) {
+	h := md5.New()
+	hashed := int64(0)
+	if info.Hashed <= size && len(info.MD5State) > 0 {
+		if h.(encoding.BinaryUnmarshaler).UnmarshalBinary(info.MD5State) == nil {
+			hashed = info.Hashed
+		} else {
+			h.Reset()
+		}
+	}
+	if hashed == size {
+		return h, nil
+	}
+
+	file, err := os.Open(tusDataPath(id))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if _, err := io.Copy(h, io.NewSectionReader(file, hashed, size-hashed)); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// parseTusMetadata — разбирает заголовок Upload-Metadata вида "name base64,name base64"
+func parseTusMetadata(header string) map[string]string {
+	meta := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		parts := strings.Fields(pair)
+		if len(parts) == 0 {
+			continue
+		}
+		value := ""
+		if len(parts) > 1 {
+			decoded, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				continue
+			}
+			value = string(decoded)
+		}
+		meta[parts[0]] = value
+	}
+	return meta
+}
+
+// HandleTus — обработчик протокола tus
+func HandleTus(w http.ResponseWriter, r *http.Request, uploads *TusUploads) {
+	w.Header().Set("Tus-Resumable", TUS_VERSION)
+
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Tus-Version", TUS_VERSION)
+		w.Header().Set("Tus-Extension", "creation")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Header.Get("Tus-Resumable") != TUS_VERSION {
+		w.Header().Set("Tus-Version", TUS_VERSION)
+		http.Error(w, "Неподдерживаемая версия протокола tus", http.StatusPreconditionFailed)
+		return
+	}
+
+	id := r.URL.Path[TUS_PREFIX_LEN:]
+	switch {
+	case r.Method == http.MethodPost && id == "":
+		uploads.create(w, r)
+	case r.Method == http.MethodHead && id != "":
+		uploads.offset(w, r, id)
+	case r.Method == http.MethodPatch && id != "":
+		uploads.patch(w, r, id)
+	case id == "":
+		methodNotAllowed(w, http.MethodPost, http.MethodOptions)
+	default:
+		methodNotAllowed(w, http.MethodHead, http.MethodPatch, http.MethodOptions)
+	}
+}
+
+// create — создаёт новую загрузку (POST /files/)
+func (t *TusUploads) create(w http.ResponseWriter, r *http.Request) {
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		http.Error(w, "Некорректный заголовок Upload-Length", http.StatusBadRequest)
+		return
+	}
+	if t.storage.maxObjectSize > 0 && length > t.storage.maxObjectSize {
+		http.Error(w, ErrTooLarge.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// Ключ объекта передаётся в метаданных загрузки как key или filename
+	meta := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	key := meta["key"]
+	if key == "" {
+		key = meta["filename"]
+	}
+	if key == "" {
+		http.Error(w, "В Upload-Metadata не указан ключ объекта (key или filename)", http.StatusBadRequest)
+		return
+	}
+	key = t.storage.RequestKey(r, key)
+	if !checkKey(w, key) {
+		return
+	}
+	if !checkExpires(w, r) {
+		return
+	}
+	// Тип файла клиент tus сообщает в метаданных filetype, заголовок Content-Type тут не о нём
+	if err := t.storage.checkDeclaredType(key, meta["filetype"]); err != nil {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	if t.storage.Live(key) {
+		writeExists(w, r, t.storage, key, "Объект "+key+" уже существует")
+		return
+	}
+	if !checkLease(w, r, t.storage, key) || !checkNotAlias(w, t.storage, key) || !checkQuota(w, t.storage, length) {
+		return
+	}
+
+	id := randomID()
+	err = createTusData(id, length)
+	if err == nil {
+		err = saveTusInfo(id, tusInfo{Key: key, Length: length, Meta: uploadMeta(r)})
+	}
+	if errors.Is(err, syscall.ENOSPC) {
+		// Места под объявленный размер нет: лучше отказать сразу, чем на середине загрузки
+		os.Remove(tusDataPath(id))
+		http.Error(w, "Недостаточно места для загрузки", http.StatusInsufficientStorage)
+		return
+	}
+	if errors.Is(err, syscall.EFBIG) {
+		os.Remove(tusDataPath(id))
+		http.Error(w, "Объявленный размер превышает допустимый для файловой системы", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		log.Printf("Ошибка создания загрузки %s: %v", logKey(key), logErr(err))
+		http.Error(w, "Ошибка создания загрузки", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", TUS_PREFIX+id)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// createTusData — создаёт пустой файл данных загрузки и резервирует под него место
+func createTusData(id string, length int64) error {
+	file, err := os.Create(tusDataPath(id))
+	if err != nil {
+		return err
+	}
+	if err := preallocate(file, length); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// offset — сообщает, сколько байт загрузки уже получено (HEAD /files/<id>)
+func (t *TusUploads) offset(w http.ResponseWriter, r *http.Request, id string) {
+	info, err := loadTusInfo(id)
+	if err != nil {
+		http.Error(w, "Загрузка не найдена", http.StatusNotFound)
+		return
+	}
+	stat, err := os.Stat(tusDataPath(id))
+	if err != nil {
+		http.Error(w, "Загрузка не найдена", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(stat.Size(), 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(info.Length, 10))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+// patch — дописывает очередную часть загрузки (PATCH /files/<id>).
+// Если соединение оборвалось, сохранённым остаётся всё полученное до обрыва,
+// и клиент продолжает с offset, который вернёт HEAD.
+func (t *TusUploads) patch(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Header.Get("Content-Type") != TUS_CHUNK_TYPE {
+		http.Error(w, "Ожидается Content-Type "+TUS_CHUNK_TYPE, http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "Некорректный заголовок Upload-Offset", http.StatusBadRequest)
+		return
+	}
+
+	defer t.lock(id)()
+	info, err := loadTusInfo(id)
+	if err != nil {
+		http.Error(w, "Загрузка не найдена", http.StatusNotFound)
+		return
+	}
+	file, err := os.OpenFile(tusDataPath(id), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		http.Error(w, "Загрузка не найдена", http.StatusNotFound)
+		return
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		http.Error(w, "Ошибка чтения загрузки", http.StatusInternalServerError)
+		return
+	}
+	if stat.Size() != offset {
+		file.Close()
+		http.Error(w, "Upload-Offset не совпадает с полученным объёмом", http.StatusConflict)
+		return
+	}
+
+	h, err := info.hash(id, offset)
+	if err != nil {
+		file.Close()
+		http.Error(w, "Ошибка чтения загрузки", http.StatusInternalServerError)
+		return
+	}
+
+	// Не даём записать больше объявленного размера. MD5 считается по ходу записи,
+	// и по завершении файл не приходится читать заново ради ETag
+	written, err := io.Copy(io.MultiWriter(file, h), io.LimitReader(r.Body, info.Length-offset))
+	file.Close()
+	offset += written
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	if err != nil {
+		log.Printf("Загрузка %s прервана на %d байтах: %v", id, offset, logErr(err))
+		http.Error(w, "Ошибка чтения данных", http.StatusInternalServerError)
+		return
+	}
+
+	if offset == info.Length {
+		t.finish(w, id, info, hex.EncodeToString(h.Sum(nil)))
+		return
+	}
+	// Не сохранившееся состояние хэша не страшно: недостающее дочитается с диска
+	if state, err := h.(encoding.BinaryMarshaler).MarshalBinary(); err == nil {
+		info.MD5State, info.Hashed = state, offset
+		saveTusInfo(id, info)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// finish — перемещает полностью полученную загрузку с MD5 md5sum в хранилище
+func (t *TusUploads) finish(w http.ResponseWriter, id string, info tusInfo, md5sum string) {
+	defer t.forget(id)
+	err := t.storage.SaveFile(info.Key, tusDataPath(id), md5sum, info.Meta)
+	os.Remove(tusInfoPath(id))
+	if errors.Is(err, ErrRejected) {
+		os.Remove(tusDataPath(id))
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if errors.Is(err, ErrUnsupportedType) {
+		os.Remove(tusDataPath(id))
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	if errors.Is(err, ErrQuotaExceeded) {
+		os.Remove(tusDataPath(id))
+		http.Error(w, "Недостаточно места в квоте хранилища", http.StatusInsufficientStorage)
+		return
+	}
+	if err != nil {
+		os.Remove(tusDataPath(id))
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
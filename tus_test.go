@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding"
+	"encoding/base64"
+	"net/http"
+	"path"
+	"testing"
+)
+
+func TestTusUpload(t *testing.T) {
+	ts, _ := newTestServer(t)
+	tus := []string{"Tus-Resumable", TUS_VERSION}
+	metadata := "key " + base64.StdEncoding.EncodeToString([]byte("resumed"))
+
+	resp, _ := do(t, ts, http.MethodOptions, "/files/", "")
+	if resp.StatusCode != http.StatusNoContent || resp.Header.Get("Tus-Version") != TUS_VERSION {
+		t.Fatalf("OPTIONS /files/: %d, Tus-Version %q", resp.StatusCode, resp.Header.Get("Tus-Version"))
+	}
+	if resp, _ := do(t, ts, http.MethodPost, "/files/", "", "Upload-Length", "11"); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("create without Tus-Resumable: %d, want 412", resp.StatusCode)
+	}
+	creates := []struct {
+		name   string
+		header []string
+		status int
+	}{
+		{"no length", []string{"Upload-Metadata", metadata}, http.StatusBadRequest},
+		{"negative length", []string{"Upload-Length", "-1", "Upload-Metadata", metadata}, http.StatusBadRequest},
+		{"no key", []string{"Upload-Length", "11"}, http.StatusBadRequest},
+		{"valid", []string{"Upload-Length", "11", "Upload-Metadata", metadata}, http.StatusCreated},
+	}
+	var location string
+	for _, tt := range creates {
+		resp, _ := do(t, ts, http.MethodPost, "/files/", "", append(tt.header, tus...)...)
+		if resp.StatusCode != tt.status {
+			t.Errorf("create %s: %d, want %d", tt.name, resp.StatusCode, tt.status)
+		}
+		location = resp.Header.Get("Location")
+	}
+	if location == "" {
+		t.Fatal("created upload has no Location")
+	}
+
+	chunk := func(offset string) []string {
+		return append([]string{"Content-Type", TUS_CHUNK_TYPE, "Upload-Offset", offset}, tus...)
+	}
+	steps := []struct {
+		name   string
+		method string
+		body   string
+		header []string
+		status int
+		offset string
+	}{
+		{"initial offset", http.MethodHead, "", tus, http.StatusOK, "0"},
+		{"first chunk", http.MethodPatch, "hello ", chunk("0"), http.StatusNoContent, "6"},
+		{"stale offset", http.MethodPatch, "hello ", chunk("0"), http.StatusConflict, ""},
+		{"wrong content type", http.MethodPatch, "world", append([]string{"Upload-Offset", "6"}, tus...), http.StatusUnsupportedMediaType, ""},
+		{"resumed offset", http.MethodHead, "", tus, http.StatusOK, "6"},
+		{"last chunk", http.MethodPatch, "world", chunk("6"), http.StatusNoContent, "11"},
+		{"finished upload", http.MethodHead, "", tus, http.StatusNotFound, ""},
+	}
+	for _, tt := range steps {
+		resp, _ := do(t, ts, tt.method, location, tt.body, tt.header...)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: %d, want %d", tt.name, resp.StatusCode, tt.status)
+		}
+		if got := resp.Header.Get("Upload-Offset"); tt.offset != "" && got != tt.offset {
+			t.Errorf("%s: Upload-Offset %q, want %q", tt.name, got, tt.offset)
+		}
+	}
+
+	resp, body := do(t, ts, http.MethodGet, "/download/resumed", "")
+	if resp.StatusCode != http.StatusOK || body != "hello world" {
+		t.Fatalf("download of finished upload: %d %q", resp.StatusCode, body)
+	}
+	// MD5, посчитанный по частям, совпадает с MD5 всего содержимого
+	if etag := resp.Header.Get("ETag"); etag != `"5eb63bbbe01eeed093cb22bb8f5acdc3"` {
+		t.Errorf("ETag = %s, want md5 of the whole object", etag)
+	}
+	// Ключ занят: вторая загрузка под ним не создаётся
+	if resp, _ := do(t, ts, http.MethodPost, "/files/", "", append(creates[3].header, tus...)...); resp.StatusCode != http.StatusConflict {
+		t.Errorf("create over an existing key: %d, want 409", resp.StatusCode)
+	}
+}
+
+func TestTusResumedHash(t *testing.T) {
+	// Состояние MD5 после первых двух байт — как если бы сохранение после следующей части не удалось
+	h := md5.New()
+	h.Write([]byte("he"))
+	partial, _ := h.(encoding.BinaryMarshaler).MarshalBinary()
+
+	tests := []struct {
+		name  string
+		state func(info *tusInfo)
+	}{
+		{"saved state", func(info *tusInfo) {}},
+		{"no state", func(info *tusInfo) { info.MD5State, info.Hashed = nil, 0 }},
+		{"stale state", func(info *tusInfo) { info.MD5State, info.Hashed = partial, 2 }},
+		{"corrupt state", func(info *tusInfo) { info.MD5State = []byte("garbage") }},
+		// Состояние дальше, чем записано на диск, не используется
+		{"state past offset", func(info *tusInfo) { info.MD5State, info.Hashed = partial, 100 }},
+	}
+	tus := []string{"Tus-Resumable", TUS_VERSION}
+	chunk := func(offset string) []string {
+		return append([]string{"Content-Type", TUS_CHUNK_TYPE, "Upload-Offset", offset}, tus...)
+	}
+	ts, _ := newTestServer(t)
+	for _, tt := range tests {
+		metadata := "key " + base64.StdEncoding.EncodeToString([]byte(tt.name))
+		resp, _ := do(t, ts, http.MethodPost, "/files/", "", append([]string{"Upload-Length", "11", "Upload-Metadata", metadata}, tus...)...)
+		location := resp.Header.Get("Location")
+		if resp, _ := do(t, ts, http.MethodPatch, location, "hello ", chunk("0")...); resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("%s: first chunk: %d", tt.name, resp.StatusCode)
+		}
+
+		id := path.Base(location)
+		info, err := loadTusInfo(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Hashed != 6 || len(info.MD5State) == 0 {
+			t.Errorf("%s: hash state after the first chunk: %d bytes hashed", tt.name, info.Hashed)
+		}
+		tt.state(&info)
+		if err := saveTusInfo(id, info); err != nil {
+			t.Fatal(err)
+		}
+
+		if resp, _ := do(t, ts, http.MethodPatch, location, "world", chunk("6")...); resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("%s: last chunk: %d", tt.name, resp.StatusCode)
+		}
+		resp, body := do(t, ts, http.MethodGet, "/download/"+tt.name, "")
+		if body != "hello world" || resp.Header.Get("ETag") != `"5eb63bbbe01eeed093cb22bb8f5acdc3"` {
+			t.Errorf("%s: %q, ETag %s, want md5 of the whole object", tt.name, body, resp.Header.Get("ETag"))
+		}
+	}
+}
+
+func TestParseTusMetadata(t *testing.T) {
+	tests := []struct {
+		header string
+		want   map[string]string
+	}{
+		{"", map[string]string{}},
+		{"key a2V5", map[string]string{"key": "key"}},
+		{"filename YS5qcGc=,is_private", map[string]string{"filename": "a.jpg", "is_private": ""}},
+		{"bad !!!,key a2V5", map[string]string{"key": "key"}},
+	}
+	for _, tt := range tests {
+		got := parseTusMetadata(tt.header)
+		if len(got) != len(tt.want) {
+			t.Errorf("parseTusMetadata(%q) = %v, want %v", tt.header, got, tt.want)
+			continue
+		}
+		for k, v := range tt.want {
+			if got[k] != v {
+				t.Errorf("parseTusMetadata(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"path/filepath"
+	"strings"
+)
+
+// TypeRoute — где хранить объекты одного типа содержимого: Pattern — тип
+// ("application/pdf") или группа типов ("image/*"), Dir — корень для их файлов
+type TypeRoute struct {
+	Pattern string
+	Dir     string
+}
+
+// match — подходит ли тип содержимого под шаблон маршрута
+func (t TypeRoute) match(ctype string) bool {
+	return typeMatches(t.Pattern, ctype)
+}
+
+// parseTypeRoutes — разбирает -type-dirs: элементы вида тип=директория, например
+// image/*=/mnt/media. Директории — как и -temp-dir: вне хранилища root или служебные внутри.
+func parseTypeRoutes(root string, list []string) ([]TypeRoute, error) {
+	routes := make([]TypeRoute, 0, len(list))
+	seen := make(map[string]bool)
+	for _, item := range list {
+		pattern, dir, ok := strings.Cut(item, "=")
+		pattern = strings.ToLower(pattern)
+		if !ok || !strings.Contains(pattern, "/") || dir == "" {
+			return nil, fmt.Errorf("type route %q must be in type=dir form, e.g. image/*=/mnt/media", item)
+		}
+		if err := checkServiceDir(root, dir); err != nil {
+			return nil, fmt.Errorf("invalid directory for type %q: %v", pattern, err)
+		}
+		if seen[pattern] {
+			return nil, fmt.Errorf("type %q is routed twice", pattern)
+		}
+		seen[pattern] = true
+		routes = append(routes, TypeRoute{pattern, filepath.Clean(dir)})
+	}
+	return routes, nil
+}
+
+// objectRoot — корень, под которым лежит файл объекта. Тип определяется по расширению
+// ключа, как при отдаче без заданного типа, поэтому корень известен по одному ключу
+// и при записи, и при чтении; первый подходящий маршрут -type-dirs важнее остальных.
+func (s *Storage) objectRoot(key string) string {
+	if len(s.typeRoutes) == 0 {
+		return storageDir
+	}
+	ctype := mediaType(mime.TypeByExtension(filepath.Ext(key)))
+	for _, route := range s.typeRoutes {
+		if route.match(ctype) {
+			return route.Dir
+		}
+	}
+	return storageDir
+}
+
+// objectRoots — все корни файлов объектов: хранилище и директории -type-dirs
+func (s *Storage) objectRoots() []string {
+	roots := []string{storageDir}
+	seen := map[string]bool{storageDir: true}
+	for _, route := range s.typeRoutes {
+		if !seen[route.Dir] {
+			seen[route.Dir] = true
+			roots = append(roots, route.Dir)
+		}
+	}
+	return roots
+}
+
+// stagingDir — куда класть временный файл перед переименованием в path: на той же
+// ФС, что и корень объекта, иначе переименование в другой том невозможно
+func (s *Storage) stagingDir(path string) string {
+	for _, root := range s.objectRoots()[1:] {
+		if strings.HasPrefix(path, root+"/") {
+			return root + "/.tmp"
+		}
+	}
+	return storagePath(TMP_DIR)
+}
+
+// stagingDirs — директории временных файлов всех корней объектов
+func (s *Storage) stagingDirs() []string {
+	dirs := []string{storagePath(TMP_DIR)}
+	for _, root := range s.objectRoots()[1:] {
+		dirs = append(dirs, root+"/.tmp")
+	}
+	return dirs
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestTypeDirs(t *testing.T) {
+	dir, media, docs := t.TempDir(), t.TempDir(), t.TempDir()
+	ts, _ := newTestServer(t, "-storage-dir", dir, "-type-dirs", "image/*="+media+",application/pdf="+docs+",image/png="+docs)
+	tests := []struct {
+		key  string
+		root string
+	}{
+		{"photos/a.png", media}, // Первый подходящий маршрут важнее точного типа ниже
+		{"b.JPG", media},
+		{"docs/c.pdf", docs},
+		{"d.txt", dir},
+		{"noext", dir},
+	}
+	for _, tt := range tests {
+		upload(t, ts, tt.key, "data "+tt.key)
+		if data, err := os.ReadFile(tt.root + "/" + tt.key); err != nil || string(data) != "data "+tt.key {
+			t.Errorf("%s: file in %s: %q, %v", tt.key, tt.root, data, err)
+		}
+		if resp, body := do(t, ts, http.MethodGet, "/download/"+tt.key, ""); resp.StatusCode != http.StatusOK || body != "data "+tt.key {
+			t.Errorf("download %s: %d %q", tt.key, resp.StatusCode, body)
+		}
+	}
+	// Метаданные всех томов остаются в хранилище
+	for _, key := range []string{"photos/a.png", "docs/c.pdf"} {
+		if _, err := os.Stat(dir + "/" + META_DIR + "/" + key + ".json"); err != nil {
+			t.Errorf("%s: metadata is not in the storage: %v", key, err)
+		}
+	}
+
+	// Список видит объекты всех томов вместе
+	if got, want := listNames(t, ts, ""), []string{"b.JPG", "d.txt", "docs/c.pdf", "noext", "photos/a.png"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GET /list = %v, want %v", got, want)
+	}
+
+	// Удаление убирает файл из тома, временные файлы записи в томе не остаются
+	if resp, _ := do(t, ts, http.MethodDelete, "/delete/photos/a.png", ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("delete photos/a.png: %d", resp.StatusCode)
+	}
+	if _, err := os.Stat(media + "/photos/a.png"); !os.IsNotExist(err) {
+		t.Errorf("deleted object file is still in the volume: %v", err)
+	}
+	for _, root := range []string{media, docs} {
+		if entries, _ := os.ReadDir(root + "/.tmp"); len(entries) != 0 {
+			t.Errorf("temp files left in %s/.tmp: %v", root, entries)
+		}
+	}
+}
+
+func TestParseTypeDirs(t *testing.T) {
+	tests := []struct {
+		value  string
+		ok     bool
+		routes []TypeRoute
+	}{
+		{"", true, []TypeRoute{}},
+		{"IMAGE/*=/mnt/media,application/pdf=/mnt/docs/", true, []TypeRoute{{"image/*", "/mnt/media"}, {"application/pdf", "/mnt/docs"}}},
+		{"image/*=/storage/.media", true, []TypeRoute{{"image/*", "/storage/.media"}}},
+		{"image=/mnt/media", false, nil},
+		{"image/*=", false, nil},
+		{"image/*", false, nil},
+		{"image/*=mnt/media", false, nil},
+		{"image/*=/storage/media", false, nil},
+		{"image/*=/mnt/a,image/*=/mnt/b", false, nil},
+	}
+	for _, tt := range tests {
+		cfg, err := ParseConfig([]string{"-storage-dir", "/storage", "-type-dirs", tt.value})
+		if (err == nil) != tt.ok {
+			t.Errorf("-type-dirs %q: %v, want ok %v", tt.value, err, tt.ok)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(cfg.TypeRoutes, tt.routes) {
+			t.Errorf("-type-dirs %q = %v, want %v", tt.value, cfg.TypeRoutes, tt.routes)
+		}
+	}
+}
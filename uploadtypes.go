@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SNIFF_LEN — СКОЛЬКО ПЕРВЫХ БАЙТОВ СМОТРИТ http.DetectContentType
+const SNIFF_LEN = 512
+
+// ErrUnsupportedType — тип содержимого загрузки не входит в -allowed-types
+var ErrUnsupportedType = errors.New("content type is not allowed")
+
+// mediaType — тип содержимого без параметров, в нижнем регистре
+// ("text/html; charset=utf-8" → "text/html")
+func mediaType(ctype string) string {
+	t, _, _ := strings.Cut(ctype, ";")
+	return strings.ToLower(strings.TrimSpace(t))
+}
+
+// typeMatches — подходит ли тип под шаблон: точный тип ("application/pdf") или группу ("image/*")
+func typeMatches(pattern, ctype string) bool {
+	if group, ok := strings.CutSuffix(pattern, "/*"); ok {
+		return strings.HasPrefix(ctype, group+"/")
+	}
+	return ctype == pattern
+}
+
+// typeAllowed — можно ли хранить объект такого типа (без -allowed-types — любого)
+func (s *Storage) typeAllowed(ctype string) bool {
+	if len(s.allowedTypes) == 0 {
+		return true
+	}
+	ctype = mediaType(ctype)
+	for _, pattern := range s.allowedTypes {
+		if typeMatches(pattern, ctype) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDeclaredType — проверяет по -allowed-types то, что известно без тела: тип по
+// расширению ключа и заголовок Content-Type загрузки (application/octet-stream
+// означает, что клиент типа не знает, — тогда решает содержимое)
+func (s *Storage) checkDeclaredType(key, declared string) error {
+	if len(s.allowedTypes) == 0 {
+		return nil
+	}
+	if ctype := mime.TypeByExtension(filepath.Ext(key)); ctype != "" && !s.typeAllowed(ctype) {
+		return fmt.Errorf("%w: %v (by extension of %v)", ErrUnsupportedType, mediaType(ctype), key)
+	}
+	if declared != "" && mediaType(declared) != DEFAULT_CONTENT_TYPE && !s.typeAllowed(declared) {
+		return fmt.Errorf("%w: %v", ErrUnsupportedType, mediaType(declared))
+	}
+	return nil
+}
+
+// checkContentType — проверяет по -allowed-types и тип, определённый по первым байтам
+// head: объект с расширением .png, а внутри HTML, не пройдёт. Распознать по байтам можно
+// не всё: двоичное без сигнатуры определяется как application/octet-stream, а JSON, CSV
+// и прочий текст — как text/plain, поэтому такой результат при известном расширении
+// текстового типа не проверяется. Если тип не определить ни по расширению, ни по
+// содержимому, объект будет отдаваться с -default-type — его и проверяем.
+func (s *Storage) checkContentType(key string, head []byte) error {
+	if err := s.checkDeclaredType(key, ""); err != nil || len(s.allowedTypes) == 0 {
+		return err
+	}
+	if len(head) > SNIFF_LEN {
+		head = head[:SNIFF_LEN]
+	}
+	sniffed := mediaType(http.DetectContentType(head))
+	byExt := mediaType(mime.TypeByExtension(filepath.Ext(key)))
+	switch {
+	case sniffed == DEFAULT_CONTENT_TYPE && byExt != "":
+		return nil
+	case sniffed == DEFAULT_CONTENT_TYPE:
+		sniffed = s.defaultType
+	case sniffed == "text/plain" && byExt != "" && !binaryType(byExt):
+		return nil
+	}
+	if !s.typeAllowed(sniffed) {
+		return fmt.Errorf("%w: %v (detected from content of %v)", ErrUnsupportedType, mediaType(sniffed), key)
+	}
+	return nil
+}
+
+// binaryType — тип, содержимое которого не может быть простым текстом
+func binaryType(ctype string) bool {
+	for _, group := range []string{"image/", "audio/", "video/", "font/"} {
+		if strings.HasPrefix(ctype, group) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkFileType — checkContentType для содержимого файла, ещё не ставшего объектом
+func (s *Storage) checkFileType(key, path string) error {
+	if len(s.allowedTypes) == 0 {
+		return nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	head := make([]byte, SNIFF_LEN)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	return s.checkContentType(key, head[:n])
+}
+
+// checkUploadType — отвечает 415, если заголовок Content-Type или расширение ключа
+// загрузки не входят в -allowed-types; проверяется до чтения тела
+func checkUploadType(w http.ResponseWriter, r *http.Request, storage *Storage, key string) bool {
+	if err := storage.checkDeclaredType(key, r.Header.Get("Content-Type")); err != nil {
+		http.Error(w, clientError(r, err), http.StatusUnsupportedMediaType)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestAllowedTypes(t *testing.T) {
+	const (
+		png  = "\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"
+		pdf  = "%PDF-1.4\n"
+		html = "<html><body>hi"
+	)
+	ts, _ := newTestServer(t, "-allowed-types", "image/*,application/pdf,text/plain")
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		header []string
+		status int
+	}{
+		{"png", http.MethodPost, "/upload/a.png", png, nil, http.StatusCreated},
+		{"pdf", http.MethodPost, "/upload/b.pdf", pdf, nil, http.StatusCreated},
+		{"text", http.MethodPost, "/upload/notes.txt", "hello", nil, http.StatusCreated},
+		{"sniffed png", http.MethodPost, "/upload/noext", png, nil, http.StatusCreated},
+		{"unknown client type", http.MethodPost, "/upload/sent", png, []string{"Content-Type", "application/octet-stream"}, http.StatusCreated},
+		{"by extension", http.MethodPost, "/upload/c.html", "hello", nil, http.StatusUnsupportedMediaType},
+		{"json by extension", http.MethodPost, "/upload/d.json", "{}", nil, http.StatusUnsupportedMediaType},
+		{"by header", http.MethodPost, "/upload/x", png, []string{"Content-Type", "text/html"}, http.StatusUnsupportedMediaType},
+		{"html inside png", http.MethodPost, "/upload/fake.png", html, nil, http.StatusUnsupportedMediaType},
+		{"sniffed html", http.MethodPost, "/upload/page", html, nil, http.StatusUnsupportedMediaType},
+		{"default type", http.MethodPost, "/upload/blob", "\x00\x01\x02", nil, http.StatusUnsupportedMediaType},
+		{"copy to html", http.MethodPost, "/copy/copy.html?source=notes.txt", "", nil, http.StatusUnsupportedMediaType},
+		{"copy", http.MethodPost, "/copy/copy.png?source=a.png", "", nil, http.StatusCreated},
+		{"s3 png", http.MethodPut, "/bucket/a.png", png, nil, http.StatusOK},
+		{"s3 by extension", http.MethodPut, "/bucket/c.html", "hello", nil, http.StatusUnsupportedMediaType},
+		{"s3 html inside png", http.MethodPut, "/bucket/fake.png", html, nil, http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		if resp, body := do(t, ts, tt.method, tt.path, tt.body, tt.header...); resp.StatusCode != tt.status {
+			t.Errorf("%s: %s %s: %d %s, want %d", tt.name, tt.method, tt.path, resp.StatusCode, body, tt.status)
+		}
+	}
+	// Отклонённое не сохраняется
+	for _, key := range []string{"c.html", "fake.png", "page", "blob", "copy.html", "bucket/fake.png"} {
+		if resp, _ := do(t, ts, http.MethodGet, "/download/"+key, ""); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("rejected %s is stored: %d", key, resp.StatusCode)
+		}
+	}
+
+	// tus: тип из метаданных проверяется при создании, содержимое — когда загрузка завершена
+	tus := []string{"Tus-Resumable", TUS_VERSION}
+	create := func(key, filetype string, length int) *http.Response {
+		metadata := "key " + base64.StdEncoding.EncodeToString([]byte(key))
+		if filetype != "" {
+			metadata += ",filetype " + base64.StdEncoding.EncodeToString([]byte(filetype))
+		}
+		resp, _ := do(t, ts, http.MethodPost, "/files/", "", append([]string{"Upload-Length", strconv.Itoa(length), "Upload-Metadata", metadata}, tus...)...)
+		return resp
+	}
+	if resp := create("t", "text/html", len(html)); resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("tus upload with filetype text/html: %d, want 415", resp.StatusCode)
+	}
+	resp := create("t.png", "", len(html))
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("tus create: %d", resp.StatusCode)
+	}
+	if resp, body := do(t, ts, http.MethodPatch, resp.Header.Get("Location"), html, append([]string{"Content-Type", TUS_CHUNK_TYPE, "Upload-Offset", "0"}, tus...)...); resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("tus upload of html into t.png: %d %s, want 415", resp.StatusCode, body)
+	}
+	if resp, _ := do(t, ts, http.MethodGet, "/download/t.png", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("rejected tus upload is stored: %d", resp.StatusCode)
+	}
+}
+
+func TestAllowedTypesConfig(t *testing.T) {
+	// Неопределимое содержимое проверяется по -default-type
+	ts, _ := newTestServer(t, "-allowed-types", "Image/*", "-default-type", "image/png")
+	upload(t, ts, "blob", "\x00\x01\x02")
+
+	for _, value := range []string{"image", "/png", "image/", "image/png,pdf"} {
+		if _, err := ParseConfig([]string{"-allowed-types", value}); err == nil {
+			t.Errorf("ParseConfig accepted -allowed-types %q", value)
+		}
+	}
+}
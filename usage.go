@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// prefixUsage — число объектов на диске с ключами, начинающимися с prefix,
+// и их суммарный размер, как du для «папки»
+func (s *Storage) prefixUsage(prefix string) (objects, bytes int64, err error) {
+	err = s.walkPrefixKeys(prefix, func(key string) error {
+		info, err := s.backend.Stat(key)
+		if err != nil {
+			// Объект могли удалить во время обхода
+			return nil
+		}
+		objects++
+		bytes += info.Size()
+		return nil
+	})
+	return objects, bytes, err
+}
+
+// checkPrefix — проверяет префикс ключей из запроса: его директория должна быть
+// допустимым ключом, иначе обход вышел бы за пределы хранилища
+func checkPrefix(w http.ResponseWriter, prefix string) bool {
+	i := strings.LastIndex(prefix, "/")
+	return i < 0 || checkKey(w, prefix[:i])
+}
+
+// HandleUsage — обработчик для подсчёта объектов и занятого ими места под префиксом
+// ключа: GET /usage?prefix=photos/ (без префикса — всё хранилище или хост целиком)
+func HandleUsage(w http.ResponseWriter, r *http.Request, storage *Storage) {
+	prefix := storage.NormalizeKey(r.URL.Query().Get("prefix"))
+	if !checkPrefix(w, prefix) {
+		return
+	}
+	objects, bytes, err := storage.prefixUsage(tenantPath(r, prefix))
+	if err != nil {
+		log.Printf("Ошибка подсчёта объектов под префиксом %s: %v", logKey(prefix), logErr(err))
+		http.Error(w, "Ошибка чтения хранилища", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Prefix  string
+		Objects int64
+		Bytes   int64
+	}{prefix, objects, bytes})
+}
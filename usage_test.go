@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestHandleUsage(t *testing.T) {
+	for _, width := range []string{"0", "2"} {
+		ts, _ := newTestServer(t, "-shard-width", width)
+		objects := map[string]string{
+			"photos/a.jpg":      "12345",
+			"photos/2024/b.jpg": "123",
+			"phone.txt":         "1",
+			"docs/c.txt":        "1234567890",
+		}
+		for key, body := range objects {
+			upload(t, ts, key, body)
+		}
+
+		tests := []struct {
+			prefix         string
+			status         int
+			objects, bytes int64
+		}{
+			{"", http.StatusOK, 4, 19},
+			{"photos/", http.StatusOK, 2, 8},
+			{"photos/2024/", http.StatusOK, 1, 3},
+			// Префикс — начало ключа, а не обязательно целая «папка»
+			{"pho", http.StatusOK, 3, 9},
+			{"missing/", http.StatusOK, 0, 0},
+			{"../", http.StatusBadRequest, 0, 0},
+		}
+		for _, tt := range tests {
+			resp, body := do(t, ts, http.MethodGet, "/usage?prefix="+url.QueryEscape(tt.prefix), "")
+			if resp.StatusCode != tt.status {
+				t.Errorf("width %s, prefix %q: %d %s, want %d", width, tt.prefix, resp.StatusCode, body, tt.status)
+				continue
+			}
+			if tt.status != http.StatusOK {
+				continue
+			}
+			var got struct {
+				Prefix         string
+				Objects, Bytes int64
+			}
+			if err := json.Unmarshal([]byte(body), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Prefix != tt.prefix || got.Objects != tt.objects || got.Bytes != tt.bytes {
+				t.Errorf("width %s, prefix %q: %+v, want %d objects of %d bytes", width, tt.prefix, got, tt.objects, tt.bytes)
+			}
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Tenant — поддиректория хранилища, выбранная по Host запроса (пусто — всё хранилище)
+func Tenant(r *http.Request) string {
+	tenant, _ := r.Context().Value(tenantKey).(string)
+	return tenant
+}
+
+// tenantPath — ключ в хранилище для ключа клиента: с поддиректорией его хоста
+func tenantPath(r *http.Request, key string) string {
+	if tenant := Tenant(r); tenant != "" {
+		return tenant + "/" + key
+	}
+	return key
+}
+
+// clientKey — обратное к tenantPath: ключ, под которым объект виден клиенту
+func clientKey(r *http.Request, key string) string {
+	if tenant := Tenant(r); tenant != "" {
+		return strings.TrimPrefix(key, tenant+"/")
+	}
+	return key
+}
+
+// clientError — текст ошибки для клиента: ключи в нём (ErrExists, ErrKeyIsPrefix,
+// ErrUnsupportedType пишут их после пробела) — без поддиректории хоста
+func clientError(r *http.Request, err error) string {
+	if tenant := Tenant(r); tenant != "" {
+		return strings.ReplaceAll(err.Error(), " "+tenant+"/", " ")
+	}
+	return err.Error()
+}
+
+// RequestKey — ключ объекта в хранилище для ключа из запроса: нормализованный
+// и помещённый в поддиректорию хоста запроса
+func (s *Storage) RequestKey(r *http.Request, key string) string {
+	return tenantPath(r, s.NormalizeKey(key))
+}
+
+// parseVirtualHosts — разбирает список хост=поддиректория; пустая поддиректория
+// открывает хосту всё хранилище
+func parseVirtualHosts(list []string) (map[string]string, error) {
+	hosts := make(map[string]string, len(list))
+	for _, item := range list {
+		host, dir, ok := strings.Cut(item, "=")
+		host = strings.ToLower(host)
+		if !ok || host == "" {
+			return nil, fmt.Errorf("virtual host %q must be in host=dir form", item)
+		}
+		if dir != "" {
+			if err := validateKey(dir); err != nil {
+				return nil, fmt.Errorf("invalid directory for virtual host %q: %v", host, err)
+			}
+		}
+		if _, dup := hosts[host]; dup {
+			return nil, fmt.Errorf("virtual host %q is listed twice", host)
+		}
+		hosts[host] = dir
+	}
+	return hosts, nil
+}
+
+// WithVirtualHosts — выбирает по заголовку Host поддиректорию хранилища, в которой
+// живут объекты запроса: tenant1.example.com/download/x — это объект tenant1/x.
+// Хосты вне списка получают 421 Misdirected Request. Пустой список — без виртуальных хостов.
+func WithVirtualHosts(hosts map[string]string, next http.Handler) http.Handler {
+	if len(hosts) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		tenant, ok := hosts[strings.ToLower(host)]
+		if !ok {
+			http.Error(w, "Неизвестный хост "+host, http.StatusMisdirectedRequest)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tenantKey, tenant)))
+	})
+}
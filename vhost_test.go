@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestVirtualHosts(t *testing.T) {
+	ts, storage := newTestServer(t, "-virtual-hosts", "a.test=tenant-a,B.test=tenant-b,admin.test=")
+	upload(t, ts, "obj", "from a", "Host", "a.test")
+	upload(t, ts, "obj", "from b", "Host", "b.test:8080")
+
+	tests := []struct {
+		host   string
+		path   string
+		status int
+		body   string
+	}{
+		{"a.test", "/download/obj", http.StatusOK, "from a"},
+		{"A.TEST", "/download/obj", http.StatusOK, "from a"},
+		{"b.test", "/download/obj", http.StatusOK, "from b"},
+		// Хост с пустой поддиректорией видит всё хранилище
+		{"admin.test", "/download/tenant-a/obj", http.StatusOK, "from a"},
+		{"admin.test", "/download/obj", http.StatusNotFound, ""},
+		{"other.test", "/download/obj", http.StatusMisdirectedRequest, ""},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, ts, http.MethodGet, tt.path, "", "Host", tt.host)
+		if resp.StatusCode != tt.status || tt.body != "" && body != tt.body {
+			t.Errorf("GET %s%s: %d %q, want %d %q", tt.host, tt.path, resp.StatusCode, body, tt.status, tt.body)
+		}
+	}
+	if !storage.Exists("tenant-a/obj") || !storage.Exists("tenant-b/obj") {
+		t.Error("objects are not stored in the host directories")
+	}
+
+	// Список и Location показывают ключи так, как их видит клиент хоста
+	resp, _ := do(t, ts, http.MethodPost, "/upload/new", "x", "Host", "a.test")
+	if got := resp.Header.Get("Location"); got != "/download/new" {
+		t.Errorf("Location = %q, want /download/new", got)
+	}
+	_, body := do(t, ts, http.MethodGet, "/list", "", "Host", "a.test")
+	var entries []List
+	if err := json.Unmarshal([]byte(body), &entries); err != nil {
+		t.Fatalf("list of a.test: %v: %s", err, body)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	sort.Strings(names)
+	if want := []string{"new", "obj"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("list of a.test = %v, want %v", names, want)
+	}
+
+	for _, list := range []string{"a.test", "a.test=x,A.test=y", "a.test=../x"} {
+		if _, err := parseVirtualHosts(strings.Split(list, ",")); err == nil {
+			t.Errorf("parseVirtualHosts(%s) is accepted", list)
+		}
+	}
+}
+
+func TestVirtualHostResponseKeys(t *testing.T) {
+	ts, _ := newTestServer(t, "-virtual-hosts", "a.test=tenant-a")
+	host := []string{"Host", "a.test"}
+	upload(t, ts, "locked", "x", host...)
+	upload(t, ts, "leased", "x", host...)
+
+	// Ответы называют ключ так, как его видит клиент хоста, без поддиректории хранилища
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header []string
+		status int
+		body   string
+	}{
+		{"upload", http.MethodPost, "/upload/dir/obj", nil, http.StatusCreated, "dir/obj"},
+		{"existing", http.MethodPost, "/upload/dir/obj", nil, http.StatusConflict, "dir/obj"},
+		{"prefix is object", http.MethodPost, "/upload/dir/obj/nested", nil, http.StatusConflict, "dir/obj"},
+		{"overwrite", http.MethodPost, "/upload/dir/obj", []string{"If-Match", "*"}, http.StatusOK, "dir/obj"},
+		{"patch", http.MethodPatch, "/patch/dir/obj", []string{OFFSET_HEADER, "0"}, http.StatusOK, "dir/obj"},
+		{"touch", http.MethodPost, "/touch/dir/obj", nil, http.StatusOK, "dir/obj"},
+		{"checksum", http.MethodGet, "/checksum/dir/obj", nil, http.StatusOK, `"Key":"dir/obj"`},
+		{"lock", http.MethodPost, "/lock/locked?seconds=60", nil, http.StatusOK, `"Key":"locked"`},
+		{"lease", http.MethodPost, "/lease/leased", []string{LEASE_HEADER, "token"}, http.StatusOK, `"Key":"leased"`},
+		{"delete", http.MethodDelete, "/delete/dir/obj", nil, http.StatusOK, "dir/obj"},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, ts, tt.method, tt.path, "y", append(tt.header, host...)...)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: %d %s, want %d", tt.name, resp.StatusCode, body, tt.status)
+		}
+		if !strings.Contains(body, tt.body) || strings.Contains(body, "tenant-a") {
+			t.Errorf("%s: body %q, want key %s without the host directory", tt.name, body, tt.body)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+const LOCK_PREFIX_LEN = len("/lock/") // ДЛИНА ПРЕФИКСА ДЛЯ МАРШРУТА УСТАНОВКИ СРОКА ХРАНЕНИЯ
+
+var (
+	ErrLocked       = errors.New("object is locked until its retention expires") // Объект защищён сроком хранения
+	ErrETagMismatch = errors.New("object etag does not match If-Match")          // Условие If-Match не выполнено
+)
+
+// checkMutable — возвращает ErrLocked, если срок хранения объекта ещё не истёк
+func (s *Storage) checkMutable(key string) error {
+	m, err := s.LoadMeta(key)
+	if err != nil {
+		return err
+	}
+	if time.Now().Before(m.LockUntil) {
+		return ErrLocked
+	}
+	return nil
+}
+
+// SetRetention — защищает объект от перезаписи и удаления до момента until
+// (режим WORM: write once, read many). Срок можно только продлить, но не сократить.
+func (s *Storage) SetRetention(key string, until time.Time) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.exists(key) {
+		return time.Time{}, os.ErrNotExist
+	}
+
+	err := s.UpdateMeta(key, func(m *Meta) {
+		if until.After(m.LockUntil) {
+			m.LockUntil = until
+		}
+		until = m.LockUntil
+	})
+	return until, err
+}
+
+// HandleLock — обработчик для установки срока хранения объекта (?seconds=N)
+func HandleLock(w http.ResponseWriter, r *http.Request, storage *Storage) {
+	// Получаем ключ (имя объекта) из URL и срок хранения из параметров
+	key := storage.RequestKey(r, r.URL.Path[LOCK_PREFIX_LEN:])
+	if !checkKey(w, key) {
+		return
+	}
+	if !storage.Exists(key) {
+		http.Error(w, "Объект не найден", http.StatusNotFound)
+		return
+	}
+	if !authorizeObject(w, r, storage, key, true) {
+		return
+	}
+	seconds, err := strconv.ParseInt(r.URL.Query().Get("seconds"), 10, 64)
+	if err != nil || seconds <= 0 {
+		http.Error(w, "Срок хранения задаётся параметром seconds > 0", http.StatusBadRequest)
+		return
+	}
+
+	until, err := storage.SetRetention(key, time.Now().Add(time.Duration(seconds)*time.Second))
+	if os.IsNotExist(err) {
+		http.Error(w, "Объект не найден", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Ошибка установки срока хранения %s: %v", logKey(key), logErr(err))
+		http.Error(w, "Ошибка установки срока хранения", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Key       string
+		LockUntil time.Time
+	}{clientKey(r, key), until})
+}
+
+// SEAL_OVERRIDE_HEADER — ЗАГОЛОВОК, КОТОРЫМ АДМИНИСТРАТОР ИЗМЕНЯЕТ ЗАПЕЧАТАННЫЙ ОБЪЕКТ
+const SEAL_OVERRIDE_HEADER = "X-Seal-Override"
+
+// ErrSealed — объект изменяли слишком давно, и он стал доступен только для чтения
+var ErrSealed = errors.New("object is read-only after its write grace window")
+
+// Sealed — истекло ли у объекта окно -seal-after после последней записи (автоматический
+// WORM). Для объектов, записанных до появления Written в метаданных, берётся время файла.
+func (s *Storage) Sealed(key string) (bool, error) {
+	if s.sealAfter <= 0 {
+		return false, nil
+	}
+	m, err := s.LoadMeta(key)
+	if err != nil {
+		return false, err
+	}
+	written := m.Written
+	if written.IsZero() {
+		_, modTime, ok := s.objectStat(key)
+		if !ok {
+			return false, nil
+		}
+		written = modTime
+	}
+	return time.Since(written) > s.sealAfter, nil
+}
+
+// sealOverride — предъявил ли администратор право изменить запечатанный объект
+func sealOverride(r *http.Request) bool {
+	return Identity(r) == ADMIN_IDENTITY && r.Header.Get(SEAL_OVERRIDE_HEADER) == "true"
+}
+
+// checkSealed — отвечает 403, если объект запечатан и администратор не снял запрет.
+// Как и права доступа, проверяется обработчиком до изменения: окно со временем
+// только закрывается, а запись внутри него сама продлевает его
+func checkSealed(w http.ResponseWriter, r *http.Request, storage *Storage, key string) bool {
+	sealed, err := storage.Sealed(key)
+	if err != nil {
+		log.Printf("Ошибка чтения метаданных %s: %v", logKey(key), logErr(err))
+		http.Error(w, "Ошибка чтения метаданных", http.StatusInternalServerError)
+		return false
+	}
+	if sealed && !sealOverride(r) {
+		http.Error(w, ErrSealed.Error(), http.StatusForbidden)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetentionLock(t *testing.T) {
+	ts, _ := newTestServer(t)
+	upload(t, ts, "kept", "v1")
+	upload(t, ts, "free", "v1")
+
+	locks := []struct {
+		path   string
+		status int
+	}{
+		{"/lock/kept", http.StatusBadRequest},
+		{"/lock/kept?seconds=0", http.StatusBadRequest},
+		{"/lock/kept?seconds=x", http.StatusBadRequest},
+		{"/lock/missing?seconds=60", http.StatusNotFound},
+		{"/lock/kept?seconds=3600", http.StatusOK},
+		// Срок можно только продлить: более короткий не сокращает его
+		{"/lock/kept?seconds=1", http.StatusOK},
+	}
+	for _, tt := range locks {
+		if resp, body := do(t, ts, http.MethodPost, tt.path, ""); resp.StatusCode != tt.status {
+			t.Errorf("POST %s: %d %s, want %d", tt.path, resp.StatusCode, body, tt.status)
+		}
+	}
+
+	changes := []struct {
+		name   string
+		method string
+		path   string
+		header []string
+		status int
+	}{
+		{"overwrite locked", http.MethodPut, "/upload/kept", []string{"If-Match", "*"}, http.StatusForbidden},
+		{"delete locked", http.MethodDelete, "/delete/kept", nil, http.StatusForbidden},
+		{"overwrite unlocked", http.MethodPut, "/upload/free", []string{"If-Match", "*"}, http.StatusOK},
+		{"delete unlocked", http.MethodDelete, "/delete/free", nil, http.StatusOK},
+	}
+	for _, tt := range changes {
+		if resp, body := do(t, ts, tt.method, tt.path, "v2", tt.header...); resp.StatusCode != tt.status {
+			t.Errorf("%s: %d %s, want %d", tt.name, resp.StatusCode, body, tt.status)
+		}
+	}
+	if resp, body := do(t, ts, http.MethodGet, "/download/kept", ""); resp.StatusCode != http.StatusOK || body != "v1" {
+		t.Errorf("locked object after attempts: %d %q, want v1", resp.StatusCode, body)
+	}
+}
+
+func TestSealAfter(t *testing.T) {
+	ts, _ := newTestServer(t, "-seal-after", "50ms", "-api-key", "secret", "-users", "alice:a-key")
+	admin := []string{"Authorization", "Bearer secret"}
+	alice := []string{"Authorization", "Bearer a-key"}
+	upload(t, ts, "obj", "v1", admin...)
+	upload(t, ts, "own", "v1", alice...)
+
+	// Внутри окна объект можно перезаписать, и запись продлевает окно
+	if resp, _ := do(t, ts, http.MethodPut, "/upload/obj", "v2", append(admin, "If-Match", "*")...); resp.StatusCode != http.StatusOK {
+		t.Fatalf("overwrite within window: %d, want 200", resp.StatusCode)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		auth   []string
+		header []string
+		status int
+	}{
+		{"overwrite sealed", http.MethodPut, "/upload/obj", admin, []string{"If-Match", "*"}, http.StatusForbidden},
+		{"delete sealed", http.MethodDelete, "/delete/obj", admin, nil, http.StatusForbidden},
+		// Снять запрет может только администратор, но не владелец объекта
+		{"owner override", http.MethodPut, "/upload/own", alice, []string{"If-Match", "*", SEAL_OVERRIDE_HEADER, "true"}, http.StatusForbidden},
+		{"override", http.MethodPut, "/upload/obj", admin, []string{"If-Match", "*", SEAL_OVERRIDE_HEADER, "true"}, http.StatusOK},
+		{"admin override of another's object", http.MethodDelete, "/delete/own", admin, []string{SEAL_OVERRIDE_HEADER, "true"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if resp, body := do(t, ts, tt.method, tt.path, "v3", append(tt.auth, tt.header...)...); resp.StatusCode != tt.status {
+			t.Errorf("%s: %d %s, want %d", tt.name, resp.StatusCode, body, tt.status)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// WRITE_BACK_MAX_PENDING — СТОЛЬКО ОБЪЕКТОВ В ОЧЕРЕДИ СБРАСЫВАЮТСЯ, НЕ ДОЖИДАЯСЬ ИНТЕРВАЛА
+const WRITE_BACK_MAX_PENDING = 1000
+
+// writeBack — очередь объектов, ожидающих записи на диск в режиме отложенной записи
+type writeBack struct {
+	mu       sync.Mutex        // Мьютекс для доступа к pending
+	flushMu  sync.Mutex        // Не даёт двум сбросам на диск выполняться одновременно
+	pending  map[string]queued // Объекты, ещё не записанные на диск
+	seq      uint64            // Номер последней постановки в очередь
+	notify   chan struct{}     // Сигнал фоновому обработчику о появлении новых объектов
+	interval time.Duration     // Период сброса на диск (0 — сразу после каждой записи)
+}
+
+// queued — объект в очереди записи; по seq сброс отличает записанную версию
+// от более новой, поставленной в очередь, пока он шёл
+type queued struct {
+	obj
+	seq uint64
+}
+
+// newWriteBack — конструктор очереди отложенной записи со сбросом раз в interval
+func newWriteBack(interval time.Duration) *writeBack {
+	return &writeBack{
+		pending:  make(map[string]queued),
+		notify:   make(chan struct{}, 1),
+		interval: interval,
+	}
+}
+
+// add — ставит объект в очередь записи и будит фоновый обработчик. При периодическом
+// сбросе обработчик будится, только если очередь переполнена
+func (wb *writeBack) add(o obj) {
+	wb.mu.Lock()
+	wb.seq++
+	wb.pending[o.name] = queued{o, wb.seq}
+	full := len(wb.pending) >= WRITE_BACK_MAX_PENDING
+	wb.mu.Unlock()
+
+	if wb.interval > 0 && !full {
+		return
+	}
+	select {
+	case wb.notify <- struct{}{}:
+	default:
+	}
+}
+
+// get — возвращает объект, ещё не записанный на диск
+func (wb *writeBack) get(key string) (obj, bool) {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	q, ok := wb.pending[key]
+	return q.obj, ok
+}
+
+// Len — число объектов, ожидающих записи на диск
+func (wb *writeBack) Len() int {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	return len(wb.pending)
+}
+
+// remove — убирает объект из очереди записи, сообщая, был ли он там
+func (wb *writeBack) remove(key string) bool {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	_, ok := wb.pending[key]
+	delete(wb.pending, key)
+	return ok
+}
+
+// writeBackLoop — фоновый обработчик, сбрасывающий очередь на диск по сигналу,
+// а при заданном интервале ещё и периодически: так потеря данных при сбое
+// ограничена записями за последний интервал
+func (s *Storage) writeBackLoop() {
+	var tick <-chan time.Time
+	if s.wb.interval > 0 {
+		ticker := time.NewTicker(s.wb.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-s.wb.notify:
+		case <-tick:
+		}
+		if _, err := s.Flush(); err != nil {
+			log.Printf("Ошибка отложенной записи на диск: %v", logErr(err))
+		}
+	}
+}
+
+// pendingWrites — число объектов, ещё не записанных на диск
+func (s *Storage) pendingWrites() int {
+	if s.wb == nil {
+		return 0
+	}
+	return s.wb.Len()
+}
+
+// Flush — записывает на диск все объекты из очереди отложенной записи и дожидается
+// их сохранения (fsync). Возвращает количество записанных объектов.
+func (s *Storage) Flush() (int, error) {
+	if s.wb == nil {
+		return 0, nil
+	}
+	s.wb.flushMu.Lock()
+	defer s.wb.flushMu.Unlock()
+
+	s.wb.mu.Lock()
+	batch := make([]queued, 0, len(s.wb.pending))
+	for _, q := range s.wb.pending {
+		batch = append(batch, q)
+	}
+	s.wb.mu.Unlock()
+
+	flushed := 0
+	for _, q := range batch {
+		if err := s.backend.Write(q.name, q.body, true); err != nil {
+			return flushed, err
+		}
+		// Объект убирается из очереди только после того, как он надёжно записан,
+		// до этого Load отдаёт его из очереди. Перезаписанный за время сброса
+		// остаётся в очереди: на диск пока попала прежняя версия
+		s.wb.mu.Lock()
+		if s.wb.pending[q.name].seq == q.seq {
+			delete(s.wb.pending, q.name)
+		}
+		s.wb.mu.Unlock()
+		flushed++
+	}
+	return flushed, nil
+}
+
+// HandleFlush — обработчик для принудительного сброса очереди отложенной записи на диск
+func HandleFlush(w http.ResponseWriter, r *http.Request, storage *Storage) {
+	flushed, err := storage.Flush()
+	if err != nil {
+		log.Printf("Ошибка сброса на диск: %v", logErr(err))
+		http.Error(w, "Ошибка сброса на диск", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct{ Flushed int }{flushed})
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestHandleFlush(t *testing.T) {
+	ts, _ := newTestServer(t, "-write-back")
+	upload(t, ts, "a", "first")
+	upload(t, ts, "b", "second")
+
+	// Фоновая запись могла успеть раньше, поэтому число сброшенных при первом сбросе не проверяем
+	tests := []struct {
+		method string
+		status int
+		body   string
+	}{
+		{http.MethodGet, http.StatusMethodNotAllowed, ""},
+		{http.MethodPost, http.StatusOK, ""},
+		{http.MethodPost, http.StatusOK, "{\"Flushed\":0}\n"},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, ts, tt.method, "/admin/flush", "")
+		if resp.StatusCode != tt.status || (tt.body != "" && body != tt.body) {
+			t.Errorf("%s /admin/flush: %d %q, want %d %q", tt.method, resp.StatusCode, body, tt.status, tt.body)
+		}
+	}
+
+	// После ответа на сброс все объекты уже на диске
+	for key, want := range map[string]string{"a": "first", "b": "second"} {
+		if data, err := os.ReadFile(storageDir + "/" + key); err != nil || string(data) != want {
+			t.Errorf("%s on disk after flush: %q, %v", key, data, err)
+		}
+	}
+}
+
+func TestFlushInterval(t *testing.T) {
+	// Интервал больше времени теста: на диск пишет только явный сброс
+	ts, _ := newTestServer(t, "-write-back", "-flush-interval", "1h")
+	upload(t, ts, "a", "first")
+	upload(t, ts, "b", "second")
+
+	for _, key := range []string{"a", "b"} {
+		if _, err := os.Stat(storageDir + "/" + key); !os.IsNotExist(err) {
+			t.Errorf("%s is on disk before flush: %v", key, err)
+		}
+	}
+	// Ожидающий записи объект отдаётся из очереди
+	if resp, body := do(t, ts, http.MethodGet, "/download/a", ""); resp.StatusCode != http.StatusOK || body != "first" {
+		t.Errorf("download before flush: %d %q", resp.StatusCode, body)
+	}
+	if got := metrics(t, ts)["storage_write_back_pending"]; got != "2" {
+		t.Errorf("pending before flush = %s, want 2", got)
+	}
+
+	tests := []struct {
+		method string
+		status int
+		body   string
+	}{
+		{http.MethodGet, http.StatusMethodNotAllowed, ""},
+		{http.MethodPost, http.StatusOK, "{\"Flushed\":2}\n"},
+		{http.MethodPost, http.StatusOK, "{\"Flushed\":0}\n"},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, ts, tt.method, "/admin/flush", "")
+		if resp.StatusCode != tt.status || (tt.body != "" && body != tt.body) {
+			t.Errorf("%s /admin/flush: %d %q, want %d %q", tt.method, resp.StatusCode, body, tt.status, tt.body)
+		}
+	}
+
+	for key, want := range map[string]string{"a": "first", "b": "second"} {
+		if data, err := os.ReadFile(storageDir + "/" + key); err != nil || string(data) != want {
+			t.Errorf("%s on disk after flush: %q, %v", key, data, err)
+		}
+	}
+	if got := metrics(t, ts)["storage_write_back_pending"]; got != "0" {
+		t.Errorf("pending after flush = %s, want 0", got)
+	}
+
+	// С коротким интервалом очередь сбрасывается сама
+	ts, _ = newTestServer(t, "-write-back", "-flush-interval", "20ms")
+	upload(t, ts, "c", "third")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if data, err := os.ReadFile(storageDir + "/c"); err == nil && string(data) == "third" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("object is not flushed by the interval")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for _, args := range [][]string{{"-flush-interval", "1s"}, {"-write-back", "-flush-interval", "-1s"}} {
+		if _, err := ParseConfig(args); err == nil {
+			t.Errorf("%v is accepted", args)
+		}
+	}
+}
+
+func TestWriteBackRequeue(t *testing.T) {
+	wb := newWriteBack(0)
+	wb.add(obj{name: "k", body: []byte("v1")})
+	first := wb.pending["k"].seq
+	wb.add(obj{name: "k", body: []byte("v2")})
+
+	// Новая версия заменяет прежнюю в очереди и получает новый номер
+	if o, ok := wb.get("k"); !ok || string(o.body) != "v2" || wb.Len() != 1 {
+		t.Fatalf("queue after requeue: %q %v, %d pending", o.body, ok, wb.Len())
+	}
+	if wb.pending["k"].seq == first {
+		t.Errorf("requeued object has the same seq %d", first)
+	}
+	if !wb.remove("k") || wb.remove("k") {
+		t.Errorf("remove did not report the object exactly once")
+	}
+}
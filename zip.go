@@ -0,0 +1,78 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// requestKeys — ключи из JSON-массива в теле POST или из параметров ?key=
+func requestKeys(r *http.Request) ([]string, error) {
+	if r.Method == http.MethodGet {
+		return r.URL.Query()["key"], nil
+	}
+	var keys []string
+	err := json.NewDecoder(r.Body).Decode(&keys)
+	return keys, err
+}
+
+// HandleZip — обработчик для скачивания нескольких объектов одним zip-архивом.
+// Архив пишется в ответ потоком, поэтому объём памяти не зависит от размера объектов.
+// Отсутствующие объекты пропускаются и перечисляются в трейлере X-Missing-Keys.
+func HandleZip(w http.ResponseWriter, r *http.Request, storage *Storage) {
+	keys, err := requestKeys(r)
+	if err != nil {
+		http.Error(w, "Ожидается JSON-массив ключей", http.StatusBadRequest)
+		return
+	}
+	if len(keys) == 0 {
+		http.Error(w, "Не указаны ключи объектов", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Trailer", "X-Missing-Keys")
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="objects.zip"`)
+	w.WriteHeader(http.StatusOK)
+
+	archive := zip.NewWriter(w)
+	missing := make([]string, 0)
+	for _, requested := range keys {
+		// Недопустимые ключи и чужие закрытые объекты считаются отсутствующими
+		key := storage.RequestKey(r, requested)
+		if validateKey(key) != nil {
+			missing = append(missing, requested)
+			continue
+		}
+		if m, err := storage.LoadMeta(key); err != nil || !m.canRead(Identity(r)) {
+			missing = append(missing, requested)
+			continue
+		}
+		file, info, err := storage.openObject(key)
+		if err != nil {
+			missing = append(missing, requested)
+			continue
+		}
+
+		header := &zip.FileHeader{Name: clientKey(r, key), Method: zip.Deflate, Modified: info.ModTime()}
+		entry, err := archive.CreateHeader(header)
+		if err == nil {
+			_, err = io.Copy(entry, file)
+		}
+		file.Close()
+		if err != nil {
+			// Заголовки уже отправлены, поэтому остаётся только прервать архив
+			log.Printf("Ошибка при записи %s в архив: %v", logKey(key), logErr(err))
+			return
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		log.Printf("Ошибка при завершении архива: %v", logErr(err))
+		return
+	}
+	w.Header().Set("X-Missing-Keys", strings.Join(missing, ","))
+}
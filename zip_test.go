@@ -0,0 +1,62 @@
+package main
+
+import (
+	"archive/zip"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHandleZip(t *testing.T) {
+	ts, _ := newTestServer(t)
+	upload(t, ts, "a", "first")
+	upload(t, ts, "dir/b", "second")
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		status  int
+		files   map[string]string
+		missing string
+	}{
+		{"post", http.MethodPost, "/zip", `["a","dir/b"]`, http.StatusOK, map[string]string{"a": "first", "dir/b": "second"}, ""},
+		{"get", http.MethodGet, "/zip?key=dir/b", "", http.StatusOK, map[string]string{"dir/b": "second"}, ""},
+		{"missing keys", http.MethodPost, "/zip", `["a","nope","../x"]`, http.StatusOK, map[string]string{"a": "first"}, "nope,../x"},
+		{"not json", http.MethodPost, "/zip", `a,b`, http.StatusBadRequest, nil, ""},
+		{"no keys", http.MethodPost, "/zip", `[]`, http.StatusBadRequest, nil, ""},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, ts, tt.method, tt.path, tt.body)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: %d, want %d", tt.name, resp.StatusCode, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		archive, err := zip.NewReader(strings.NewReader(body), int64(len(body)))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		files := make(map[string]string)
+		for _, f := range archive.File {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatalf("%s: %s: %v", tt.name, f.Name, err)
+			}
+			data, _ := io.ReadAll(rc)
+			rc.Close()
+			files[f.Name] = string(data)
+		}
+		if !reflect.DeepEqual(files, tt.files) {
+			t.Errorf("%s: archive = %v, want %v", tt.name, files, tt.files)
+		}
+		if got := resp.Trailer.Get("X-Missing-Keys"); got != tt.missing {
+			t.Errorf("%s: X-Missing-Keys = %q, want %q", tt.name, got, tt.missing)
+		}
+	}
+}